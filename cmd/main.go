@@ -5,26 +5,229 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/benchmark"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/calibration"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
 	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/evaluation"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/explain"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/fairness"
 	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/pipeline"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/policy"
 	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/preprocessing"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/reasons"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/segmentation"
 	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/visualization"
 )
 
+// calibrationBins is the number of score bins in the calibration table
+const calibrationBins = 10
+
+// calibrationFolds is the number of folds the calibration table's training
+// scores are predicted out of
+const calibrationFolds = 5
+
 func main() {
 	// Define command line flags
 	preprocessPtr := flag.Bool("preprocess", false, "Run data preprocessing")
 	trainPtr := flag.Bool("train", false, "Train models")
 	evaluatePtr := flag.Bool("evaluate", false, "Evaluate models")
 	visualizePtr := flag.Bool("visualize", false, "Generate visualizations")
+	noCachePtr := flag.Bool("no-cache", false, "Always rerun preprocessing instead of reusing cached output")
+	benchDatasetsPtr := flag.String("bench-datasets", "", "JSON list of raw datasets and their schemas to run the pipeline on, comparing every model across them, then exit")
+	cpuProfilePtr := flag.String("cpuprofile", "", "Write a CPU profile to this file")
+	memProfilePtr := flag.String("memprofile", "", "Write a heap profile to this file on exit")
+	gradesPtr := flag.String("grades", "", "JSON file of risk grades (default A-E bands)")
+	policyPtr := flag.String("policy", "", "JSON credit policy whose score bands and knock-out rules decide each test application of the best model, written to the predictions file")
+	sparsePtr := flag.Bool("sparse", false, "Keep the feature matrices in sparse (CSR) form for the models that support it")
+	compressPtr := flag.Bool("compress", false, "Write the processed CSVs and evaluation export gzip-compressed (.gz)")
+	encryptPtr := flag.Bool("encrypt", false, "AES-encrypt the processed data and every report written, with the key from CCAP_ARTIFACT_KEY or CCAP_ARTIFACT_KEY_COMMAND")
+	externalPtr := flag.String("external-model", "", "Command for an external training process, run with fit/predict as its last argument")
+	externalNamePtr := flag.String("external-name", "External", "Name to report for the -external-model results")
+	externalTimeoutPtr := flag.Duration("external-timeout", 0, "Time limit for each external model call (0 means none)")
+	dpEpsilonPtr := flag.Float64("dp-epsilon", 0, "Also train a logistic regression by differentially private SGD within this privacy budget (0 turns it off)")
+	segmentsPtr := flag.Int("segments", 0, "Cluster applicants into this many segments by k-means on the numeric features, add the segment as a feature and report each segment's approval rate and metrics (0 turns it off)")
+	segmentPlanPtr := flag.String("segment-plan", "", "JSON file declaring applicant segments, such as thin- and thick-file, to train and route to a model of their own")
+	tunePtr := flag.Bool("tune", false, "Tune the random forest and gradient boosting by random search with successive halving")
+	tuneTrialsPtr := flag.Int("tune-trials", models.DefaultTuningConfig().Trials, "Number of random configurations -tune samples per model")
+	pdpPtr := flag.String("pdp", "", "Plot the best model's partial dependence and ICE curves for these comma-separated numeric features, or \"all\"")
+	surrogatePtr := flag.String("surrogate", "", "Fit a \"tree\" or \"logistic\" surrogate to the best model's decisions and report its fidelity")
+	cvPtr := flag.Int("cv", 0, "Cross-validate each model on the training data with this many folds (0 turns it off)")
+	stabilityPtr := flag.Int("stability", 0, "Retrain each model on this many bootstrap resamples and report how stable its feature importance ranking is (0 turns it off)")
+	shapPtr := flag.String("shap", "", "Explain the best model's probability for these comma-separated test rows (numbered as in predictions.csv) with SHAP values")
+	reasonsPtr := flag.Bool("reasons", false, "Write ranked adverse action reason codes for every test application the best model rejects")
+	reasonCatalogPtr := flag.String("reason-catalog", "", "JSON file mapping reason codes to the wording used in notices")
+	fairnessPtr := flag.String("fairness", "", "Audit every model's test decisions for disparities across the groups of this sensitive attribute, e.g. A1")
+	fairnessReferencePtr := flag.String("fairness-reference", "", "Group of the -fairness attribute the others are compared with (default the most approved group)")
+	anchorsPtr := flag.Bool("anchors", false, "Write an if-then anchor rule for each of the best model's test decisions")
+	permutationPtr := flag.Int("permutation", 0, "Shuffle each feature of the test set this many times and report every model's drop in AUC (0 turns it off)")
+	interactionsPtr := flag.Bool("interactions", false, "Report the feature pairs the best model combines most strongly, by Friedman's H statistic")
+	rulesPtr := flag.Bool("rules", false, "Extract ranked if-then rules from the random forest and gradient boosting")
+	thresholdPtr := flag.String("threshold-objective", "f1", "Operating point to pick from the threshold sweep: a metric (f1, accuracy, precision, recall, approval) to maximize, optionally constrained as recall@precision=0.9")
+	falseApprovalCostPtr := flag.Float64("false-approval-cost", 0, "Cost of approving an application that should be rejected; set with -false-rejection-cost to compare models by expected cost")
+	falseRejectionCostPtr := flag.Float64("false-rejection-cost", 0, "Cost of rejecting an application that should be approved")
+	selectByPtr := flag.String("select-by", "f1", "Pick the best model by highest \"f1\" score or lowest expected \"cost\"")
+	gatePtr := flag.String("gate", "", "Compare the best model with the baseline in this JSON file and exit with status 1 if AUC or KS drop by more than -gate-tolerance")
+	gateTolerancePtr := flag.Float64("gate-tolerance", 0.01, "Largest drop in AUC or KS that -gate accepts")
+	saveBaselinePtr := flag.String("save-baseline", "", "Write the best model's metrics to this JSON file as the baseline for -gate")
+	recalibratePtr := flag.String("recalibrate", "", "Report how much \"platt\" or \"isotonic\" recalibration improves the best model's probabilities")
+	configPtr := flag.String("config", "", "YAML preprocessing config declaring the raw columns, their types, imputation and encoding, and optionally the raw data file (default the crx columns)")
+	amountPtr := flag.String("amount", "", "Raw column, such as a credit limit, that a second-stage regression predicts for approved applications instead of using it as a feature")
+	amountIntervalPtr := flag.Float64("amount-interval", 0, "Coverage, such as 0.8, of the prediction intervals a quantile regression forest gives the amount model instead of gradient boosting (0 keeps gradient boosting)")
+	piiPtr := flag.String("pii", "", "JSON file of identifier columns to drop or hash right after loading the raw data (hashing reads its key from "+preprocessing.PIIKeyEnv+")")
+	keepMissingPtr := flag.Bool("keep-missing", false, "Skip imputation and leave missing values for the tree models to route natively")
+	seedPtr := flag.Uint64("seed", 0, "Seed for the train/test split, model training and sampling, so runs are repeatable (0 picks a random seed each run)")
 	flag.Parse()
 
+	// "bench datasets.json" is the subcommand form of -bench-datasets, and
+	// takes the same flags before or after the subcommand name
+	if flag.NArg() > 0 && flag.Arg(0) == "bench" {
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() != 1 {
+			fmt.Printf("Usage: %s bench [flags] datasets.json\n", filepath.Base(os.Args[0]))
+			exit(2)
+		}
+		*benchDatasetsPtr = flag.Arg(0)
+	}
+
+	if err := startProfiling(*cpuProfilePtr, *memProfilePtr); err != nil {
+		fmt.Printf("Error starting profiler: %v\n", err)
+		exit(1)
+	}
+	defer stopProfiling()
+
+	// Draw the random seed up front so the run can be repeated and its
+	// preprocessing is cached apart from other random runs
+	if *seedPtr == 0 {
+		*seedPtr = preprocessing.ResolveSeed(0)
+		fmt.Printf("Using random seed %d\n", *seedPtr)
+	}
+
+	thresholdObjective, err := evaluation.ParseThresholdObjective(*thresholdPtr)
+	if err != nil {
+		fmt.Printf("Error parsing -threshold-objective: %v\n", err)
+		exit(1)
+	}
+
+	var creditPolicy *policy.Policy
+	if *policyPtr != "" {
+		creditPolicy, err = policy.LoadPolicy(*policyPtr)
+		if err != nil {
+			fmt.Printf("Error loading -policy: %v\n", err)
+			exit(1)
+		}
+	}
+
+	var surrogateKind explain.SurrogateKind
+	if *surrogatePtr != "" {
+		kind, err := explain.ParseSurrogateKind(*surrogatePtr)
+		if err != nil {
+			fmt.Printf("Error parsing -surrogate: %v\n", err)
+			exit(1)
+		}
+		surrogateKind = kind
+	}
+
+	var costs *evaluation.CostMatrix
+	if *falseApprovalCostPtr != 0 || *falseRejectionCostPtr != 0 {
+		costs = &evaluation.CostMatrix{FalseApproval: *falseApprovalCostPtr, FalseRejection: *falseRejectionCostPtr}
+		if err := costs.Validate(); err != nil {
+			fmt.Printf("Error parsing misclassification costs: %v\n", err)
+			exit(1)
+		}
+	}
+	switch *selectByPtr {
+	case "f1":
+	case "cost":
+		if costs == nil {
+			fmt.Println("Error parsing -select-by: cost selection needs -false-approval-cost or -false-rejection-cost")
+			exit(1)
+		}
+	default:
+		fmt.Printf("Error parsing -select-by: unknown criterion %q (want f1 or cost)\n", *selectByPtr)
+		exit(1)
+	}
+
+	var recalibration calibration.Method
+	if *recalibratePtr != "" {
+		method, err := calibration.ParseMethod(*recalibratePtr)
+		if err != nil {
+			fmt.Printf("Error parsing -recalibrate: %v\n", err)
+			exit(1)
+		}
+		recalibration = method
+	}
+
+	if *dpEpsilonPtr < 0 {
+		fmt.Printf("Error parsing -dp-epsilon: epsilon must not be negative, got %g\n", *dpEpsilonPtr)
+		exit(1)
+	}
+
+	// Encrypted artifacts are read whenever a key is available, and written
+	// when asked
+	key, err := dataset.LoadKey()
+	if err != nil {
+		fmt.Printf("Error loading artifact key: %v\n", err)
+		exit(1)
+	}
+	if err := dataset.SetEncryption(key, *encryptPtr); err != nil {
+		fmt.Printf("Error parsing -encrypt: %v (set %s or %s)\n", err, dataset.KeyEnv, dataset.KeyCommandEnv)
+		exit(1)
+	}
+
+	if *amountIntervalPtr < 0 || *amountIntervalPtr >= 1 {
+		fmt.Printf("Error parsing -amount-interval: coverage must be in (0, 1), got %v\n", *amountIntervalPtr)
+		exit(1)
+	}
+
+	// A preprocessing config replaces the crx columns and may name its own
+	// raw data file
+	var schema *preprocessing.Schema
+	var configRawPath string
+	if *configPtr != "" {
+		schema, configRawPath, err = preprocessing.LoadConfig(*configPtr)
+		if err != nil {
+			fmt.Printf("Error loading -config: %v\n", err)
+			exit(1)
+		}
+	}
+	if *amountPtr != "" {
+		base := schema
+		if base == nil {
+			base = preprocessing.CRXSchema()
+		}
+		if schema, err = base.WithAmount(*amountPtr); err != nil {
+			fmt.Printf("Error setting -amount: %v\n", err)
+			exit(1)
+		}
+	}
+	if *amountIntervalPtr > 0 && (schema == nil || schema.Amount == "") {
+		fmt.Println("Error parsing -amount-interval: needs -amount or an amount column in -config")
+		exit(1)
+	}
+
+	var pii *preprocessing.PIIConfig
+	if *piiPtr != "" {
+		columns := preprocessing.RawColumns
+		if schema != nil {
+			columns = schema.Columns
+		}
+		config, err := preprocessing.LoadPIIConfig(*piiPtr, columns)
+		if err != nil {
+			fmt.Printf("Error loading -pii: %v\n", err)
+			exit(1)
+		}
+		pii = config
+	}
+
 	// Get project root directory
 	execPath, err := os.Executable()
 	if err != nil {
 		fmt.Printf("Error getting executable path: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Assuming the executable is in the project root or built into it
@@ -35,66 +238,260 @@ func main() {
 
 	// Define file paths
 	rawDataPath := filepath.Join(projectRoot, "data", "raw", "crx.data")
+	if configRawPath != "" {
+		rawDataPath = configRawPath
+	}
+	namesPath := filepath.Join(projectRoot, "data", "raw", "crx.names")
 	trainDataPath := filepath.Join(projectRoot, "data", "processed", "train.csv")
 	testDataPath := filepath.Join(projectRoot, "data", "processed", "test.csv")
 	modelEvalPath := filepath.Join(projectRoot, "data", "processed", "model_evaluation.csv")
+	multiclassEvalPath := filepath.Join(projectRoot, "data", "processed", "multiclass_evaluation.csv")
+	multiclassReportPath := filepath.Join(projectRoot, "data", "processed", "multiclass_classification_report.csv")
 	visualizationDir := filepath.Join(projectRoot, "data", "processed", "visualizations")
 	confusionMatrixDir := filepath.Join(projectRoot, "data", "processed", "confusion_matrices")
+	treeDumpPath := filepath.Join(projectRoot, "data", "processed", "decision_tree.txt")
+	calibrationPath := filepath.Join(projectRoot, "data", "processed", "calibration_table.csv")
+	predictionsPath := filepath.Join(projectRoot, "data", "processed", "predictions.csv")
+	counterfactualsPath := filepath.Join(projectRoot, "data", "processed", "counterfactuals.csv")
+	surrogatePath := filepath.Join(projectRoot, "data", "processed", "surrogate.txt")
+	anchorsPath := filepath.Join(projectRoot, "data", "processed", "anchors.csv")
+	thresholdPath := filepath.Join(projectRoot, "data", "processed", "threshold_analysis.csv")
+	screeningPath := filepath.Join(projectRoot, "data", "processed", "feature_screening.csv")
+	interactionsPath := filepath.Join(projectRoot, "data", "processed", "interactions.csv")
+	reliabilityPath := filepath.Join(projectRoot, "data", "processed", "reliability.csv")
+	classReportPath := filepath.Join(projectRoot, "data", "processed", "classification_report.csv")
+	stabilityPath := filepath.Join(projectRoot, "data", "processed", "importance_stability.csv")
+	permutationPath := filepath.Join(projectRoot, "data", "processed", "permutation_importance.csv")
+	datasetBenchmarkPath := filepath.Join(projectRoot, "data", "processed", "dataset_benchmark.csv")
+	shapPath := filepath.Join(projectRoot, "data", "processed", "shap_explanations.csv")
+	reasonsPath := filepath.Join(projectRoot, "data", "processed", "adverse_action_reasons.csv")
+	segmentsPath := filepath.Join(projectRoot, "data", "processed", "segments.csv")
+	segmentModelsPath := filepath.Join(projectRoot, "data", "processed", "segment_models.csv")
+	fairnessPath := filepath.Join(projectRoot, "data", "processed", "fairness_report.csv")
+	amountModelPath := filepath.Join(projectRoot, "data", "processed", "amount_model.csv")
+	amountIntervalsPath := filepath.Join(projectRoot, "data", "processed", "amount_intervals.csv")
+	survivalModelPath := filepath.Join(projectRoot, "data", "processed", "survival_model.csv")
+	pipelinePath := filepath.Join(projectRoot, "data", "processed", "pipeline.json")
+	rulesDir := filepath.Join(projectRoot, "data", "processed")
+	dictionaryDir := filepath.Join(projectRoot, "data", "processed", "dictionary")
+	cacheDir := filepath.Join(projectRoot, "data", "processed", "cache")
+
+	// Compressed artifacts get a .gz suffix; readers detect gzip by content
+	if *compressPtr {
+		trainDataPath += ".gz"
+		testDataPath += ".gz"
+		modelEvalPath += ".gz"
+		multiclassEvalPath += ".gz"
+		multiclassReportPath += ".gz"
+		calibrationPath += ".gz"
+		predictionsPath += ".gz"
+		counterfactualsPath += ".gz"
+		anchorsPath += ".gz"
+		thresholdPath += ".gz"
+		stabilityPath += ".gz"
+		permutationPath += ".gz"
+		datasetBenchmarkPath += ".gz"
+		shapPath += ".gz"
+		reasonsPath += ".gz"
+		fairnessPath += ".gz"
+		segmentsPath += ".gz"
+		segmentModelsPath += ".gz"
+		amountModelPath += ".gz"
+		amountIntervalsPath += ".gz"
+		survivalModelPath += ".gz"
+		pipelinePath += ".gz"
+		reliabilityPath += ".gz"
+		classReportPath += ".gz"
+		screeningPath += ".gz"
+		interactionsPath += ".gz"
+		treeDumpPath += ".gz"
+		surrogatePath += ".gz"
+	}
+
+	// The dataset benchmark runs its own pipelines and skips the main one
+	if *benchDatasetsPtr != "" {
+		specs, err := benchmark.LoadDatasetSpecs(*benchDatasetsPtr)
+		if err != nil {
+			fmt.Printf("Error loading -bench-datasets: %v\n", err)
+			exit(1)
+		}
+		results, err := benchmark.RunDatasets(specs, *seedPtr)
+		if err != nil {
+			fmt.Printf("Error benchmarking datasets: %v\n", err)
+			exit(1)
+		}
+		benchmark.PrintComparison(results)
+		if err := benchmark.SaveComparison(datasetBenchmarkPath, results); err != nil {
+			fmt.Printf("Error saving dataset benchmark: %v\n", err)
+			exit(1)
+		}
+		fmt.Printf("Saved dataset benchmark to %s\n", datasetBenchmarkPath)
+		return
+	}
 
 	// Initialize evaluation object
 	modelEval := evaluation.NewModelEvaluation()
+	modelEval.Costs = costs
+	modelEval.SelectByCost = *selectByPtr == "cost"
+
+	// A multiclass outcome is evaluated apart from the binary label, with
+	// the models ranked by their macro-averaged F1 score
+	multiclassEval := evaluation.NewModelEvaluation()
+	multiclassEval.Title = "Multiclass Evaluation Results"
+	var classes []string
+	if schema != nil {
+		classes = schema.Classes
+	}
+
+	// The feature matrices are kept for explaining predictions after
+	// evaluation
+	var trainData, testData *models.FeatureMatrix
+	// segmenter holds the applicant segments when -segments is set
+	var segmenter *segmentation.KMeans
+
+	// Registered hooks see and may change the pipeline state around each
+	// stage
+	hookCtx := &pipeline.Context{
+		Seed:          *seedPtr,
+		RawDataPath:   rawDataPath,
+		TrainDataPath: trainDataPath,
+		TestDataPath:  testDataPath,
+		Evaluation:    modelEval,
+	}
 
 	// Run the pipeline steps based on flags
 	if *preprocessPtr || runAll {
 		fmt.Println("Running preprocessing...")
-		// Implement preprocessing
-		data, err := preprocessing.LoadData(rawDataPath)
-		if err != nil {
-			fmt.Printf("Error loading data: %v\n", err)
-			os.Exit(1)
-		}
-
-		// Handle missing values
-		data.HandleMissingValues()
 
-		// Encode categorical variables
-		if err := data.EncodeCategoricalFeatures(); err != nil {
-			fmt.Printf("Error encoding categorical features: %v\n", err)
-			os.Exit(1)
+		// Reuse the output of an earlier run on identical data and config
+		cacheKey, err := preprocessing.CacheKey(rawDataPath, *seedPtr, *keepMissingPtr, pii, schema)
+		if err != nil {
+			fmt.Printf("Error hashing raw data: %v\n", err)
+			exit(1)
 		}
 
-		// Convert target variable
-		if err := data.ConvertTargetVariable(); err != nil {
-			fmt.Printf("Error converting target variable: %v\n", err)
-			os.Exit(1)
+		// Hooks that change the raw data make the output depend on code
+		// the cache key does not cover
+		rawHooks := pipeline.HasHooks("before-preprocess")
+		cached := false
+		if !*noCachePtr && !rawHooks {
+			cached, err = preprocessing.RestoreFromCache(cacheDir, cacheKey, trainDataPath, testDataPath, pipelinePath)
+			if err != nil {
+				fmt.Printf("Error reading preprocessing cache: %v\n", err)
+				exit(1)
+			}
 		}
 
-		// Normalize numerical features
-		data.NormalizeFeatures()
+		if cached {
+			fmt.Printf("Using cached preprocessing output %s\n", cacheKey[:12])
+		} else {
+			runPreprocessing(hookCtx, screeningPath, pipelinePath, *keepMissingPtr, pii, schema)
 
-		// Save processed data
-		err = data.SaveProcessedData(trainDataPath, testDataPath)
-		if err != nil {
-			fmt.Printf("Error saving processed data: %v\n", err)
-			os.Exit(1)
+			if !rawHooks {
+				if err := preprocessing.StoreInCache(cacheDir, cacheKey, trainDataPath, testDataPath, pipelinePath); err != nil {
+					fmt.Printf("Warning: could not cache preprocessing output: %v\n", err)
+				}
+			}
 		}
+		runHooks("after-preprocess", hookCtx)
 
-		// Split data into train and test sets (already handled in SaveProcessedData)
-		if err != nil {
-			fmt.Printf("Error splitting data: %v\n", err)
-			os.Exit(1)
+		// Describe the columns of this processed version
+		dictionaryPath := filepath.Join(dictionaryDir, cacheKey[:12])
+		if err := saveDataDictionary(trainDataPath, namesPath, dictionaryPath, cacheKey[:12], *compressPtr, schema); err != nil {
+			fmt.Printf("Error saving data dictionary: %v\n", err)
+			exit(1)
 		}
+		fmt.Printf("Saved data dictionary to %s.csv and %s.md\n", dictionaryPath, dictionaryPath)
 
 		fmt.Println("Preprocessing completed successfully!")
 	}
 
 	if *trainPtr || runAll {
 		fmt.Println("Training models...")
-		// Implement model training
-		modelResults, err := models.TrainAllModels(trainDataPath, testDataPath)
+		// Load the processed data once as feature matrices
+		loadData := models.LoadDataFromCSV
+		if *sparsePtr {
+			loadData = models.LoadSparseDataFromCSV
+		}
+		var err error
+		trainData, testData, err = loadData(trainDataPath, testDataPath)
+		if err != nil {
+			fmt.Printf("Error loading processed data: %v\n", err)
+			exit(1)
+		}
+		hookCtx.TrainData, hookCtx.TestData = trainData, testData
+		runHooks("before-train", hookCtx)
+		trainData, testData = hookCtx.TrainData, hookCtx.TestData
+
+		// Segment the applicants and give every model the segment
+		if *segmentsPtr > 0 {
+			segmentConfig := segmentation.DefaultConfig(*segmentsPtr)
+			segmentConfig.Seed = *seedPtr
+			segmenter, err = segmentation.Fit(trainData, segmentConfig)
+			if err != nil {
+				fmt.Printf("Error segmenting applicants: %v\n", err)
+				exit(1)
+			}
+			segmenter.PrintSegments(trainData)
+			if trainData, err = segmenter.AddFeature(trainData); err == nil {
+				testData, err = segmenter.AddFeature(testData)
+			}
+			if err != nil {
+				fmt.Printf("Error adding segment feature: %v\n", err)
+				exit(1)
+			}
+			hookCtx.TrainData, hookCtx.TestData = trainData, testData
+		}
+
+		modelResults, err := models.TrainAllModels(trainData, testData, *seedPtr)
 		if err != nil {
 			fmt.Printf("Error training models: %v\n", err)
-			os.Exit(1)
+			exit(1)
+		}
+
+		// Measure how much each model's metrics vary across folds
+		if *cvPtr > 0 {
+			for _, modelType := range models.AllModelTypes {
+				result, ok := modelResults[modelType.String()]
+				if !ok {
+					continue
+				}
+				fmt.Printf("Cross-validating %s (%d folds)...\n", modelType, *cvPtr)
+				cv, err := evaluation.CrossValidate(modelType, trainData, *cvPtr, *seedPtr)
+				if err != nil {
+					fmt.Printf("Error cross-validating %s: %v\n", modelType, err)
+					exit(1)
+				}
+				result.CrossValidation = cv
+			}
+		}
+
+		// Check whether each model's feature importance ranking survives
+		// retraining on resampled data
+		if *stabilityPtr > 0 {
+			stability := evaluation.DefaultStabilityConfig()
+			stability.Resamples = *stabilityPtr
+			stability.Seed = *seedPtr
+			var reports []*evaluation.StabilityReport
+			for _, modelType := range models.AllModelTypes {
+				result, ok := modelResults[modelType.String()]
+				if !ok {
+					continue
+				}
+				fmt.Printf("Resampling %s feature importance (%d resamples)...\n", modelType, *stabilityPtr)
+				report, err := evaluation.ImportanceStability(modelType, result.Model, trainData, testData, evaluation.AblationImportance, stability)
+				if err != nil {
+					fmt.Printf("Error analyzing %s importance stability: %v\n", modelType, err)
+					exit(1)
+				}
+				reports = append(reports, report)
+			}
+			evaluation.PrintStabilityReports(reports)
+			if err := evaluation.SaveStabilityReports(stabilityPath, reports); err != nil {
+				fmt.Printf("Error saving importance stability: %v\n", err)
+				exit(1)
+			}
+			fmt.Printf("Saved importance stability to %s\n", stabilityPath)
 		}
 
 		// Add results to evaluation
@@ -102,52 +499,911 @@ func main() {
 			modelEval.AddResult(result)
 		}
 
+		// Delegate an extra model to an external process if one is configured
+		if *externalPtr != "" {
+			fmt.Printf("Training %s model...\n", *externalNamePtr)
+			result, err := models.TrainExternalModel(trainData, testData, models.ExternalConfig{
+				Name:    *externalNamePtr,
+				Command: strings.Fields(*externalPtr),
+				Timeout: *externalTimeoutPtr,
+			})
+			if err != nil {
+				fmt.Printf("Error training external model: %v\n", err)
+				exit(1)
+			}
+			modelEval.AddResult(result)
+		}
+
+		// Train a differentially private logistic regression when asked
+		if *dpEpsilonPtr > 0 {
+			fmt.Printf("Training %s (epsilon %g)...\n", models.PrivateLogisticRegressionName, *dpEpsilonPtr)
+			privacy := models.DefaultPrivacyConfig(*dpEpsilonPtr)
+			privacy.Seed = *seedPtr
+			result, err := models.TrainPrivateLogisticRegression(trainData, testData, privacy)
+			if err != nil {
+				fmt.Printf("Error training private logistic regression: %v\n", err)
+				exit(1)
+			}
+			if lr, ok := result.Model.(*models.LogisticRegressionModel); ok && lr.Budget != nil {
+				fmt.Printf("%s privacy budget: %s\n", result.ModelName, lr.Budget)
+			}
+			modelEval.AddResult(result)
+		}
+
+		// Train a model per declared segment and route each application to
+		// its segment's model
+		if *segmentPlanPtr != "" {
+			plan, err := models.LoadSegmentPlan(*segmentPlanPtr)
+			if err != nil {
+				fmt.Printf("Error loading -segment-plan: %v\n", err)
+				exit(1)
+			}
+			scales, err := explain.LoadNormalizationScales(trainDataPath)
+			if err != nil {
+				fmt.Printf("Error loading normalization scales: %v\n", err)
+				exit(1)
+			}
+			fmt.Printf("Training %s per segment...\n", plan.Model)
+			result, err := models.TrainSegmentedModel(trainData, testData, plan, *seedPtr, explain.Normalizer(scales))
+			if err != nil {
+				fmt.Printf("Error training segment models: %v\n", err)
+				exit(1)
+			}
+			if segmented, ok := result.Model.(*models.SegmentedModel); ok {
+				evaluations := segmented.EvaluateSegments(testData)
+				evaluation.PrintSegmentEvaluations(result.ModelName, evaluations)
+				if err := evaluation.SaveSegmentEvaluations(segmentModelsPath, result.ModelName, evaluations); err != nil {
+					fmt.Printf("Error saving segment models: %v\n", err)
+					exit(1)
+				}
+			}
+			modelEval.AddResult(result)
+		}
+
+		// Processed data with an amount get a second-stage model predicting
+		// it for approved applications, with prediction intervals from a
+		// quantile regression forest when asked
+		if trainData.Amounts != nil {
+			fmt.Println("Training amount model...")
+			var result *models.AmountResult
+			if *amountIntervalPtr > 0 {
+				forestConfig := models.DefaultQuantileForestConfig()
+				forestConfig.Seed = *seedPtr
+				result, err = models.TrainQuantileAmountModel(trainData, testData, forestConfig, *amountIntervalPtr)
+			} else {
+				amountConfig := models.DefaultAmountConfig()
+				amountConfig.Seed = *seedPtr
+				result, err = models.TrainAmountModel(trainData, testData, amountConfig)
+			}
+			if err != nil {
+				fmt.Printf("Error training amount model: %v\n", err)
+				exit(1)
+			}
+			evaluation.PrintAmountResult(result)
+			if err := evaluation.SaveAmountResult(amountModelPath, result); err != nil {
+				fmt.Printf("Error saving amount model: %v\n", err)
+				exit(1)
+			}
+			fmt.Printf("Saved amount model metrics to %s\n", amountModelPath)
+			if result.Lower != nil {
+				if err := evaluation.SaveAmountIntervals(amountIntervalsPath, result); err != nil {
+					fmt.Printf("Error saving amount intervals: %v\n", err)
+					exit(1)
+				}
+				fmt.Printf("Saved amount prediction intervals to %s\n", amountIntervalsPath)
+			}
+		}
+
+		// Processed data with a time to default get a Cox model, scored by
+		// the probability of no default within the horizon
+		if trainData.Durations != nil {
+			fmt.Println("Training Cox proportional hazards model...")
+			horizon := 0.0
+			if schema != nil {
+				horizon = schema.Horizon
+			}
+			result, report, err := models.TrainCoxModel(trainData, testData, models.DefaultCoxConfig(horizon))
+			if err != nil {
+				fmt.Printf("Error training Cox model: %v\n", err)
+				exit(1)
+			}
+			evaluation.PrintSurvivalReport(report)
+			if err := evaluation.SaveSurvivalReport(survivalModelPath, report); err != nil {
+				fmt.Printf("Error saving survival model: %v\n", err)
+				exit(1)
+			}
+			fmt.Printf("Saved survival model to %s\n", survivalModelPath)
+			modelEval.AddResult(result)
+		}
+
+		// Processed data with a multiclass outcome get a one-vs-rest model
+		// of every type
+		if trainData.Classes != nil && len(classes) > 0 {
+			for _, result := range models.TrainAllMulticlassModels(trainData, testData, classes, *seedPtr) {
+				multiclassEval.AddResult(result)
+			}
+		}
+
+		// Search for better tree ensemble settings when asked
+		if *tunePtr {
+			tuning := models.DefaultTuningConfig()
+			tuning.Trials = *tuneTrialsPtr
+			tuning.Seed = *seedPtr
+			for _, modelType := range models.TunableModelTypes {
+				fmt.Printf("Tuning %s (%d trials)...\n", modelType, tuning.Trials)
+				result, report, err := models.TuneModel(trainData, testData, modelType, tuning)
+				if err != nil {
+					fmt.Printf("Error tuning %s: %v\n", modelType, err)
+					exit(1)
+				}
+				printTuningReport(report)
+				modelEval.AddResult(result)
+			}
+		}
+
+		// Blend the trained models into a validation-selected ensemble
+		fmt.Println("Selecting ensemble...")
+		selection := models.DefaultEnsembleSelectionConfig()
+		selection.Seed = *seedPtr
+		ensembleResult, err := models.SelectEnsemble(trainData, testData, modelResults, selection)
+		if err != nil {
+			fmt.Printf("Error selecting ensemble: %v\n", err)
+			exit(1)
+		}
+		modelEval.AddResult(ensembleResult)
+		if ensemble, ok := ensembleResult.Model.(*models.EnsembleModel); ok {
+			fmt.Printf("%s: %s (validation AUC %.4f)\n", models.SelectedEnsembleName, ensemble, ensemble.ValidationAUC)
+		}
+
+		// Report the forest's out-of-bag error estimate
+		if result, ok := modelResults[models.RandomForest.String()]; ok {
+			if forest, ok := result.Model.(*models.RandomForestModel); ok {
+				fmt.Printf("Random Forest OOB error: %.4f (%d rows)\n", forest.OOBError, forest.OOBRows)
+			}
+		}
+
+		// Report how far boosting ran before early stopping
+		if result, ok := modelResults[models.GradientBoosting.String()]; ok {
+			if gbm, ok := result.Model.(*models.GradientBoostingModel); ok {
+				printBoostingProgress(gbm)
+			}
+		}
+
+		// Save the learned tree structure for inspection
+		if result, ok := modelResults[models.DecisionTree.String()]; ok {
+			if tree, ok := result.Model.(*models.DecisionTreeModel); ok {
+				if err := saveTreeDump(tree, trainData.Features, treeDumpPath); err != nil {
+					fmt.Printf("Error saving decision tree: %v\n", err)
+					exit(1)
+				}
+			}
+		}
+
+		// Distill the tree ensembles into readable rules
+		if *rulesPtr {
+			scales, err := explain.LoadNormalizationScales(trainDataPath)
+			if err != nil {
+				fmt.Printf("Error loading normalization scales: %v\n", err)
+				exit(1)
+			}
+			for _, modelType := range []models.ModelType{models.RandomForest, models.GradientBoosting} {
+				result, ok := modelResults[modelType.String()]
+				if !ok {
+					continue
+				}
+				rules, err := explain.ExtractRules(result.ModelName, result.Model, trainData, scales, explain.DefaultRuleConfig())
+				if err != nil {
+					fmt.Printf("Error extracting %s rules: %v\n", modelType, err)
+					exit(1)
+				}
+				base := filepath.Join(rulesDir, strings.ReplaceAll(strings.ToLower(result.ModelName), " ", "_")+"_rules")
+				csvPath := base + ".csv"
+				if *compressPtr {
+					csvPath += ".gz"
+				}
+				if err := rules.SaveCSV(csvPath); err != nil {
+					fmt.Printf("Error saving %s rules: %v\n", modelType, err)
+					exit(1)
+				}
+				if err := rules.SaveMarkdown(base + ".md"); err != nil {
+					fmt.Printf("Error saving %s rules: %v\n", modelType, err)
+					exit(1)
+				}
+				fmt.Printf("Saved %d %s rules to %s and %s.md\n", len(rules.Rules), result.ModelName, csvPath, base)
+			}
+		}
+
+		runHooks("after-train", hookCtx)
 		fmt.Println("Model training completed successfully!")
 	}
 
 	if *evaluatePtr || runAll {
 		fmt.Println("Evaluating models...")
+		runHooks("before-evaluate", hookCtx)
 		// Implement model evaluation
 		modelEval.PrintResults()
+		if best := modelEval.GetBestModel(); best != "" {
+			evaluation.NewClassificationReport(modelEval.Results[best]).Print()
+		}
+
+		// Test whether the best model is meaningfully better than the
+		// runner-up
+		if ranked := modelEval.Ranking(); len(ranked) >= 2 {
+			significance := evaluation.DefaultSignificanceConfig()
+			significance.Seed = *seedPtr
+			comparison, err := evaluation.CompareModels(modelEval.Results[ranked[0]], modelEval.Results[ranked[1]], significance)
+			if err != nil {
+				fmt.Printf("Warning: could not compare models: %v\n", err)
+			} else {
+				evaluation.PrintComparison(comparison, significance.Confidence)
+			}
+		}
 
 		// Save evaluation results
 		err := modelEval.SaveResultsToCSV(modelEvalPath)
 		if err != nil {
 			fmt.Printf("Error saving evaluation results: %v\n", err)
-			os.Exit(1)
+			exit(1)
+		}
+
+		// Measure every model's reliance on each feature the same way
+		if *permutationPtr > 0 && testData != nil {
+			permutation := evaluation.DefaultPermutationConfig()
+			permutation.Repeats = *permutationPtr
+			permutation.Seed = *seedPtr
+			var reports []*evaluation.PermutationReport
+			for _, name := range modelEval.Ranking() {
+				report, err := evaluation.PermutationImportances(name, modelEval.Results[name].Model, testData, permutation)
+				if err != nil {
+					fmt.Printf("Error computing %s permutation importance: %v\n", name, err)
+					exit(1)
+				}
+				reports = append(reports, report)
+			}
+			if len(reports) > 0 {
+				evaluation.PrintPermutationReport(reports[0])
+			}
+			if err := evaluation.SavePermutationReports(permutationPath, reports); err != nil {
+				fmt.Printf("Error saving permutation importance: %v\n", err)
+				exit(1)
+			}
+			fmt.Printf("Saved permutation importance to %s\n", permutationPath)
+		}
+
+		// Check whether any model treats the groups of a sensitive
+		// attribute differently
+		if *fairnessPtr != "" && testData != nil {
+			groups, err := fairness.SensitiveGroups(testData, *fairnessPtr)
+			if err != nil {
+				fmt.Printf("Error auditing fairness: %v\n", err)
+				exit(1)
+			}
+			fairnessConfig := fairness.DefaultConfig()
+			fairnessConfig.Reference = *fairnessReferencePtr
+			var reports []*fairness.Report
+			for _, name := range modelEval.Ranking() {
+				report, err := fairness.Audit(modelEval.Results[name], *fairnessPtr, groups, fairnessConfig)
+				if err != nil {
+					fmt.Printf("Error auditing %s fairness: %v\n", name, err)
+					exit(1)
+				}
+				reports = append(reports, report)
+			}
+			if len(reports) > 0 {
+				fairness.PrintReport(reports[0])
+			}
+			if err := fairness.SaveReports(fairnessPath, reports); err != nil {
+				fmt.Printf("Error saving fairness report: %v\n", err)
+				exit(1)
+			}
+			fmt.Printf("Saved fairness report to %s\n", fairnessPath)
+		}
+
+		// Break every model's performance down by applicant segment
+		if segmenter != nil && testData != nil {
+			assignments := segmenter.Assign(testData)
+			var reports []*segmentation.Report
+			for _, name := range modelEval.Ranking() {
+				report, err := segmenter.Evaluate(modelEval.Results[name], assignments)
+				if err != nil {
+					fmt.Printf("Error evaluating %s by segment: %v\n", name, err)
+					exit(1)
+				}
+				reports = append(reports, report)
+			}
+			if len(reports) > 0 {
+				segmentation.PrintReport(reports[0])
+			}
+			if err := segmenter.SaveReports(segmentsPath, reports); err != nil {
+				fmt.Printf("Error saving segment report: %v\n", err)
+				exit(1)
+			}
+			fmt.Printf("Saved segment report to %s\n", segmentsPath)
+		}
+
+		// Save every model's per-class metrics
+		if err := modelEval.SaveClassificationReports(classReportPath); err != nil {
+			fmt.Printf("Error saving classification reports: %v\n", err)
+			exit(1)
 		}
 
 		// Save confusion matrices
-		err = modelEval.SaveConfusionMatrices(confusionMatrixDir)
+		err = modelEval.SaveConfusionMatrices(confusionMatrixDir, *compressPtr)
 		if err != nil {
 			fmt.Printf("Error saving confusion matrices: %v\n", err)
-			os.Exit(1)
+			exit(1)
+		}
+
+		// Save each model's reliability diagram
+		if err := modelEval.SaveReliability(reliabilityPath); err != nil {
+			fmt.Printf("Error saving reliability: %v\n", err)
+			exit(1)
+		}
+
+		// Report the multiclass models like the binary ones
+		if len(multiclassEval.Results) > 0 {
+			multiclassEval.PrintResults()
+			if best := multiclassEval.GetBestModel(); best != "" {
+				evaluation.NewClassificationReport(multiclassEval.Results[best]).Print()
+			}
+			if err := multiclassEval.SaveResultsToCSV(multiclassEvalPath); err != nil {
+				fmt.Printf("Error saving multiclass evaluation results: %v\n", err)
+				exit(1)
+			}
+			if err := multiclassEval.SaveClassificationReports(multiclassReportPath); err != nil {
+				fmt.Printf("Error saving multiclass classification reports: %v\n", err)
+				exit(1)
+			}
+			if err := multiclassEval.SaveConfusionMatrices(filepath.Join(confusionMatrixDir, "multiclass"), *compressPtr); err != nil {
+				fmt.Printf("Error saving multiclass confusion matrices: %v\n", err)
+				exit(1)
+			}
+			fmt.Printf("Saved multiclass evaluation results to %s\n", multiclassEvalPath)
+		}
+
+		// Calibrate the best model's scores into probabilities of default
+		// and grade each test prediction. A base model type is refitted
+		// fold by fold on the training rows, so the table comes from scores
+		// of rows the models never saw and the test rows stay out of it.
+		// Other models cannot be refitted here, so each test row is graded
+		// by a table fitted on the other test folds instead.
+		if best, ok := modelEval.Results[modelEval.GetBestModel()]; ok && len(best.Probabilities) > 0 {
+			scores, labels, weights := best.Probabilities, best.Labels, best.Weights
+			outOfFold := false
+			if modelType, err := models.ParseModelType(best.ModelName); err == nil {
+				scores, err = evaluation.OutOfFoldScores(modelType, trainData, calibrationFolds, *seedPtr)
+				if err != nil {
+					fmt.Printf("Error scoring %s out of fold: %v\n", best.ModelName, err)
+					exit(1)
+				}
+				labels, weights = trainData.Y, trainData.Weights
+				outOfFold = true
+			}
+			table, err := calibration.Fit(scores, labels, weights, calibrationBins)
+			if err != nil {
+				fmt.Printf("Error calibrating %s: %v\n", best.ModelName, err)
+				exit(1)
+			}
+			if err := table.SaveCSV(calibrationPath); err != nil {
+				fmt.Printf("Error saving calibration table: %v\n", err)
+				exit(1)
+			}
+			fmt.Printf("Saved %s calibration table to %s\n", best.ModelName, calibrationPath)
+
+			scale := calibration.DefaultGradeScale()
+			if *gradesPtr != "" {
+				scale, err = calibration.LoadGradeScale(*gradesPtr)
+				if err != nil {
+					fmt.Printf("Error loading risk grades: %v\n", err)
+					exit(1)
+				}
+			}
+
+			var pds []float64
+			source := fmt.Sprintf("a table fitted on %d-fold out-of-fold training scores", calibrationFolds)
+			if outOfFold {
+				pds = make([]float64, len(best.Probabilities))
+				for i, p := range best.Probabilities {
+					pds[i] = table.PD(p)
+				}
+			} else {
+				pds, err = calibration.CrossFitPD(best.Probabilities, best.Labels, best.Weights, calibrationBins, calibrationFolds)
+				if err != nil {
+					fmt.Printf("Error cross-fitting %s calibration: %v\n", best.ModelName, err)
+					exit(1)
+				}
+				source = fmt.Sprintf("tables cross-fitted over %d folds of the test rows", calibrationFolds)
+			}
+			evaluation.PrintGradeSummary(best.ModelName, source, scale.Summarize(pds, best.Labels, best.Weights))
+
+			// Decide each test application by the credit policy, whose rules
+			// test the unscaled attributes kept in the processed test file
+			var decisions []policy.Decision
+			if creditPolicy != nil {
+				decisions, err = decideApplications(creditPolicy, best.Probabilities, testDataPath)
+				if err != nil {
+					fmt.Printf("Error applying credit policy: %v\n", err)
+					exit(1)
+				}
+				counts := make(map[policy.Outcome]int)
+				for _, d := range decisions {
+					counts[d.Outcome]++
+				}
+				fmt.Printf("Credit policy on %s: %d approved, %d referred, %d declined\n",
+					best.ModelName, counts[policy.Approve], counts[policy.Refer], counts[policy.Decline])
+			}
+
+			if err := evaluation.SavePredictions(predictionsPath, best, pds, scale, decisions); err != nil {
+				fmt.Printf("Error saving predictions: %v\n", err)
+				exit(1)
+			}
+
+			// Sweep the approval cutoff and pick the operating point
+			sweep := evaluation.SweepThresholds(best.Probabilities, best.Labels, best.Weights, evaluation.ThresholdSteps)
+			selected, err := evaluation.SelectThreshold(sweep, thresholdObjective)
+			if err != nil {
+				fmt.Printf("Warning: %v for %s\n", err, best.ModelName)
+			} else {
+				m := sweep[selected]
+				fmt.Printf("Best %s threshold for %s: %.2f (accuracy %.4f, precision %.4f, recall %.4f, F1 %.4f, approval rate %.4f)\n",
+					thresholdObjective, best.ModelName, m.Threshold, m.Accuracy, m.Precision, m.Recall, m.F1Score, m.ApprovalRate)
+			}
+			if err := evaluation.SaveThresholdAnalysis(thresholdPath, sweep, selected); err != nil {
+				fmt.Printf("Error saving threshold analysis: %v\n", err)
+				exit(1)
+			}
+
+			// Approving pays off above the break-even probability once the
+			// scores are calibrated
+			if costs != nil {
+				fmt.Printf("Break-even approval probability for these costs: %.4f\n", costs.BreakEvenThreshold())
+			}
+
+			// Check how much recalibration would improve the probabilities
+			if *recalibratePtr != "" {
+				report, err := evaluation.EvaluateRecalibration(best, recalibration)
+				if err != nil {
+					fmt.Printf("Error evaluating recalibration: %v\n", err)
+					exit(1)
+				}
+				fmt.Printf("%s recalibration of %s: Brier %.4f -> %.4f, ECE %.4f -> %.4f\n",
+					report.Method, report.ModelName, report.BrierBefore, report.BrierAfter, report.ECEBefore, report.ECEAfter)
+			}
+
+			// Explain what would flip each rejected test application
+			if best.Model != nil && testData != nil {
+				scales, err := explain.LoadNormalizationScales(trainDataPath)
+				if err != nil {
+					fmt.Printf("Error loading normalization scales: %v\n", err)
+					exit(1)
+				}
+				if *anchorsPtr {
+					anchorConfig := explain.DefaultAnchorConfig()
+					anchorConfig.Seed = *seedPtr
+					anchorer, err := explain.NewAnchorer(best.Model, trainData, scales, anchorConfig)
+					if err != nil {
+						fmt.Printf("Error preparing anchors: %v\n", err)
+						exit(1)
+					}
+					if err := explain.SaveAnchors(anchorsPath, anchorer, testData); err != nil {
+						fmt.Printf("Error saving anchors: %v\n", err)
+						exit(1)
+					}
+					fmt.Printf("Saved anchor rules for %s to %s\n", best.ModelName, anchorsPath)
+				}
+				var explainer *explain.SHAPExplainer
+				if *shapPtr != "" || *reasonsPtr {
+					shapConfig := explain.DefaultSHAPConfig()
+					shapConfig.Seed = *seedPtr
+					explainer, err = explain.NewSHAPExplainer(best.Model, trainData, scales, shapConfig)
+					if err != nil {
+						fmt.Printf("Error preparing SHAP explanations: %v\n", err)
+						exit(1)
+					}
+				}
+				if *shapPtr != "" {
+					rows, err := parseRows(*shapPtr)
+					if err != nil {
+						fmt.Printf("Error parsing -shap: %v\n", err)
+						exit(1)
+					}
+					var explanations []*explain.SHAPExplanation
+					for _, i := range rows {
+						x, err := explainer.Explain(testData, i)
+						if err != nil {
+							fmt.Printf("Error explaining test row %d: %v\n", i, err)
+							exit(1)
+						}
+						fmt.Printf("\nSHAP explanation of test row %d (%s): %s\n", i, best.ModelName, x)
+						explanations = append(explanations, x)
+					}
+					if err := explain.SaveSHAPExplanations(shapPath, rows, explanations); err != nil {
+						fmt.Printf("Error saving SHAP explanations: %v\n", err)
+						exit(1)
+					}
+				}
+
+				// Give the principal reasons for every rejection, as an
+				// adverse action notice must
+				if *reasonsPtr {
+					generator, err := reasons.NewGenerator(best.Model, explainer, trainData, reasons.DefaultConfig())
+					if err != nil {
+						fmt.Printf("Error preparing reason codes: %v\n", err)
+						exit(1)
+					}
+					if *reasonCatalogPtr != "" {
+						if err := generator.LoadCatalog(*reasonCatalogPtr); err != nil {
+							fmt.Printf("Error loading -reason-catalog: %v\n", err)
+							exit(1)
+						}
+					}
+					decisions, err := generator.DecideAll(testData)
+					if err != nil {
+						fmt.Printf("Error generating reason codes: %v\n", err)
+						exit(1)
+					}
+					fmt.Printf("\nPrincipal Rejection Reasons (%s):\n", best.ModelName)
+					for _, c := range reasons.PrincipalCodes(decisions) {
+						fmt.Printf("  %-12s %d\n", c.Code, c.Count)
+					}
+					if err := reasons.SaveReasons(reasonsPath, decisions); err != nil {
+						fmt.Printf("Error saving reason codes: %v\n", err)
+						exit(1)
+					}
+					fmt.Printf("Saved reason codes to %s\n", reasonsPath)
+				}
+				rejected, flipped, err := explain.SaveCounterfactuals(counterfactualsPath, best.Model, testData, scales, explain.DefaultCounterfactualConfig())
+				if err != nil {
+					fmt.Printf("Error saving counterfactuals: %v\n", err)
+					exit(1)
+				}
+				fmt.Printf("Found counterfactuals for %d of %d rejected applications, saved to %s\n", flipped, rejected, counterfactualsPath)
+			}
+
+			// Find the feature pairs the best model combines, as
+			// candidates for engineered features
+			if *interactionsPtr && best.Model != nil && trainData != nil {
+				interactionConfig := explain.DefaultInteractionConfig()
+				interactionConfig.Seed = *seedPtr
+				pairs, err := explain.FindInteractions(best.Model, trainData, interactionConfig)
+				if err != nil {
+					fmt.Printf("Error finding interactions: %v\n", err)
+					exit(1)
+				}
+				fmt.Printf("\nStrongest Interactions (%s):\n", best.ModelName)
+				for _, pair := range pairs {
+					fmt.Printf("  %s x %s: H %.4f, strength %.4f\n", pair.A, pair.B, pair.H, pair.Strength)
+				}
+				if err := explain.SaveInteractions(interactionsPath, pairs); err != nil {
+					fmt.Printf("Error saving interactions: %v\n", err)
+					exit(1)
+				}
+			}
+
+			// Plot how the best model responds to each requested feature
+			if *pdpPtr != "" && best.Model != nil && trainData != nil {
+				scales, err := explain.LoadNormalizationScales(trainDataPath)
+				if err != nil {
+					fmt.Printf("Error loading normalization scales: %v\n", err)
+					exit(1)
+				}
+				features := explain.NumericFeatures(trainData)
+				if *pdpPtr != "all" {
+					features = strings.Split(*pdpPtr, ",")
+				}
+				pdpDir := filepath.Join(visualizationDir, "partial_dependence")
+				if err := visualization.CreateOutputDir(pdpDir); err != nil {
+					fmt.Printf("Error creating partial dependence directory: %v\n", err)
+					exit(1)
+				}
+				pdpConfig := explain.DefaultPDPConfig()
+				pdpConfig.Seed = *seedPtr
+				for _, feature := range features {
+					feature = strings.TrimSpace(feature)
+					pd, err := explain.ComputePartialDependence(best.Model, trainData, feature, scales, pdpConfig)
+					if err != nil {
+						fmt.Printf("Error computing partial dependence: %v\n", err)
+						exit(1)
+					}
+					path := filepath.Join(pdpDir, feature+".svg")
+					if err := visualization.PlotPartialDependence(best.ModelName, feature, pd.Grid, pd.Average, pd.ICE, path); err != nil {
+						fmt.Printf("Error plotting partial dependence: %v\n", err)
+						exit(1)
+					}
+				}
+				fmt.Printf("Saved partial dependence plots of %s for %d features to %s\n", best.ModelName, len(features), pdpDir)
+			}
+
+			// Mimic the best model with an interpretable one for review
+			if *surrogatePtr != "" && best.Model != nil && trainData != nil {
+				surrogate, err := explain.FitSurrogate(best.Model, trainData, testData, surrogateKind)
+				if err != nil {
+					fmt.Printf("Error fitting surrogate: %v\n", err)
+					exit(1)
+				}
+				// Report thresholds in the raw units of the fitted pipeline
+				prep, err := preprocessing.LoadPipeline(pipelinePath)
+				if err != nil {
+					fmt.Printf("Error loading preprocessing pipeline: %v\n", err)
+					exit(1)
+				}
+				if err := surrogate.Save(surrogatePath, trainData.Features, explain.PipelineScales(prep.Scalings)); err != nil {
+					fmt.Printf("Error saving surrogate: %v\n", err)
+					exit(1)
+				}
+				fmt.Printf("%s surrogate of %s agrees on %.2f%% of test decisions (%.2f%% train), saved to %s\n",
+					surrogateKind, best.ModelName, 100*surrogate.TestFidelity, 100*surrogate.TrainFidelity, surrogatePath)
+			}
+		}
+
+		// Record the best model as the new champion when asked
+		if *saveBaselinePtr != "" {
+			if best, ok := modelEval.Results[modelEval.GetBestModel()]; ok {
+				if err := evaluation.NewBaseline(best).Save(*saveBaselinePtr); err != nil {
+					fmt.Printf("Error saving baseline: %v\n", err)
+					exit(1)
+				}
+				fmt.Printf("Saved %s as the baseline in %s\n", best.ModelName, *saveBaselinePtr)
+			}
+		}
+
+		// Block regressions against the stored champion
+		if *gatePtr != "" {
+			baseline, err := evaluation.LoadBaseline(*gatePtr)
+			if err != nil {
+				fmt.Printf("Error loading baseline: %v\n", err)
+				exit(1)
+			}
+			best, ok := modelEval.Results[modelEval.GetBestModel()]
+			if !ok {
+				fmt.Println("Error: -gate needs trained models to evaluate")
+				exit(1)
+			}
+			checks, passed := baseline.Gate(best, evaluation.DefaultGateRules(*gateTolerancePtr))
+			evaluation.PrintGate(baseline, best.ModelName, checks)
+			if !passed {
+				fmt.Println("Champion gate failed")
+				exit(1)
+			}
+			fmt.Println("Champion gate passed")
 		}
 
+		runHooks("after-evaluate", hookCtx)
 		fmt.Println("Model evaluation completed successfully!")
 	}
 
 	if *visualizePtr || runAll {
 		fmt.Println("Generating visualizations...")
+		runHooks("before-visualize", hookCtx)
 		// Create visualization directory if it doesn't exist
 		if err := visualization.CreateOutputDir(visualizationDir); err != nil {
 			fmt.Printf("Error creating visualization directory: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		// Generate all visualizations
+		var featureImportance map[string]map[string]float64
+		if trainData != nil {
+			featureImportance = modelEval.AnalyzeFeatureImportance(trainData)
+		}
 		err := visualization.GenerateAllVisualizations(
 			trainDataPath,
 			visualizationDir,
 			modelEval.Results,
+			featureImportance,
+			classes,
+			multiclassEval.Results,
 		)
 		if err != nil {
 			fmt.Printf("Error generating visualizations: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
+		runHooks("after-visualize", hookCtx)
 		fmt.Println("Visualization generation completed successfully!")
 	}
 
 	fmt.Println("Pipeline completed successfully!")
 }
+
+// runPreprocessing loads the raw data described by schema, or the crx data
+// when it is nil, drops its ignored columns, masks its identifier columns
+// when pii is set and runs the before-preprocess hooks on it. It then screens the
+// raw features and splits the data, shuffling with the context's seed
+// unless it is zero. The preprocessing pipeline is fitted on the training
+// rows, imputing missing values unless keepMissing is set, and saved to
+// pipelinePath; it then cleans and encodes both sets. The processed
+// training rows are left in the context for the after-preprocess hooks.
+func runPreprocessing(ctx *pipeline.Context, screeningPath, pipelinePath string, keepMissing bool, pii *preprocessing.PIIConfig, schema *preprocessing.Schema) {
+	if schema == nil {
+		schema = preprocessing.CRXSchema()
+	}
+	data, err := preprocessing.LoadDataWithSchema(ctx.RawDataPath, schema)
+	if err != nil {
+		fmt.Printf("Error loading data: %v\n", err)
+		exit(1)
+	}
+	if err := data.DropIgnoredColumns(); err != nil {
+		fmt.Printf("Error dropping ignored columns: %v\n", err)
+		exit(1)
+	}
+	if pii != nil {
+		if err := data.MaskPII(pii); err != nil {
+			fmt.Printf("Error masking identifier columns: %v\n", err)
+			exit(1)
+		}
+	}
+	ctx.Data = data
+	runHooks("before-preprocess", ctx)
+	data = ctx.Data
+
+	// Rank the raw features by their predictive power on their own
+	screens, err := data.ScreenFeatures()
+	if err != nil {
+		fmt.Printf("Error screening features: %v\n", err)
+		exit(1)
+	}
+	preprocessing.PrintScreening(screens)
+	if err := preprocessing.SaveScreening(screeningPath, screens); err != nil {
+		fmt.Printf("Error saving feature screening: %v\n", err)
+		exit(1)
+	}
+	data.Seed = ctx.Seed
+
+	// Split before fitting, so imputation, encodings and normalization are
+	// learned from the training rows only, and save the fitted pipeline
+	// for new applications
+	train, test := data.Split(preprocessing.TestSize)
+	prep := preprocessing.NewPipeline(schema, keepMissing)
+	if err := prep.Fit(train); err != nil {
+		fmt.Printf("Error fitting preprocessing: %v\n", err)
+		exit(1)
+	}
+	if err := preprocessing.SavePipeline(pipelinePath, prep); err != nil {
+		fmt.Printf("Error saving preprocessing pipeline: %v\n", err)
+		exit(1)
+	}
+
+	// Impute, encode, label and normalize both sets
+	if err := prep.Transform(train); err != nil {
+		fmt.Printf("Error preprocessing training data: %v\n", err)
+		exit(1)
+	}
+	if err := prep.Transform(test); err != nil {
+		fmt.Printf("Error preprocessing test data: %v\n", err)
+		exit(1)
+	}
+	ctx.Data = train
+
+	// Save processed data
+	if err := preprocessing.SaveProcessedSplit(train, test, ctx.TrainDataPath, ctx.TestDataPath); err != nil {
+		fmt.Printf("Error saving processed data: %v\n", err)
+		exit(1)
+	}
+}
+
+// runHooks runs the hooks registered at point, exiting on the first error
+func runHooks(point string, ctx *pipeline.Context) {
+	if err := pipeline.RunHooks(point, ctx); err != nil {
+		fmt.Printf("Error running %s hooks: %v\n", point, err)
+		exit(1)
+	}
+}
+
+// saveDataDictionary describes the columns of the processed training data
+// in base.csv and base.md, taking the column descriptions from the names
+// file when it can be read. schema is the preprocessing config, or nil for
+// the crx columns.
+func saveDataDictionary(trainDataPath, namesPath, base, version string, compress bool, schema *preprocessing.Schema) error {
+	file, err := dataset.Open(trainDataPath)
+	if err != nil {
+		return fmt.Errorf("error opening processed data: %v", err)
+	}
+	defer file.Close()
+	ds, err := dataset.ReadCSV(file)
+	if err != nil {
+		return fmt.Errorf("error reading processed data: %v", err)
+	}
+
+	descriptions, err := preprocessing.LoadAttributeDescriptions(namesPath)
+	if err != nil {
+		fmt.Printf("Warning: data dictionary has no column descriptions: %v\n", err)
+	}
+	dict, err := preprocessing.BuildDataDictionary(ds, version, descriptions, schema)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return fmt.Errorf("error creating data dictionary directory: %v", err)
+	}
+	csvPath := base + ".csv"
+	if compress {
+		csvPath += ".gz"
+	}
+	if err := dict.SaveCSV(csvPath); err != nil {
+		return err
+	}
+	return dict.SaveMarkdown(base + ".md")
+}
+
+// printBoostingProgress prints the training and validation loss every few
+// iterations and the number of trees kept
+func printBoostingProgress(gbm *models.GradientBoostingModel) {
+	for i, loss := range gbm.TrainLoss {
+		if (i+1)%25 != 0 && i != len(gbm.TrainLoss)-1 {
+			continue
+		}
+		if i < len(gbm.ValidationLoss) {
+			fmt.Printf("Gradient Boosting iteration %d: train loss %.4f, validation loss %.4f\n", i+1, loss, gbm.ValidationLoss[i])
+		} else {
+			fmt.Printf("Gradient Boosting iteration %d: train loss %.4f\n", i+1, loss)
+		}
+	}
+	fmt.Printf("Gradient Boosting kept %d of %d trees\n", gbm.BestIteration, len(gbm.TrainLoss))
+}
+
+// printTuningReport prints the best trial of each rung and the winning
+// configuration
+func printTuningReport(report *models.TuningReport) {
+	var best *models.TuningTrial
+	for i := range report.Trials {
+		trial := &report.Trials[i]
+		if best == nil || trial.Budget != best.Budget {
+			if best != nil {
+				fmt.Printf("  %d trees: best validation AUC %.4f (%s)\n", best.Budget, best.ValidationAUC, best.Params)
+			}
+			best = trial
+		}
+		if trial.ValidationAUC > best.ValidationAUC {
+			best = trial
+		}
+	}
+	if best != nil {
+		fmt.Printf("  %d trees: best validation AUC %.4f (%s)\n", best.Budget, best.ValidationAUC, best.Params)
+	}
+	fmt.Printf("  Selected %s (seed %d)\n", report.BestParams, report.Config.Seed)
+}
+
+// decideApplications applies a credit policy to the scores of the rows of
+// the processed test file
+func decideApplications(p *policy.Policy, scores []float64, testDataPath string) ([]policy.Decision, error) {
+	file, err := dataset.Open(testDataPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening test data: %v", err)
+	}
+	defer file.Close()
+	ds, err := dataset.ReadCSV(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading test data: %v", err)
+	}
+	return p.DecideAll(scores, ds)
+}
+
+// saveTreeDump writes the text dump of a decision tree to path,
+// gzip-compressed when it ends in .gz and encrypted when encrypted writes
+// are on
+func saveTreeDump(tree *models.DecisionTreeModel, features []string, path string) error {
+	f, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating tree dump: %v", err)
+	}
+	if err := tree.Dump(f, features); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing tree dump: %v", err)
+	}
+	return f.Close()
+}
+
+// parseRows parses a comma-separated list of row numbers
+func parseRows(list string) ([]int, error) {
+	var rows []int
+	for _, field := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid row %q", field)
+		}
+		rows = append(rows, n)
+	}
+	return rows, nil
+}
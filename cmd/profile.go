@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// stopProfiling flushes any profiles started by startProfiling. It is a no-op
+// until profiling starts.
+var stopProfiling = func() {}
+
+// startProfiling starts CPU profiling and arranges for a heap profile to be
+// written when stopProfiling runs. Empty paths disable the matching profile.
+func startProfiling(cpuPath, memPath string) error {
+	var cpuFile *os.File
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return fmt.Errorf("error creating CPU profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("error starting CPU profile: %v", err)
+		}
+		cpuFile = f
+	}
+
+	stopProfiling = func() {
+		stopProfiling = func() {}
+
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+		}
+
+		if memPath != "" {
+			f, err := os.Create(memPath)
+			if err != nil {
+				fmt.Printf("Error creating memory profile: %v\n", err)
+				return
+			}
+			defer f.Close()
+
+			// Collect garbage so the profile reflects live allocations
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				fmt.Printf("Error writing memory profile: %v\n", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// exit flushes profiles before terminating, since os.Exit skips deferred calls
+func exit(code int) {
+	stopProfiling()
+	os.Exit(code)
+}
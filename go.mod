@@ -3,8 +3,7 @@ module github.com/jimmymcguigan18/credit-card-approval-prediction
 go 1.16
 
 require (
-	github.com/go-gota/gota v0.12.0
 	github.com/wcharczuk/go-chart/v2 v2.1.0
-	golang.org/x/exp v0.0.0-20200331195152-e8c3332aa8e5 // indirect
-	gonum.org/v1/gonum v0.9.3 // indirect
+	gonum.org/v1/gonum v0.9.3
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,81 @@
+package benchmark
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/preprocessing"
+)
+
+// SizesEnv holds a comma-separated list of the synthetic row counts the
+// preprocessing and training benchmarks run on
+const SizesEnv = "CCAP_BENCH_SIZES"
+
+// DefaultSizes are the synthetic dataset sizes benchmarked when none are given
+var DefaultSizes = []int{1000, 10000, 50000}
+
+// Sizes returns the row counts listed in SizesEnv, or DefaultSizes when it
+// is unset
+func Sizes() ([]int, error) {
+	list := os.Getenv(SizesEnv)
+	if list == "" {
+		return DefaultSizes, nil
+	}
+	var sizes []int
+	for _, field := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid size %q in %s", field, SizesEnv)
+		}
+		sizes = append(sizes, n)
+	}
+	return sizes, nil
+}
+
+// Records generates n synthetic crx-shaped records, the same for a given
+// seed and size
+func Records(n int, seed uint64) [][]string {
+	return SyntheticRecords(n, rand.New(rand.NewPCG(seed, uint64(n))))
+}
+
+// CreditData builds a fresh, unprocessed CreditData from raw records
+func CreditData(records [][]string) (*preprocessing.CreditData, error) {
+	ds, err := dataset.FromRecords(preprocessing.RawColumns, records)
+	if err != nil {
+		return nil, err
+	}
+	return &preprocessing.CreditData{Data: ds}, nil
+}
+
+// FeatureMatrices fully preprocesses raw records and splits them into the
+// training and test matrices the models are trained on
+func FeatureMatrices(records [][]string, seed uint64) (trainData, testData *models.FeatureMatrix, err error) {
+	data, err := CreditData(records)
+	if err != nil {
+		return nil, nil, err
+	}
+	data.Seed = seed
+	data.HandleMissingValues()
+	if err := data.EncodeCategoricalFeatures(); err != nil {
+		return nil, nil, err
+	}
+	if err := data.ConvertTargetVariable(); err != nil {
+		return nil, nil, err
+	}
+	data.NormalizeFeatures()
+
+	trainDS, testDS := data.SplitTrainTest(0.2)
+	features := models.FeatureColumns(trainDS)
+	if trainData, err = models.NewFeatureMatrix(trainDS, features); err != nil {
+		return nil, nil, err
+	}
+	if testData, err = models.NewFeatureMatrix(testDS, features); err != nil {
+		return nil, nil, err
+	}
+	return trainData, testData, nil
+}
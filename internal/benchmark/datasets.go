@@ -0,0 +1,283 @@
+package benchmark
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/preprocessing"
+)
+
+// DatasetSpec names a raw dataset to benchmark and its schema
+type DatasetSpec struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Schema is the name of a bundled schema (crx, german or taiwan) or
+	// the path of a JSON schema or YAML preprocessing config
+	Schema string `json:"schema"`
+}
+
+// LoadDatasetSpecs reads the datasets to benchmark from a JSON file such as
+//
+//	{"datasets": [
+//	  {"name": "crx", "path": "data/raw/crx.data", "schema": "crx"},
+//	  {"name": "german", "path": "german.data", "schema": "german"},
+//	  {"name": "bank", "path": "bank.csv", "schema": "bank_schema.json"}
+//	]}
+//
+// Relative paths are resolved against the file's directory.
+func LoadDatasetSpecs(path string) ([]DatasetSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading dataset list: %v", err)
+	}
+
+	var list struct {
+		Datasets []DatasetSpec `json:"datasets"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("error parsing dataset list: %v", err)
+	}
+	if len(list.Datasets) == 0 {
+		return nil, fmt.Errorf("dataset list has no datasets")
+	}
+
+	dir := filepath.Dir(path)
+	seen := make(map[string]bool)
+	for k, spec := range list.Datasets {
+		if spec.Name == "" || spec.Path == "" || spec.Schema == "" {
+			return nil, fmt.Errorf("dataset %d needs a name, a path and a schema", k+1)
+		}
+		if seen[spec.Name] {
+			return nil, fmt.Errorf("dataset %s is listed twice", spec.Name)
+		}
+		seen[spec.Name] = true
+		if !filepath.IsAbs(spec.Path) {
+			list.Datasets[k].Path = filepath.Join(dir, spec.Path)
+		}
+		if _, builtin := preprocessing.BuiltinSchemas[spec.Schema]; !builtin && !filepath.IsAbs(spec.Schema) {
+			list.Datasets[k].Schema = filepath.Join(dir, spec.Schema)
+		}
+	}
+	return list.Datasets, nil
+}
+
+// schema returns the bundled schema of that name, or reads the schema file
+func (s DatasetSpec) schema() (*preprocessing.Schema, error) {
+	if builtin, ok := preprocessing.BuiltinSchemas[s.Schema]; ok {
+		return builtin(), nil
+	}
+	return preprocessing.LoadSchema(s.Schema)
+}
+
+// DatasetResult is every model's test performance on one dataset
+type DatasetResult struct {
+	Dataset  string
+	Rows     int
+	Features int
+	// ApprovalRate is the share of good applicants
+	ApprovalRate float64
+	Results      map[string]*models.ModelResult
+}
+
+// RunDatasets preprocesses each dataset as the pipeline does, splits it
+// with the same seed and trains and evaluates every model type on it
+func RunDatasets(specs []DatasetSpec, seed uint64) ([]*DatasetResult, error) {
+	var results []*DatasetResult
+	for _, spec := range specs {
+		fmt.Printf("Benchmarking dataset %s (%s)...\n", spec.Name, spec.Path)
+		result, err := runDataset(spec, seed)
+		if err != nil {
+			return nil, fmt.Errorf("dataset %s: %v", spec.Name, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// runDataset runs the pipeline on one dataset
+func runDataset(spec DatasetSpec, seed uint64) (*DatasetResult, error) {
+	schema, err := spec.schema()
+	if err != nil {
+		return nil, err
+	}
+	data, err := preprocessing.LoadDataWithSchema(spec.Path, schema)
+	if err != nil {
+		return nil, err
+	}
+	data.Seed = seed
+	if err := data.DropUnusedColumns(); err != nil {
+		return nil, err
+	}
+
+	// Fit preprocessing on the training rows only, as the pipeline does
+	train, test := data.Split(preprocessing.TestSize)
+	prep := preprocessing.NewPipeline(schema, false)
+	if err := prep.Fit(train); err != nil {
+		return nil, err
+	}
+	if err := prep.Transform(train); err != nil {
+		return nil, err
+	}
+	if err := prep.Transform(test); err != nil {
+		return nil, err
+	}
+
+	trainDS, testDS := train.Data, test.Data
+	features := models.FeatureColumns(trainDS)
+	trainData, err := models.NewFeatureMatrix(trainDS, features)
+	if err != nil {
+		return nil, fmt.Errorf("error building training matrix: %v", err)
+	}
+	testData, err := models.NewFeatureMatrix(testDS, features)
+	if err != nil {
+		return nil, fmt.Errorf("error building test matrix: %v", err)
+	}
+
+	trained, err := models.TrainAllModels(trainData, testData, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	approved := 0.0
+	for _, y := range trainData.Y {
+		approved += y
+	}
+	for _, y := range testData.Y {
+		approved += y
+	}
+	rows := trainData.Rows() + testData.Rows()
+	return &DatasetResult{
+		Dataset:      spec.Name,
+		Rows:         rows,
+		Features:     len(features),
+		ApprovalRate: approved / float64(rows),
+		Results:      trained,
+	}, nil
+}
+
+// ModelNames returns every model trained on any dataset, sorted
+func ModelNames(results []*DatasetResult) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, r := range results {
+		for name := range r.Results {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AUCRanks returns each model's rank by AUC on every dataset, 1 being the
+// best, keyed by dataset and then model
+func AUCRanks(results []*DatasetResult) map[string]map[string]int {
+	ranks := make(map[string]map[string]int)
+	for _, r := range results {
+		names := make([]string, 0, len(r.Results))
+		for name := range r.Results {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(a, b int) bool {
+			if r.Results[names[a]].AUC != r.Results[names[b]].AUC {
+				return r.Results[names[a]].AUC > r.Results[names[b]].AUC
+			}
+			return names[a] < names[b]
+		})
+		ranks[r.Dataset] = make(map[string]int)
+		for k, name := range names {
+			ranks[r.Dataset][name] = k + 1
+		}
+	}
+	return ranks
+}
+
+// PrintComparison prints each model's test AUC on every dataset and its
+// mean AUC rank across them, best first
+func PrintComparison(results []*DatasetResult) {
+	fmt.Println("\nDataset Benchmark:")
+	fmt.Println("==================")
+	for _, r := range results {
+		fmt.Printf("%-12s %7d rows, %4d features, %.1f%% approved\n", r.Dataset, r.Rows, r.Features, 100*r.ApprovalRate)
+	}
+
+	ranks := AUCRanks(results)
+	names := ModelNames(results)
+	meanRank := make(map[string]float64)
+	for _, name := range names {
+		n := 0
+		for _, r := range results {
+			if rank, ok := ranks[r.Dataset][name]; ok {
+				meanRank[name] += float64(rank)
+				n++
+			}
+		}
+		meanRank[name] /= float64(n)
+	}
+	sort.SliceStable(names, func(a, b int) bool {
+		return meanRank[names[a]] < meanRank[names[b]]
+	})
+
+	fmt.Printf("\n%-26s", "Model (test AUC)")
+	for _, r := range results {
+		fmt.Printf(" %-10s", r.Dataset)
+	}
+	fmt.Printf(" %-10s\n", "Mean Rank")
+	for _, name := range names {
+		fmt.Printf("%-26s", name)
+		for _, r := range results {
+			if result, ok := r.Results[name]; ok {
+				fmt.Printf(" %-10.4f", result.AUC)
+			} else {
+				fmt.Printf(" %-10s", "-")
+			}
+		}
+		fmt.Printf(" %-10.2f\n", meanRank[name])
+	}
+}
+
+// SaveComparison writes every model's metrics on every dataset to a CSV
+// file, gzip-compressed when the path ends in .gz
+func SaveComparison(path string, results []*DatasetResult) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating dataset benchmark file: %v", err)
+	}
+	defer file.Close()
+
+	ranks := AUCRanks(results)
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Dataset", "Rows", "Features", "Model", "Accuracy", "F1 Score", "AUC", "KS", "Brier", "AUC Rank"})
+	for _, r := range results {
+		for _, name := range ModelNames([]*DatasetResult{r}) {
+			result := r.Results[name]
+			writer.Write([]string{
+				r.Dataset,
+				strconv.Itoa(r.Rows),
+				strconv.Itoa(r.Features),
+				name,
+				strconv.FormatFloat(result.Accuracy, 'f', 4, 64),
+				strconv.FormatFloat(result.F1Score, 'f', 4, 64),
+				strconv.FormatFloat(result.AUC, 'f', 4, 64),
+				strconv.FormatFloat(result.KS, 'f', 4, 64),
+				strconv.FormatFloat(result.Brier, 'f', 4, 64),
+				strconv.Itoa(ranks[r.Dataset][name]),
+			})
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing dataset benchmark: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,66 @@
+package benchmark_test
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/benchmark"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// TestRunDatasets runs the bench subcommand's steps on two small synthetic
+// crx datasets listed in a dataset spec
+func TestRunDatasets(t *testing.T) {
+	dir := t.TempDir()
+	for i, name := range []string{"first.data", "second.data"} {
+		if err := benchmark.WriteRecords(filepath.Join(dir, name), benchmark.Records(300, uint64(i+1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	specPath := filepath.Join(dir, "datasets.json")
+	if err := os.WriteFile(specPath, []byte(`{"datasets": [
+		{"name": "first", "path": "first.data", "schema": "crx"},
+		{"name": "second", "path": "second.data", "schema": "crx"}
+	]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	specs, err := benchmark.LoadDatasetSpecs(specPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := benchmark.RunDatasets(specs, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d dataset results, want 2", len(results))
+	}
+	for _, r := range results {
+		if r.Rows != 300 {
+			t.Errorf("%s has %d rows, want 300", r.Dataset, r.Rows)
+		}
+		if len(r.Results) != len(models.AllModelTypes) {
+			t.Errorf("%s trained %d models, want %d", r.Dataset, len(r.Results), len(models.AllModelTypes))
+		}
+	}
+
+	outPath := filepath.Join(dir, "dataset_benchmark.csv")
+	if err := benchmark.SaveComparison(outPath, results); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 1 + 2*len(models.AllModelTypes); len(rows) != want {
+		t.Errorf("comparison has %d rows, want %d", len(rows), want)
+	}
+}
@@ -0,0 +1,74 @@
+package benchmark
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+)
+
+// categoryLevels lists the levels of each categorical crx attribute
+var categoryLevels = map[int][]string{
+	0:  {"a", "b"},
+	3:  {"u", "y", "l"},
+	4:  {"g", "p", "gg"},
+	5:  {"c", "d", "cc", "i", "j", "k", "m", "r", "q", "w", "x", "e", "aa", "ff"},
+	6:  {"v", "h", "bb", "j", "n", "z", "dd", "ff", "o"},
+	8:  {"t", "f"},
+	9:  {"t", "f"},
+	11: {"t", "f"},
+	12: {"g", "p", "s"},
+}
+
+// continuousScale is the rough upper bound of each continuous crx attribute
+var continuousScale = map[int]float64{
+	1:  80,
+	2:  28,
+	7:  28,
+	10: 67,
+	13: 2000,
+	14: 100000,
+}
+
+// SyntheticRecords generates n raw records shaped like crx.data, including
+// roughly 1% missing values marked with '?'
+func SyntheticRecords(n int, rng *rand.Rand) [][]string {
+	records := make([][]string, n)
+	for i := range records {
+		record := make([]string, 16)
+		for j := 0; j < 15; j++ {
+			if rng.Float64() < 0.01 {
+				record[j] = "?"
+				continue
+			}
+			if levels, ok := categoryLevels[j]; ok {
+				record[j] = levels[rng.IntN(len(levels))]
+				continue
+			}
+			record[j] = strconv.FormatFloat(rng.Float64()*continuousScale[j], 'f', 2, 64)
+		}
+
+		record[15] = "-"
+		if rng.Float64() < 0.445 {
+			record[15] = "+"
+		}
+		records[i] = record
+	}
+	return records
+}
+
+// WriteRecords writes raw records to a headerless CSV file like crx.data
+func WriteRecords(path string, records [][]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.WriteAll(records); err != nil {
+		return fmt.Errorf("error writing records: %v", err)
+	}
+	return nil
+}
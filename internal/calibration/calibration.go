@@ -0,0 +1,209 @@
+package calibration
+
+import (
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// Bin is one row of the calibration table: the scores in [Lower, Upper], how
+// many rows fell in it and their calibrated probability of default
+type Bin struct {
+	Lower float64
+	Upper float64
+	Count int
+	// BadRate is the observed share of bad outcomes in the bin, and PD the
+	// isotonic estimate that never increases with the score
+	BadRate float64
+	PD      float64
+	// weight is the summed sample weight of the bin's rows
+	weight float64
+}
+
+// Table maps model scores to calibrated probabilities of default
+type Table struct {
+	Bins []Bin
+}
+
+// Fit builds a calibration table from scores and 0/1 labels, where 1 is the
+// good outcome. crx records approvals rather than repayment, so a declined
+// application (label 0) stands in for a default. Scores are cut into
+// equal-frequency bins, and the bad rates are smoothed by weighted isotonic
+// regression so a higher score never maps to a higher PD. Bad rates weight
+// rows by weights, or count each once when it is nil.
+func Fit(scores, labels, weights []float64, bins int) (*Table, error) {
+	if len(scores) != len(labels) {
+		return nil, fmt.Errorf("got %d scores but %d labels", len(scores), len(labels))
+	}
+	if weights != nil && len(weights) != len(scores) {
+		return nil, fmt.Errorf("got %d scores but %d weights", len(scores), len(weights))
+	}
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("no scores to calibrate")
+	}
+	if bins <= 0 {
+		return nil, fmt.Errorf("bin count must be positive, got %d", bins)
+	}
+
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return scores[order[a]] < scores[order[b]]
+	})
+
+	// Cut at equal-frequency positions, moving each cut past tied scores so
+	// equal scores always share a bin
+	table := &Table{}
+	start := 0
+	for b := 1; b <= bins && start < len(order); b++ {
+		end := b * len(order) / bins
+		if end <= start {
+			continue
+		}
+		for end < len(order) && scores[order[end]] == scores[order[end-1]] {
+			end++
+		}
+
+		bad, total := 0.0, 0.0
+		for _, i := range order[start:end] {
+			w := models.WeightAt(weights, i)
+			total += w
+			if labels[i] < 0.5 {
+				bad += w
+			}
+		}
+		bin := Bin{
+			Lower:  scores[order[start]],
+			Upper:  scores[order[end-1]],
+			Count:  end - start,
+			weight: total,
+		}
+		if total > 0 {
+			bin.BadRate = bad / total
+		}
+		table.Bins = append(table.Bins, bin)
+		start = end
+	}
+
+	table.isotonic()
+	return table, nil
+}
+
+// CrossFitPD returns out-of-fold PDs: the rows are dealt into folds in
+// order, as in CrossFit, and each fold's PDs come from a table fitted on the
+// others, so no row is graded by a table it helped fit
+func CrossFitPD(scores, labels, weights []float64, bins, folds int) ([]float64, error) {
+	if folds < 2 || len(scores) < folds {
+		return nil, fmt.Errorf("cannot cross-fit %d scores in %d folds", len(scores), folds)
+	}
+	pds := make([]float64, len(scores))
+	for f := 0; f < folds; f++ {
+		var s, y, w []float64
+		for i := range scores {
+			if i%folds == f {
+				continue
+			}
+			s = append(s, scores[i])
+			y = append(y, labels[i])
+			if weights != nil {
+				w = append(w, weights[i])
+			}
+		}
+		table, err := Fit(s, y, w, bins)
+		if err != nil {
+			return nil, fmt.Errorf("error in fold %d: %v", f+1, err)
+		}
+		for i := f; i < len(scores); i += folds {
+			pds[i] = table.PD(scores[i])
+		}
+	}
+	return pds, nil
+}
+
+// isotonic sets each bin's PD by pooling adjacent bins whose bad rates
+// increase with the score, weighting each bin by its summed sample weight
+func (t *Table) isotonic() {
+	type block struct {
+		mean   float64
+		weight float64
+		bins   int
+	}
+
+	var blocks []block
+	for _, bin := range t.Bins {
+		blocks = append(blocks, block{mean: bin.BadRate, weight: bin.weight, bins: 1})
+		for len(blocks) > 1 {
+			last, prev := blocks[len(blocks)-1], blocks[len(blocks)-2]
+			if last.mean <= prev.mean {
+				break
+			}
+			weight := prev.weight + last.weight
+			mean := (prev.mean + last.mean) / 2
+			if weight > 0 {
+				mean = (prev.mean*prev.weight + last.mean*last.weight) / weight
+			}
+			blocks = blocks[:len(blocks)-2]
+			blocks = append(blocks, block{
+				mean:   mean,
+				weight: weight,
+				bins:   prev.bins + last.bins,
+			})
+		}
+	}
+
+	b := 0
+	for _, blk := range blocks {
+		for k := 0; k < blk.bins; k++ {
+			t.Bins[b].PD = blk.mean
+			b++
+		}
+	}
+}
+
+// PD returns the calibrated probability of default for a score. Scores
+// between bins take the PD of the bin above, and scores outside the table
+// the PD of the nearest end.
+func (t *Table) PD(score float64) float64 {
+	k := sort.Search(len(t.Bins), func(k int) bool {
+		return score <= t.Bins[k].Upper
+	})
+	if k == len(t.Bins) {
+		k--
+	}
+	return t.Bins[k].PD
+}
+
+// SaveCSV writes the table to a CSV file, gzip-compressed when the path ends
+// in .gz
+func (t *Table) SaveCSV(path string) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating calibration table: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Bin", "Score Lower", "Score Upper", "Count", "Observed Bad Rate", "PD"})
+	for k, bin := range t.Bins {
+		writer.Write([]string{
+			strconv.Itoa(k + 1),
+			strconv.FormatFloat(bin.Lower, 'f', 4, 64),
+			strconv.FormatFloat(bin.Upper, 'f', 4, 64),
+			strconv.Itoa(bin.Count),
+			strconv.FormatFloat(bin.BadRate, 'f', 4, 64),
+			strconv.FormatFloat(bin.PD, 'f', 4, 64),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing calibration table: %v", err)
+	}
+	return file.Close()
+}
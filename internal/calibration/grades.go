@@ -0,0 +1,134 @@
+package calibration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Grade is a risk band. A prediction gets the first grade whose MaxPD is at
+// or above its probability of default.
+type Grade struct {
+	Name  string  `json:"name"`
+	MaxPD float64 `json:"max_pd"`
+	// TargetBadRate is the bad rate the band is expected to show
+	TargetBadRate float64 `json:"target_bad_rate"`
+}
+
+// GradeScale is an ordered list of grades from best to worst
+type GradeScale struct {
+	Grades []Grade `json:"grades"`
+}
+
+// DefaultGradeScale returns five bands from A (lowest risk) to E
+func DefaultGradeScale() *GradeScale {
+	return &GradeScale{
+		Grades: []Grade{
+			{Name: "A", MaxPD: 0.05, TargetBadRate: 0.02},
+			{Name: "B", MaxPD: 0.15, TargetBadRate: 0.10},
+			{Name: "C", MaxPD: 0.30, TargetBadRate: 0.22},
+			{Name: "D", MaxPD: 0.50, TargetBadRate: 0.40},
+			{Name: "E", MaxPD: 1.00, TargetBadRate: 0.75},
+		},
+	}
+}
+
+// LoadGradeScale reads a grade scale from a JSON file
+func LoadGradeScale(path string) (*GradeScale, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading grade file: %v", err)
+	}
+
+	s := &GradeScale{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("error parsing grade file: %v", err)
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Validate checks that the grades are named, ordered by MaxPD and that the
+// last one covers every PD
+func (s *GradeScale) Validate() error {
+	if len(s.Grades) == 0 {
+		return fmt.Errorf("grade scale has no grades")
+	}
+
+	for i, g := range s.Grades {
+		if g.Name == "" {
+			return fmt.Errorf("grade %d has no name", i)
+		}
+		if i > 0 && g.MaxPD <= s.Grades[i-1].MaxPD {
+			return fmt.Errorf("grade %s must have a higher max PD than grade %s", g.Name, s.Grades[i-1].Name)
+		}
+		if g.TargetBadRate < 0 || g.TargetBadRate > 1 {
+			return fmt.Errorf("grade %s has target bad rate %.4f outside [0, 1]", g.Name, g.TargetBadRate)
+		}
+	}
+	if last := s.Grades[len(s.Grades)-1]; last.MaxPD < 1 {
+		return fmt.Errorf("last grade %s must cover PDs up to 1, got %.4f", last.Name, last.MaxPD)
+	}
+
+	return nil
+}
+
+// Assign returns the grade for a probability of default
+func (s *GradeScale) Assign(pd float64) string {
+	for _, g := range s.Grades {
+		if pd <= g.MaxPD {
+			return g.Name
+		}
+	}
+	return s.Grades[len(s.Grades)-1].Name
+}
+
+// BandSummary describes the predictions that fell in one grade
+type BandSummary struct {
+	Grade
+	Count int
+	// MeanPD is the average calibrated PD of the band's predictions and
+	// BadRate the observed share of bad outcomes, both weighted by the
+	// sample weights when there are any
+	MeanPD  float64
+	BadRate float64
+}
+
+// Summarize grades each PD and reports every band's size, mean PD and
+// observed bad rate against its target. Labels use 1 for the good outcome.
+// Rows are weighted by weights, or count once when it is nil.
+func (s *GradeScale) Summarize(pds, labels, weights []float64) []BandSummary {
+	bands := make([]BandSummary, len(s.Grades))
+	index := make(map[string]int, len(s.Grades))
+	for k, g := range s.Grades {
+		bands[k].Grade = g
+		index[g.Name] = k
+	}
+
+	total := make([]float64, len(bands))
+	for i, pd := range pds {
+		k := index[s.Assign(pd)]
+		w := 1.0
+		if weights != nil {
+			w = weights[i]
+		}
+		bands[k].Count++
+		bands[k].MeanPD += w * pd
+		if labels[i] < 0.5 {
+			bands[k].BadRate += w
+		}
+		total[k] += w
+	}
+
+	for k := range bands {
+		if total[k] > 0 {
+			bands[k].MeanPD /= total[k]
+			bands[k].BadRate /= total[k]
+		}
+	}
+	return bands
+}
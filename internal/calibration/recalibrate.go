@@ -0,0 +1,302 @@
+package calibration
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// Method selects how approval probabilities are recalibrated
+type Method int
+
+const (
+	PlattScaling Method = iota
+	IsotonicRegression
+)
+
+// String returns the name of the method
+func (m Method) String() string {
+	switch m {
+	case PlattScaling:
+		return "platt"
+	case IsotonicRegression:
+		return "isotonic"
+	}
+	return fmt.Sprintf("Method(%d)", int(m))
+}
+
+// ParseMethod parses "platt" or "isotonic"
+func ParseMethod(s string) (Method, error) {
+	switch s {
+	case "platt":
+		return PlattScaling, nil
+	case "isotonic":
+		return IsotonicRegression, nil
+	}
+	return 0, fmt.Errorf("unknown recalibration method %q (want platt or isotonic)", s)
+}
+
+// Recalibrator maps a model's approval probability to a calibrated one
+type Recalibrator interface {
+	Calibrate(score float64) float64
+}
+
+// FitRecalibrator fits a recalibrator of the given method to scores and
+// their 0/1 labels. Rows are weighted by weights, or count once when it is
+// nil.
+func FitRecalibrator(method Method, scores, labels, weights []float64) (Recalibrator, error) {
+	if len(scores) != len(labels) {
+		return nil, fmt.Errorf("got %d scores but %d labels", len(scores), len(labels))
+	}
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("no scores to recalibrate")
+	}
+	switch method {
+	case PlattScaling:
+		return FitPlatt(scores, labels, weights)
+	case IsotonicRegression:
+		return FitIsotonic(scores, labels, weights), nil
+	}
+	return nil, fmt.Errorf("unknown recalibration method %v", method)
+}
+
+// logitEpsilon keeps scores of exactly 0 or 1 at a finite log-odds
+const logitEpsilon = 1e-6
+
+// logit returns the log-odds of a probability clipped away from 0 and 1
+func logit(p float64) float64 {
+	p = math.Min(math.Max(p, logitEpsilon), 1-logitEpsilon)
+	return math.Log(p / (1 - p))
+}
+
+// Platt maps a score to 1 / (1 + exp(-(A*logit(score) + B)))
+type Platt struct {
+	A float64
+	B float64
+}
+
+// Calibrate returns the recalibrated probability of a score
+func (p *Platt) Calibrate(score float64) float64 {
+	return 1 / (1 + math.Exp(-(p.A*logit(score) + p.B)))
+}
+
+// FitPlatt fits a logistic regression of the labels on the log-odds of the
+// scores by Newton's method. As in Platt's paper, the targets are pulled
+// slightly away from 0 and 1 according to the class counts so that a
+// separable sample does not send the slope to infinity.
+func FitPlatt(scores, labels, weights []float64) (*Platt, error) {
+	pos, neg := 0.0, 0.0
+	for i, y := range labels {
+		if y >= 0.5 {
+			pos += models.WeightAt(weights, i)
+		} else {
+			neg += models.WeightAt(weights, i)
+		}
+	}
+	if pos == 0 || neg == 0 {
+		return nil, fmt.Errorf("platt scaling needs both classes")
+	}
+	hi, lo := (pos+1)/(pos+2), 1/(neg+2)
+
+	x := make([]float64, len(scores))
+	t := make([]float64, len(scores))
+	for i, s := range scores {
+		x[i] = logit(s)
+		t[i] = lo
+		if labels[i] >= 0.5 {
+			t[i] = hi
+		}
+	}
+
+	// The weighted log loss is convex in (A, B), so Newton's method with
+	// step halving converges from the identity map
+	p := &Platt{A: 1}
+	loss := plattLoss(p, x, t, weights)
+	for iter := 0; iter < 100; iter++ {
+		var gA, gB, hAA, hAB, hBB float64
+		for i := range x {
+			q := 1 / (1 + math.Exp(-(p.A*x[i] + p.B)))
+			w := models.WeightAt(weights, i)
+			d := w * (q - t[i])
+			gA += d * x[i]
+			gB += d
+			v := w * math.Max(q*(1-q), 1e-12)
+			hAA += v * x[i] * x[i]
+			hAB += v * x[i]
+			hBB += v
+		}
+		det := hAA*hBB - hAB*hAB
+		if math.Abs(gA)+math.Abs(gB) < 1e-9 || det <= 0 {
+			break
+		}
+		dA := (hBB*gA - hAB*gB) / det
+		dB := (hAA*gB - hAB*gA) / det
+
+		step := 1.0
+		for ; step > 1e-8; step /= 2 {
+			next := &Platt{A: p.A - step*dA, B: p.B - step*dB}
+			if l := plattLoss(next, x, t, weights); l <= loss {
+				p, loss = next, l
+				break
+			}
+		}
+		if step <= 1e-8 {
+			break
+		}
+	}
+	return p, nil
+}
+
+// plattLoss returns the weighted cross-entropy of the targets under p
+func plattLoss(p *Platt, x, t, weights []float64) float64 {
+	loss := 0.0
+	for i := range x {
+		z := p.A*x[i] + p.B
+		// log(1 + exp(z)) - t*z, computed without overflow
+		loss += models.WeightAt(weights, i) * (math.Max(z, 0) + math.Log1p(math.Exp(-math.Abs(z))) - t[i]*z)
+	}
+	return loss
+}
+
+// Isotonic maps a score to a calibrated probability that never decreases
+// with the score, interpolating linearly between the fitted points and
+// holding the end values outside them
+type Isotonic struct {
+	Scores []float64
+	Values []float64
+}
+
+// Calibrate returns the recalibrated probability of a score
+func (iso *Isotonic) Calibrate(score float64) float64 {
+	n := len(iso.Scores)
+	k := sort.SearchFloat64s(iso.Scores, score)
+	switch {
+	case k == 0:
+		return iso.Values[0]
+	case k == n:
+		return iso.Values[n-1]
+	}
+	lo, hi := iso.Scores[k-1], iso.Scores[k]
+	frac := (score - lo) / (hi - lo)
+	return iso.Values[k-1] + frac*(iso.Values[k]-iso.Values[k-1])
+}
+
+// FitIsotonic fits the positive rate as a non-decreasing function of the
+// score by pooling adjacent violators. Each pooled block becomes one point
+// at its mean score.
+func FitIsotonic(scores, labels, weights []float64) *Isotonic {
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return scores[order[a]] < scores[order[b]]
+	})
+
+	type block struct {
+		score  float64
+		rate   float64
+		weight float64
+	}
+	var blocks []block
+	for start := 0; start < len(order); {
+		// Tied scores enter as one block
+		end := start
+		cur := block{}
+		for end < len(order) && scores[order[end]] == scores[order[start]] {
+			i := order[end]
+			w := models.WeightAt(weights, i)
+			cur.score += w * scores[i]
+			if labels[i] >= 0.5 {
+				cur.rate += w
+			}
+			cur.weight += w
+			end++
+		}
+		start = end
+		if cur.weight == 0 {
+			continue
+		}
+		cur.score /= cur.weight
+		cur.rate /= cur.weight
+
+		blocks = append(blocks, cur)
+		for len(blocks) > 1 {
+			last, prev := blocks[len(blocks)-1], blocks[len(blocks)-2]
+			if last.rate > prev.rate {
+				break
+			}
+			weight := prev.weight + last.weight
+			blocks = blocks[:len(blocks)-2]
+			blocks = append(blocks, block{
+				score:  (prev.score*prev.weight + last.score*last.weight) / weight,
+				rate:   (prev.rate*prev.weight + last.rate*last.weight) / weight,
+				weight: weight,
+			})
+		}
+	}
+
+	iso := &Isotonic{}
+	for _, blk := range blocks {
+		iso.Scores = append(iso.Scores, blk.score)
+		iso.Values = append(iso.Values, blk.rate)
+	}
+	return iso
+}
+
+// CrossFit returns out-of-fold recalibrated scores: the rows are dealt
+// into folds in order, and each fold is recalibrated by a map fitted on the
+// others, so the result measures how the method does on unseen scores
+func CrossFit(method Method, scores, labels, weights []float64, folds int) ([]float64, error) {
+	if folds < 2 || len(scores) < folds {
+		return nil, fmt.Errorf("cannot cross-fit %d scores in %d folds", len(scores), folds)
+	}
+	out := make([]float64, len(scores))
+	for f := 0; f < folds; f++ {
+		var s, y, w []float64
+		for i := range scores {
+			if i%folds == f {
+				continue
+			}
+			s = append(s, scores[i])
+			y = append(y, labels[i])
+			if weights != nil {
+				w = append(w, weights[i])
+			}
+		}
+		r, err := FitRecalibrator(method, s, y, w)
+		if err != nil {
+			return nil, fmt.Errorf("error in fold %d: %v", f+1, err)
+		}
+		for i := f; i < len(scores); i += folds {
+			out[i] = r.Calibrate(scores[i])
+		}
+	}
+	return out, nil
+}
+
+// Calibrated wraps a classifier so that its predicted probabilities pass
+// through a recalibrator, for serving calibrated scores from any model
+type Calibrated struct {
+	models.Classifier
+	Recalibrator Recalibrator
+}
+
+// PredictProba returns the recalibrated probabilities of the wrapped model
+func (c *Calibrated) PredictProba(X *mat.Dense) []float64 {
+	probs := c.Classifier.PredictProba(X)
+	for i, p := range probs {
+		probs[i] = c.Recalibrator.Calibrate(p)
+	}
+	return probs
+}
+
+// HandlesMissing reports whether the wrapped model accepts missing values
+func (c *Calibrated) HandlesMissing() bool {
+	mh, ok := c.Classifier.(models.MissingValueHandler)
+	return ok && mh.HandlesMissing()
+}
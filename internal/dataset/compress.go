@@ -0,0 +1,125 @@
+package dataset
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// gzipMagic is the two-byte header that starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Open opens a file for reading. Encrypted and gzip content is decrypted
+// and decompressed transparently, whatever the file is named.
+func Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(file)
+	rc := &readCloser{Reader: br, file: file}
+	if magic, _ := br.Peek(len(encryptedMagic)); string(magic) == string(encryptedMagic) {
+		aead, _ := encryption()
+		if aead == nil {
+			file.Close()
+			return nil, fmt.Errorf("%s is encrypted; set %s or %s to read it", path, KeyEnv, KeyCommandEnv)
+		}
+		dr, err := newDecryptReader(br, aead)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error reading %s: %v", path, err)
+		}
+		br = bufio.NewReader(dr)
+		rc.Reader = br
+	}
+
+	magic, _ := br.Peek(len(gzipMagic))
+	if string(magic) != string(gzipMagic) {
+		return rc, nil
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error reading gzip header of %s: %v", path, err)
+	}
+	rc.Reader, rc.zr = zr, zr
+	return rc, nil
+}
+
+// Create creates a file for writing, gzip-compressing it when the path ends
+// in ".gz" and encrypting it when SetEncryption asked for encrypted writes.
+// Close must be called and its error checked, since it writes the end of
+// the compressed and encrypted streams.
+func Create(path string) (io.WriteCloser, error) {
+	aead, encrypt := encryption()
+	compress := strings.HasSuffix(path, ".gz")
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if !compress && !encrypt {
+		return file, nil
+	}
+
+	wc := &writeCloser{Writer: file, file: file}
+	if encrypt {
+		ew, err := newEncryptWriter(file, aead)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error encrypting %s: %v", path, err)
+		}
+		wc.Writer, wc.ew = ew, ew
+	}
+	if compress {
+		wc.zw = gzip.NewWriter(wc.Writer)
+		wc.Writer = wc.zw
+	}
+	return wc, nil
+}
+
+// readCloser closes the decompressor, if any, and the underlying file
+type readCloser struct {
+	io.Reader
+	file *os.File
+	zr   *gzip.Reader
+}
+
+// Close closes the reader
+func (r *readCloser) Close() error {
+	if r.zr != nil {
+		r.zr.Close()
+	}
+	return r.file.Close()
+}
+
+// writeCloser flushes the compressor and the encryptor, if any, before
+// closing the underlying file
+type writeCloser struct {
+	io.Writer
+	file *os.File
+	zw   *gzip.Writer
+	ew   *encryptWriter
+}
+
+// Close finishes the gzip and encrypted streams and closes the file
+func (w *writeCloser) Close() error {
+	var err error
+	if w.zw != nil {
+		err = w.zw.Close()
+	}
+	if w.ew != nil {
+		if eerr := w.ew.Close(); err == nil {
+			err = eerr
+		}
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,449 @@
+package dataset
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind is the storage type of a column
+type Kind int
+
+const (
+	Float Kind = iota
+	Int
+	String
+)
+
+// String returns the name of the column kind
+func (k Kind) String() string {
+	switch k {
+	case Float:
+		return "float"
+	case Int:
+		return "int"
+	case String:
+		return "string"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Column is a typed column with a null mask. Only the slice matching Kind
+// holds values; Null[i] marks a missing value at row i.
+type Column struct {
+	Name    string
+	Kind    Kind
+	Floats  []float64
+	Ints    []int
+	Strings []string
+	Null    []bool
+}
+
+// NewFloatColumn creates a float column. A nil null mask means no missing values.
+func NewFloatColumn(name string, vals []float64, null []bool) *Column {
+	return &Column{Name: name, Kind: Float, Floats: vals, Null: nullMask(null, len(vals))}
+}
+
+// NewIntColumn creates an int column. A nil null mask means no missing values.
+func NewIntColumn(name string, vals []int, null []bool) *Column {
+	return &Column{Name: name, Kind: Int, Ints: vals, Null: nullMask(null, len(vals))}
+}
+
+// NewStringColumn creates a string column. A nil null mask means no missing values.
+func NewStringColumn(name string, vals []string, null []bool) *Column {
+	return &Column{Name: name, Kind: String, Strings: vals, Null: nullMask(null, len(vals))}
+}
+
+// nullMask returns the given mask or an all-false mask of length n
+func nullMask(null []bool, n int) []bool {
+	if null != nil {
+		return null
+	}
+	return make([]bool, n)
+}
+
+// Len returns the number of rows in the column
+func (c *Column) Len() int {
+	return len(c.Null)
+}
+
+// IsNull reports whether the value at row i is missing
+func (c *Column) IsNull(i int) bool {
+	return c.Null[i]
+}
+
+// Float returns the value at row i as a float64. String values are parsed;
+// ok is false for missing or non-numeric values.
+func (c *Column) Float(i int) (float64, bool) {
+	if c.Null[i] {
+		return 0, false
+	}
+	switch c.Kind {
+	case Float:
+		return c.Floats[i], true
+	case Int:
+		return float64(c.Ints[i]), true
+	case String:
+		val, err := strconv.ParseFloat(c.Strings[i], 64)
+		if err != nil {
+			return 0, false
+		}
+		return val, true
+	}
+	return 0, false
+}
+
+// FloatValues converts the whole column to float64 in a single pass. valid[i]
+// is false where the value is missing or not numeric.
+func (c *Column) FloatValues() (vals []float64, valid []bool) {
+	vals = make([]float64, c.Len())
+	valid = make([]bool, c.Len())
+
+	switch c.Kind {
+	case Float:
+		copy(vals, c.Floats)
+		for i := range vals {
+			valid[i] = !c.Null[i]
+		}
+	default:
+		for i := range vals {
+			vals[i], valid[i] = c.Float(i)
+		}
+	}
+
+	return vals, valid
+}
+
+// String returns the value at row i formatted as text, or "" if missing
+func (c *Column) String(i int) string {
+	if c.Null[i] {
+		return ""
+	}
+	switch c.Kind {
+	case Float:
+		return strconv.FormatFloat(c.Floats[i], 'f', -1, 64)
+	case Int:
+		return strconv.Itoa(c.Ints[i])
+	case String:
+		return c.Strings[i]
+	}
+	return ""
+}
+
+// Subset returns a new column containing the given rows in order
+func (c *Column) Subset(rows []int) *Column {
+	out := &Column{Name: c.Name, Kind: c.Kind, Null: make([]bool, len(rows))}
+	switch c.Kind {
+	case Float:
+		out.Floats = make([]float64, len(rows))
+	case Int:
+		out.Ints = make([]int, len(rows))
+	case String:
+		out.Strings = make([]string, len(rows))
+	}
+
+	for j, i := range rows {
+		out.Null[j] = c.Null[i]
+		switch c.Kind {
+		case Float:
+			out.Floats[j] = c.Floats[i]
+		case Int:
+			out.Ints[j] = c.Ints[i]
+		case String:
+			out.Strings[j] = c.Strings[i]
+		}
+	}
+	return out
+}
+
+// Dataset is an ordered collection of equal-length named columns
+type Dataset struct {
+	cols  []*Column
+	index map[string]int
+}
+
+// New creates a dataset from the given columns
+func New(cols ...*Column) (*Dataset, error) {
+	ds := &Dataset{index: make(map[string]int)}
+	for _, col := range cols {
+		if err := ds.Set(col); err != nil {
+			return nil, err
+		}
+	}
+	return ds, nil
+}
+
+// FromRecords creates a dataset of string columns from raw records.
+// Every record is treated as data; names supplies the column names.
+func FromRecords(names []string, records [][]string) (*Dataset, error) {
+	cols := make([]*Column, len(names))
+	for j, name := range names {
+		cols[j] = NewStringColumn(name, make([]string, len(records)), nil)
+	}
+
+	for i, record := range records {
+		if len(record) != len(names) {
+			return nil, fmt.Errorf("record %d has %d fields, expected %d", i+1, len(record), len(names))
+		}
+		for j, val := range record {
+			cols[j].Strings[i] = val
+		}
+	}
+
+	return New(cols...)
+}
+
+// ReadCSV reads a CSV with a header row. Column kinds are inferred: a column
+// is Int if every non-empty value parses as an integer, Float if every
+// non-empty value parses as a number, and String otherwise. Empty fields are
+// stored as missing.
+func ReadCSV(r io.Reader) (*Dataset, error) {
+	return ReadCSVColumns(r, nil)
+}
+
+// ReadCSVColumns is like ReadCSV but only decodes the named columns, in the
+// order given. Fields of other columns are skipped as rows stream in, so
+// unused columns are never stored or parsed. A nil names slice selects every
+// column.
+func ReadCSVColumns(r io.Reader, names []string) (*Dataset, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %v", err)
+	}
+
+	position := make(map[string]int, len(header))
+	for j, name := range header {
+		position[name] = j
+	}
+
+	if names == nil {
+		names = append([]string(nil), header...)
+	}
+	fields := make([]int, len(names))
+	for k, name := range names {
+		j, ok := position[name]
+		if !ok {
+			return nil, fmt.Errorf("column %s not found", name)
+		}
+		fields[k] = j
+	}
+
+	raw := make([][]string, len(names))
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV: %v", err)
+		}
+		// Fields share one backing string per record; clone them so the
+		// skipped columns are not kept alive
+		for k, j := range fields {
+			raw[k] = append(raw[k], strings.Clone(strings.TrimSpace(record[j])))
+		}
+	}
+
+	cols := make([]*Column, len(names))
+	for k, name := range names {
+		null := make([]bool, len(raw[k]))
+		for i, val := range raw[k] {
+			null[i] = val == ""
+		}
+		cols[k] = inferColumn(name, raw[k], null)
+	}
+
+	return New(cols...)
+}
+
+// inferColumn converts raw strings into the narrowest column kind that fits
+func inferColumn(name string, raw []string, null []bool) *Column {
+	ints := make([]int, len(raw))
+	isInt := true
+	for i, s := range raw {
+		if null[i] {
+			continue
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			isInt = false
+			break
+		}
+		ints[i] = v
+	}
+	if isInt {
+		return NewIntColumn(name, ints, null)
+	}
+
+	floats := make([]float64, len(raw))
+	for i, s := range raw {
+		if null[i] {
+			continue
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return NewStringColumn(name, raw, null)
+		}
+		floats[i] = v
+	}
+	return NewFloatColumn(name, floats, null)
+}
+
+// Nrow returns the number of rows
+func (ds *Dataset) Nrow() int {
+	if len(ds.cols) == 0 {
+		return 0
+	}
+	return ds.cols[0].Len()
+}
+
+// Ncol returns the number of columns
+func (ds *Dataset) Ncol() int {
+	return len(ds.cols)
+}
+
+// Names returns the column names in order
+func (ds *Dataset) Names() []string {
+	names := make([]string, len(ds.cols))
+	for j, col := range ds.cols {
+		names[j] = col.Name
+	}
+	return names
+}
+
+// Col returns the named column
+func (ds *Dataset) Col(name string) (*Column, error) {
+	j, ok := ds.index[name]
+	if !ok {
+		return nil, fmt.Errorf("column %s not found", name)
+	}
+	return ds.cols[j], nil
+}
+
+// Columns returns the columns in order
+func (ds *Dataset) Columns() []*Column {
+	return ds.cols
+}
+
+// Set replaces the column with the same name, or appends it if it is new
+func (ds *Dataset) Set(col *Column) error {
+	if len(ds.cols) > 0 && col.Len() != ds.Nrow() {
+		return fmt.Errorf("column %s has %d rows, expected %d", col.Name, col.Len(), ds.Nrow())
+	}
+	if j, ok := ds.index[col.Name]; ok {
+		ds.cols[j] = col
+		return nil
+	}
+	ds.index[col.Name] = len(ds.cols)
+	ds.cols = append(ds.cols, col)
+	return nil
+}
+
+// Drop removes the named column
+func (ds *Dataset) Drop(name string) error {
+	j, ok := ds.index[name]
+	if !ok {
+		return fmt.Errorf("column %s not found", name)
+	}
+	ds.cols = append(ds.cols[:j], ds.cols[j+1:]...)
+	delete(ds.index, name)
+	for k := j; k < len(ds.cols); k++ {
+		ds.index[ds.cols[k].Name] = k
+	}
+	return nil
+}
+
+// Subset returns a new dataset containing the given rows in order
+func (ds *Dataset) Subset(rows []int) *Dataset {
+	out := &Dataset{index: make(map[string]int, len(ds.cols))}
+	for _, col := range ds.cols {
+		out.index[col.Name] = len(out.cols)
+		out.cols = append(out.cols, col.Subset(rows))
+	}
+	return out
+}
+
+// WriteCSV streams the dataset as CSV with a header row. Values are
+// formatted straight from their typed storage into a reused buffer, so no
+// per-row string slices are built. Missing values are written as empty fields.
+func (ds *Dataset) WriteCSV(w io.Writer) error {
+	bw := bufio.NewWriterSize(w, 64*1024)
+
+	var buf []byte
+	for j, col := range ds.cols {
+		if j > 0 {
+			buf = append(buf, ',')
+		}
+		buf = appendCSVField(buf, col.Name)
+	}
+	buf = append(buf, '\n')
+	if _, err := bw.Write(buf); err != nil {
+		return fmt.Errorf("error writing header: %v", err)
+	}
+
+	for i := 0; i < ds.Nrow(); i++ {
+		buf = buf[:0]
+		for j, col := range ds.cols {
+			if j > 0 {
+				buf = append(buf, ',')
+			}
+			if col.Null[i] {
+				continue
+			}
+			switch col.Kind {
+			case Float:
+				buf = strconv.AppendFloat(buf, col.Floats[i], 'f', -1, 64)
+			case Int:
+				buf = strconv.AppendInt(buf, int64(col.Ints[i]), 10)
+			case String:
+				buf = appendCSVField(buf, col.Strings[i])
+			}
+		}
+		buf = append(buf, '\n')
+		if _, err := bw.Write(buf); err != nil {
+			return fmt.Errorf("error writing row: %v", err)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// appendCSVField appends a string field, quoting it with the same rules as
+// encoding/csv when it contains separators, quotes, newlines or leading space
+func appendCSVField(buf []byte, field string) []byte {
+	if !fieldNeedsQuotes(field) {
+		return append(buf, field...)
+	}
+
+	buf = append(buf, '"')
+	for i := 0; i < len(field); i++ {
+		if field[i] == '"' {
+			buf = append(buf, '"')
+		}
+		buf = append(buf, field[i])
+	}
+	return append(buf, '"')
+}
+
+// fieldNeedsQuotes reports whether a field must be quoted in CSV output
+func fieldNeedsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	if field == `\.` || strings.ContainsAny(field, ",\"\r\n") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r)
+}
@@ -0,0 +1,248 @@
+package dataset
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Environment variables the artifact key is read from
+const (
+	// KeyEnv holds the base64-encoded AES key itself
+	KeyEnv = "CCAP_ARTIFACT_KEY"
+	// KeyCommandEnv holds a command that prints the base64-encoded key, such
+	// as a KMS CLI call that decrypts a wrapped data key, so the key never
+	// has to be stored in the environment
+	KeyCommandEnv = "CCAP_ARTIFACT_KEY_COMMAND"
+)
+
+// encryptedMagic starts every encrypted file and is authenticated with
+// each segment
+var encryptedMagic = []byte("CCAPENC1")
+
+// Encrypted files are sealed in segments of segmentSize plaintext bytes,
+// each with its own nonce: the file's random nonce prefix, the segment
+// number and a flag marking the last segment. Reordering, dropping or
+// truncating segments therefore fails authentication.
+const (
+	segmentSize = 64 * 1024
+	prefixSize  = 7
+)
+
+var (
+	keyMu         sync.RWMutex
+	artifactAEAD  cipher.AEAD
+	encryptWrites bool
+)
+
+// LoadKey reads the artifact key from KeyEnv, or from the output of the
+// command in KeyCommandEnv. It returns nil, with no error, when neither is
+// set.
+func LoadKey() ([]byte, error) {
+	encoded := os.Getenv(KeyEnv)
+	if command := strings.Fields(os.Getenv(KeyCommandEnv)); encoded == "" && len(command) > 0 {
+		var stderr bytes.Buffer
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("error running %s: %v: %s", KeyCommandEnv, err, strings.TrimSpace(stderr.String()))
+		}
+		encoded = string(out)
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding artifact key: %v", err)
+	}
+	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+		return nil, fmt.Errorf("artifact key must be 16, 24 or 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// SetEncryption sets the AES key Open decrypts encrypted files with, and
+// whether Create encrypts the files it writes. A nil key turns both off.
+func SetEncryption(key []byte, encrypt bool) error {
+	if key == nil {
+		if encrypt {
+			return fmt.Errorf("encrypting artifacts needs a key")
+		}
+		keyMu.Lock()
+		artifactAEAD, encryptWrites = nil, false
+		keyMu.Unlock()
+		return nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("error creating cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("error creating cipher: %v", err)
+	}
+	keyMu.Lock()
+	artifactAEAD, encryptWrites = aead, encrypt
+	keyMu.Unlock()
+	return nil
+}
+
+// encryption returns the configured cipher and whether writes are encrypted
+func encryption() (cipher.AEAD, bool) {
+	keyMu.RLock()
+	defer keyMu.RUnlock()
+	return artifactAEAD, encryptWrites
+}
+
+// segmentNonce returns the nonce of segment n
+func segmentNonce(prefix []byte, n uint32, last bool) []byte {
+	nonce := make([]byte, prefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], n)
+	if last {
+		nonce[prefixSize+4] = 1
+	}
+	return nonce
+}
+
+// encryptWriter seals what is written to it segment by segment. A segment
+// is only sealed once more data follows it, so the last one, sealed by
+// Close, is always marked as such.
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	n      uint32
+	buf    []byte
+	closed bool
+}
+
+// newEncryptWriter writes the header of an encrypted file to w
+func newEncryptWriter(w io.Writer, aead cipher.AEAD) (*encryptWriter, error) {
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %v", err)
+	}
+	if _, err := w.Write(append(append([]byte(nil), encryptedMagic...), prefix...)); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, segmentSize)}, nil
+}
+
+// Write buffers p, sealing every full segment that more data follows
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if len(e.buf) == segmentSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		k := copy(e.buf[len(e.buf):segmentSize], p)
+		e.buf = e.buf[:len(e.buf)+k]
+		p = p[k:]
+		written += k
+	}
+	return written, nil
+}
+
+// seal writes the buffered segment
+func (e *encryptWriter) seal(last bool) error {
+	if e.n == ^uint32(0) {
+		return fmt.Errorf("encrypted file is too large")
+	}
+	sealed := e.aead.Seal(nil, segmentNonce(e.prefix, e.n, last), e.buf, encryptedMagic)
+	e.n++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// Close seals the last segment once; it does not close the underlying
+// writer
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.seal(true)
+}
+
+// decryptReader opens the segments of an encrypted file as they are read
+type decryptReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	n      uint32
+	// next holds the first byte of the following segment, read ahead to
+	// tell whether the current one is the last
+	next  []byte
+	plain []byte
+	done  bool
+}
+
+// newDecryptReader reads the header of an encrypted file from r
+func newDecryptReader(r io.Reader, aead cipher.AEAD) (*decryptReader, error) {
+	header := make([]byte, len(encryptedMagic)+prefixSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("error reading encryption header: %v", err)
+	}
+	return &decryptReader{r: r, aead: aead, prefix: header[len(encryptedMagic):]}, nil
+}
+
+// Read returns decrypted bytes, opening the next segment when needed
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	k := copy(p, d.plain)
+	d.plain = d.plain[k:]
+	return k, nil
+}
+
+// open reads and authenticates the next segment
+func (d *decryptReader) open() error {
+	sealedSize := segmentSize + d.aead.Overhead()
+	segment := make([]byte, sealedSize+1)
+	k := copy(segment, d.next)
+	m, err := io.ReadFull(d.r, segment[k:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	segment = segment[:k+m]
+
+	// A segment is the last one when nothing follows it
+	last := len(segment) <= sealedSize
+	d.next = nil
+	if !last {
+		d.next = segment[sealedSize:]
+		segment = segment[:sealedSize]
+	}
+
+	plain, err := d.aead.Open(nil, segmentNonce(d.prefix, d.n, last), segment, encryptedMagic)
+	if err != nil {
+		return fmt.Errorf("encrypted file is corrupt, truncated or was written with another key")
+	}
+	d.n++
+	d.plain = plain
+	d.done = last
+	return nil
+}
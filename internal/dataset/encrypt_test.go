@@ -0,0 +1,134 @@
+package dataset
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useKey turns on encrypted writes with a random key for the test
+func useKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetEncryption(key, true); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetEncryption(nil, false) })
+	return key
+}
+
+// writeEncrypted writes data to a new encrypted file and returns its path
+func writeEncrypted(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "artifact.csv")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readAll opens path and reads it to the end
+func readAll(path string) ([]byte, error) {
+	r, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	useKey(t)
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 2*segmentSize + 100} {
+		data := make([]byte, size)
+		rand.Read(data)
+		path := writeEncrypted(t, data)
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(raw, encryptedMagic) {
+			t.Fatalf("size %d: file does not start with %q", size, encryptedMagic)
+		}
+		if size > 0 && bytes.Contains(raw, data) {
+			t.Fatalf("size %d: file holds the plaintext", size)
+		}
+
+		got, err := readAll(path)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("size %d: read %d bytes that differ from the %d written", size, len(got), len(data))
+		}
+	}
+}
+
+func TestEncryptRejectsTruncationAtSegmentBoundary(t *testing.T) {
+	useKey(t)
+	data := make([]byte, 2*segmentSize+10)
+	rand.Read(data)
+	path := writeEncrypted(t, data)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealedSize := segmentSize + 16
+	header := len(encryptedMagic) + prefixSize
+	for _, segments := range []int{1, 2} {
+		if err := os.WriteFile(path, raw[:header+segments*sealedSize], 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readAll(path); err == nil {
+			t.Fatalf("file cut after %d full segments was read without error", segments)
+		}
+	}
+}
+
+func TestEncryptRejectsFlippedByte(t *testing.T) {
+	useKey(t)
+	data := make([]byte, segmentSize+10)
+	rand.Read(data)
+	path := writeEncrypted(t, data)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := len(encryptedMagic) + prefixSize
+	for _, at := range []int{header, header + segmentSize, len(raw) - 1} {
+		tampered := append([]byte(nil), raw...)
+		tampered[at] ^= 0x01
+		if err := os.WriteFile(path, tampered, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readAll(path); err == nil {
+			t.Fatalf("file with byte %d flipped was read without error", at)
+		}
+	}
+}
+
+func TestEncryptRejectsWrongKey(t *testing.T) {
+	useKey(t)
+	path := writeEncrypted(t, []byte("A1,A2\nb,30.83\n"))
+
+	useKey(t)
+	if _, err := readAll(path); err == nil {
+		t.Fatal("file was read with the wrong key")
+	}
+}
@@ -0,0 +1,123 @@
+package evaluation
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// PrintAmountResult prints the test errors of the amount model next to
+// those of predicting the mean training amount
+func PrintAmountResult(result *models.AmountResult) {
+	fmt.Printf("\nAmount Model (%d approved training applications):\n", result.TrainRows)
+	fmt.Println("=========================")
+	fmt.Printf("%-28s %-8s %-14s %-14s %-8s\n", "Model", "Rows", "RMSE", "MAE", "R2")
+	fmt.Println("--------------------------------------------------------------------------")
+	for _, row := range amountRows(result) {
+		fmt.Printf("%-28s %-8d %-14.4f %-14.4f %-8.4f\n", row.name, row.metrics.Rows, row.metrics.RMSE, row.metrics.MAE, row.metrics.R2)
+	}
+	if result.Lower != nil {
+		fmt.Printf("%.0f%% prediction intervals: %.4f of %d approved test amounts covered, mean width %.4f\n",
+			100*result.Coverage, result.Interval.Coverage, result.Interval.Rows, result.Interval.Width)
+	}
+}
+
+// SaveAmountResult writes the test errors of the amount model and of the
+// mean baseline to a CSV file, gzip-compressed when the path ends in .gz. A
+// model with prediction intervals adds their nominal and actual coverage
+// and mean width.
+func SaveAmountResult(path string, result *models.AmountResult) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating amount model file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	header := []string{"Model", "Train Rows", "Test Rows", "RMSE", "MAE", "R2"}
+	if result.Lower != nil {
+		header = append(header, "Nominal Coverage", "Coverage", "Mean Width")
+	}
+	writer.Write(header)
+	for k, row := range amountRows(result) {
+		record := []string{
+			row.name,
+			strconv.Itoa(result.TrainRows),
+			strconv.Itoa(row.metrics.Rows),
+			strconv.FormatFloat(row.metrics.RMSE, 'f', 4, 64),
+			strconv.FormatFloat(row.metrics.MAE, 'f', 4, 64),
+			strconv.FormatFloat(row.metrics.R2, 'f', 4, 64),
+		}
+		// Only the model has intervals, not the mean baseline
+		if result.Lower != nil && k == 0 {
+			record = append(record,
+				strconv.FormatFloat(result.Coverage, 'f', 4, 64),
+				strconv.FormatFloat(result.Interval.Coverage, 'f', 4, 64),
+				strconv.FormatFloat(result.Interval.Width, 'f', 4, 64),
+			)
+		} else if result.Lower != nil {
+			record = append(record, "", "", "")
+		}
+		writer.Write(record)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing amount model: %v", err)
+	}
+	return file.Close()
+}
+
+// SaveAmountIntervals writes the predicted amount and prediction interval of
+// every test application, with its actual amount when it was approved with
+// one, to a CSV file, gzip-compressed when the path ends in .gz
+func SaveAmountIntervals(path string, result *models.AmountResult) error {
+	if result.Lower == nil {
+		return fmt.Errorf("%s has no prediction intervals", result.ModelName)
+	}
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating amount intervals file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Row", "Actual", "Predicted", "Lower", "Upper"})
+	for i, predicted := range result.Predictions {
+		actual := ""
+		if !math.IsNaN(result.Actual[i]) {
+			actual = strconv.FormatFloat(result.Actual[i], 'f', 4, 64)
+		}
+		writer.Write([]string{
+			strconv.Itoa(i),
+			actual,
+			strconv.FormatFloat(predicted, 'f', 4, 64),
+			strconv.FormatFloat(result.Lower[i], 'f', 4, 64),
+			strconv.FormatFloat(result.Upper[i], 'f', 4, 64),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing amount intervals: %v", err)
+	}
+	return file.Close()
+}
+
+// amountRow is one line of the amount model output
+type amountRow struct {
+	name    string
+	metrics models.RegressionMetrics
+}
+
+// amountRows returns the amount model's errors and the mean baseline's
+func amountRows(result *models.AmountResult) []amountRow {
+	return []amountRow{
+		{result.ModelName, result.Metrics},
+		{"Mean amount", result.Baseline},
+	}
+}
@@ -0,0 +1,173 @@
+package evaluation
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// classNames labels the binary confusion matrix classes in reports
+var classNames = map[string]string{
+	"0": "Rejected",
+	"1": "Approved",
+}
+
+// ClassMetrics is the precision, recall and F1 score of one class, or an
+// average over the classes
+type ClassMetrics struct {
+	Class     string
+	Precision float64
+	Recall    float64
+	F1Score   float64
+	// Support is the summed sample weight of the rows actually in the
+	// class, or in all classes for an average
+	Support float64
+}
+
+// ClassificationReport breaks a model's test results down by class, like
+// scikit-learn's classification_report
+type ClassificationReport struct {
+	ModelName string
+	Classes   []ClassMetrics
+	Accuracy  float64
+	// MacroAvg averages the classes equally, WeightedAvg by their support
+	MacroAvg    ClassMetrics
+	WeightedAvg ClassMetrics
+}
+
+// NewClassificationReport computes the per-class metrics of a result from
+// its confusion matrix, treating each class in turn as the positive one
+func NewClassificationReport(result *models.ModelResult) *ClassificationReport {
+	classes := result.ClassOrder()
+
+	report := &ClassificationReport{ModelName: result.ModelName}
+	var correct, total float64
+	for _, class := range classes {
+		var truePos, predicted, actual float64
+		for _, a := range classes {
+			for _, p := range classes {
+				count := result.ConfMatrix[a][p]
+				if a == class {
+					actual += count
+				}
+				if p == class {
+					predicted += count
+				}
+				if a == class && p == class {
+					truePos = count
+				}
+			}
+		}
+
+		m := ClassMetrics{Class: class, Support: actual}
+		if result.Classes == nil {
+			m.Class = className(class)
+		}
+		if predicted > 0 {
+			m.Precision = truePos / predicted
+		}
+		if actual > 0 {
+			m.Recall = truePos / actual
+		}
+		if m.Precision+m.Recall > 0 {
+			m.F1Score = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+		}
+		report.Classes = append(report.Classes, m)
+		correct += truePos
+		total += actual
+	}
+	if total > 0 {
+		report.Accuracy = correct / total
+	}
+
+	report.MacroAvg = ClassMetrics{Class: "macro avg", Support: total}
+	report.WeightedAvg = ClassMetrics{Class: "weighted avg", Support: total}
+	n := float64(len(report.Classes))
+	for _, m := range report.Classes {
+		report.MacroAvg.Precision += m.Precision / n
+		report.MacroAvg.Recall += m.Recall / n
+		report.MacroAvg.F1Score += m.F1Score / n
+		if total > 0 {
+			share := m.Support / total
+			report.WeightedAvg.Precision += share * m.Precision
+			report.WeightedAvg.Recall += share * m.Recall
+			report.WeightedAvg.F1Score += share * m.F1Score
+		}
+	}
+	return report
+}
+
+// className returns the display name of a class
+func className(class string) string {
+	if name, ok := classNames[class]; ok {
+		return name
+	}
+	return class
+}
+
+// formatSupport prints a support as a whole number unless sample weights
+// made it fractional
+func formatSupport(support float64) string {
+	return strconv.FormatFloat(support, 'f', -1, 64)
+}
+
+// Print prints the report in the layout of scikit-learn's
+// classification_report
+func (r *ClassificationReport) Print() {
+	fmt.Printf("\nClassification Report (%s):\n", r.ModelName)
+	fmt.Println("=========================")
+	fmt.Printf("%-14s %10s %10s %10s %10s\n", "", "precision", "recall", "f1-score", "support")
+	fmt.Println()
+	for _, m := range r.Classes {
+		fmt.Printf("%-14s %10.4f %10.4f %10.4f %10s\n", m.Class, m.Precision, m.Recall, m.F1Score, formatSupport(m.Support))
+	}
+	fmt.Println()
+	fmt.Printf("%-14s %10s %10s %10.4f %10s\n", "accuracy", "", "", r.Accuracy, formatSupport(r.MacroAvg.Support))
+	for _, m := range []ClassMetrics{r.MacroAvg, r.WeightedAvg} {
+		fmt.Printf("%-14s %10.4f %10.4f %10.4f %10s\n", m.Class, m.Precision, m.Recall, m.F1Score, formatSupport(m.Support))
+	}
+}
+
+// SaveClassificationReports writes the per-class metrics of every model to
+// a CSV file, gzip-compressed when the path ends in .gz. Each model gets a
+// row per class, then its accuracy and its macro and weighted averages.
+func (me *ModelEvaluation) SaveClassificationReports(path string) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating classification report file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Model", "Class", "Precision", "Recall", "F1 Score", "Support"})
+	for _, name := range me.names() {
+		report := NewClassificationReport(me.Results[name])
+		for _, m := range report.Classes {
+			writer.Write(classMetricsFields(name, m))
+		}
+		writer.Write([]string{name, "accuracy", "", "", strconv.FormatFloat(report.Accuracy, 'f', 4, 64), formatSupport(report.MacroAvg.Support)})
+		writer.Write(classMetricsFields(name, report.MacroAvg))
+		writer.Write(classMetricsFields(name, report.WeightedAvg))
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing classification reports: %v", err)
+	}
+	return file.Close()
+}
+
+// classMetricsFields formats one row of the classification report CSV
+func classMetricsFields(model string, m ClassMetrics) []string {
+	return []string{
+		model,
+		m.Class,
+		strconv.FormatFloat(m.Precision, 'f', 4, 64),
+		strconv.FormatFloat(m.Recall, 'f', 4, 64),
+		strconv.FormatFloat(m.F1Score, 'f', 4, 64),
+		formatSupport(m.Support),
+	}
+}
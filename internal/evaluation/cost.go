@@ -0,0 +1,54 @@
+package evaluation
+
+import (
+	"fmt"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// CostMatrix holds the cost of each kind of wrong decision, in any one
+// monetary unit. Correct decisions cost nothing.
+type CostMatrix struct {
+	// FalseApproval is the cost of approving an application that should
+	// have been rejected, such as the expected credit loss
+	FalseApproval float64
+	// FalseRejection is the cost of rejecting an application that should
+	// have been approved, such as the forgone margin
+	FalseRejection float64
+}
+
+// Validate checks that the costs are non-negative and not both zero
+func (c CostMatrix) Validate() error {
+	if c.FalseApproval < 0 || c.FalseRejection < 0 {
+		return fmt.Errorf("misclassification costs must be non-negative, got %g and %g", c.FalseApproval, c.FalseRejection)
+	}
+	if c.FalseApproval == 0 && c.FalseRejection == 0 {
+		return fmt.Errorf("at least one misclassification cost must be positive")
+	}
+	return nil
+}
+
+// ExpectedCost returns a model's mean cost per test application at its 0.5
+// threshold, from its confusion matrix, so rows count by their sample
+// weight
+func (c CostMatrix) ExpectedCost(result *models.ModelResult) float64 {
+	total := 0.0
+	for _, row := range result.ConfMatrix {
+		for _, w := range row {
+			total += w
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	falseApprovals := result.ConfMatrix["0"]["1"]
+	falseRejections := result.ConfMatrix["1"]["0"]
+	return (c.FalseApproval*falseApprovals + c.FalseRejection*falseRejections) / total
+}
+
+// BreakEvenThreshold is the approval cutoff that minimizes expected cost
+// for calibrated probabilities: approving pays off once the chance of a
+// good outcome exceeds FalseApproval / (FalseApproval + FalseRejection)
+func (c CostMatrix) BreakEvenThreshold() float64 {
+	return c.FalseApproval / (c.FalseApproval + c.FalseRejection)
+}
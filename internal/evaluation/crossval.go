@@ -0,0 +1,108 @@
+package evaluation
+
+import (
+	"fmt"
+
+	"gonum.org/v1/gonum/stat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// CrossValidate trains a fresh model of the given type on k-1 folds of data
+// and scores it on the remaining fold, k times, and returns the mean and
+// sample standard deviation of each metric. Randomized models are seeded
+// with seed, or randomly when it is zero. Folds are stratified: rows of
+// each class are dealt round-robin in their existing order, which the
+// train/test split has already shuffled.
+func CrossValidate(modelType models.ModelType, data *models.FeatureMatrix, k int, seed uint64) (*models.CrossValidationResult, error) {
+	if k < 2 {
+		return nil, fmt.Errorf("cross-validation needs at least 2 folds, got %d", k)
+	}
+	if len(data.Y) < k {
+		return nil, fmt.Errorf("cannot split %d rows into %d folds", len(data.Y), k)
+	}
+
+	fold := stratifiedFolds(data.Y, k)
+	var accuracy, precision, recall, f1 []float64
+	for f := 0; f < k; f++ {
+		var trainRows, testRows []int
+		for i := range fold {
+			if fold[i] == f {
+				testRows = append(testRows, i)
+			} else {
+				trainRows = append(trainRows, i)
+			}
+		}
+
+		result, err := models.TrainModel(data.Subset(trainRows), data.Subset(testRows), modelType, seed)
+		if err != nil {
+			return nil, fmt.Errorf("error in fold %d: %v", f+1, err)
+		}
+		accuracy = append(accuracy, result.Accuracy)
+		precision = append(precision, result.Precision)
+		recall = append(recall, result.Recall)
+		f1 = append(f1, result.F1Score)
+	}
+
+	return &models.CrossValidationResult{
+		Folds:     k,
+		Accuracy:  summarize(accuracy),
+		Precision: summarize(precision),
+		Recall:    summarize(recall),
+		F1Score:   summarize(f1),
+	}, nil
+}
+
+// OutOfFoldScores trains a fresh model of the given type on k-1 folds of
+// data and scores the remaining fold, k times, so every row gets a score
+// from a model that never saw it. The folds and seeding are those of
+// CrossValidate.
+func OutOfFoldScores(modelType models.ModelType, data *models.FeatureMatrix, k int, seed uint64) ([]float64, error) {
+	if k < 2 {
+		return nil, fmt.Errorf("out-of-fold scoring needs at least 2 folds, got %d", k)
+	}
+	if len(data.Y) < k {
+		return nil, fmt.Errorf("cannot split %d rows into %d folds", len(data.Y), k)
+	}
+
+	fold := stratifiedFolds(data.Y, k)
+	scores := make([]float64, len(data.Y))
+	for f := 0; f < k; f++ {
+		var trainRows, testRows []int
+		for i := range fold {
+			if fold[i] == f {
+				testRows = append(testRows, i)
+			} else {
+				trainRows = append(trainRows, i)
+			}
+		}
+
+		result, err := models.TrainModel(data.Subset(trainRows), data.Subset(testRows), modelType, seed)
+		if err != nil {
+			return nil, fmt.Errorf("error in fold %d: %v", f+1, err)
+		}
+		for j, i := range testRows {
+			scores[i] = result.Probabilities[j]
+		}
+	}
+	return scores, nil
+}
+
+// stratifiedFolds deals the rows of each class round-robin into k folds,
+// in their existing order
+func stratifiedFolds(labels []float64, k int) []int {
+	fold := make([]int, len(labels))
+	next := map[bool]int{}
+	for i, y := range labels {
+		positive := y >= 0.5
+		fold[i] = next[positive] % k
+		next[positive]++
+	}
+	return fold
+}
+
+// summarize returns the mean and sample standard deviation of the values
+func summarize(values []float64) models.MetricSummary {
+	mean, std := stat.MeanStdDev(values, nil)
+	return models.MetricSummary{Mean: mean, Std: std}
+}
@@ -4,14 +4,28 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/calibration"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
 	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/policy"
 )
 
 // ModelEvaluation contains evaluation metrics for all models
 type ModelEvaluation struct {
 	Results map[string]*models.ModelResult
+	// Costs, when set, adds each model's expected misclassification cost
+	// to the results
+	Costs *CostMatrix
+	// SelectByCost makes GetBestModel pick the lowest expected cost rather
+	// than the highest F1 score. It has no effect without Costs.
+	SelectByCost bool
+	// Title heads the printed results; empty means "Model Evaluation
+	// Results"
+	Title string
 }
 
 // NewModelEvaluation creates a new ModelEvaluation instance
@@ -26,53 +40,111 @@ func (me *ModelEvaluation) AddResult(result *models.ModelResult) {
 	me.Results[result.ModelName] = result
 }
 
-// GetBestModel returns the name of the best performing model based on F1 score
+// names returns the model names in sorted order, so output and ties do
+// not depend on map iteration
+func (me *ModelEvaluation) names() []string {
+	names := make([]string, 0, len(me.Results))
+	for name := range me.Results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetBestModel returns the name of the best performing model based on F1
+// score, or on expected cost with SelectByCost, taking the first name in
+// sorted order on ties
 func (me *ModelEvaluation) GetBestModel() string {
-	bestScore := -1.0
-	bestModel := ""
+	if ranked := me.Ranking(); len(ranked) > 0 {
+		return ranked[0]
+	}
+	return ""
+}
 
-	for name, result := range me.Results {
-		if result.F1Score > bestScore {
-			bestScore = result.F1Score
-			bestModel = name
+// Ranking returns the model names from best to worst by the selection
+// criterion GetBestModel uses, in sorted order on ties
+func (me *ModelEvaluation) Ranking() []string {
+	names := me.names()
+	sort.SliceStable(names, func(a, b int) bool {
+		ra, rb := me.Results[names[a]], me.Results[names[b]]
+		if me.SelectByCost && me.Costs != nil {
+			return me.Costs.ExpectedCost(ra) < me.Costs.ExpectedCost(rb)
 		}
-	}
+		return ra.F1Score > rb.F1Score
+	})
+	return names
+}
 
-	return bestModel
+// selectionCriterion names what GetBestModel ranks by
+func (me *ModelEvaluation) selectionCriterion() string {
+	if me.SelectByCost && me.Costs != nil {
+		return "Expected Cost"
+	}
+	return "F1 Score"
 }
 
 // PrintResults prints the evaluation results to the console
 func (me *ModelEvaluation) PrintResults() {
-	fmt.Println("\nModel Evaluation Results:")
+	title := me.Title
+	if title == "" {
+		title = "Model Evaluation Results"
+	}
+	fmt.Printf("\n%s:\n", title)
 	fmt.Println("=========================")
 
 	// Print header
-	fmt.Printf("%-20s %-10s %-10s %-10s %-10s\n", "Model", "Accuracy", "Precision", "Recall", "F1 Score")
-	fmt.Println("------------------------------------------------------------")
+	width := me.nameWidth()
+	header := fmt.Sprintf("%-*s %-10s %-10s %-10s %-10s %-10s %-10s %-10s", width, "Model", "Accuracy", "Precision", "Recall", "F1 Score", "AUC", "Avg Prec", "Brier")
+	rule := strings.Repeat("-", width+73)
+	if me.Costs != nil {
+		header += fmt.Sprintf(" %-10s", "Exp Cost")
+		rule += "-----------"
+	}
+	fmt.Println(header)
+	fmt.Println(rule)
 
 	// Print results for each model
-	for name, result := range me.Results {
-		fmt.Printf("%-20s %-10.4f %-10.4f %-10.4f %-10.4f\n",
-			name, result.Accuracy, result.Precision, result.Recall, result.F1Score)
+	for _, name := range me.names() {
+		me.printResult(name, width)
 	}
 
 	// Print best model
 	bestModel := me.GetBestModel()
 	if bestModel != "" {
-		fmt.Println("\nBest Model (by F1 Score):")
-		fmt.Printf("%-20s %-10.4f %-10.4f %-10.4f %-10.4f\n",
-			bestModel,
-			me.Results[bestModel].Accuracy,
-			me.Results[bestModel].Precision,
-			me.Results[bestModel].Recall,
-			me.Results[bestModel].F1Score)
+		fmt.Printf("\nBest Model (by %s):\n", me.selectionCriterion())
+		me.printResult(bestModel, width)
+	}
+}
+
+// nameWidth returns the width of the model column: at least 20, and enough
+// for the longest model name
+func (me *ModelEvaluation) nameWidth() int {
+	width := 20
+	for name := range me.Results {
+		if len(name) > width {
+			width = len(name)
+		}
 	}
+	return width
 }
 
-// SaveResultsToCSV saves the evaluation results to a CSV file
+// printResult prints one row of the results table with the model column
+// width characters wide
+func (me *ModelEvaluation) printResult(name string, width int) {
+	result := me.Results[name]
+	line := fmt.Sprintf("%-*s %-10.4f %-10.4f %-10.4f %-10.4f %-10.4f %-10.4f %-10.4f",
+		width, name, result.Accuracy, result.Precision, result.Recall, result.F1Score, result.AUC, result.AveragePrecision, result.Brier)
+	if me.Costs != nil {
+		line += fmt.Sprintf(" %-10.4f", me.Costs.ExpectedCost(result))
+	}
+	fmt.Println(line)
+}
+
+// SaveResultsToCSV saves the evaluation results to a CSV file, gzip-compressed
+// when the path ends in .gz
 func (me *ModelEvaluation) SaveResultsToCSV(outputPath string) error {
 	// Create output file
-	file, err := os.Create(outputPath)
+	file, err := dataset.Create(outputPath)
 	if err != nil {
 		return fmt.Errorf("error creating output file: %v", err)
 	}
@@ -80,23 +152,59 @@ func (me *ModelEvaluation) SaveResultsToCSV(outputPath string) error {
 
 	// Create CSV writer
 	writer := csv.NewWriter(file)
-	defer writer.Flush()
 
 	// Write header
-	header := []string{"Model", "Accuracy", "Precision", "Recall", "F1 Score"}
+	header := []string{"Model", "Accuracy", "Precision", "Recall", "F1 Score", "AUC", "Average Precision", "KS", "Brier Score",
+		"Specificity", "Balanced Accuracy", "MCC", "Cohen's Kappa"}
+
+	// The cost column is only added when costs are configured
+	if me.Costs != nil {
+		header = append(header, "Expected Cost")
+	}
+
+	// Cross-validation columns are only added when some model has them
+	withCV := false
+	for _, result := range me.Results {
+		if result.CrossValidation != nil {
+			withCV = true
+		}
+	}
+	if withCV {
+		header = append(header, "CV Folds",
+			"CV Accuracy Mean", "CV Accuracy Std",
+			"CV Precision Mean", "CV Precision Std",
+			"CV Recall Mean", "CV Recall Std",
+			"CV F1 Mean", "CV F1 Std")
+	}
+
 	err = writer.Write(header)
 	if err != nil {
 		return fmt.Errorf("error writing header: %v", err)
 	}
 
 	// Write results for each model
-	for name, result := range me.Results {
+	for _, name := range me.names() {
+		result := me.Results[name]
 		row := []string{
 			name,
 			strconv.FormatFloat(result.Accuracy, 'f', 4, 64),
 			strconv.FormatFloat(result.Precision, 'f', 4, 64),
 			strconv.FormatFloat(result.Recall, 'f', 4, 64),
 			strconv.FormatFloat(result.F1Score, 'f', 4, 64),
+			strconv.FormatFloat(result.AUC, 'f', 4, 64),
+			strconv.FormatFloat(result.AveragePrecision, 'f', 4, 64),
+			strconv.FormatFloat(result.KS, 'f', 4, 64),
+			strconv.FormatFloat(result.Brier, 'f', 4, 64),
+			strconv.FormatFloat(result.Specificity, 'f', 4, 64),
+			strconv.FormatFloat(result.BalancedAccuracy, 'f', 4, 64),
+			strconv.FormatFloat(result.MCC, 'f', 4, 64),
+			strconv.FormatFloat(result.Kappa, 'f', 4, 64),
+		}
+		if me.Costs != nil {
+			row = append(row, strconv.FormatFloat(me.Costs.ExpectedCost(result), 'f', 4, 64))
+		}
+		if withCV {
+			row = append(row, crossValidationFields(result.CrossValidation)...)
 		}
 
 		err = writer.Write(row)
@@ -105,31 +213,45 @@ func (me *ModelEvaluation) SaveResultsToCSV(outputPath string) error {
 		}
 	}
 
-	return nil
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing results: %v", err)
+	}
+	return file.Close()
 }
 
-// AnalyzeFeatureImportance analyzes feature importance from model results
-// This is a placeholder function that would be implemented with actual model-specific
-// feature importance extraction in a real application
-func (me *ModelEvaluation) AnalyzeFeatureImportance() map[string]float64 {
-	// In a real implementation, this would extract feature importance from models
-	// For now, return mock data
-	return map[string]float64{
-		"A2":  0.15,
-		"A3":  0.12,
-		"A8":  0.18,
-		"A11": 0.09,
-		"A14": 0.14,
-		"A15": 0.11,
-		"A1":  0.07,
-		"A4":  0.06,
-		"A5":  0.05,
-		"A6":  0.03,
-	}
-}
-
-// SaveConfusionMatrices saves confusion matrices for all models to CSV files
-func (me *ModelEvaluation) SaveConfusionMatrices(outputDir string) error {
+// crossValidationFields formats the fold count and the mean and standard
+// deviation of each metric, or blanks when cv is nil
+func crossValidationFields(cv *models.CrossValidationResult) []string {
+	if cv == nil {
+		return make([]string, 9)
+	}
+	fields := []string{strconv.Itoa(cv.Folds)}
+	for _, m := range []models.MetricSummary{cv.Accuracy, cv.Precision, cv.Recall, cv.F1Score} {
+		fields = append(fields,
+			strconv.FormatFloat(m.Mean, 'f', 4, 64),
+			strconv.FormatFloat(m.Std, 'f', 4, 64))
+	}
+	return fields
+}
+
+// AnalyzeFeatureImportance returns each model's importance per raw
+// feature of data, the training matrix: coefficient magnitudes for logistic
+// regression, Gini importance for the tree and forest, and split gain for
+// boosting. Models that do not measure importance are left out.
+func (me *ModelEvaluation) AnalyzeFeatureImportance(data *models.FeatureMatrix) map[string]map[string]float64 {
+	importance := make(map[string]map[string]float64)
+	for name, result := range me.Results {
+		if scores, ok := models.RawFeatureImportance(result.Model, data); ok {
+			importance[name] = scores
+		}
+	}
+	return importance
+}
+
+// SaveConfusionMatrices saves confusion matrices for all models to CSV files,
+// gzip-compressed with a .gz suffix when compress is set
+func (me *ModelEvaluation) SaveConfusionMatrices(outputDir string, compress bool) error {
 	// Create output directory if it doesn't exist
 	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
 		err := os.MkdirAll(outputDir, 0755)
@@ -142,7 +264,10 @@ func (me *ModelEvaluation) SaveConfusionMatrices(outputDir string) error {
 	for name, result := range me.Results {
 		// Create output file
 		filePath := fmt.Sprintf("%s/%s_confusion_matrix.csv", outputDir, name)
-		file, err := os.Create(filePath)
+		if compress {
+			filePath += ".gz"
+		}
+		file, err := dataset.Create(filePath)
 		if err != nil {
 			return fmt.Errorf("error creating output file: %v", err)
 		}
@@ -151,10 +276,7 @@ func (me *ModelEvaluation) SaveConfusionMatrices(outputDir string) error {
 		writer := csv.NewWriter(file)
 
 		// Get classes
-		classes := make([]string, 0, len(result.ConfMatrix))
-		for class := range result.ConfMatrix {
-			classes = append(classes, class)
-		}
+		classes := result.ClassOrder()
 
 		// Write header
 		header := append([]string{"Actual/Predicted"}, classes...)
@@ -169,7 +291,7 @@ func (me *ModelEvaluation) SaveConfusionMatrices(outputDir string) error {
 			row := []string{actualClass}
 			for _, predictedClass := range classes {
 				count := result.ConfMatrix[actualClass][predictedClass]
-				row = append(row, strconv.Itoa(count))
+				row = append(row, strconv.FormatFloat(count, 'f', -1, 64))
 			}
 
 			err = writer.Write(row)
@@ -180,8 +302,66 @@ func (me *ModelEvaluation) SaveConfusionMatrices(outputDir string) error {
 		}
 
 		writer.Flush()
-		file.Close()
+		if err := writer.Error(); err != nil {
+			file.Close()
+			return fmt.Errorf("error writing confusion matrix: %v", err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("error closing confusion matrix: %v", err)
+		}
 	}
 
 	return nil
 }
+
+// PrintGradeSummary prints the size, mean PD and observed bad rate of each
+// risk grade next to its target bad rate
+func PrintGradeSummary(modelName, source string, bands []calibration.BandSummary) {
+	fmt.Printf("\nRisk Grades (%s, PDs from %s):\n", modelName, source)
+	fmt.Println("=========================")
+	fmt.Printf("%-6s %-8s %-10s %-10s %-10s %-10s\n", "Grade", "Count", "Max PD", "Mean PD", "Bad Rate", "Target")
+	fmt.Println("------------------------------------------------------------")
+	for _, band := range bands {
+		fmt.Printf("%-6s %-8d %-10.4f %-10.4f %-10.4f %-10.4f\n",
+			band.Name, band.Count, band.MaxPD, band.MeanPD, band.BadRate, band.TargetBadRate)
+	}
+}
+
+// SavePredictions writes one row per test prediction of a model with its
+// score, calibrated PD from pds, risk grade and actual label, gzip-compressed
+// when the path ends in .gz. With decisions, each row also gets the credit
+// policy's outcome and the knock-out rule that decided it.
+func SavePredictions(path string, result *models.ModelResult, pds []float64, scale *calibration.GradeScale, decisions []policy.Decision) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating predictions file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	header := []string{"Row", "Probability", "PD", "Grade", "Actual"}
+	if decisions != nil {
+		header = append(header, "Decision", "Rule")
+	}
+	writer.Write(header)
+	for i, p := range result.Probabilities {
+		pd := pds[i]
+		row := []string{
+			strconv.Itoa(i),
+			strconv.FormatFloat(p, 'f', 4, 64),
+			strconv.FormatFloat(pd, 'f', 4, 64),
+			scale.Assign(pd),
+			strconv.FormatFloat(result.Labels[i], 'f', -1, 64),
+		}
+		if decisions != nil {
+			row = append(row, string(decisions[i].Outcome), decisions[i].Rule)
+		}
+		writer.Write(row)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing predictions: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,157 @@
+package evaluation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// Baseline is the stored test metrics of a champion model, which a new
+// model has to match to pass the gate
+type Baseline struct {
+	Model   string             `json:"model"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// NewBaseline records the gate metrics of a result
+func NewBaseline(result *models.ModelResult) *Baseline {
+	return &Baseline{Model: result.ModelName, Metrics: GateMetrics(result)}
+}
+
+// GateMetrics returns the metrics of a result that gate rules can refer to,
+// by name
+func GateMetrics(result *models.ModelResult) map[string]float64 {
+	return map[string]float64{
+		"auc":               result.AUC,
+		"ks":                result.KS,
+		"average_precision": result.AveragePrecision,
+		"f1":                result.F1Score,
+		"brier":             result.Brier,
+		"mcc":               result.MCC,
+	}
+}
+
+// LoadBaseline reads a baseline from a JSON file, decrypting and
+// decompressing it as needed
+func LoadBaseline(path string) (*Baseline, error) {
+	file, err := dataset.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening baseline: %v", err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading baseline: %v", err)
+	}
+
+	b := &Baseline{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("error parsing baseline: %v", err)
+	}
+	if len(b.Metrics) == 0 {
+		return nil, fmt.Errorf("baseline %s has no metrics", path)
+	}
+	return b, nil
+}
+
+// Save writes the baseline to a JSON file, gzip-compressed when the path
+// ends in .gz and encrypted when encrypted writes are on
+func (b *Baseline) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding baseline: %v", err)
+	}
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating baseline file: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing baseline: %v", err)
+	}
+	return file.Close()
+}
+
+// GateRule bounds how far one metric may get worse than the baseline
+type GateRule struct {
+	Metric         string
+	HigherIsBetter bool
+	// Tolerance is the largest allowed change for the worse, in the
+	// metric's own units
+	Tolerance float64
+}
+
+// DefaultGateRules lets AUC and KS drop by at most tolerance
+func DefaultGateRules(tolerance float64) []GateRule {
+	return []GateRule{
+		{Metric: "auc", HigherIsBetter: true, Tolerance: tolerance},
+		{Metric: "ks", HigherIsBetter: true, Tolerance: tolerance},
+	}
+}
+
+// GateCheck is the outcome of one rule
+type GateCheck struct {
+	Rule     GateRule
+	Baseline float64
+	Current  float64
+	// Skipped is set when the baseline or the current model lacks the
+	// metric, so baselines stored before a metric existed still work
+	Skipped bool
+	Passed  bool
+}
+
+// Regression returns how much the metric got worse, negative when it
+// improved
+func (c GateCheck) Regression() float64 {
+	if c.Rule.HigherIsBetter {
+		return c.Baseline - c.Current
+	}
+	return c.Current - c.Baseline
+}
+
+// Gate checks a result against the baseline and reports whether every rule
+// passed
+func (b *Baseline) Gate(result *models.ModelResult, rules []GateRule) ([]GateCheck, bool) {
+	current := GateMetrics(result)
+	passed := true
+	checks := make([]GateCheck, 0, len(rules))
+	for _, rule := range rules {
+		check := GateCheck{Rule: rule, Passed: true}
+		base, inBase := b.Metrics[rule.Metric]
+		now, inCurrent := current[rule.Metric]
+		if !inBase || !inCurrent {
+			check.Skipped = true
+			checks = append(checks, check)
+			continue
+		}
+		check.Baseline, check.Current = base, now
+		check.Passed = check.Regression() <= rule.Tolerance
+		passed = passed && check.Passed
+		checks = append(checks, check)
+	}
+	return checks, passed
+}
+
+// PrintGate prints each rule's baseline and current value and whether it
+// passed
+func PrintGate(baseline *Baseline, modelName string, checks []GateCheck) {
+	fmt.Printf("\nChampion Gate (%s vs baseline %s):\n", modelName, baseline.Model)
+	fmt.Println("=========================")
+	fmt.Printf("%-20s %-10s %-10s %-10s %-10s %-6s\n", "Metric", "Baseline", "Current", "Change", "Tolerance", "Result")
+	fmt.Println("---------------------------------------------------------------------")
+	for _, c := range checks {
+		if c.Skipped {
+			fmt.Printf("%-20s %-10s %-10s %-10s %-10.4f %-6s\n", c.Rule.Metric, "n/a", "n/a", "n/a", c.Rule.Tolerance, "skip")
+			continue
+		}
+		result := "pass"
+		if !c.Passed {
+			result = "FAIL"
+		}
+		fmt.Printf("%-20s %-10.4f %-10.4f %-+10.4f %-10.4f %-6s\n",
+			c.Rule.Metric, c.Baseline, c.Current, c.Current-c.Baseline, c.Rule.Tolerance, result)
+	}
+}
@@ -0,0 +1,178 @@
+package evaluation
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// MetricFunc scores probabilities against labels, honoring the weights
+// when they are not nil, higher meaning better
+type MetricFunc func(scores, labels, weights []float64) float64
+
+// PermutationConfig holds the settings of permutation importance
+type PermutationConfig struct {
+	// Repeats is the number of times each feature is shuffled
+	Repeats int
+	// Metric is the score whose drop measures importance
+	Metric MetricFunc
+	// Seed determines the shuffles; zero draws a random one
+	Seed uint64
+}
+
+// DefaultPermutationConfig measures the drop in AUC over 5 shuffles
+func DefaultPermutationConfig() PermutationConfig {
+	return PermutationConfig{
+		Repeats: 5,
+		Metric:  models.AUC,
+	}
+}
+
+// PermutationImportance is how much a model's score drops when one raw
+// feature is shuffled across the rows
+type PermutationImportance struct {
+	Feature string
+	// Mean and Std are the mean and standard deviation of the drop over
+	// the repeats. A negative mean means shuffling the feature helped.
+	Mean float64
+	Std  float64
+}
+
+// PermutationReport is a model's permutation importance, most important
+// feature first
+type PermutationReport struct {
+	ModelName string
+	// Baseline is the model's score on the unshuffled data
+	Baseline float64
+	Features []PermutationImportance
+}
+
+// PermutationImportances shuffles each raw feature of data, usually the test
+// set, and measures how much clf's score drops. Only the classifier's
+// predictions are used, so every model type is measured the same way. A
+// categorical field's one-hot columns are shuffled together, and missing
+// values move with the values they belong to.
+func PermutationImportances(name string, clf models.Classifier, data *models.FeatureMatrix, config PermutationConfig) (*PermutationReport, error) {
+	if config.Repeats <= 0 || config.Metric == nil {
+		return nil, fmt.Errorf("permutation importance needs a positive repeat count and a metric")
+	}
+	rows := data.Rows()
+	if rows < 2 {
+		return nil, fmt.Errorf("permutation importance needs at least 2 rows, got %d", rows)
+	}
+	for config.Seed == 0 {
+		config.Seed = rand.Uint64()
+	}
+	rng := rand.New(rand.NewPCG(config.Seed, 0))
+
+	X := data.Dense()
+	report := &PermutationReport{
+		ModelName: name,
+		Baseline:  config.Metric(models.Score(clf, data), data.Y, data.Weights),
+	}
+	for _, group := range data.Groups() {
+		drops := make([]float64, config.Repeats)
+		for r := range drops {
+			shuffled := permuteColumns(data, X, group.Columns, rng.Perm(rows))
+			drops[r] = report.Baseline - config.Metric(models.Score(clf, shuffled), data.Y, data.Weights)
+		}
+		mean, std := stat.MeanStdDev(drops, nil)
+		if config.Repeats == 1 {
+			std = 0
+		}
+		report.Features = append(report.Features, PermutationImportance{Feature: group.Name, Mean: mean, Std: std})
+	}
+
+	sort.SliceStable(report.Features, func(a, b int) bool {
+		return report.Features[a].Mean > report.Features[b].Mean
+	})
+	return report, nil
+}
+
+// permuteColumns returns a copy of data whose row i takes the given
+// columns, and their missing marks, from row perm[i]
+func permuteColumns(data *models.FeatureMatrix, X *mat.Dense, cols []int, perm []int) *models.FeatureMatrix {
+	shuffled := mat.DenseCopyOf(X)
+	for i, src := range perm {
+		for _, j := range cols {
+			shuffled.Set(i, j, X.At(src, j))
+		}
+	}
+
+	var missing [][]int
+	if data.Missing != nil {
+		missing = make([][]int, len(perm))
+		for i, src := range perm {
+			for _, j := range data.Missing[i] {
+				if !containsInt(cols, j) {
+					missing[i] = append(missing[i], j)
+				}
+			}
+			for _, j := range data.Missing[src] {
+				if containsInt(cols, j) {
+					missing[i] = append(missing[i], j)
+				}
+			}
+		}
+	}
+
+	return &models.FeatureMatrix{
+		X:           shuffled,
+		Y:           data.Y,
+		Features:    data.Features,
+		Missing:     missing,
+		Categorical: data.Categorical,
+		Weights:     data.Weights,
+	}
+}
+
+// PrintPermutationReport prints a model's features by permutation
+// importance
+func PrintPermutationReport(report *PermutationReport) {
+	fmt.Printf("\nPermutation Importance (%s, baseline %.4f):\n", report.ModelName, report.Baseline)
+	fmt.Println("=========================")
+	fmt.Printf("%-6s %-10s %-10s %-10s\n", "Rank", "Feature", "Mean Drop", "Std")
+	fmt.Println("--------------------------------------")
+	for k, f := range report.Features {
+		fmt.Printf("%-6d %-10s %-10.4f %-10.4f\n", k+1, f.Feature, f.Mean, f.Std)
+	}
+}
+
+// SavePermutationReports writes every model's permutation importance to a
+// CSV file, gzip-compressed when the path ends in .gz
+func SavePermutationReports(path string, reports []*PermutationReport) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating permutation importance file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Model", "Baseline", "Rank", "Feature", "Mean Drop", "Std Drop"})
+	for _, report := range reports {
+		for k, f := range report.Features {
+			writer.Write([]string{
+				report.ModelName,
+				strconv.FormatFloat(report.Baseline, 'f', 4, 64),
+				strconv.Itoa(k + 1),
+				f.Feature,
+				strconv.FormatFloat(f.Mean, 'f', 4, 64),
+				strconv.FormatFloat(f.Std, 'f', 4, 64),
+			})
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing permutation importance: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,87 @@
+package evaluation
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/calibration"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// ReliabilityBins is the number of equal-width score bins of the
+// reliability diagrams
+const ReliabilityBins = 10
+
+// RecalibrationFolds is the number of folds the recalibration report
+// cross-fits the test scores in
+const RecalibrationFolds = 5
+
+// SaveReliability writes the calibration curve of every model with test
+// probabilities to a CSV file, one row per non-empty bin, gzip-compressed
+// when the path ends in .gz
+func (me *ModelEvaluation) SaveReliability(path string) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating reliability file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Model", "Score Lower", "Score Upper", "Mean Predicted", "Observed Rate", "Weight", "Brier Score", "ECE"})
+	for _, name := range me.names() {
+		result := me.Results[name]
+		curve := models.CalibrationCurve(result.Probabilities, result.Labels, result.Weights, ReliabilityBins)
+		ece := models.ExpectedCalibrationError(curve)
+		for _, pt := range curve {
+			writer.Write([]string{
+				name,
+				strconv.FormatFloat(pt.Lower, 'f', 2, 64),
+				strconv.FormatFloat(pt.Upper, 'f', 2, 64),
+				strconv.FormatFloat(pt.MeanPredicted, 'f', 4, 64),
+				strconv.FormatFloat(pt.ObservedRate, 'f', 4, 64),
+				strconv.FormatFloat(pt.Weight, 'f', -1, 64),
+				strconv.FormatFloat(result.Brier, 'f', 4, 64),
+				strconv.FormatFloat(ece, 'f', 4, 64),
+			})
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing reliability: %v", err)
+	}
+	return file.Close()
+}
+
+// RecalibrationReport compares a model's calibration before and after
+// recalibrating its test scores
+type RecalibrationReport struct {
+	ModelName   string
+	Method      calibration.Method
+	BrierBefore float64
+	BrierAfter  float64
+	ECEBefore   float64
+	ECEAfter    float64
+}
+
+// EvaluateRecalibration measures how much the method improves a model's
+// calibration. The recalibrated scores are cross-fitted over
+// RecalibrationFolds folds of the test rows, so no score is recalibrated by
+// a map fitted on it.
+func EvaluateRecalibration(result *models.ModelResult, method calibration.Method) (*RecalibrationReport, error) {
+	after, err := calibration.CrossFit(method, result.Probabilities, result.Labels, result.Weights, RecalibrationFolds)
+	if err != nil {
+		return nil, fmt.Errorf("error recalibrating %s: %v", result.ModelName, err)
+	}
+	before := result.Probabilities
+	return &RecalibrationReport{
+		ModelName:   result.ModelName,
+		Method:      method,
+		BrierBefore: models.BrierScore(before, result.Labels, result.Weights),
+		BrierAfter:  models.BrierScore(after, result.Labels, result.Weights),
+		ECEBefore:   models.ExpectedCalibrationError(models.CalibrationCurve(before, result.Labels, result.Weights, ReliabilityBins)),
+		ECEAfter:    models.ExpectedCalibrationError(models.CalibrationCurve(after, result.Labels, result.Weights, ReliabilityBins)),
+	}, nil
+}
@@ -0,0 +1,61 @@
+package evaluation
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// PrintSegmentEvaluations prints how each segment's model does on its test
+// applications next to the pooled model, whose rows show "pooled" when the
+// segment had no model of its own
+func PrintSegmentEvaluations(modelName string, evaluations []models.SegmentEvaluation) {
+	fmt.Printf("\nSegment Models (%s):\n", modelName)
+	fmt.Println("=========================")
+	fmt.Printf("%-16s %-8s %-8s %-8s %-10s %-10s %-12s %-12s\n",
+		"Segment", "Train", "Test", "Model", "AUC", "Accuracy", "Pooled AUC", "Pooled Acc")
+	fmt.Println("------------------------------------------------------------------------------------")
+	for _, e := range evaluations {
+		model := "own"
+		if !e.OwnModel {
+			model = "pooled"
+		}
+		fmt.Printf("%-16s %-8d %-8.1f %-8s %-10.4f %-10.4f %-12.4f %-12.4f\n",
+			e.Segment, e.TrainRows, e.TestCount, model, e.AUC, e.Accuracy, e.PooledAUC, e.PooledAccuracy)
+	}
+}
+
+// SaveSegmentEvaluations writes one row per segment to a CSV file,
+// gzip-compressed when the path ends in .gz
+func SaveSegmentEvaluations(path, modelName string, evaluations []models.SegmentEvaluation) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating segment model file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Model", "Segment", "Train Rows", "Test Count", "Own Model", "AUC", "Accuracy", "Pooled AUC", "Pooled Accuracy"})
+	for _, e := range evaluations {
+		writer.Write([]string{
+			modelName,
+			e.Segment,
+			strconv.Itoa(e.TrainRows),
+			strconv.FormatFloat(e.TestCount, 'f', 4, 64),
+			strconv.FormatBool(e.OwnModel),
+			strconv.FormatFloat(e.AUC, 'f', 4, 64),
+			strconv.FormatFloat(e.Accuracy, 'f', 4, 64),
+			strconv.FormatFloat(e.PooledAUC, 'f', 4, 64),
+			strconv.FormatFloat(e.PooledAccuracy, 'f', 4, 64),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing segment models: %v", err)
+	}
+	return file.Close()
+}
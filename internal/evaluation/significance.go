@@ -0,0 +1,211 @@
+package evaluation
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// SignificanceConfig holds the settings of the model comparison tests
+type SignificanceConfig struct {
+	// Resamples is the number of bootstrap resamples of the test set
+	Resamples int
+	// Confidence is the coverage of the bootstrap intervals
+	Confidence float64
+	// Seed determines the resamples; zero draws a random one
+	Seed uint64
+}
+
+// DefaultSignificanceConfig returns 95% intervals from 1000 resamples
+func DefaultSignificanceConfig() SignificanceConfig {
+	return SignificanceConfig{
+		Resamples:  1000,
+		Confidence: 0.95,
+	}
+}
+
+// McNemarResult is McNemar's test of whether two models make different
+// numbers of errors on the same rows
+type McNemarResult struct {
+	// OnlyA counts the rows only the first model gets right, and OnlyB those
+	// only the second one gets right
+	OnlyA int
+	OnlyB int
+	// Statistic is the continuity-corrected chi-squared statistic, and
+	// PValue the two-sided p-value, exact binomial below 25 discordant rows
+	Statistic float64
+	PValue    float64
+}
+
+// Interval is a bootstrap percentile confidence interval around an estimate
+type Interval struct {
+	Estimate float64
+	Lower    float64
+	Upper    float64
+}
+
+// Contains reports whether v lies within the interval
+func (iv Interval) Contains(v float64) bool {
+	return iv.Lower <= v && v <= iv.Upper
+}
+
+// Comparison is the paired comparison of two models on the same test rows
+type Comparison struct {
+	ModelA  string
+	ModelB  string
+	McNemar McNemarResult
+	// AUCA and AUCB are the models' AUCs, and AUCDiff the paired difference
+	// AUCA - AUCB, each with a bootstrap interval
+	AUCA    Interval
+	AUCB    Interval
+	AUCDiff Interval
+}
+
+// Significant reports whether either test separates the models: McNemar's
+// p-value is below 1 - confidence, or the AUC difference interval excludes
+// zero
+func (c *Comparison) Significant(confidence float64) bool {
+	return c.McNemar.PValue < 1-confidence || !c.AUCDiff.Contains(0)
+}
+
+// McNemar tests the 0.5-threshold decisions of two models on the same rows.
+// Rows count once each, whatever their sample weight, as the test counts
+// discordant pairs.
+func McNemar(a, b *models.ModelResult) (McNemarResult, error) {
+	if err := paired(a, b); err != nil {
+		return McNemarResult{}, err
+	}
+
+	var res McNemarResult
+	for i, y := range a.Labels {
+		actual := y >= 0.5
+		rightA := (a.Probabilities[i] >= 0.5) == actual
+		rightB := (b.Probabilities[i] >= 0.5) == actual
+		switch {
+		case rightA && !rightB:
+			res.OnlyA++
+		case rightB && !rightA:
+			res.OnlyB++
+		}
+	}
+
+	discordant := res.OnlyA + res.OnlyB
+	if discordant == 0 {
+		res.PValue = 1
+		return res, nil
+	}
+	diff := math.Abs(float64(res.OnlyA-res.OnlyB)) - 1
+	res.Statistic = math.Max(diff, 0) * math.Max(diff, 0) / float64(discordant)
+	if discordant < 25 {
+		k := res.OnlyA
+		if res.OnlyB < k {
+			k = res.OnlyB
+		}
+		binomial := distuv.Binomial{N: float64(discordant), P: 0.5}
+		res.PValue = math.Min(1, 2*binomial.CDF(float64(k)))
+	} else {
+		res.PValue = distuv.ChiSquared{K: 1}.Survival(res.Statistic)
+	}
+	return res, nil
+}
+
+// paired checks that two results score the same test rows
+func paired(a, b *models.ModelResult) error {
+	if len(a.Probabilities) == 0 || len(b.Probabilities) == 0 {
+		return fmt.Errorf("%s and %s need test probabilities to be compared", a.ModelName, b.ModelName)
+	}
+	if len(a.Labels) != len(b.Labels) {
+		return fmt.Errorf("%s has %d test rows but %s has %d", a.ModelName, len(a.Labels), b.ModelName, len(b.Labels))
+	}
+	for i := range a.Labels {
+		if a.Labels[i] != b.Labels[i] {
+			return fmt.Errorf("%s and %s were scored on different test rows", a.ModelName, b.ModelName)
+		}
+	}
+	return nil
+}
+
+// CompareModels runs McNemar's test on two models' decisions and
+// bootstraps their AUCs and the AUC difference over the same resamples of
+// the test rows
+func CompareModels(a, b *models.ModelResult, config SignificanceConfig) (*Comparison, error) {
+	if config.Resamples < 2 || config.Confidence <= 0 || config.Confidence >= 1 {
+		return nil, fmt.Errorf("need at least 2 resamples and a confidence in (0, 1)")
+	}
+	mcnemar, err := McNemar(a, b)
+	if err != nil {
+		return nil, err
+	}
+	for config.Seed == 0 {
+		config.Seed = rand.Uint64()
+	}
+	rng := rand.New(rand.NewPCG(config.Seed, 0))
+
+	n := len(a.Labels)
+	aucA := make([]float64, config.Resamples)
+	aucB := make([]float64, config.Resamples)
+	diffs := make([]float64, config.Resamples)
+	scoresA := make([]float64, n)
+	scoresB := make([]float64, n)
+	labels := make([]float64, n)
+	var weights []float64
+	if a.Weights != nil {
+		weights = make([]float64, n)
+	}
+	for r := range diffs {
+		for k := 0; k < n; k++ {
+			i := rng.IntN(n)
+			scoresA[k], scoresB[k], labels[k] = a.Probabilities[i], b.Probabilities[i], a.Labels[i]
+			if weights != nil {
+				weights[k] = a.Weights[i]
+			}
+		}
+		aucA[r] = models.AUC(scoresA, labels, weights)
+		aucB[r] = models.AUC(scoresB, labels, weights)
+		diffs[r] = aucA[r] - aucB[r]
+	}
+
+	return &Comparison{
+		ModelA:  a.ModelName,
+		ModelB:  b.ModelName,
+		McNemar: mcnemar,
+		AUCA:    percentileInterval(a.AUC, aucA, config.Confidence),
+		AUCB:    percentileInterval(b.AUC, aucB, config.Confidence),
+		AUCDiff: percentileInterval(a.AUC-b.AUC, diffs, config.Confidence),
+	}, nil
+}
+
+// percentileInterval returns the estimate with the central confidence
+// share of the bootstrap values
+func percentileInterval(estimate float64, values []float64, confidence float64) Interval {
+	sort.Float64s(values)
+	tail := (1 - confidence) / 2
+	return Interval{
+		Estimate: estimate,
+		Lower:    stat.Quantile(tail, stat.Empirical, values, nil),
+		Upper:    stat.Quantile(1-tail, stat.Empirical, values, nil),
+	}
+}
+
+// PrintComparison prints the tests of the best model against the runner-up
+func PrintComparison(c *Comparison, confidence float64) {
+	fmt.Printf("\nSignificance (%s vs %s):\n", c.ModelA, c.ModelB)
+	fmt.Println("=========================")
+	fmt.Printf("McNemar: %d rows only %s gets right, %d only %s, chi-squared %.4f, p = %.4f\n",
+		c.McNemar.OnlyA, c.ModelA, c.McNemar.OnlyB, c.ModelB, c.McNemar.Statistic, c.McNemar.PValue)
+	pct := 100 * confidence
+	fmt.Printf("AUC %s: %.4f (%.0f%% CI %.4f-%.4f)\n", c.ModelA, c.AUCA.Estimate, pct, c.AUCA.Lower, c.AUCA.Upper)
+	fmt.Printf("AUC %s: %.4f (%.0f%% CI %.4f-%.4f)\n", c.ModelB, c.AUCB.Estimate, pct, c.AUCB.Lower, c.AUCB.Upper)
+	fmt.Printf("AUC difference: %.4f (%.0f%% CI %.4f to %.4f)\n", c.AUCDiff.Estimate, pct, c.AUCDiff.Lower, c.AUCDiff.Upper)
+	if c.Significant(confidence) {
+		fmt.Printf("%s is significantly different from %s\n", c.ModelA, c.ModelB)
+	} else {
+		fmt.Printf("%s is not significantly different from %s\n", c.ModelA, c.ModelB)
+	}
+}
@@ -0,0 +1,338 @@
+package evaluation
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// ImportanceFunc scores how much a trained classifier relies on each
+// feature column of data, higher meaning more important
+type ImportanceFunc func(clf models.Classifier, data *models.FeatureMatrix) []float64
+
+// AblationImportance measures each feature as the mean absolute change in
+// the predicted approval probability when the feature is replaced by its
+// mean over data. It works for any classifier.
+func AblationImportance(clf models.Classifier, data *models.FeatureMatrix) []float64 {
+	X := data.Dense()
+	rows, cols := X.Dims()
+	base := models.Score(clf, data)
+
+	importance := make([]float64, cols)
+	for j := 0; j < cols; j++ {
+		ablated := &models.FeatureMatrix{
+			X:           mat.DenseCopyOf(X),
+			Y:           data.Y,
+			Features:    data.Features,
+			Missing:     withoutColumn(data.Missing, j),
+			Categorical: data.Categorical,
+		}
+		mean := columnMean(X, data.Missing, j)
+		for i := 0; i < rows; i++ {
+			ablated.X.Set(i, j, mean)
+		}
+
+		for i, p := range models.Score(clf, ablated) {
+			importance[j] += math.Abs(p - base[i])
+		}
+		if rows > 0 {
+			importance[j] /= float64(rows)
+		}
+	}
+	return importance
+}
+
+// columnMean returns the mean of the present values of column j
+func columnMean(X *mat.Dense, missing [][]int, j int) float64 {
+	rows, _ := X.Dims()
+	sum, count := 0.0, 0
+	for i := 0; i < rows; i++ {
+		if missing != nil && containsInt(missing[i], j) {
+			continue
+		}
+		sum += X.At(i, j)
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// withoutColumn returns a copy of the missing cells with column j removed,
+// for a column that has been filled in
+func withoutColumn(missing [][]int, j int) [][]int {
+	if missing == nil {
+		return nil
+	}
+	out := make([][]int, len(missing))
+	for i, cols := range missing {
+		for _, c := range cols {
+			if c != j {
+				out[i] = append(out[i], c)
+			}
+		}
+	}
+	return out
+}
+
+// containsInt reports whether values contains v
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// StabilityConfig holds the settings of the importance stability analysis
+type StabilityConfig struct {
+	// Resamples is the number of bootstrap resamples the model is retrained on
+	Resamples int
+	// TopK is the number of leading features whose membership is compared
+	TopK int
+	// A model is fragile when the mean Spearman correlation of its resampled
+	// rankings with the full-data ranking is below MinRankCorrelation, or
+	// when on average less than MinTopKOverlap of the top features stay in
+	// the top
+	MinRankCorrelation float64
+	MinTopKOverlap     float64
+	// Seed determines the resamples and the retrained models; zero draws a
+	// random one
+	Seed uint64
+}
+
+// DefaultStabilityConfig returns 20 resamples comparing the top 10
+// features, flagging rank correlations below 0.5 or top-10 overlaps below
+// 70%
+func DefaultStabilityConfig() StabilityConfig {
+	return StabilityConfig{
+		Resamples:          20,
+		TopK:               10,
+		MinRankCorrelation: 0.5,
+		MinTopKOverlap:     0.7,
+	}
+}
+
+// FeatureStability summarizes one feature's importance across resamples
+type FeatureStability struct {
+	Feature string
+	// ReferenceRank is the feature's rank (1 is most important) for the
+	// model trained on all the training data
+	ReferenceRank  float64
+	MeanImportance float64
+	StdImportance  float64
+	MeanRank       float64
+	RankStd        float64
+	// TopKFrequency is the share of resamples ranking the feature in the
+	// top K
+	TopKFrequency float64
+}
+
+// StabilityReport is the importance stability of one model
+type StabilityReport struct {
+	ModelName string
+	Resamples int
+	TopK      int
+	// RankCorrelation is the mean Spearman correlation between each
+	// resample's importance ranking and the reference ranking
+	RankCorrelation float64
+	// TopKOverlap is the mean share of the reference top K features that a
+	// resample also ranks in its top K
+	TopKOverlap float64
+	// Fragile is set when either measure falls below its minimum
+	Fragile bool
+	// Features are ordered by reference rank
+	Features []FeatureStability
+}
+
+// ImportanceStability compares the feature importance of reference, a
+// model of the given type trained on all of trainData, with that of models
+// retrained on bootstrap resamples of trainData. Importance is measured on
+// evalData.
+func ImportanceStability(modelType models.ModelType, reference models.Classifier, trainData, evalData *models.FeatureMatrix, importance ImportanceFunc, config StabilityConfig) (*StabilityReport, error) {
+	if config.Resamples < 2 {
+		return nil, fmt.Errorf("stability analysis needs at least 2 resamples, got %d", config.Resamples)
+	}
+	if config.TopK <= 0 {
+		return nil, fmt.Errorf("top k must be positive, got %d", config.TopK)
+	}
+	for config.Seed == 0 {
+		config.Seed = rand.Uint64()
+	}
+	rng := rand.New(rand.NewPCG(config.Seed, 0))
+
+	features := evalData.Features
+	topK := config.TopK
+	if topK > len(features) {
+		topK = len(features)
+	}
+
+	refRanks := ranks(importance(reference, evalData))
+	refTop := topSet(refRanks, topK)
+
+	n := trainData.Rows()
+	scores := make([][]float64, len(features))
+	rankings := make([][]float64, len(features))
+	inTop := make([]int, len(features))
+	report := &StabilityReport{
+		ModelName: modelType.String(),
+		Resamples: config.Resamples,
+		TopK:      topK,
+	}
+	for r := 0; r < config.Resamples; r++ {
+		rows := make([]int, n)
+		for i := range rows {
+			rows[i] = rng.IntN(n)
+		}
+		result, err := models.TrainModel(trainData.Subset(rows), evalData, modelType, rng.Uint64())
+		if err != nil {
+			return nil, fmt.Errorf("error in resample %d: %v", r+1, err)
+		}
+
+		imp := importance(result.Model, evalData)
+		rk := ranks(imp)
+		top := topSet(rk, topK)
+		overlap := 0
+		for j := range features {
+			scores[j] = append(scores[j], imp[j])
+			rankings[j] = append(rankings[j], rk[j])
+			if top[j] {
+				inTop[j]++
+				if refTop[j] {
+					overlap++
+				}
+			}
+		}
+		report.TopKOverlap += float64(overlap) / float64(topK)
+		report.RankCorrelation += spearman(refRanks, rk)
+	}
+	report.TopKOverlap /= float64(config.Resamples)
+	report.RankCorrelation /= float64(config.Resamples)
+	report.Fragile = report.RankCorrelation < config.MinRankCorrelation || report.TopKOverlap < config.MinTopKOverlap
+
+	for j, name := range features {
+		fs := FeatureStability{
+			Feature:       name,
+			ReferenceRank: refRanks[j],
+			TopKFrequency: float64(inTop[j]) / float64(config.Resamples),
+		}
+		fs.MeanImportance, fs.StdImportance = stat.MeanStdDev(scores[j], nil)
+		fs.MeanRank, fs.RankStd = stat.MeanStdDev(rankings[j], nil)
+		report.Features = append(report.Features, fs)
+	}
+	sort.SliceStable(report.Features, func(a, b int) bool {
+		return report.Features[a].ReferenceRank < report.Features[b].ReferenceRank
+	})
+	return report, nil
+}
+
+// ranks returns the rank of each importance, 1 for the highest, giving
+// tied values their average rank
+func ranks(importance []float64) []float64 {
+	order := make([]int, len(importance))
+	for j := range order {
+		order[j] = j
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return importance[order[a]] > importance[order[b]]
+	})
+
+	r := make([]float64, len(importance))
+	for start := 0; start < len(order); {
+		end := start + 1
+		for end < len(order) && importance[order[end]] == importance[order[start]] {
+			end++
+		}
+		avg := float64(start+end+1) / 2
+		for _, j := range order[start:end] {
+			r[j] = avg
+		}
+		start = end
+	}
+	return r
+}
+
+// topSet marks the features ranked within the top k. Ties at the boundary
+// count only when their average rank is within k.
+func topSet(ranks []float64, k int) []bool {
+	top := make([]bool, len(ranks))
+	for j, r := range ranks {
+		top[j] = r <= float64(k)
+	}
+	return top
+}
+
+// spearman returns the Pearson correlation of two rankings, or 0 when
+// either ranking is constant
+func spearman(a, b []float64) float64 {
+	c := stat.Correlation(a, b, nil)
+	if math.IsNaN(c) {
+		return 0
+	}
+	return c
+}
+
+// PrintStabilityReports prints each model's rank correlation and top-K
+// overlap and whether its explanations are fragile
+func PrintStabilityReports(reports []*StabilityReport) {
+	fmt.Println("\nFeature Importance Stability:")
+	fmt.Println("=========================")
+	fmt.Printf("%-20s %-10s %-10s %-10s %-10s\n", "Model", "Resamples", "Rank Corr", "Top-K", "Status")
+	fmt.Println("------------------------------------------------------------")
+	for _, r := range reports {
+		status := "stable"
+		if r.Fragile {
+			status = "FRAGILE"
+		}
+		fmt.Printf("%-20s %-10d %-10.4f %-10s %-10s\n",
+			r.ModelName, r.Resamples, r.RankCorrelation, fmt.Sprintf("%.0f%%", 100*r.TopKOverlap), status)
+	}
+}
+
+// SaveStabilityReports writes one row per model and feature to a CSV file,
+// gzip-compressed when the path ends in .gz
+func SaveStabilityReports(path string, reports []*StabilityReport) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating stability file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Model", "Feature", "Reference Rank", "Mean Importance", "Importance Std",
+		"Mean Rank", "Rank Std", "Top-K Frequency", "Rank Correlation", "Top-K Overlap", "Fragile"})
+	for _, r := range reports {
+		for _, f := range r.Features {
+			writer.Write([]string{
+				r.ModelName,
+				f.Feature,
+				strconv.FormatFloat(f.ReferenceRank, 'f', -1, 64),
+				strconv.FormatFloat(f.MeanImportance, 'f', 6, 64),
+				strconv.FormatFloat(f.StdImportance, 'f', 6, 64),
+				strconv.FormatFloat(f.MeanRank, 'f', 2, 64),
+				strconv.FormatFloat(f.RankStd, 'f', 2, 64),
+				strconv.FormatFloat(f.TopKFrequency, 'f', 4, 64),
+				strconv.FormatFloat(r.RankCorrelation, 'f', 4, 64),
+				strconv.FormatFloat(r.TopKOverlap, 'f', 4, 64),
+				strconv.FormatBool(r.Fragile),
+			})
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing stability analysis: %v", err)
+	}
+	return file.Close()
+}
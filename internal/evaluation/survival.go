@@ -0,0 +1,85 @@
+package evaluation
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// survivalTopFeatures is how many hazard ratios PrintSurvivalReport lists
+const survivalTopFeatures = 10
+
+// PrintSurvivalReport prints the Cox model's concordance on the test
+// applications and the features that move the hazard the most
+func PrintSurvivalReport(report *models.SurvivalReport) {
+	fmt.Printf("\n%s (horizon %g):\n", report.ModelName, report.Horizon)
+	fmt.Println("=========================")
+	fmt.Printf("Training applications: %d (%d defaults)\n", report.TrainRows, report.TrainEvents)
+	fmt.Printf("Test applications:     %d (%d defaults)\n", report.TestRows, report.TestEvents)
+	fmt.Printf("Concordance (C-index): %.4f\n", report.Concordance)
+
+	fmt.Printf("\n%-30s %-14s %-14s\n", "Feature", "Coefficient", "Hazard Ratio")
+	fmt.Println("----------------------------------------------------------")
+	order := hazardOrder(report)
+	if len(order) > survivalTopFeatures {
+		order = order[:survivalTopFeatures]
+	}
+	for _, j := range order {
+		fmt.Printf("%-30s %-14.4f %-14.4f\n", report.Features[j], report.Coefficients[j], math.Exp(report.Coefficients[j]))
+	}
+}
+
+// SaveSurvivalReport writes every coefficient and hazard ratio of the Cox
+// model, largest effect first, after a row with its horizon and test
+// concordance. The file is gzip-compressed when the path ends in .gz.
+func SaveSurvivalReport(path string, report *models.SurvivalReport) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating survival model file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Horizon", "Train Rows", "Train Defaults", "Test Rows", "Test Defaults", "Concordance"})
+	writer.Write([]string{
+		strconv.FormatFloat(report.Horizon, 'g', -1, 64),
+		strconv.Itoa(report.TrainRows),
+		strconv.Itoa(report.TrainEvents),
+		strconv.Itoa(report.TestRows),
+		strconv.Itoa(report.TestEvents),
+		strconv.FormatFloat(report.Concordance, 'f', 4, 64),
+	})
+	writer.Write(nil)
+	writer.Write([]string{"Feature", "Coefficient", "Hazard Ratio"})
+	for _, j := range hazardOrder(report) {
+		writer.Write([]string{
+			report.Features[j],
+			strconv.FormatFloat(report.Coefficients[j], 'f', 6, 64),
+			strconv.FormatFloat(math.Exp(report.Coefficients[j]), 'f', 6, 64),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing survival model: %v", err)
+	}
+	return file.Close()
+}
+
+// hazardOrder returns the feature indices by decreasing absolute
+// coefficient
+func hazardOrder(report *models.SurvivalReport) []int {
+	order := make([]int, len(report.Coefficients))
+	for j := range order {
+		order[j] = j
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return math.Abs(report.Coefficients[order[a]]) > math.Abs(report.Coefficients[order[b]])
+	})
+	return order
+}
@@ -0,0 +1,189 @@
+package evaluation
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+)
+
+// ThresholdSteps is the number of intervals the threshold sweep divides
+// [0, 1] into; the cutoffs are the interior points 0.01 to 0.99
+const ThresholdSteps = 100
+
+// ThresholdMetrics are the metrics of approving every row scored at or
+// above Threshold
+type ThresholdMetrics struct {
+	Threshold float64
+	Accuracy  float64
+	Precision float64
+	Recall    float64
+	F1Score   float64
+	// ApprovalRate is the share of rows approved
+	ApprovalRate float64
+}
+
+// metric returns the named metric
+func (m ThresholdMetrics) metric(name string) float64 {
+	switch name {
+	case "accuracy":
+		return m.Accuracy
+	case "precision":
+		return m.Precision
+	case "recall":
+		return m.Recall
+	case "approval":
+		return m.ApprovalRate
+	}
+	return m.F1Score
+}
+
+// SweepThresholds scores the predictions at every cutoff from 1/steps to
+// (steps-1)/steps. Rows are weighted by weights, or count once when it is
+// nil.
+func SweepThresholds(scores, labels, weights []float64, steps int) []ThresholdMetrics {
+	sweep := make([]ThresholdMetrics, 0, steps-1)
+	for k := 1; k < steps; k++ {
+		threshold := float64(k) / float64(steps)
+		var tp, fp, fn, tn float64
+		for i, p := range scores {
+			w := 1.0
+			if weights != nil {
+				w = weights[i]
+			}
+			approved, good := p >= threshold, labels[i] >= 0.5
+			switch {
+			case approved && good:
+				tp += w
+			case approved:
+				fp += w
+			case good:
+				fn += w
+			default:
+				tn += w
+			}
+		}
+
+		m := ThresholdMetrics{Threshold: threshold}
+		if total := tp + fp + fn + tn; total > 0 {
+			m.Accuracy = (tp + tn) / total
+			m.ApprovalRate = (tp + fp) / total
+		}
+		if tp+fp > 0 {
+			m.Precision = tp / (tp + fp)
+		}
+		if tp+fn > 0 {
+			m.Recall = tp / (tp + fn)
+		}
+		if m.Precision+m.Recall > 0 {
+			m.F1Score = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+		}
+		sweep = append(sweep, m)
+	}
+	return sweep
+}
+
+// ThresholdObjective chooses an operating point: the cutoff maximizing
+// Metric, among those where Constraint is at least Min when Constraint is
+// set
+type ThresholdObjective struct {
+	Metric     string
+	Constraint string
+	Min        float64
+}
+
+// thresholdMetrics are the metric names an objective can use
+var thresholdMetrics = []string{"f1", "accuracy", "precision", "recall", "approval"}
+
+// String returns the objective in the form ParseThresholdObjective reads
+func (o ThresholdObjective) String() string {
+	if o.Constraint == "" {
+		return o.Metric
+	}
+	return fmt.Sprintf("%s@%s=%g", o.Metric, o.Constraint, o.Min)
+}
+
+// ParseThresholdObjective reads an objective such as "f1", or
+// "recall@precision=0.9" for the highest recall with precision of at least
+// 0.9
+func ParseThresholdObjective(s string) (ThresholdObjective, error) {
+	metric, constraint, constrained := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "@")
+	o := ThresholdObjective{Metric: metric}
+	if !knownThresholdMetric(metric) {
+		return o, fmt.Errorf("unknown threshold metric %q (want one of %s)", metric, strings.Join(thresholdMetrics, ", "))
+	}
+	if !constrained {
+		return o, nil
+	}
+
+	name, value, ok := strings.Cut(constraint, "=")
+	if !ok || !knownThresholdMetric(name) {
+		return o, fmt.Errorf("invalid threshold constraint %q (want <metric>=<minimum>)", constraint)
+	}
+	min, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return o, fmt.Errorf("invalid threshold constraint minimum %q: %v", value, err)
+	}
+	o.Constraint, o.Min = name, min
+	return o, nil
+}
+
+// knownThresholdMetric reports whether name is a metric objectives can use
+func knownThresholdMetric(name string) bool {
+	for _, m := range thresholdMetrics {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectThreshold returns the index in sweep of the cutoff that best meets
+// the objective, taking the lowest cutoff on ties
+func SelectThreshold(sweep []ThresholdMetrics, objective ThresholdObjective) (int, error) {
+	best := -1
+	for k, m := range sweep {
+		if objective.Constraint != "" && m.metric(objective.Constraint) < objective.Min {
+			continue
+		}
+		if best < 0 || m.metric(objective.Metric) > sweep[best].metric(objective.Metric) {
+			best = k
+		}
+	}
+	if best < 0 {
+		return -1, fmt.Errorf("no threshold reaches %s of %g", objective.Constraint, objective.Min)
+	}
+	return best, nil
+}
+
+// SaveThresholdAnalysis writes the sweep to a CSV file with the selected
+// cutoff marked, gzip-compressed when the path ends in .gz
+func SaveThresholdAnalysis(path string, sweep []ThresholdMetrics, selected int) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating threshold analysis file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Threshold", "Accuracy", "Precision", "Recall", "F1 Score", "Approval Rate", "Selected"})
+	for k, m := range sweep {
+		writer.Write([]string{
+			strconv.FormatFloat(m.Threshold, 'f', 2, 64),
+			strconv.FormatFloat(m.Accuracy, 'f', 4, 64),
+			strconv.FormatFloat(m.Precision, 'f', 4, 64),
+			strconv.FormatFloat(m.Recall, 'f', 4, 64),
+			strconv.FormatFloat(m.F1Score, 'f', 4, 64),
+			strconv.FormatFloat(m.ApprovalRate, 'f', 4, 64),
+			strconv.FormatBool(k == selected),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing threshold analysis: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,331 @@
+package explain
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// AnchorConfig holds the parameters of the anchor search
+type AnchorConfig struct {
+	// Precision is the share of perturbed rows that must keep the decision
+	// for the rule to count as an anchor
+	Precision float64
+	// MaxPredicates bounds the length of a rule
+	MaxPredicates int
+	// Samples is the number of perturbed rows used to estimate precision
+	Samples int
+	// Bins is the number of quantile bins continuous features are cut into
+	Bins int
+	// Seed determines the perturbation samples. Zero draws a random seed,
+	// which NewAnchorer records in its config.
+	Seed uint64
+}
+
+// DefaultAnchorConfig returns 95% precision rules of at most four
+// predicates over quartiles, estimated on 200 samples
+func DefaultAnchorConfig() AnchorConfig {
+	return AnchorConfig{
+		Precision:     0.95,
+		MaxPredicates: 4,
+		Samples:       200,
+		Bins:          4,
+	}
+}
+
+// Anchor is an if-then rule under which the model's decision for a row
+// rarely changes
+type Anchor struct {
+	Predicates []string
+	// Precision is the estimated share of rows matching the rule that get
+	// the same decision, and Coverage the share of training rows matching it
+	Precision float64
+	Coverage  float64
+}
+
+// String joins the predicates into a rule
+func (a Anchor) String() string {
+	if len(a.Predicates) == 0 {
+		return "(any application)"
+	}
+	return strings.Join(a.Predicates, " AND ")
+}
+
+// anchorGroup is one raw field of the dataset: a normalized continuous
+// column, or the one-hot columns of a categorical field
+type anchorGroup struct {
+	name       string
+	cols       []int
+	continuous bool
+	// edges are the inner quantile cut points of a continuous feature, and
+	// rowsByBin the training rows falling in each bin
+	edges     []float64
+	rowsByBin [][]int
+}
+
+// bin returns the quantile bin of a continuous value
+func (g *anchorGroup) bin(v float64) int {
+	return sort.Search(len(g.edges), func(k int) bool { return v <= g.edges[k] })
+}
+
+// Anchorer finds anchors for individual predictions of a model, perturbing
+// rows by drawing from the training data
+type Anchorer struct {
+	Config   AnchorConfig
+	clf      models.Classifier
+	train    *mat.Dense
+	features []string
+	scales   map[string]LinearScale
+	groups   []*anchorGroup
+	rng      *rand.Rand
+}
+
+// NewAnchorer groups the training features into raw fields and cuts the
+// continuous ones into quantile bins
+func NewAnchorer(clf models.Classifier, trainData *models.FeatureMatrix, scales map[string]LinearScale, config AnchorConfig) (*Anchorer, error) {
+	if config.Precision <= 0 || config.Precision > 1 {
+		return nil, fmt.Errorf("precision must be in (0, 1], got %v", config.Precision)
+	}
+	if config.Samples <= 0 || config.Bins < 2 || config.MaxPredicates <= 0 {
+		return nil, fmt.Errorf("samples, bins and max predicates must be positive, with at least 2 bins")
+	}
+	for config.Seed == 0 {
+		config.Seed = rand.Uint64()
+	}
+
+	a := &Anchorer{
+		Config:   config,
+		clf:      clf,
+		train:    trainData.Dense(),
+		features: trainData.Features,
+		scales:   scales,
+		rng:      rand.New(rand.NewPCG(config.Seed, 0)),
+	}
+
+	index := make(map[string]*anchorGroup)
+	for j, name := range a.features {
+		field := name
+		continuous := strings.HasSuffix(name, "_norm")
+		if k := strings.Index(name, "_"); k > 0 && !continuous {
+			field = name[:k]
+		}
+		g, ok := index[field]
+		if !ok {
+			g = &anchorGroup{name: field, continuous: continuous}
+			index[field] = g
+			a.groups = append(a.groups, g)
+		}
+		g.cols = append(g.cols, j)
+	}
+
+	rows, _ := a.train.Dims()
+	for _, g := range a.groups {
+		if !g.continuous {
+			continue
+		}
+		values := mat.Col(nil, g.cols[0], a.train)
+		sort.Float64s(values)
+		for b := 1; b < config.Bins; b++ {
+			edge := values[b*len(values)/config.Bins]
+			if len(g.edges) == 0 || edge > g.edges[len(g.edges)-1] {
+				g.edges = append(g.edges, edge)
+			}
+		}
+		g.rowsByBin = make([][]int, len(g.edges)+1)
+		for i := 0; i < rows; i++ {
+			b := g.bin(a.train.At(i, g.cols[0]))
+			g.rowsByBin[b] = append(g.rowsByBin[b], i)
+		}
+	}
+	return a, nil
+}
+
+// Explain greedily adds the predicate that keeps the model's decision for
+// row most often, until the rule reaches the target precision or the
+// maximum length. Perturbed rows are training rows with the anchored fields
+// replaced: categorical fields take the row's value, continuous fields a
+// training value from the row's bin.
+func (a *Anchorer) Explain(row []float64) Anchor {
+	decision := a.predict([][]float64{row})[0] >= 0.5
+	var chosen []*anchorGroup
+	anchor := Anchor{Precision: a.precision(row, chosen, decision), Coverage: 1}
+
+	for len(chosen) < a.Config.MaxPredicates && anchor.Precision < a.Config.Precision {
+		var best *anchorGroup
+		bestPrecision, bestCoverage := -1.0, 0.0
+		for _, g := range a.groups {
+			if containsGroup(chosen, g) {
+				continue
+			}
+			candidate := append(append([]*anchorGroup(nil), chosen...), g)
+			precision := a.precision(row, candidate, decision)
+			coverage := a.coverage(row, candidate)
+			if precision > bestPrecision || (precision == bestPrecision && coverage > bestCoverage) {
+				best, bestPrecision, bestCoverage = g, precision, coverage
+			}
+		}
+		if best == nil {
+			break
+		}
+		chosen = append(chosen, best)
+		anchor.Precision, anchor.Coverage = bestPrecision, bestCoverage
+	}
+
+	for _, g := range chosen {
+		anchor.Predicates = append(anchor.Predicates, a.predicate(row, g))
+	}
+	return anchor
+}
+
+// containsGroup reports whether g is in groups
+func containsGroup(groups []*anchorGroup, g *anchorGroup) bool {
+	for _, h := range groups {
+		if h == g {
+			return true
+		}
+	}
+	return false
+}
+
+// predict scores several rows with one model call
+func (a *Anchorer) predict(rows [][]float64) []float64 {
+	X := mat.NewDense(len(rows), len(rows[0]), nil)
+	for i, r := range rows {
+		X.SetRow(i, r)
+	}
+	return a.clf.PredictProba(X)
+}
+
+// precision estimates how often perturbed rows that satisfy the anchored
+// groups keep the decision
+func (a *Anchorer) precision(row []float64, groups []*anchorGroup, decision bool) float64 {
+	rows, _ := a.train.Dims()
+	samples := make([][]float64, a.Config.Samples)
+	for s := range samples {
+		z := append([]float64(nil), a.train.RawRowView(a.rng.IntN(rows))...)
+		for _, g := range groups {
+			if !g.continuous {
+				for _, j := range g.cols {
+					z[j] = row[j]
+				}
+				continue
+			}
+			j := g.cols[0]
+			if same := g.rowsByBin[g.bin(row[j])]; len(same) > 0 {
+				z[j] = a.train.At(same[a.rng.IntN(len(same))], j)
+			} else {
+				z[j] = row[j]
+			}
+		}
+		samples[s] = z
+	}
+
+	kept := 0
+	for _, p := range a.predict(samples) {
+		if (p >= 0.5) == decision {
+			kept++
+		}
+	}
+	return float64(kept) / float64(len(samples))
+}
+
+// coverage returns the share of training rows that satisfy every anchored
+// group
+func (a *Anchorer) coverage(row []float64, groups []*anchorGroup) float64 {
+	rows, _ := a.train.Dims()
+	matched := 0
+	for i := 0; i < rows; i++ {
+		ok := true
+		for _, g := range groups {
+			if g.continuous {
+				ok = g.bin(a.train.At(i, g.cols[0])) == g.bin(row[g.cols[0]])
+			} else {
+				for _, j := range g.cols {
+					if a.train.At(i, j) != row[j] {
+						ok = false
+						break
+					}
+				}
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			matched++
+		}
+	}
+	return float64(matched) / float64(rows)
+}
+
+// predicate describes the row's value of a group: the bin of a continuous
+// feature, in raw units when known, or the category of a one-hot field
+func (a *Anchorer) predicate(row []float64, g *anchorGroup) string {
+	if !g.continuous {
+		for _, j := range g.cols {
+			if row[j] >= 0.5 {
+				return fmt.Sprintf("%s = %s", g.name, strings.TrimPrefix(a.features[j], g.name+"_"))
+			}
+		}
+		return fmt.Sprintf("%s is missing", g.name)
+	}
+
+	name, unit := g.name, func(v float64) float64 { return v }
+	if scale, ok := a.scales[g.name]; ok {
+		name, unit = scale.Column, scale.Raw
+	}
+	b := g.bin(row[g.cols[0]])
+	switch {
+	case b == 0:
+		return fmt.Sprintf("%s <= %.2f", name, unit(g.edges[0]))
+	case b == len(g.edges):
+		return fmt.Sprintf("%s > %.2f", name, unit(g.edges[b-1]))
+	}
+	return fmt.Sprintf("%.2f < %s <= %.2f", unit(g.edges[b-1]), name, unit(g.edges[b]))
+}
+
+// SaveAnchors writes an anchor for the model's decision on every row of
+// data, gzip-compressed when the path ends in .gz. Rows are numbered as in
+// the predictions export.
+func SaveAnchors(path string, anchorer *Anchorer, data *models.FeatureMatrix) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating anchors file: %v", err)
+	}
+	defer file.Close()
+
+	X := data.Dense()
+	probs := anchorer.clf.PredictProba(X)
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Row", "Probability", "Decision", "Rule", "Precision", "Coverage"})
+	for i, p := range probs {
+		decision := "decline"
+		if p >= 0.5 {
+			decision = "approve"
+		}
+		anchor := anchorer.Explain(X.RawRowView(i))
+		writer.Write([]string{
+			strconv.Itoa(i),
+			strconv.FormatFloat(p, 'f', 4, 64),
+			decision,
+			anchor.String(),
+			strconv.FormatFloat(anchor.Precision, 'f', 4, 64),
+			strconv.FormatFloat(anchor.Coverage, 'f', 4, 64),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing anchors: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,260 @@
+package explain
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// CounterfactualConfig controls the counterfactual search
+type CounterfactualConfig struct {
+	// Threshold is the approval cut-off the counterfactual has to reach
+	Threshold float64
+	// Step is the grid spacing, in normalized units, used to scan a feature
+	Step float64
+	// MaxFeatures bounds how many features a counterfactual may change
+	MaxFeatures int
+	// Limit is the number of counterfactuals returned, cheapest first
+	Limit int
+}
+
+// DefaultCounterfactualConfig returns a 0.5 threshold, a 1% grid and at most
+// two changed features
+func DefaultCounterfactualConfig() CounterfactualConfig {
+	return CounterfactualConfig{
+		Threshold:   0.5,
+		Step:        0.01,
+		MaxFeatures: 2,
+		Limit:       3,
+	}
+}
+
+// Change is a change to one feature. From and To are the model's normalized
+// values; Raw holds the same change in the original units when known.
+type Change struct {
+	Feature string
+	From    float64
+	To      float64
+	Raw     *RawChange
+}
+
+// RawChange is a feature change in the original units of the raw column
+type RawChange struct {
+	Column string
+	From   float64
+	To     float64
+}
+
+// String describes the change, in raw units when available
+func (c Change) String() string {
+	if c.Raw != nil {
+		return fmt.Sprintf("%s %+.2f (%.2f -> %.2f)", c.Raw.Column, c.Raw.To-c.Raw.From, c.Raw.From, c.Raw.To)
+	}
+	return fmt.Sprintf("%s %+.4f (%.4f -> %.4f)", c.Feature, c.To-c.From, c.From, c.To)
+}
+
+// Counterfactual is a set of feature changes that flips a decision
+type Counterfactual struct {
+	Changes []Change
+	// Probability is the model's approval probability after the changes
+	Probability float64
+	// Cost is the total absolute change in normalized units
+	Cost float64
+}
+
+// String lists the changes
+func (c Counterfactual) String() string {
+	parts := make([]string, len(c.Changes))
+	for k, change := range c.Changes {
+		parts[k] = change.String()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Counterfactuals searches for the smallest changes to the normalized
+// continuous features (those ending in "_norm") of a rejected row that lift
+// its approval probability to the threshold. Each feature is first scanned
+// on its own, in both directions up to the [0, 1] range of the
+// normalization, and the first flipping grid point is tightened by
+// bisection; if no single feature is enough, features are changed
+// greedily one step at a time. Categorical one-hot columns are not changed,
+// since flipping them rarely describes something an applicant can act on.
+func Counterfactuals(clf models.Classifier, features []string, row []float64, scales map[string]LinearScale, config CounterfactualConfig) ([]Counterfactual, error) {
+	if len(row) != len(features) {
+		return nil, fmt.Errorf("row has %d values but %d feature names", len(row), len(features))
+	}
+	if config.Step <= 0 || config.Step > 1 {
+		return nil, fmt.Errorf("step must be in (0, 1], got %v", config.Step)
+	}
+
+	var mutable []int
+	for j, name := range features {
+		if strings.HasSuffix(name, "_norm") {
+			mutable = append(mutable, j)
+		}
+	}
+	if len(mutable) == 0 {
+		return nil, fmt.Errorf("no continuous features to change")
+	}
+
+	s := &searcher{clf: clf, features: features, scales: scales, config: config}
+	if s.predict([][]float64{row})[0] >= config.Threshold {
+		return nil, nil
+	}
+
+	var found []Counterfactual
+	for _, j := range mutable {
+		for _, dir := range []float64{1, -1} {
+			if cf, ok := s.scan(row, j, dir); ok {
+				found = append(found, cf)
+			}
+		}
+	}
+	if len(found) == 0 && config.MaxFeatures > 1 {
+		if cf, ok := s.greedy(row, mutable); ok {
+			found = append(found, cf)
+		}
+	}
+
+	sort.SliceStable(found, func(a, b int) bool {
+		return found[a].Cost < found[b].Cost
+	})
+	if config.Limit > 0 && len(found) > config.Limit {
+		found = found[:config.Limit]
+	}
+	return found, nil
+}
+
+// searcher holds the model and settings during a counterfactual search
+type searcher struct {
+	clf      models.Classifier
+	features []string
+	scales   map[string]LinearScale
+	config   CounterfactualConfig
+}
+
+// predict scores several candidate rows with one model call
+func (s *searcher) predict(rows [][]float64) []float64 {
+	X := mat.NewDense(len(rows), len(rows[0]), nil)
+	for i, r := range rows {
+		X.SetRow(i, r)
+	}
+	return s.clf.PredictProba(X)
+}
+
+// scan moves feature j in direction dir in grid steps and returns the
+// smallest move that reaches the threshold
+func (s *searcher) scan(row []float64, j int, dir float64) (Counterfactual, bool) {
+	var candidates [][]float64
+	for v := row[j] + dir*s.config.Step; v >= 0 && v <= 1; v += dir * s.config.Step {
+		c := append([]float64(nil), row...)
+		c[j] = v
+		candidates = append(candidates, c)
+	}
+	if len(candidates) == 0 {
+		return Counterfactual{}, false
+	}
+
+	for k, p := range s.predict(candidates) {
+		if p >= s.config.Threshold {
+			lo := row[j]
+			if k > 0 {
+				lo = candidates[k-1][j]
+			}
+			return s.refine(row, candidates[k], j, lo, p), true
+		}
+	}
+	return Counterfactual{}, false
+}
+
+// refineSteps is the number of bisection steps used to tighten a grid move
+const refineSteps = 20
+
+// refine bisects feature j between lo, which does not reach the threshold,
+// and the flipping value in changed, returning the smallest move found
+func (s *searcher) refine(row, changed []float64, j int, lo, prob float64) Counterfactual {
+	hi := changed[j]
+	probe := append([]float64(nil), changed...)
+	for step := 0; step < refineSteps; step++ {
+		probe[j] = (lo + hi) / 2
+		if p := s.predict([][]float64{probe})[0]; p >= s.config.Threshold {
+			hi, prob = probe[j], p
+		} else {
+			lo = probe[j]
+		}
+	}
+	probe[j] = hi
+	return s.counterfactual(row, probe, prob)
+}
+
+// greedy repeatedly takes the single step that raises the probability most,
+// changing at most MaxFeatures features, until the threshold is reached
+func (s *searcher) greedy(row []float64, mutable []int) (Counterfactual, bool) {
+	current := append([]float64(nil), row...)
+	changed := make(map[int]bool)
+	maxSteps := int(math.Ceil(1/s.config.Step)) * s.config.MaxFeatures
+
+	for step := 0; step < maxSteps; step++ {
+		var candidates [][]float64
+		var moved []int
+		for _, j := range mutable {
+			if !changed[j] && len(changed) >= s.config.MaxFeatures {
+				continue
+			}
+			for _, dir := range []float64{1, -1} {
+				v := current[j] + dir*s.config.Step
+				if v < 0 || v > 1 {
+					continue
+				}
+				c := append([]float64(nil), current...)
+				c[j] = v
+				candidates = append(candidates, c)
+				moved = append(moved, j)
+			}
+		}
+		if len(candidates) == 0 {
+			return Counterfactual{}, false
+		}
+
+		probs := s.predict(candidates)
+		best := 0
+		for k, p := range probs {
+			if p > probs[best] {
+				best = k
+			}
+		}
+
+		current = candidates[best]
+		changed[moved[best]] = true
+		if probs[best] >= s.config.Threshold {
+			return s.counterfactual(row, current, probs[best]), true
+		}
+	}
+	return Counterfactual{}, false
+}
+
+// counterfactual describes the differences between row and changed
+func (s *searcher) counterfactual(row, changed []float64, prob float64) Counterfactual {
+	cf := Counterfactual{Probability: prob}
+	for j := range row {
+		if changed[j] == row[j] {
+			continue
+		}
+		change := Change{Feature: s.features[j], From: row[j], To: changed[j]}
+		if scale, ok := s.scales[s.features[j]]; ok {
+			change.Raw = &RawChange{
+				Column: scale.Column,
+				From:   scale.Raw(row[j]),
+				To:     scale.Raw(changed[j]),
+			}
+		}
+		cf.Changes = append(cf.Changes, change)
+		cf.Cost += math.Abs(changed[j] - row[j])
+	}
+	return cf
+}
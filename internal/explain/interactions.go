@@ -0,0 +1,190 @@
+package explain
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+
+	"gonum.org/v1/gonum/mat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// InteractionConfig holds the parameters of the interaction search
+type InteractionConfig struct {
+	// SampleRows is the number of training rows the partial dependences are
+	// estimated on. The cost grows with its square.
+	SampleRows int
+	// MaxFeatures is the number of features with the strongest main effect
+	// whose pairs are tested
+	MaxFeatures int
+	// TopPairs is the number of pairs reported
+	TopPairs int
+	// Seed determines the sampled rows; zero draws a random one
+	Seed uint64
+}
+
+// DefaultInteractionConfig tests the pairs among the 8 strongest features
+// on 100 sampled rows and reports the top 10
+func DefaultInteractionConfig() InteractionConfig {
+	return InteractionConfig{
+		SampleRows:  100,
+		MaxFeatures: 8,
+		TopPairs:    10,
+	}
+}
+
+// Interaction is the interaction between two features
+type Interaction struct {
+	A, B string
+	// H is Friedman's H statistic: the share of the variance of the pair's
+	// joint partial dependence that the two one-way partial dependences do
+	// not explain, as a square root between 0 and 1
+	H float64
+	// Strength is the root mean square of that unexplained part, in
+	// approval probability, which is not inflated when the pair's joint
+	// effect is small
+	Strength float64
+}
+
+// FindInteractions estimates the pairwise interactions of clf's features
+// on sampled rows of data and returns the strongest pairs, strongest first.
+// A categorical field's one-hot columns count as one feature. The one-way
+// partial dependences pick the MaxFeatures features with the largest main
+// effect; only their pairs are tested.
+func FindInteractions(clf models.Classifier, data *models.FeatureMatrix, config InteractionConfig) ([]Interaction, error) {
+	if config.SampleRows < 2 || config.MaxFeatures < 2 || config.TopPairs <= 0 {
+		return nil, fmt.Errorf("interactions need at least 2 rows and 2 features, and a positive pair count")
+	}
+	for config.Seed == 0 {
+		config.Seed = rand.Uint64()
+	}
+
+	X := data.Dense()
+	rows, cols := X.Dims()
+	n := config.SampleRows
+	if n > rows {
+		n = rows
+	}
+	order := rand.New(rand.NewPCG(config.Seed, 0)).Perm(rows)[:n]
+	sample := mat.NewDense(n, cols, nil)
+	for k, i := range order {
+		sample.SetRow(k, X.RawRowView(i))
+	}
+
+	fields := data.Groups()
+	oneWay := make([][]float64, len(fields))
+	effect := make([]float64, len(fields))
+	for f, fd := range fields {
+		oneWay[f] = partialDependence(clf, sample, fd.Columns)
+		for _, v := range oneWay[f] {
+			effect[f] += v * v
+		}
+	}
+
+	strongest := make([]int, len(fields))
+	for f := range strongest {
+		strongest[f] = f
+	}
+	sort.SliceStable(strongest, func(a, b int) bool {
+		return effect[strongest[a]] > effect[strongest[b]]
+	})
+	if len(strongest) > config.MaxFeatures {
+		strongest = strongest[:config.MaxFeatures]
+	}
+
+	var pairs []Interaction
+	for a := 0; a < len(strongest); a++ {
+		for b := a + 1; b < len(strongest); b++ {
+			fa, fb := strongest[a], strongest[b]
+			pairCols := append(append([]int(nil), fields[fa].Columns...), fields[fb].Columns...)
+			joint := partialDependence(clf, sample, pairCols)
+
+			var residual, total float64
+			for i, v := range joint {
+				d := v - oneWay[fa][i] - oneWay[fb][i]
+				residual += d * d
+				total += v * v
+			}
+			pair := Interaction{A: fields[fa].Name, B: fields[fb].Name, Strength: math.Sqrt(residual / float64(n))}
+			if total > 0 {
+				pair.H = math.Sqrt(math.Min(residual/total, 1))
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+
+	sort.SliceStable(pairs, func(a, b int) bool {
+		return pairs[a].Strength > pairs[b].Strength
+	})
+	if len(pairs) > config.TopPairs {
+		pairs = pairs[:config.TopPairs]
+	}
+	return pairs, nil
+}
+
+// partialDependence returns, for each sampled row, the mean prediction over
+// all sampled rows with cols set to that row's values, centered to mean
+// zero. All the rows are scored with one model call.
+func partialDependence(clf models.Classifier, sample *mat.Dense, cols []int) []float64 {
+	n, p := sample.Dims()
+	grid := mat.NewDense(n*n, p, nil)
+	for i := 0; i < n; i++ {
+		at := sample.RawRowView(i)
+		for r := 0; r < n; r++ {
+			row := grid.RawRowView(i*n + r)
+			copy(row, sample.RawRowView(r))
+			for _, j := range cols {
+				row[j] = at[j]
+			}
+		}
+	}
+	probs := clf.PredictProba(grid)
+
+	pd := make([]float64, n)
+	mean := 0.0
+	for i := range pd {
+		for r := 0; r < n; r++ {
+			pd[i] += probs[i*n+r]
+		}
+		pd[i] /= float64(n)
+		mean += pd[i]
+	}
+	mean /= float64(n)
+	for i := range pd {
+		pd[i] -= mean
+	}
+	return pd
+}
+
+// SaveInteractions writes the ranked feature pairs to a CSV file,
+// gzip-compressed when the path ends in .gz
+func SaveInteractions(path string, pairs []Interaction) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating interactions file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Rank", "Feature A", "Feature B", "H", "Strength"})
+	for k, pair := range pairs {
+		writer.Write([]string{
+			strconv.Itoa(k + 1),
+			pair.A,
+			pair.B,
+			strconv.FormatFloat(pair.H, 'f', 4, 64),
+			strconv.FormatFloat(pair.Strength, 'f', 4, 64),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing interactions: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,212 @@
+package explain
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// PDPConfig holds the parameters of partial dependence
+type PDPConfig struct {
+	// GridPoints is the number of evenly spaced values the feature is set
+	// to, between its smallest and largest observed value
+	GridPoints int
+	// ICERows is the number of sampled rows whose individual curves are
+	// kept
+	ICERows int
+	// Seed determines the sampled rows; zero draws a random one
+	Seed uint64
+}
+
+// DefaultPDPConfig evaluates 20 grid values and keeps 50 individual curves
+func DefaultPDPConfig() PDPConfig {
+	return PDPConfig{
+		GridPoints: 20,
+		ICERows:    50,
+	}
+}
+
+// PartialDependence is how a model's approval probability changes with one
+// numeric feature
+type PartialDependence struct {
+	Feature string
+	// Grid holds the feature values in raw units, or normalized when the
+	// feature's scale is unknown
+	Grid []float64
+	// Average is the partial dependence: the mean probability over all the
+	// rows, weighted by their sample weights, with the feature set to each
+	// grid value
+	Average []float64
+	// ICE holds the individual conditional expectation curves of the
+	// sampled rows: each row's probability at every grid value
+	ICE [][]float64
+}
+
+// NumericFeatures returns the raw names of the matrix's numeric features,
+// the ones partial dependence can be computed for
+func NumericFeatures(data *models.FeatureMatrix) []string {
+	var names []string
+	for _, g := range data.Groups() {
+		if len(g.Columns) == 1 && !isCategorical(data, g.Columns[0]) {
+			names = append(names, g.Name)
+		}
+	}
+	return names
+}
+
+// isCategorical reports whether column j is a one-hot column
+func isCategorical(data *models.FeatureMatrix, j int) bool {
+	for _, cf := range data.Categorical {
+		if containsInt(cf.Columns, j) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsInt reports whether values contains v
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ComputePartialDependence sets the numeric feature to each grid value in
+// every row of data and scores the rows with clf. A row whose value was
+// missing is scored as if it had the grid value. scales, as from
+// NormalizationScales, converts the grid to raw units and may be nil.
+func ComputePartialDependence(clf models.Classifier, data *models.FeatureMatrix, feature string, scales map[string]LinearScale, config PDPConfig) (*PartialDependence, error) {
+	if config.GridPoints < 2 || config.ICERows < 0 {
+		return nil, fmt.Errorf("partial dependence needs at least 2 grid points and a non-negative ICE row count")
+	}
+	col := -1
+	for _, g := range data.Groups() {
+		if g.Name == feature {
+			if len(g.Columns) != 1 || isCategorical(data, g.Columns[0]) {
+				return nil, fmt.Errorf("feature %s is not numeric", feature)
+			}
+			col = g.Columns[0]
+		}
+	}
+	if col < 0 {
+		return nil, fmt.Errorf("feature %s is not in the data", feature)
+	}
+	for config.Seed == 0 {
+		config.Seed = rand.Uint64()
+	}
+
+	X := data.Dense()
+	rows, cols := X.Dims()
+	grid, err := featureGrid(data, X, col, config.GridPoints)
+	if err != nil {
+		return nil, fmt.Errorf("feature %s: %v", feature, err)
+	}
+
+	// Score every row at every grid value in one call, row i at grid value
+	// g landing at g*rows+i
+	expanded := mat.NewDense(len(grid)*rows, cols, nil)
+	var missing [][]int
+	if data.Missing != nil {
+		missing = make([][]int, len(grid)*rows)
+	}
+	for g, v := range grid {
+		for i := 0; i < rows; i++ {
+			row := expanded.RawRowView(g*rows + i)
+			copy(row, X.RawRowView(i))
+			row[col] = v
+			if missing == nil {
+				continue
+			}
+			for _, j := range data.Missing[i] {
+				if j != col {
+					missing[g*rows+i] = append(missing[g*rows+i], j)
+				}
+			}
+		}
+	}
+	probs := models.Score(clf, &models.FeatureMatrix{
+		X:           expanded,
+		Features:    data.Features,
+		Missing:     missing,
+		Categorical: data.Categorical,
+	})
+
+	pd := &PartialDependence{Feature: feature, Average: make([]float64, len(grid))}
+	for g := range grid {
+		total, weight := 0.0, 0.0
+		for i := 0; i < rows; i++ {
+			w := 1.0
+			if data.Weights != nil {
+				w = data.Weights[i]
+			}
+			total += w * probs[g*rows+i]
+			weight += w
+		}
+		if weight > 0 {
+			pd.Average[g] = total / weight
+		}
+	}
+
+	n := config.ICERows
+	if n > rows {
+		n = rows
+	}
+	sampled := rand.New(rand.NewPCG(config.Seed, 0)).Perm(rows)[:n]
+	sort.Ints(sampled)
+	for _, i := range sampled {
+		curve := make([]float64, len(grid))
+		for g := range grid {
+			curve[g] = probs[g*rows+i]
+		}
+		pd.ICE = append(pd.ICE, curve)
+	}
+
+	pd.Grid = grid
+	if scale, ok := scales[data.Features[col]]; ok {
+		pd.Grid = make([]float64, len(grid))
+		for g, v := range grid {
+			pd.Grid[g] = scale.Raw(v)
+		}
+	}
+	return pd, nil
+}
+
+// featureGrid returns points evenly spaced values between the smallest and
+// largest observed value of column col, or the distinct observed values
+// when there are fewer of them
+func featureGrid(data *models.FeatureMatrix, X *mat.Dense, col, points int) ([]float64, error) {
+	rows, _ := X.Dims()
+	distinct := make(map[float64]bool)
+	for i := 0; i < rows; i++ {
+		if data.IsMissing(i, col) {
+			continue
+		}
+		distinct[X.At(i, col)] = true
+	}
+	if len(distinct) < 2 {
+		return nil, fmt.Errorf("fewer than 2 distinct observed values")
+	}
+
+	values := make([]float64, 0, len(distinct))
+	for v := range distinct {
+		values = append(values, v)
+	}
+	sort.Float64s(values)
+	if len(values) <= points {
+		return values, nil
+	}
+
+	lo, hi := values[0], values[len(values)-1]
+	grid := make([]float64, points)
+	for g := range grid {
+		grid[g] = lo + (hi-lo)*float64(g)/float64(points-1)
+	}
+	return grid, nil
+}
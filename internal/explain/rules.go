@@ -0,0 +1,390 @@
+package explain
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// RuleConfig holds the limits of rule extraction
+type RuleConfig struct {
+	// MaxConditions bounds the length of a rule, which is the depth of the
+	// tree paths it is taken from
+	MaxConditions int
+	// MinCoverage is the smallest share of rows a rule has to match
+	MinCoverage float64
+	// MaxRules is the number of rules kept after ranking
+	MaxRules int
+}
+
+// DefaultRuleConfig returns rules of up to three conditions that match at
+// least 2% of the rows, keeping the best 20
+func DefaultRuleConfig() RuleConfig {
+	return RuleConfig{
+		MaxConditions: 3,
+		MinCoverage:   0.02,
+		MaxRules:      20,
+	}
+}
+
+// Condition is one split of a rule: Feature above Threshold, or at or below
+// it
+type Condition struct {
+	Feature   int
+	Threshold float64
+	Above     bool
+}
+
+// holds reports whether a row satisfies the condition
+func (c Condition) holds(row []float64) bool {
+	return (row[c.Feature] > c.Threshold) == c.Above
+}
+
+// Rule is a conjunction of conditions and the decision the model mostly
+// makes on the rows matching it
+type Rule struct {
+	Conditions []Condition
+	Approve    bool
+	// Support is the number of matching rows and Coverage their share.
+	// Precision is the share of them on which the model makes the rule's
+	// decision, and LabelPrecision the share whose actual outcome agrees.
+	Support        int
+	Coverage       float64
+	Precision      float64
+	LabelPrecision float64
+}
+
+// RuleSet is a ranked list of rules extracted from a model
+type RuleSet struct {
+	ModelName string
+	Rules     []Rule
+	features  []string
+	scales    map[string]LinearScale
+}
+
+// ExtractRules distills a random forest or gradient boosting model into
+// rules. Every path from a tree's root down to MaxConditions levels is a
+// candidate; conditions on the same feature and side are merged. Each
+// distinct candidate is scored on data against the model's own decisions,
+// and the rules with the highest precision (then coverage) that match
+// different rows are kept.
+func ExtractRules(name string, clf models.Classifier, data *models.FeatureMatrix, scales map[string]LinearScale, config RuleConfig) (*RuleSet, error) {
+	if config.MaxConditions <= 0 || config.MaxRules <= 0 {
+		return nil, fmt.Errorf("max conditions and max rules must be positive")
+	}
+
+	var roots []*models.TreeNode
+	switch m := clf.(type) {
+	case *models.RandomForestModel:
+		for _, tree := range m.Trees {
+			roots = append(roots, tree.Root)
+		}
+	case *models.GradientBoostingModel:
+		roots = m.Trees
+	case *models.DecisionTreeModel:
+		roots = []*models.TreeNode{m.Root}
+	default:
+		return nil, fmt.Errorf("cannot extract rules from %s", name)
+	}
+
+	candidates := make(map[string][]Condition)
+	for _, root := range roots {
+		collectPaths(root, nil, 0, config.MaxConditions, candidates)
+	}
+
+	X := data.Dense()
+	rows, _ := X.Dims()
+	decisions := decide(clf.PredictProba(X))
+
+	type scored struct {
+		rule    Rule
+		key     string
+		matched string
+	}
+	var all []scored
+	for key, conditions := range candidates {
+		rule, matched := scoreRule(conditions, X, decisions, data.Y)
+		if rule.Coverage = float64(rule.Support) / float64(rows); rule.Coverage >= config.MinCoverage {
+			all = append(all, scored{rule: rule, key: key, matched: matched})
+		}
+	}
+
+	sort.Slice(all, func(a, b int) bool {
+		ra, rb := all[a].rule, all[b].rule
+		if ra.Precision != rb.Precision {
+			return ra.Precision > rb.Precision
+		}
+		if ra.Support != rb.Support {
+			return ra.Support > rb.Support
+		}
+		if len(ra.Conditions) != len(rb.Conditions) {
+			return len(ra.Conditions) < len(rb.Conditions)
+		}
+		return all[a].key < all[b].key
+	})
+
+	// Rules matching exactly the same rows say the same thing, so only the
+	// first (shortest) of them is kept
+	set := &RuleSet{ModelName: name, features: data.Features, scales: scales}
+	seen := make(map[string]bool)
+	for _, sc := range all {
+		if len(set.Rules) == config.MaxRules {
+			break
+		}
+		if seen[sc.matched] {
+			continue
+		}
+		seen[sc.matched] = true
+		set.Rules = append(set.Rules, sc.rule)
+	}
+	return set, nil
+}
+
+// collectPaths adds the path to each child of n, down to depth levels
+// below the root, keyed so that equal rules from different trees coincide.
+// MaxConditions bounds the depth, so a path through categorical splits can
+// have more conditions.
+func collectPaths(n *models.TreeNode, path []Condition, level, depth int, out map[string][]Condition) {
+	if n == nil || n.IsLeaf() || level >= depth {
+		return
+	}
+	for _, above := range []bool{false, true} {
+		next := path
+		for _, c := range nodeConditions(n, above) {
+			next = mergeCondition(next, c)
+		}
+		out[conditionKey(next)] = next
+		child := n.Left
+		if above {
+			child = n.Right
+		}
+		collectPaths(child, next, level+1, depth, out)
+	}
+}
+
+// nodeConditions returns the conditions for taking the left (above false)
+// or right child of n. A categorical split becomes the one-hot columns of
+// the levels sent the other way being off.
+func nodeConditions(n *models.TreeNode, above bool) []Condition {
+	if !n.IsCategorical() {
+		return []Condition{{Feature: n.Feature, Threshold: n.Threshold, Above: above}}
+	}
+	var conditions []Condition
+	for k, j := range n.Columns {
+		if n.Categories[k] == above {
+			conditions = append(conditions, Condition{Feature: j, Threshold: 0.5})
+		}
+	}
+	return conditions
+}
+
+// mergeCondition returns path plus c, keeping only the tighter threshold
+// when path already has a condition on the same feature and side
+func mergeCondition(path []Condition, c Condition) []Condition {
+	merged := make([]Condition, 0, len(path)+1)
+	for _, p := range path {
+		if p.Feature == c.Feature && p.Above == c.Above {
+			if (c.Above && p.Threshold > c.Threshold) || (!c.Above && p.Threshold < c.Threshold) {
+				c.Threshold = p.Threshold
+			}
+			continue
+		}
+		merged = append(merged, p)
+	}
+	merged = append(merged, c)
+	sort.Slice(merged, func(a, b int) bool {
+		if merged[a].Feature != merged[b].Feature {
+			return merged[a].Feature < merged[b].Feature
+		}
+		return !merged[a].Above && merged[b].Above
+	})
+	return merged
+}
+
+// conditionKey identifies a sorted list of conditions
+func conditionKey(conditions []Condition) string {
+	parts := make([]string, len(conditions))
+	for k, c := range conditions {
+		parts[k] = fmt.Sprintf("%d/%t/%g", c.Feature, c.Above, c.Threshold)
+	}
+	return strings.Join(parts, ",")
+}
+
+// scoreRule counts the rows matching the conditions and takes the model's
+// majority decision on them as the rule's decision. It also returns a key
+// identifying the set of matched rows.
+func scoreRule(conditions []Condition, X *mat.Dense, decisions, labels []float64) (Rule, string) {
+	rule := Rule{Conditions: conditions}
+	rows, _ := X.Dims()
+	matched := make([]byte, rows)
+	approved, actual := 0, 0
+	for i := 0; i < rows; i++ {
+		row := X.RawRowView(i)
+		holds := true
+		for _, c := range conditions {
+			if !c.holds(row) {
+				holds = false
+				break
+			}
+		}
+		if !holds {
+			continue
+		}
+		rule.Support++
+		matched[i] = 1
+		if decisions[i] == 1 {
+			approved++
+		}
+		if labels[i] >= 0.5 {
+			actual++
+		}
+	}
+	if rule.Support == 0 {
+		return rule, string(matched)
+	}
+
+	rule.Approve = 2*approved >= rule.Support
+	if !rule.Approve {
+		approved = rule.Support - approved
+		actual = rule.Support - actual
+	}
+	rule.Precision = float64(approved) / float64(rule.Support)
+	rule.LabelPrecision = float64(actual) / float64(rule.Support)
+	return rule, string(matched)
+}
+
+// describe renders a condition: one-hot columns as the category they
+// encode, normalized columns in raw units when known
+func (s *RuleSet) describe(c Condition) string {
+	name := fmt.Sprintf("x[%d]", c.Feature)
+	if c.Feature < len(s.features) {
+		name = s.features[c.Feature]
+	}
+
+	if scale, ok := s.scales[name]; ok {
+		op := "<="
+		if c.Above {
+			op = ">"
+		}
+		return fmt.Sprintf("%s %s %.2f", scale.Column, op, scale.Raw(c.Threshold))
+	}
+	if k := strings.Index(name, "_"); k > 0 && !strings.HasSuffix(name, "_norm") && c.Threshold > 0 && c.Threshold < 1 {
+		op := "!="
+		if c.Above {
+			op = "="
+		}
+		return fmt.Sprintf("%s %s %s", name[:k], op, name[k+1:])
+	}
+
+	op := "<="
+	if c.Above {
+		op = ">"
+	}
+	return fmt.Sprintf("%s %s %.4f", name, op, c.Threshold)
+}
+
+// Text returns the rule's conditions joined with AND. Several excluded
+// levels of one categorical field are listed together.
+func (s *RuleSet) Text(r Rule) string {
+	var parts []string
+	fields := make(map[string]int)
+	excluded := make(map[int][]string)
+	for _, c := range r.Conditions {
+		part := s.describe(c)
+		field, level, ok := strings.Cut(part, " != ")
+		if !ok {
+			parts = append(parts, part)
+			continue
+		}
+		k, seen := fields[field]
+		if !seen {
+			k = len(parts)
+			fields[field] = k
+			parts = append(parts, field)
+		}
+		excluded[k] = append(excluded[k], level)
+	}
+	for k, levels := range excluded {
+		if len(levels) == 1 {
+			parts[k] += " != " + levels[0]
+		} else {
+			parts[k] += " not in {" + strings.Join(levels, ", ") + "}"
+		}
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// decisionName returns "approve" or "decline"
+func decisionName(approve bool) string {
+	if approve {
+		return "approve"
+	}
+	return "decline"
+}
+
+// SaveCSV writes the ranked rules to a CSV file, gzip-compressed when the
+// path ends in .gz
+func (s *RuleSet) SaveCSV(path string) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating rules file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Rank", "Rule", "Decision", "Support", "Coverage", "Precision", "Label Precision"})
+	for k, r := range s.Rules {
+		writer.Write([]string{
+			strconv.Itoa(k + 1),
+			s.Text(r),
+			decisionName(r.Approve),
+			strconv.Itoa(r.Support),
+			strconv.FormatFloat(r.Coverage, 'f', 4, 64),
+			strconv.FormatFloat(r.Precision, 'f', 4, 64),
+			strconv.FormatFloat(r.LabelPrecision, 'f', 4, 64),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing rules: %v", err)
+	}
+	return file.Close()
+}
+
+// WriteMarkdown writes the ranked rules as a Markdown table
+func (s *RuleSet) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s rules\n\n", s.ModelName)
+	b.WriteString("Precision is agreement with the model's decisions; label precision is agreement with the actual outcomes.\n\n")
+	b.WriteString("| Rank | Rule | Decision | Support | Coverage | Precision | Label Precision |\n")
+	b.WriteString("|---:|---|---|---:|---:|---:|---:|\n")
+	for k, r := range s.Rules {
+		fmt.Fprintf(&b, "| %d | %s | %s | %d | %.2f%% | %.2f%% | %.2f%% |\n",
+			k+1, s.Text(r), decisionName(r.Approve), r.Support, 100*r.Coverage, 100*r.Precision, 100*r.LabelPrecision)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// SaveMarkdown writes the Markdown table to path
+func (s *RuleSet) SaveMarkdown(path string) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating rules file: %v", err)
+	}
+	defer file.Close()
+
+	if err := s.WriteMarkdown(file); err != nil {
+		return fmt.Errorf("error writing rules: %v", err)
+	}
+	return file.Close()
+}
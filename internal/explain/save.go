@@ -0,0 +1,61 @@
+package explain
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// SaveCounterfactuals searches counterfactuals for every row the model
+// rejects and writes one line per counterfactual, gzip-compressed when the
+// path ends in .gz. Rows are numbered as in the predictions export. It
+// returns the number of rejected rows and how many of them could be flipped.
+func SaveCounterfactuals(path string, clf models.Classifier, data *models.FeatureMatrix, scales map[string]LinearScale, config CounterfactualConfig) (rejected, flipped int, err error) {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error creating counterfactuals file: %v", err)
+	}
+	defer file.Close()
+
+	X := data.Dense()
+	probs := clf.PredictProba(X)
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Row", "Probability", "Rank", "Changes", "New Probability", "Cost"})
+	for i, p := range probs {
+		if p >= config.Threshold {
+			continue
+		}
+		rejected++
+
+		found, err := Counterfactuals(clf, data.Features, X.RawRowView(i), scales, config)
+		if err != nil {
+			return rejected, flipped, fmt.Errorf("error explaining row %d: %v", i, err)
+		}
+		if len(found) == 0 {
+			writer.Write([]string{strconv.Itoa(i), strconv.FormatFloat(p, 'f', 4, 64), "", "", "", ""})
+			continue
+		}
+		flipped++
+
+		for k, cf := range found {
+			writer.Write([]string{
+				strconv.Itoa(i),
+				strconv.FormatFloat(p, 'f', 4, 64),
+				strconv.Itoa(k + 1),
+				cf.String(),
+				strconv.FormatFloat(cf.Probability, 'f', 4, 64),
+				strconv.FormatFloat(cf.Cost, 'f', 4, 64),
+			})
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return rejected, flipped, fmt.Errorf("error writing counterfactuals: %v", err)
+	}
+	return rejected, flipped, file.Close()
+}
@@ -0,0 +1,124 @@
+package explain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/preprocessing"
+)
+
+// LinearScale maps a normalized feature back to its raw column as
+// raw = Offset + Slope·normalized
+type LinearScale struct {
+	Column string
+	Offset float64
+	Slope  float64
+}
+
+// Raw converts a normalized value to raw units
+func (s LinearScale) Raw(normalized float64) float64 {
+	return s.Offset + s.Slope*normalized
+}
+
+// NormalizationScales recovers the min-max normalization of every "_norm"
+// column in a processed dataset from the raw column stored next to it. The
+// map is keyed by the normalized column name; columns whose raw values are
+// constant or missing are left out.
+func NormalizationScales(ds *dataset.Dataset) map[string]LinearScale {
+	scales := make(map[string]LinearScale)
+	for _, col := range ds.Columns() {
+		if !strings.HasSuffix(col.Name, "_norm") {
+			continue
+		}
+		rawName := strings.TrimSuffix(col.Name, "_norm")
+		raw, err := ds.Col(rawName)
+		if err != nil {
+			continue
+		}
+
+		// The mapping is affine, so the rows with the smallest and largest
+		// normalized values pin it down
+		norm, normOK := col.FloatValues()
+		vals, rawOK := raw.FloatValues()
+		lo, hi := -1, -1
+		for i := range norm {
+			if !normOK[i] || !rawOK[i] {
+				continue
+			}
+			if lo < 0 || norm[i] < norm[lo] {
+				lo = i
+			}
+			if hi < 0 || norm[i] > norm[hi] {
+				hi = i
+			}
+		}
+		if lo < 0 || norm[hi] == norm[lo] {
+			continue
+		}
+
+		slope := (vals[hi] - vals[lo]) / (norm[hi] - norm[lo])
+		scales[col.Name] = LinearScale{
+			Column: rawName,
+			Offset: vals[lo] - slope*norm[lo],
+			Slope:  slope,
+		}
+	}
+	return scales
+}
+
+// PipelineScales returns the normalization scales a fitted pipeline applies,
+// keyed like NormalizationScales by the normalized column name
+func PipelineScales(scalings []preprocessing.ColumnScaling) map[string]LinearScale {
+	scales := make(map[string]LinearScale, len(scalings))
+	for _, sc := range scalings {
+		scales[sc.Column+"_norm"] = LinearScale{Column: sc.Column, Offset: sc.Min, Slope: sc.Max - sc.Min}
+	}
+	return scales
+}
+
+// LoadNormalizationScales reads a processed CSV (optionally gzip-compressed)
+// and recovers its normalization scales
+func LoadNormalizationScales(path string) (map[string]LinearScale, error) {
+	file, err := dataset.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	ds, err := dataset.ReadCSV(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return NormalizationScales(ds), nil
+}
+
+// Normalized converts a raw value to the normalized scale
+func (s LinearScale) Normalized(raw float64) float64 {
+	return (raw - s.Offset) / s.Slope
+}
+
+// Normalizer converts raw values of the columns in scales to their
+// normalized scale, for rules written in raw units
+func Normalizer(scales map[string]LinearScale) models.Normalizer {
+	return func(column string, raw float64) (float64, bool) {
+		s, ok := scales[column+"_norm"]
+		if !ok {
+			return 0, false
+		}
+		return s.Normalized(raw), true
+	}
+}
+
+// Denormalizer converts normalized values of the columns in scales back to
+// raw units, for models dumped in terms of the raw data
+func Denormalizer(scales map[string]LinearScale) models.Denormalizer {
+	return func(feature string, normalized float64) (string, float64, bool) {
+		s, ok := scales[feature]
+		if !ok {
+			return "", 0, false
+		}
+		return s.Column, s.Raw(normalized), true
+	}
+}
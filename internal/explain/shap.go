@@ -0,0 +1,405 @@
+package explain
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// SHAPConfig holds the parameters of the KernelSHAP approximation
+type SHAPConfig struct {
+	// Background is the number of training rows that stand in for an
+	// absent feature
+	Background int
+	// Coalitions is the number of feature subsets the model is evaluated
+	// on. Every subset is used when there are no more than this many.
+	Coalitions int
+	// Seed determines the background rows and sampled subsets; zero draws
+	// a random one
+	Seed uint64
+}
+
+// DefaultSHAPConfig uses 50 background rows and 1024 feature subsets
+func DefaultSHAPConfig() SHAPConfig {
+	return SHAPConfig{
+		Background: 50,
+		Coalitions: 1024,
+	}
+}
+
+// Contribution is one feature's share of an applicant's approval
+// probability
+type Contribution struct {
+	Feature string
+	// Value describes the applicant's value of the feature
+	Value string
+	// SHAP is how much the feature moves the probability away from the
+	// base value
+	SHAP float64
+}
+
+// SHAPExplanation splits a model's approval probability for one applicant
+// into the base value and one contribution per raw feature, largest first.
+// The base value and the contributions add up to the probability.
+type SHAPExplanation struct {
+	Probability float64
+	// Base is the mean probability over the background rows
+	Base          float64
+	Contributions []Contribution
+}
+
+// SHAPExplainer computes KernelSHAP explanations of a model's predictions.
+// It works with every model type, since it only calls the model. The
+// subsets are drawn once, so every applicant is explained against the same
+// ones.
+type SHAPExplainer struct {
+	Config     SHAPConfig
+	clf        models.Classifier
+	background *models.FeatureMatrix
+	groups     []models.FeatureGroup
+	scales     map[string]LinearScale
+	coalitions [][]bool
+	// solve maps the values of the subsets to the contributions of all but
+	// the last group, by weighted least squares
+	solve *mat.Dense
+	base  float64
+}
+
+// NewSHAPExplainer samples background rows from trainData and the feature
+// subsets, and precomputes the regression. A categorical field's one-hot
+// columns count as one feature. scales, as from NormalizationScales,
+// describes values in raw units and may be nil.
+func NewSHAPExplainer(clf models.Classifier, trainData *models.FeatureMatrix, scales map[string]LinearScale, config SHAPConfig) (*SHAPExplainer, error) {
+	if config.Background <= 0 || config.Coalitions <= 0 {
+		return nil, fmt.Errorf("SHAP needs positive background and coalition counts")
+	}
+	for config.Seed == 0 {
+		config.Seed = rand.Uint64()
+	}
+	rng := rand.New(rand.NewPCG(config.Seed, 0))
+
+	rows := trainData.Rows()
+	n := config.Background
+	if n > rows {
+		n = rows
+	}
+	sampled := rng.Perm(rows)[:n]
+	sort.Ints(sampled)
+
+	e := &SHAPExplainer{
+		Config:     config,
+		clf:        clf,
+		background: trainData.Subset(sampled),
+		groups:     trainData.Groups(),
+		scales:     scales,
+	}
+	e.base = mean(models.Score(clf, e.background))
+
+	weights := e.sampleCoalitions(rng)
+	if len(e.groups) > 1 {
+		solve, err := regression(e.coalitions, weights)
+		if err != nil {
+			return nil, err
+		}
+		e.solve = solve
+	}
+	return e, nil
+}
+
+// sampleCoalitions picks the feature subsets and returns their regression
+// weights. Small feature counts enumerate every proper, non-empty subset
+// with its Shapley kernel weight. Otherwise subset sizes are drawn in
+// proportion to the kernel, each with its complement, and weigh equally.
+func (e *SHAPExplainer) sampleCoalitions(rng *rand.Rand) []float64 {
+	m := len(e.groups)
+	if m < 2 {
+		return nil
+	}
+
+	var weights []float64
+	if m < 31 && 1<<m-2 <= e.Config.Coalitions {
+		for mask := 1; mask < 1<<m-1; mask++ {
+			z := make([]bool, m)
+			size := 0
+			for j := range z {
+				z[j] = mask&(1<<j) != 0
+				if z[j] {
+					size++
+				}
+			}
+			e.coalitions = append(e.coalitions, z)
+			weights = append(weights, float64(m-1)/(math.Exp(logBinomial(m, size))*float64(size*(m-size))))
+		}
+		return weights
+	}
+
+	// Subset sizes are drawn with probability proportional to
+	// (m-1)/(s(m-s)), which the kernel's binomial factor cancels
+	cumulative := make([]float64, m)
+	for s := 1; s < m; s++ {
+		cumulative[s] = cumulative[s-1] + 1/float64(s*(m-s))
+	}
+	for len(e.coalitions)+1 < e.Config.Coalitions || len(e.coalitions) == 0 {
+		u := rng.Float64() * cumulative[m-1]
+		size := sort.SearchFloat64s(cumulative[1:], u) + 1
+		z := make([]bool, m)
+		for _, j := range rng.Perm(m)[:size] {
+			z[j] = true
+		}
+		complement := make([]bool, m)
+		for j := range z {
+			complement[j] = !z[j]
+		}
+		e.coalitions = append(e.coalitions, z, complement)
+		weights = append(weights, 1, 1)
+	}
+	return weights
+}
+
+// regression returns the matrix solving the constrained weighted least
+// squares problem of KernelSHAP. The last group's contribution is
+// eliminated with the constraint that the contributions add up, leaving
+// the columns z_j - z_last.
+func regression(coalitions [][]bool, weights []float64) (*mat.Dense, error) {
+	n, m := len(coalitions), len(coalitions[0])
+	A := mat.NewDense(n, m-1, nil)
+	WA := mat.NewDense(n, m-1, nil)
+	for c, z := range coalitions {
+		for j := 0; j < m-1; j++ {
+			v := indicator(z[j]) - indicator(z[m-1])
+			A.Set(c, j, v)
+			WA.Set(c, j, weights[c]*v)
+		}
+	}
+
+	// (AᵀWA + εI)⁻¹AᵀW, with a small ridge against subsets that leave the
+	// system singular
+	var gram mat.Dense
+	gram.Mul(A.T(), WA)
+	for j := 0; j < m-1; j++ {
+		gram.Set(j, j, gram.At(j, j)+1e-9)
+	}
+	var solve mat.Dense
+	if err := solve.Solve(&gram, WA.T()); err != nil {
+		if _, ok := err.(mat.Condition); !ok {
+			return nil, fmt.Errorf("error solving SHAP regression: %v", err)
+		}
+	}
+	return &solve, nil
+}
+
+// Explain splits the model's probability for row i of data into feature
+// contributions
+func (e *SHAPExplainer) Explain(data *models.FeatureMatrix, i int) (*SHAPExplanation, error) {
+	if i < 0 || i >= data.Rows() {
+		return nil, fmt.Errorf("row %d is out of range [0, %d)", i, data.Rows())
+	}
+	X := data.Dense()
+	row := X.RawRowView(i)
+	var missing []int
+	if data.Missing != nil {
+		missing = data.Missing[i]
+	}
+
+	explanation := &SHAPExplanation{
+		Probability: models.Score(e.clf, data.Subset([]int{i}))[0],
+		Base:        e.base,
+	}
+	delta := explanation.Probability - e.base
+
+	phi := make([]float64, len(e.groups))
+	if len(e.groups) == 1 {
+		phi[0] = delta
+	} else {
+		values := e.coalitionValues(row, missing)
+		last := len(e.groups) - 1
+		y := mat.NewVecDense(len(values), nil)
+		for c, v := range values {
+			y.SetVec(c, v-e.base-indicator(e.coalitions[c][last])*delta)
+		}
+		var solved mat.VecDense
+		solved.MulVec(e.solve, y)
+		phi[last] = delta
+		for j := 0; j < last; j++ {
+			phi[j] = solved.AtVec(j)
+			phi[last] -= phi[j]
+		}
+	}
+
+	for g, group := range e.groups {
+		explanation.Contributions = append(explanation.Contributions, Contribution{
+			Feature: group.Name,
+			Value:   e.describe(data, group, row, missing),
+			SHAP:    phi[g],
+		})
+	}
+	sort.SliceStable(explanation.Contributions, func(a, b int) bool {
+		return math.Abs(explanation.Contributions[a].SHAP) > math.Abs(explanation.Contributions[b].SHAP)
+	})
+	return explanation, nil
+}
+
+// coalitionValues returns, for each subset, the mean probability over the
+// background rows with the subset's features taken from row. Missing
+// values move with the values they belong to. All the rows are scored with
+// one model call.
+func (e *SHAPExplainer) coalitionValues(row []float64, missing []int) []float64 {
+	bg := e.background.Dense()
+	k, cols := bg.Dims()
+	composite := mat.NewDense(len(e.coalitions)*k, cols, nil)
+	var compositeMissing [][]int
+	if e.background.Missing != nil || missing != nil {
+		compositeMissing = make([][]int, len(e.coalitions)*k)
+	}
+
+	for c, z := range e.coalitions {
+		present := make(map[int]bool)
+		for g, in := range z {
+			if in {
+				for _, j := range e.groups[g].Columns {
+					present[j] = true
+				}
+			}
+		}
+		for b := 0; b < k; b++ {
+			out := composite.RawRowView(c*k + b)
+			copy(out, bg.RawRowView(b))
+			for j := range present {
+				out[j] = row[j]
+			}
+			if compositeMissing == nil {
+				continue
+			}
+			var marks []int
+			if e.background.Missing != nil {
+				for _, j := range e.background.Missing[b] {
+					if !present[j] {
+						marks = append(marks, j)
+					}
+				}
+			}
+			for _, j := range missing {
+				if present[j] {
+					marks = append(marks, j)
+				}
+			}
+			compositeMissing[c*k+b] = marks
+		}
+	}
+
+	probs := models.Score(e.clf, &models.FeatureMatrix{
+		X:           composite,
+		Features:    e.background.Features,
+		Missing:     compositeMissing,
+		Categorical: e.background.Categorical,
+	})
+	values := make([]float64, len(e.coalitions))
+	for c := range values {
+		values[c] = mean(probs[c*k : (c+1)*k])
+	}
+	return values
+}
+
+// describe formats the row's value of a feature: the level of a categorical
+// field, or the value of a numeric one in raw units when known
+func (e *SHAPExplainer) describe(data *models.FeatureMatrix, group models.FeatureGroup, row []float64, missing []int) string {
+	for _, j := range group.Columns {
+		if containsInt(missing, j) {
+			return "missing"
+		}
+	}
+	for _, cf := range data.Categorical {
+		if cf.Name != group.Name {
+			continue
+		}
+		for k, j := range cf.Columns {
+			if row[j] >= 0.5 {
+				return cf.Levels[k]
+			}
+		}
+		return "other"
+	}
+
+	j := group.Columns[0]
+	if scale, ok := e.scales[data.Features[j]]; ok {
+		return strconv.FormatFloat(scale.Raw(row[j]), 'f', 2, 64)
+	}
+	return strconv.FormatFloat(row[j], 'f', 4, 64)
+}
+
+// String lists the contributions, one per line
+func (x *SHAPExplanation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "probability %.4f = base %.4f", x.Probability, x.Base)
+	for _, c := range x.Contributions {
+		fmt.Fprintf(&b, "\n  %+.4f  %s = %s", c.SHAP, c.Feature, c.Value)
+	}
+	return b.String()
+}
+
+// indicator returns 1 for true and 0 for false
+func indicator(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// mean returns the mean of values
+func mean(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
+
+// logBinomial returns the log of the binomial coefficient C(n, k)
+func logBinomial(n, k int) float64 {
+	ln, _ := math.Lgamma(float64(n + 1))
+	lk, _ := math.Lgamma(float64(k + 1))
+	lnk, _ := math.Lgamma(float64(n - k + 1))
+	return ln - lk - lnk
+}
+
+// SaveSHAPExplanations writes the explanations of the given rows, one line
+// per feature, gzip-compressed when the path ends in .gz. Rows are numbered
+// as in the predictions export.
+func SaveSHAPExplanations(path string, rows []int, explanations []*SHAPExplanation) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating SHAP file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Row", "Probability", "Base", "Rank", "Feature", "Value", "SHAP"})
+	for n, x := range explanations {
+		for k, c := range x.Contributions {
+			writer.Write([]string{
+				strconv.Itoa(rows[n]),
+				strconv.FormatFloat(x.Probability, 'f', 4, 64),
+				strconv.FormatFloat(x.Base, 'f', 4, 64),
+				strconv.Itoa(k + 1),
+				c.Feature,
+				c.Value,
+				strconv.FormatFloat(c.SHAP, 'f', 4, 64),
+			})
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing SHAP explanations: %v", err)
+	}
+	return file.Close()
+}
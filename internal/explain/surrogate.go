@@ -0,0 +1,165 @@
+package explain
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// SurrogateKind selects the interpretable model fitted as a surrogate
+type SurrogateKind int
+
+const (
+	TreeSurrogate SurrogateKind = iota
+	LogisticSurrogate
+)
+
+// String returns the name of the surrogate kind
+func (k SurrogateKind) String() string {
+	switch k {
+	case TreeSurrogate:
+		return "tree"
+	case LogisticSurrogate:
+		return "logistic"
+	}
+	return fmt.Sprintf("SurrogateKind(%d)", int(k))
+}
+
+// ParseSurrogateKind parses "tree" or "logistic"
+func ParseSurrogateKind(s string) (SurrogateKind, error) {
+	switch s {
+	case "tree":
+		return TreeSurrogate, nil
+	case "logistic":
+		return LogisticSurrogate, nil
+	}
+	return 0, fmt.Errorf("unknown surrogate %q (want tree or logistic)", s)
+}
+
+// surrogateTreeConfig keeps the surrogate tree shallow enough to read
+var surrogateTreeConfig = models.DecisionTreeConfig{
+	Criterion:         models.Gini,
+	MaxDepth:          4,
+	MinSamplesLeaf:    10,
+	CategoricalSplits: true,
+}
+
+// Surrogate is an interpretable model trained to mimic another model's
+// decisions
+type Surrogate struct {
+	Kind  SurrogateKind
+	Model models.Classifier
+	// TrainFidelity and TestFidelity are the shares of rows on which the
+	// surrogate makes the same decision as the original model
+	TrainFidelity float64
+	TestFidelity  float64
+}
+
+// FitSurrogate trains a surrogate on the decisions clf makes on the
+// training rows, rather than on the true labels, and measures how often the
+// two agree on the training and test rows
+func FitSurrogate(clf models.Classifier, trainData, testData *models.FeatureMatrix, kind SurrogateKind) (*Surrogate, error) {
+	s := &Surrogate{Kind: kind}
+	switch kind {
+	case TreeSurrogate:
+		// Split on whole categorical fields, which read as "A9 in {t}"
+		// rather than as thresholds on one-hot columns
+		tree := models.NewDecisionTreeModel(surrogateTreeConfig)
+		tree.SetCategorical(trainData.Categorical)
+		s.Model = tree
+	case LogisticSurrogate:
+		s.Model = models.NewLogisticRegressionModel(models.DefaultLogisticRegressionConfig())
+	default:
+		return nil, fmt.Errorf("unknown surrogate kind %v", kind)
+	}
+
+	X := trainData.Dense()
+	decisions := decide(clf.PredictProba(X))
+	if err := s.Model.Fit(X, decisions); err != nil {
+		return nil, fmt.Errorf("error fitting %s surrogate: %v", kind, err)
+	}
+
+	s.TrainFidelity = agreement(decisions, decide(s.Model.PredictProba(X)))
+	testX := testData.Dense()
+	s.TestFidelity = agreement(decide(clf.PredictProba(testX)), decide(s.Model.PredictProba(testX)))
+	return s, nil
+}
+
+// decide turns probabilities into 0/1 decisions at 0.5
+func decide(probs []float64) []float64 {
+	decisions := make([]float64, len(probs))
+	for i, p := range probs {
+		if p >= 0.5 {
+			decisions[i] = 1
+		}
+	}
+	return decisions
+}
+
+// agreement returns the share of equal decisions
+func agreement(a, b []float64) float64 {
+	if len(a) == 0 {
+		return 0
+	}
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(a))
+}
+
+// Write describes the surrogate: the tree's rules, or the logistic
+// regression's coefficients from the largest in magnitude down. scales, as
+// from PipelineScales, puts the tree's thresholds in raw units.
+func (s *Surrogate) Write(w io.Writer, features []string, scales map[string]LinearScale) error {
+	if _, err := fmt.Fprintf(w, "%s surrogate, fidelity %.4f train / %.4f test\n\n", s.Kind, s.TrainFidelity, s.TestFidelity); err != nil {
+		return err
+	}
+
+	switch m := s.Model.(type) {
+	case *models.DecisionTreeModel:
+		return m.DumpRaw(w, features, Denormalizer(scales))
+	case *models.LogisticRegressionModel:
+		order := make([]int, len(m.Weights))
+		for j := range order {
+			order[j] = j
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return math.Abs(m.Weights[order[a]]) > math.Abs(m.Weights[order[b]])
+		})
+		if _, err := fmt.Fprintf(w, "%-20s %10.4f\n", "(intercept)", m.Intercept); err != nil {
+			return err
+		}
+		for _, j := range order {
+			name := fmt.Sprintf("x[%d]", j)
+			if j < len(features) {
+				name = features[j]
+			}
+			if _, err := fmt.Fprintf(w, "%-20s %10.4f\n", name, m.Weights[j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Save writes the surrogate description to path, gzip-compressed when the
+// path ends in .gz
+func (s *Surrogate) Save(path string, features []string, scales map[string]LinearScale) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating surrogate file: %v", err)
+	}
+	defer file.Close()
+
+	if err := s.Write(file, features, scales); err != nil {
+		return fmt.Errorf("error writing surrogate: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,90 @@
+package explain_test
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/benchmark"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/explain"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/preprocessing"
+)
+
+// TestTreeSurrogateReadsInRawUnits checks that the surrogate rules name
+// categorical fields by their levels and give thresholds in the units of
+// the raw data rather than of the normalized and one-hot columns
+func TestTreeSurrogateReadsInRawUnits(t *testing.T) {
+	data, err := benchmark.CreditData(benchmark.Records(600, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Seed = 1
+	train, test := data.Split(preprocessing.TestSize)
+	prep := preprocessing.NewPipeline(nil, false)
+	if err := prep.Fit(train); err != nil {
+		t.Fatal(err)
+	}
+	for _, cd := range []*preprocessing.CreditData{train, test} {
+		if err := prep.Transform(cd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	features := models.FeatureColumns(train.Data)
+	trainData, err := models.NewFeatureMatrix(train.Data, features)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testData, err := models.NewFeatureMatrix(test.Data, features)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clf := models.NewLogisticRegressionModel(models.DefaultLogisticRegressionConfig())
+	if err := clf.Fit(trainData.Dense(), trainData.Y); err != nil {
+		t.Fatal(err)
+	}
+	surrogate, err := explain.FitSurrogate(clf, trainData, testData, explain.TreeSurrogate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := surrogate.Write(&b, trainData.Features, explain.PipelineScales(prep.Scalings)); err != nil {
+		t.Fatal(err)
+	}
+
+	ranges := make(map[string]preprocessing.ColumnScaling)
+	for _, sc := range prep.Scalings {
+		ranges[sc.Column] = sc
+	}
+	threshold := regexp.MustCompile(`\|--- (\S+) (<=|>) +(\S+)$`)
+	splits := 0
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if strings.Contains(line, "_norm") {
+			t.Errorf("rule on a normalized column: %s", line)
+		}
+		if strings.Contains(line, " in {") {
+			splits++
+			continue
+		}
+		m := threshold.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		splits++
+		sc, ok := ranges[m[1]]
+		if !ok {
+			t.Errorf("threshold on %s, which is not a raw continuous column: %s", m[1], line)
+			continue
+		}
+		value, err := strconv.ParseFloat(m[3], 64)
+		if err != nil || value < sc.Min || value > sc.Max {
+			t.Errorf("threshold %s is outside the raw range [%g, %g] of %s", m[3], sc.Min, sc.Max, m[1])
+		}
+	}
+	if splits == 0 {
+		t.Errorf("surrogate has no splits:\n%s", b.String())
+	}
+}
@@ -0,0 +1,289 @@
+package fairness
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// FourFifths is the disparate impact ratio below which a group's approval
+// rate is conventionally taken as evidence of adverse impact
+const FourFifths = 0.8
+
+// Config holds the settings of a fairness audit
+type Config struct {
+	// Threshold is the approval probability at or above which an
+	// application is approved
+	Threshold float64
+	// Reference is the group the others are compared with. Empty means the
+	// group with the highest approval rate.
+	Reference string
+}
+
+// DefaultConfig approves at 0.5 and compares every group with the most
+// approved one
+func DefaultConfig() Config {
+	return Config{Threshold: 0.5}
+}
+
+// GroupMetrics are a model's decisions on the test applications of one
+// group of the sensitive attribute
+type GroupMetrics struct {
+	Group string
+	// Count is the summed sample weight of the group's applications
+	Count        float64
+	ApprovalRate float64
+	// TruePositiveRate is the approval rate of good applicants and
+	// FalsePositiveRate that of bad ones
+	TruePositiveRate  float64
+	FalsePositiveRate float64
+	// DisparateImpact is the group's approval rate over the reference
+	// group's, and the differences are the group's rates minus the
+	// reference group's
+	DisparateImpact  float64
+	ParityDifference float64
+	TPRDifference    float64
+	FPRDifference    float64
+}
+
+// Report is a model's fairness across the groups of a sensitive attribute
+type Report struct {
+	ModelName string
+	Attribute string
+	Reference string
+	Groups    []GroupMetrics
+	// DemographicParity is the largest gap between two groups' approval
+	// rates and DisparateImpact the lowest group's approval rate over the
+	// highest
+	DemographicParity float64
+	DisparateImpact   float64
+	// EqualOpportunity is the largest gap between two groups' true
+	// positive rates, and EqualizedOdds the larger of that and the largest
+	// gap between their false positive rates
+	EqualOpportunity float64
+	EqualizedOdds    float64
+}
+
+// SensitiveGroups returns the group of each row of data for attribute, a
+// raw feature of the matrix. Rows of a categorical attribute belong to their
+// level, or to "missing" when it was not recorded; rows of a numeric one are
+// split at its median, since no other cut is neutral.
+func SensitiveGroups(data *models.FeatureMatrix, attribute string) ([]string, error) {
+	groups := make([]string, data.Rows())
+	X := data.Dense()
+	for _, cf := range data.Categorical {
+		if cf.Name != attribute {
+			continue
+		}
+		for i := range groups {
+			groups[i] = "missing"
+			for k, j := range cf.Columns {
+				if X.At(i, j) == 1 {
+					groups[i] = cf.Levels[k]
+					break
+				}
+			}
+		}
+		return groups, nil
+	}
+
+	for _, group := range data.Groups() {
+		if group.Name != attribute {
+			continue
+		}
+		j := group.Columns[0]
+		var values []float64
+		for i := range groups {
+			if !data.IsMissing(i, j) {
+				values = append(values, X.At(i, j))
+			}
+		}
+		sort.Float64s(values)
+		if len(values) == 0 {
+			return nil, fmt.Errorf("sensitive attribute %s has no values", attribute)
+		}
+		median := values[len(values)/2]
+		for i := range groups {
+			switch {
+			case data.IsMissing(i, j):
+				groups[i] = "missing"
+			case X.At(i, j) < median:
+				groups[i] = "below median"
+			default:
+				groups[i] = "at or above median"
+			}
+		}
+		return groups, nil
+	}
+	return nil, fmt.Errorf("sensitive attribute %s is not a feature of the data", attribute)
+}
+
+// Audit measures how result's test decisions differ across groups, which
+// holds the group of each test row
+func Audit(result *models.ModelResult, attribute string, groups []string, config Config) (*Report, error) {
+	if len(groups) != len(result.Probabilities) {
+		return nil, fmt.Errorf("%d groups for %d %s test predictions", len(groups), len(result.Probabilities), result.ModelName)
+	}
+
+	type tally struct {
+		count, approved, good, goodApproved, bad, badApproved float64
+	}
+	tallies := make(map[string]*tally)
+	for i, p := range result.Probabilities {
+		w := 1.0
+		if result.Weights != nil {
+			w = result.Weights[i]
+		}
+		t, ok := tallies[groups[i]]
+		if !ok {
+			t = &tally{}
+			tallies[groups[i]] = t
+		}
+		approved := p >= config.Threshold
+		t.count += w
+		if approved {
+			t.approved += w
+		}
+		if result.Labels[i] >= 0.5 {
+			t.good += w
+			if approved {
+				t.goodApproved += w
+			}
+		} else {
+			t.bad += w
+			if approved {
+				t.badApproved += w
+			}
+		}
+	}
+	if len(tallies) < 2 {
+		return nil, fmt.Errorf("sensitive attribute %s has only one group among the test applications", attribute)
+	}
+
+	report := &Report{ModelName: result.ModelName, Attribute: attribute}
+	for group, t := range tallies {
+		report.Groups = append(report.Groups, GroupMetrics{
+			Group:             group,
+			Count:             t.count,
+			ApprovalRate:      rate(t.approved, t.count),
+			TruePositiveRate:  rate(t.goodApproved, t.good),
+			FalsePositiveRate: rate(t.badApproved, t.bad),
+		})
+	}
+	sort.Slice(report.Groups, func(a, b int) bool {
+		return report.Groups[a].Group < report.Groups[b].Group
+	})
+
+	reference := -1
+	for k, g := range report.Groups {
+		if config.Reference == "" && (reference < 0 || g.ApprovalRate > report.Groups[reference].ApprovalRate) ||
+			config.Reference != "" && g.Group == config.Reference {
+			reference = k
+		}
+	}
+	if reference < 0 {
+		return nil, fmt.Errorf("reference group %s does not occur among the test applications", config.Reference)
+	}
+	report.Reference = report.Groups[reference].Group
+
+	ref := report.Groups[reference]
+	minRate, maxRate := math.Inf(1), math.Inf(-1)
+	minTPR, maxTPR := math.Inf(1), math.Inf(-1)
+	minFPR, maxFPR := math.Inf(1), math.Inf(-1)
+	for k := range report.Groups {
+		g := &report.Groups[k]
+		g.DisparateImpact = ratio(g.ApprovalRate, ref.ApprovalRate)
+		g.ParityDifference = g.ApprovalRate - ref.ApprovalRate
+		g.TPRDifference = g.TruePositiveRate - ref.TruePositiveRate
+		g.FPRDifference = g.FalsePositiveRate - ref.FalsePositiveRate
+		minRate, maxRate = math.Min(minRate, g.ApprovalRate), math.Max(maxRate, g.ApprovalRate)
+		minTPR, maxTPR = math.Min(minTPR, g.TruePositiveRate), math.Max(maxTPR, g.TruePositiveRate)
+		minFPR, maxFPR = math.Min(minFPR, g.FalsePositiveRate), math.Max(maxFPR, g.FalsePositiveRate)
+	}
+	report.DemographicParity = maxRate - minRate
+	report.DisparateImpact = ratio(minRate, maxRate)
+	report.EqualOpportunity = maxTPR - minTPR
+	report.EqualizedOdds = math.Max(report.EqualOpportunity, maxFPR-minFPR)
+	return report, nil
+}
+
+// rate returns part over whole, or 0 for an empty whole
+func rate(part, whole float64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return part / whole
+}
+
+// ratio returns a over b, which is 1 when both are zero since no group is
+// approved more than the other
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 1
+	}
+	return a / b
+}
+
+// PrintReport prints a model's per-group approval rates and its disparity
+// metrics, flagging groups below the four-fifths rule
+func PrintReport(report *Report) {
+	fmt.Printf("\nFairness of %s across %s (reference group %s):\n", report.ModelName, report.Attribute, report.Reference)
+	fmt.Printf("%-20s %-10s %-10s %-10s %-10s %-10s\n", "Group", "Count", "Approval", "TPR", "FPR", "DI")
+	for _, g := range report.Groups {
+		flag := ""
+		if g.DisparateImpact < FourFifths {
+			flag = "  below four-fifths"
+		}
+		fmt.Printf("%-20s %-10.1f %-10.4f %-10.4f %-10.4f %-10.4f%s\n",
+			g.Group, g.Count, g.ApprovalRate, g.TruePositiveRate, g.FalsePositiveRate, g.DisparateImpact, flag)
+	}
+	fmt.Printf("Demographic parity difference: %.4f\n", report.DemographicParity)
+	fmt.Printf("Disparate impact ratio: %.4f\n", report.DisparateImpact)
+	fmt.Printf("Equal opportunity difference: %.4f\n", report.EqualOpportunity)
+	fmt.Printf("Equalized odds difference: %.4f\n", report.EqualizedOdds)
+}
+
+// SaveReports writes every model's per-group fairness metrics to a CSV
+// file, gzip-compressed when the path ends in .gz. Each model's rows are
+// followed by an "all" row holding its disparities across every group.
+func SaveReports(path string, reports []*Report) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating fairness report: %v", err)
+	}
+	defer file.Close()
+
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 4, 64)
+	}
+	writer := csv.NewWriter(file)
+	writer.Write([]string{
+		"Model", "Attribute", "Group", "Reference", "Count", "Approval Rate", "True Positive Rate", "False Positive Rate",
+		"Disparate Impact", "Demographic Parity Difference", "Equal Opportunity Difference", "Equalized Odds Difference",
+	})
+	for _, r := range reports {
+		for _, g := range r.Groups {
+			writer.Write([]string{
+				r.ModelName, r.Attribute, g.Group, r.Reference, format(g.Count),
+				format(g.ApprovalRate), format(g.TruePositiveRate), format(g.FalsePositiveRate),
+				format(g.DisparateImpact), format(g.ParityDifference), format(g.TPRDifference),
+				format(math.Max(math.Abs(g.TPRDifference), math.Abs(g.FPRDifference))),
+			})
+		}
+		writer.Write([]string{
+			r.ModelName, r.Attribute, "all", r.Reference, "", "", "", "",
+			format(r.DisparateImpact), format(r.DemographicParity), format(r.EqualOpportunity), format(r.EqualizedOdds),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing fairness report: %v", err)
+	}
+	return file.Close()
+}
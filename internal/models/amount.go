@@ -0,0 +1,140 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// AmountModelName names the second stage of the two-stage model in the
+// evaluation output
+const AmountModelName = "Amount (Gradient Boosting)"
+
+// QuantileAmountModelName names the quantile regression forest variant of
+// the second stage
+const QuantileAmountModelName = "Amount (Quantile Forest)"
+
+// AmountResult is the second stage of a two-stage model: a regression of
+// the amount, such as the credit limit, fitted on the approved training
+// applications with a known amount. It is evaluated on the approved test
+// applications with a known amount, since only they were granted one.
+type AmountResult struct {
+	ModelName string
+	Model     Classifier
+	TrainRows int
+	// Metrics holds the model's test errors and Baseline those of always
+	// predicting the mean training amount
+	Metrics  RegressionMetrics
+	Baseline RegressionMetrics
+	// Predictions holds the predicted amount of every test application,
+	// approved or not, in test-set order
+	Predictions []float64
+	// Actual holds the amount of each approved test application with one,
+	// and NaN for the others
+	Actual []float64
+	// Coverage is the nominal coverage of the prediction intervals, Lower
+	// and Upper their bounds for every test application and Interval how
+	// they fare on the approved ones. They are zero and nil for a model
+	// without intervals.
+	Coverage float64
+	Lower    []float64
+	Upper    []float64
+	Interval IntervalMetrics
+}
+
+// DefaultAmountConfig returns the gradient boosting settings of the
+// classifier with squared loss
+func DefaultAmountConfig() GradientBoostingConfig {
+	config := DefaultGradientBoostingConfig()
+	config.Loss = SquaredLoss
+	return config
+}
+
+// TrainAmountModel fits the amount model on the approved training rows with
+// a known amount and scores every test row. The features are the ones the
+// approval models use, so both stages share preprocessing.
+func TrainAmountModel(trainData, testData *FeatureMatrix, config GradientBoostingConfig) (*AmountResult, error) {
+	if config.Loss != SquaredLoss {
+		return nil, fmt.Errorf("amount model needs squared loss, got %s", config.Loss)
+	}
+	return trainAmount(AmountModelName, NewGradientBoostingModel(config), trainData, testData)
+}
+
+// TrainQuantileAmountModel fits a quantile regression forest as the amount
+// model, like TrainAmountModel, and also gives every test application a
+// prediction interval holding its amount with the given coverage. With a
+// loss as the amount, the intervals bound each application's loss.
+func TrainQuantileAmountModel(trainData, testData *FeatureMatrix, config QuantileForestConfig, coverage float64) (*AmountResult, error) {
+	if coverage <= 0 || coverage >= 1 {
+		return nil, fmt.Errorf("interval coverage must be in (0, 1), got %v", coverage)
+	}
+	model := NewQuantileForestModel(config)
+	result, err := trainAmount(QuantileAmountModelName, model, trainData, testData)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Coverage = coverage
+	result.Lower, result.Upper = model.PredictInterval(denseInputs(model, testData), coverage)
+	result.Interval = IntervalErrors(result.Lower, result.Upper, result.Actual, testData.Weights)
+	return result, nil
+}
+
+// trainAmount fits the amount model on the approved training rows with a
+// known amount and evaluates it on every test row
+func trainAmount(name string, model Classifier, trainData, testData *FeatureMatrix) (*AmountResult, error) {
+	if trainData.Amounts == nil || testData.Amounts == nil {
+		return nil, fmt.Errorf("processed data has no %s column", AmountColumn)
+	}
+
+	rows := approvedWithAmount(trainData)
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("only %d approved training applications have an amount", len(rows))
+	}
+	train := trainData.Subset(rows)
+	train.Y = train.Amounts
+
+	if err := fitClassifier(model, train); err != nil {
+		return nil, fmt.Errorf("error fitting amount model: %v", err)
+	}
+
+	// Only approved test applications count towards the errors
+	actual := make([]float64, testData.Rows())
+	for i := range actual {
+		actual[i] = math.NaN()
+	}
+	for _, i := range approvedWithAmount(testData) {
+		actual[i] = testData.Amounts[i]
+	}
+
+	mean := 0.0
+	for _, y := range train.Y {
+		mean += y
+	}
+	mean /= float64(len(train.Y))
+	baseline := make([]float64, len(actual))
+	for i := range baseline {
+		baseline[i] = mean
+	}
+
+	predictions := predictProba(model, testData)
+	return &AmountResult{
+		ModelName:   name,
+		Model:       model,
+		TrainRows:   len(rows),
+		Metrics:     RegressionErrors(predictions, actual, testData.Weights),
+		Baseline:    RegressionErrors(baseline, actual, testData.Weights),
+		Predictions: predictions,
+		Actual:      actual,
+	}, nil
+}
+
+// approvedWithAmount returns the approved rows of data whose amount is known
+func approvedWithAmount(data *FeatureMatrix) []int {
+	var rows []int
+	for i, y := range data.Y {
+		if y >= 0.5 && !math.IsNaN(data.Amounts[i]) {
+			rows = append(rows, i)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,286 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// NaiveBayesConfig holds the smoothing parameters for naive Bayes
+type NaiveBayesConfig struct {
+	// Alpha is the additive (Laplace) smoothing for categorical features
+	Alpha float64
+	// VarSmoothing is added to every Gaussian variance, as a fraction of the
+	// largest feature variance
+	VarSmoothing float64
+	// MaxLevels is the largest number of distinct integer values for which a
+	// column is treated as categorical rather than Gaussian
+	MaxLevels int
+}
+
+// DefaultNaiveBayesConfig returns Laplace smoothing and sklearn's variance floor
+func DefaultNaiveBayesConfig() NaiveBayesConfig {
+	return NaiveBayesConfig{
+		Alpha:        1,
+		VarSmoothing: 1e-9,
+		MaxLevels:    10,
+	}
+}
+
+// nbKind is how naive Bayes models a feature
+type nbKind int
+
+const (
+	nbGaussian nbKind = iota
+	nbCategorical
+	nbOneHot
+)
+
+// nbFeature is one modeled feature. A one-hot group spans several columns
+// and is modeled as a single categorical variable.
+type nbFeature struct {
+	Kind nbKind
+	Cols []int
+	// Levels maps a raw categorical value to its level index
+	Levels map[float64]int
+	// LogProb holds the per-class log probability of each level; the last
+	// level stands for values not seen in training (or no hot column)
+	LogProb [2][]float64
+	// Mean and Var are the per-class Gaussian parameters
+	Mean [2]float64
+	Var  [2]float64
+}
+
+// NaiveBayesModel is a mixed Gaussian/categorical naive Bayes classifier.
+// Continuous columns get a Gaussian per class, integer-coded categoricals and
+// 0/1 columns get smoothed level frequencies, and one-hot columns sharing a
+// "<name>_" prefix are modeled together as the categorical they encode.
+type NaiveBayesModel struct {
+	Config       NaiveBayesConfig
+	FeatureNames []string
+	LogPrior     [2]float64
+	Features     []nbFeature
+}
+
+// NewNaiveBayesModel creates an untrained naive Bayes model
+func NewNaiveBayesModel(config NaiveBayesConfig) *NaiveBayesModel {
+	return &NaiveBayesModel{Config: config}
+}
+
+// SetFeatureNames records the column names used to find one-hot groups
+func (m *NaiveBayesModel) SetFeatureNames(names []string) {
+	m.FeatureNames = names
+}
+
+// Fit estimates the class priors and the per-class distribution of every feature
+func (m *NaiveBayesModel) Fit(X *mat.Dense, y []float64) error {
+	rows, cols := X.Dims()
+	if rows != len(y) {
+		return fmt.Errorf("feature matrix has %d rows but %d labels", rows, len(y))
+	}
+	if rows == 0 {
+		return fmt.Errorf("cannot fit naive Bayes on an empty matrix")
+	}
+	if m.Config.Alpha <= 0 {
+		return fmt.Errorf("alpha must be positive, got %v", m.Config.Alpha)
+	}
+	if m.FeatureNames != nil && len(m.FeatureNames) != cols {
+		return fmt.Errorf("matrix has %d columns but %d feature names", cols, len(m.FeatureNames))
+	}
+
+	var counts [2]float64
+	for _, label := range y {
+		counts[class(label)]++
+	}
+	if counts[0] == 0 || counts[1] == 0 {
+		return fmt.Errorf("training data must contain both classes")
+	}
+	for c := range counts {
+		m.LogPrior[c] = math.Log(counts[c] / float64(rows))
+	}
+
+	m.Features = m.groupFeatures(X)
+
+	// The variance floor is relative to the widest Gaussian feature
+	maxVar := 0.0
+	for f := range m.Features {
+		feat := &m.Features[f]
+		switch feat.Kind {
+		case nbGaussian:
+			col := mat.Col(nil, feat.Cols[0], X)
+			for c := 0; c < 2; c++ {
+				sum, sq := 0.0, 0.0
+				for i, v := range col {
+					if class(y[i]) == c {
+						sum += v
+						sq += v * v
+					}
+				}
+				feat.Mean[c] = sum / counts[c]
+				feat.Var[c] = sq/counts[c] - feat.Mean[c]*feat.Mean[c]
+				maxVar = math.Max(maxVar, feat.Var[c])
+			}
+		default:
+			levels := feat.levelCount()
+			var freq [2][]float64
+			for c := range freq {
+				freq[c] = make([]float64, levels)
+			}
+			for i := 0; i < rows; i++ {
+				freq[class(y[i])][feat.level(X.RawRowView(i))]++
+			}
+			for c := range freq {
+				feat.LogProb[c] = make([]float64, levels)
+				denom := counts[c] + m.Config.Alpha*float64(levels)
+				for l, n := range freq[c] {
+					feat.LogProb[c][l] = math.Log((n + m.Config.Alpha) / denom)
+				}
+			}
+		}
+	}
+
+	floor := m.Config.VarSmoothing * maxVar
+	if floor == 0 {
+		floor = 1e-9
+	}
+	for f := range m.Features {
+		if m.Features[f].Kind == nbGaussian {
+			m.Features[f].Var[0] += floor
+			m.Features[f].Var[1] += floor
+		}
+	}
+
+	return nil
+}
+
+// groupFeatures decides how each column is modeled
+func (m *NaiveBayesModel) groupFeatures(X *mat.Dense) []nbFeature {
+	_, cols := X.Dims()
+
+	// Collect 0/1 columns into one-hot groups by name prefix
+	groups := make(map[string][]int)
+	var order []string
+	if m.FeatureNames != nil {
+		for j, name := range m.FeatureNames {
+			k := strings.LastIndex(name, "_")
+			if k <= 0 || strings.HasSuffix(name, "_norm") || !isBinary(mat.Col(nil, j, X)) {
+				continue
+			}
+			prefix := name[:k]
+			if _, ok := groups[prefix]; !ok {
+				order = append(order, prefix)
+			}
+			groups[prefix] = append(groups[prefix], j)
+		}
+	}
+
+	grouped := make(map[int]bool)
+	var features []nbFeature
+	for _, prefix := range order {
+		if len(groups[prefix]) < 2 {
+			continue
+		}
+		features = append(features, nbFeature{Kind: nbOneHot, Cols: groups[prefix]})
+		for _, j := range groups[prefix] {
+			grouped[j] = true
+		}
+	}
+
+	for j := 0; j < cols; j++ {
+		if grouped[j] {
+			continue
+		}
+		if levels := m.categoricalLevels(mat.Col(nil, j, X)); levels != nil {
+			features = append(features, nbFeature{Kind: nbCategorical, Cols: []int{j}, Levels: levels})
+		} else {
+			features = append(features, nbFeature{Kind: nbGaussian, Cols: []int{j}})
+		}
+	}
+	return features
+}
+
+// categoricalLevels returns the level index of each value when a column only
+// holds a few distinct integers, or nil if it should be treated as Gaussian
+func (m *NaiveBayesModel) categoricalLevels(col []float64) map[float64]int {
+	levels := make(map[float64]int)
+	for _, v := range col {
+		if v != math.Trunc(v) {
+			return nil
+		}
+		if _, ok := levels[v]; !ok {
+			if len(levels) == m.Config.MaxLevels {
+				return nil
+			}
+			levels[v] = len(levels)
+		}
+	}
+	return levels
+}
+
+// isBinary reports whether every value is 0 or 1
+func isBinary(col []float64) bool {
+	for _, v := range col {
+		if v != 0 && v != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// levelCount returns the number of levels including the unseen level
+func (f *nbFeature) levelCount() int {
+	if f.Kind == nbOneHot {
+		return len(f.Cols) + 1
+	}
+	return len(f.Levels) + 1
+}
+
+// level returns the level index of a row
+func (f *nbFeature) level(row []float64) int {
+	if f.Kind == nbOneHot {
+		for l, j := range f.Cols {
+			if row[j] >= 0.5 {
+				return l
+			}
+		}
+		return len(f.Cols)
+	}
+	if l, ok := f.Levels[row[f.Cols[0]]]; ok {
+		return l
+	}
+	return len(f.Levels)
+}
+
+// logLikelihood returns log P(row's value | class c)
+func (f *nbFeature) logLikelihood(row []float64, c int) float64 {
+	if f.Kind == nbGaussian {
+		d := row[f.Cols[0]] - f.Mean[c]
+		return -0.5*math.Log(2*math.Pi*f.Var[c]) - d*d/(2*f.Var[c])
+	}
+	return f.LogProb[c][f.level(row)]
+}
+
+// PredictProba returns the posterior probability of approval for each row of X
+func (m *NaiveBayesModel) PredictProba(X *mat.Dense) []float64 {
+	rows, _ := X.Dims()
+	probs := make([]float64, rows)
+	for i := range probs {
+		row := X.RawRowView(i)
+		logOdds := m.LogPrior[1] - m.LogPrior[0]
+		for f := range m.Features {
+			logOdds += m.Features[f].logLikelihood(row, 1) - m.Features[f].logLikelihood(row, 0)
+		}
+		probs[i] = sigmoid(logOdds)
+	}
+	return probs
+}
+
+// class maps a 0/1 label to its class index
+func class(label float64) int {
+	if label >= 0.5 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,424 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/mat"
+)
+
+// BoostingLoss is the loss minimized by gradient boosting
+type BoostingLoss int
+
+const (
+	// LogisticLoss is the binomial deviance used by logistic regression
+	LogisticLoss BoostingLoss = iota
+	// ExponentialLoss is the AdaBoost loss
+	ExponentialLoss
+	// SquaredLoss turns the model into a regression of y on the features,
+	// whose raw score is the prediction
+	SquaredLoss
+)
+
+// String returns the name of the loss
+func (l BoostingLoss) String() string {
+	switch l {
+	case LogisticLoss:
+		return "logistic"
+	case ExponentialLoss:
+		return "exponential"
+	case SquaredLoss:
+		return "squared"
+	}
+	return fmt.Sprintf("BoostingLoss(%d)", int(l))
+}
+
+// GradientBoostingConfig holds the training parameters for gradient boosting
+type GradientBoostingConfig struct {
+	Loss         BoostingLoss
+	Iterations   int
+	LearningRate float64
+	// MaxDepth and MinSamplesLeaf limit each regression tree
+	MaxDepth       int
+	MinSamplesLeaf int
+	// L2 regularizes leaf values
+	L2 float64
+	// Subsample is the fraction of training rows each tree sees
+	Subsample float64
+	// ValidationFraction of the training rows is held out for early stopping;
+	// zero disables early stopping
+	ValidationFraction float64
+	// EarlyStoppingRounds stops training after this many iterations without
+	// an improvement in validation loss
+	EarlyStoppingRounds int
+	// Seed determines the validation split and row subsamples. Zero draws a
+	// random seed, which Fit records here.
+	Seed uint64
+}
+
+// DefaultGradientBoostingConfig returns shallow trees with shrinkage and
+// early stopping on a 10% validation fold
+func DefaultGradientBoostingConfig() GradientBoostingConfig {
+	return GradientBoostingConfig{
+		Loss:                LogisticLoss,
+		Iterations:          300,
+		LearningRate:        0.1,
+		MaxDepth:            3,
+		MinSamplesLeaf:      5,
+		L2:                  1,
+		Subsample:           0.8,
+		ValidationFraction:  0.1,
+		EarlyStoppingRounds: 20,
+	}
+}
+
+// GradientBoostingModel is an additive model of regression trees fitted to
+// the gradient of the loss
+type GradientBoostingModel struct {
+	Config GradientBoostingConfig
+	// Base is the initial raw score before any tree is added
+	Base  float64
+	Trees []*TreeNode
+	// TrainLoss and ValidationLoss hold the loss after each iteration;
+	// ValidationLoss is empty when early stopping is disabled
+	TrainLoss      []float64
+	ValidationLoss []float64
+	// BestIteration is the number of trees kept after early stopping
+	BestIteration int
+}
+
+// NewGradientBoostingModel creates an untrained gradient boosting model
+func NewGradientBoostingModel(config GradientBoostingConfig) *GradientBoostingModel {
+	return &GradientBoostingModel{Config: config}
+}
+
+// LossCurve returns the training loss per boosting iteration
+func (m *GradientBoostingModel) LossCurve() []float64 {
+	return m.TrainLoss
+}
+
+// Fit adds one tree per iteration, each fitted with a Newton step to the
+// loss gradient on a subsample of the training rows
+func (m *GradientBoostingModel) Fit(X *mat.Dense, y []float64) error {
+	rows, _ := X.Dims()
+	if rows != len(y) {
+		return fmt.Errorf("feature matrix has %d rows but %d labels", rows, len(y))
+	}
+	if m.Config.Iterations <= 0 || m.Config.LearningRate <= 0 {
+		return fmt.Errorf("iterations and learning rate must be positive")
+	}
+	if m.Config.Subsample <= 0 || m.Config.Subsample > 1 {
+		return fmt.Errorf("subsample must be in (0, 1], got %v", m.Config.Subsample)
+	}
+	if m.Config.ValidationFraction < 0 || m.Config.ValidationFraction >= 1 {
+		return fmt.Errorf("validation fraction must be in [0, 1), got %v", m.Config.ValidationFraction)
+	}
+
+	if m.Config.Seed == 0 {
+		m.Config.Seed = newSeed()
+	}
+	rng := rand.New(rand.NewPCG(m.Config.Seed, 0))
+
+	// Hold out a validation fold for early stopping
+	perm := rng.Perm(rows)
+	nValid := int(m.Config.ValidationFraction * float64(rows))
+	valid, train := perm[:nValid], perm[nValid:]
+	if len(train) == 0 {
+		return fmt.Errorf("no training rows left after the validation split")
+	}
+	sort.Ints(train)
+
+	// The positive rate, or the mean target under squared loss
+	pos := 0.0
+	for _, i := range train {
+		pos += y[i]
+	}
+	m.Base = m.Config.Loss.baseScore(pos / float64(len(train)))
+
+	raw := X.RawMatrix()
+	scores := make([]float64, rows)
+	for i := range scores {
+		scores[i] = m.Base
+	}
+
+	grad := make([]float64, rows)
+	hess := make([]float64, rows)
+	b := &boostBuilder{
+		config: m.Config,
+		X:      raw,
+		grad:   grad,
+		hess:   hess,
+	}
+
+	m.Trees = m.Trees[:0]
+	m.TrainLoss = m.TrainLoss[:0]
+	m.ValidationLoss = m.ValidationLoss[:0]
+	m.BestIteration = 0
+	bestLoss := math.Inf(1)
+	sampleSize := int(math.Ceil(m.Config.Subsample * float64(len(train))))
+
+	for iter := 0; iter < m.Config.Iterations; iter++ {
+		for _, i := range train {
+			grad[i], hess[i] = m.Config.Loss.derivatives(y[i], scores[i])
+		}
+
+		// Sample the rows this tree is fitted on
+		sample := train
+		if sampleSize < len(train) {
+			sample = make([]int, sampleSize)
+			for k, j := range rng.Perm(len(train))[:sampleSize] {
+				sample[k] = train[j]
+			}
+		}
+
+		tree := b.build(sample, 0)
+		m.Trees = append(m.Trees, tree)
+
+		for i := 0; i < rows; i++ {
+			scores[i] += m.Config.LearningRate * tree.predict(raw.Data[i*raw.Stride:i*raw.Stride+raw.Cols])
+		}
+
+		m.TrainLoss = append(m.TrainLoss, m.Config.Loss.mean(y, scores, train))
+		if nValid == 0 {
+			continue
+		}
+
+		loss := m.Config.Loss.mean(y, scores, valid)
+		m.ValidationLoss = append(m.ValidationLoss, loss)
+		if loss < bestLoss {
+			bestLoss = loss
+			m.BestIteration = iter + 1
+		} else if m.Config.EarlyStoppingRounds > 0 && iter+1-m.BestIteration >= m.Config.EarlyStoppingRounds {
+			break
+		}
+	}
+
+	// Keep only the trees up to the best validation loss
+	if nValid == 0 {
+		m.BestIteration = len(m.Trees)
+	}
+	m.Trees = m.Trees[:m.BestIteration]
+	return nil
+}
+
+// PredictProba returns the probability of approval for each row of X, or
+// the predicted target under squared loss
+func (m *GradientBoostingModel) PredictProba(X *mat.Dense) []float64 {
+	raw := X.RawMatrix()
+	probs := make([]float64, raw.Rows)
+	for i := range probs {
+		row := raw.Data[i*raw.Stride : i*raw.Stride+raw.Cols]
+		score := m.Base
+		for _, tree := range m.Trees {
+			score += m.Config.LearningRate * tree.predict(row)
+		}
+		probs[i] = m.Config.Loss.probability(score)
+	}
+	return probs
+}
+
+// HandlesMissing reports that the trees route NaN features by their learned
+// missing-value direction
+func (m *GradientBoostingModel) HandlesMissing() bool {
+	return true
+}
+
+// baseScore returns the raw score that minimizes the loss for a constant
+// positive rate p, or target mean under squared loss
+func (l BoostingLoss) baseScore(p float64) float64 {
+	if l == SquaredLoss {
+		return p
+	}
+	p = math.Min(math.Max(p, 1e-6), 1-1e-6)
+	logit := math.Log(p / (1 - p))
+	if l == ExponentialLoss {
+		return logit / 2
+	}
+	return logit
+}
+
+// derivatives returns the negative gradient and the hessian of the loss for
+// one row with label y and raw score f
+func (l BoostingLoss) derivatives(y, f float64) (grad, hess float64) {
+	if l == SquaredLoss {
+		return y - f, 1
+	}
+	if l == ExponentialLoss {
+		s := 2*y - 1
+		e := math.Exp(-s * f)
+		return s * e, e
+	}
+	p := sigmoid(f)
+	return y - p, math.Max(p*(1-p), 1e-12)
+}
+
+// probability maps a raw score to the probability of the positive class,
+// or leaves it as the prediction under squared loss
+func (l BoostingLoss) probability(f float64) float64 {
+	if l == SquaredLoss {
+		return f
+	}
+	if l == ExponentialLoss {
+		return sigmoid(2 * f)
+	}
+	return sigmoid(f)
+}
+
+// mean returns the average loss over the given rows
+func (l BoostingLoss) mean(y, scores []float64, idx []int) float64 {
+	total := 0.0
+	for _, i := range idx {
+		f := scores[i]
+		if l == SquaredLoss {
+			total += (y[i] - f) * (y[i] - f) / 2
+			continue
+		}
+		if l == ExponentialLoss {
+			total += math.Exp(-(2*y[i] - 1) * f)
+			continue
+		}
+		// log(1 + e^f) - y·f, computed without overflow
+		total += math.Max(f, 0) + math.Log1p(math.Exp(-math.Abs(f))) - y[i]*f
+	}
+	return total / float64(len(idx))
+}
+
+// boostBuilder grows second-order regression trees on the current gradients.
+// When maxFeatures is positive each split only considers that many randomly
+// chosen features.
+type boostBuilder struct {
+	config      GradientBoostingConfig
+	X           blas64.General
+	grad        []float64
+	hess        []float64
+	maxFeatures int
+	rng         *rand.Rand
+}
+
+// candidateFeatures returns the features to consider for the next split
+func (b *boostBuilder) candidateFeatures() []int {
+	if b.maxFeatures <= 0 || b.maxFeatures >= b.X.Cols {
+		features := make([]int, b.X.Cols)
+		for f := range features {
+			features[f] = f
+		}
+		return features
+	}
+	return b.rng.Perm(b.X.Cols)[:b.maxFeatures]
+}
+
+// value returns the feature value of a row
+func (b *boostBuilder) value(row, feature int) float64 {
+	return b.X.Data[row*b.X.Stride+feature]
+}
+
+// row returns the feature values of a row
+func (b *boostBuilder) row(i int) []float64 {
+	return b.X.Data[i*b.X.Stride : i*b.X.Stride+b.X.Cols]
+}
+
+// build grows the subtree for the given rows. Leaf values are the Newton
+// step G/(H+λ) for the summed gradient and hessian of the leaf's rows.
+func (b *boostBuilder) build(idx []int, depth int) *TreeNode {
+	g, h := 0.0, 0.0
+	for _, i := range idx {
+		g += b.grad[i]
+		h += b.hess[i]
+	}
+
+	node := &TreeNode{
+		Feature: -1,
+		Value:   g / (h + b.config.L2),
+		Samples: len(idx),
+	}
+
+	minLeaf := b.config.MinSamplesLeaf
+	if minLeaf < 1 {
+		minLeaf = 1
+	}
+	if len(idx) < 2*minLeaf || (b.config.MaxDepth > 0 && depth >= b.config.MaxDepth) {
+		return node
+	}
+
+	split, gain, ok := b.bestSplit(idx, g, h, minLeaf)
+	if !ok {
+		return node
+	}
+
+	split.apply(node)
+	node.Gain = gain
+	left, right := partitionRows(node, idx, b.row)
+	node.Left = b.build(left, depth+1)
+	node.Right = b.build(right, depth+1)
+	return node
+}
+
+// bestSplit finds the threshold with the largest second-order gain
+// G_L²/(H_L+λ) + G_R²/(H_R+λ) - G²/(H+λ), sweeping each sorted feature once.
+// Rows missing the feature are tried on both sides, as in treeBuilder.
+func (b *boostBuilder) bestSplit(idx []int, g, h float64, minLeaf int) (split splitCandidate, bestGain float64, ok bool) {
+	lambda := b.config.L2
+	parent := g * g / (h + lambda)
+	bestGain = 1e-12
+
+	sorted := make([]int, len(idx))
+	for _, f := range b.candidateFeatures() {
+		present, missing := presentRows(idx, sorted, f, b.value)
+		missN := len(missing)
+		gm, hm := 0.0, 0.0
+		for _, i := range missing {
+			gm += b.grad[i]
+			hm += b.hess[i]
+		}
+
+		gl, hl := 0.0, 0.0
+		for k := 0; k < len(present); k++ {
+			gl += b.grad[present[k]]
+			hl += b.hess[present[k]]
+
+			cur, last := b.value(present[k], f), k == len(present)-1
+			if last && missN == 0 {
+				break
+			}
+			if !last && cur == b.value(present[k+1], f) {
+				continue
+			}
+			threshold := cur
+			if !last {
+				threshold = (cur + b.value(present[k+1], f)) / 2
+			}
+
+			for _, missingLeft := range []bool{true, false} {
+				leftN, gs, hs := k+1, gl, hl
+				if missingLeft {
+					if last {
+						continue
+					}
+					leftN, gs, hs = leftN+missN, gs+gm, hs+hm
+				}
+				if leftN < minLeaf || len(idx)-leftN < minLeaf {
+					continue
+				}
+				if missN == 0 {
+					missingLeft = 2*leftN >= len(idx)
+				}
+
+				gr, hr := g-gs, h-hs
+				gain := gs*gs/(hs+lambda) + gr*gr/(hr+lambda) - parent
+				if gain > bestGain {
+					bestGain = gain
+					split = splitCandidate{Feature: f, Threshold: threshold, MissingLeft: missingLeft}
+					ok = true
+				}
+				if missN == 0 {
+					break
+				}
+			}
+		}
+	}
+
+	return split, bestGain, ok
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"fmt"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Classifier is a binary classifier that can be trained on a feature matrix
+type Classifier interface {
+	// Fit trains the model on the rows of X and their 0/1 labels
+	Fit(X *mat.Dense, y []float64) error
+	// PredictProba returns the probability of the positive class for each row of X
+	PredictProba(X *mat.Dense) []float64
+}
+
+// LossReporter is implemented by classifiers that record their training loss
+// per epoch or boosting iteration
+type LossReporter interface {
+	LossCurve() []float64
+}
+
+// featureNamer is implemented by classifiers that use the column names of
+// the feature matrix, set before Fit is called
+type featureNamer interface {
+	SetFeatureNames(names []string)
+}
+
+// categoricalLearner is implemented by classifiers that treat the one-hot
+// columns of a categorical field as one feature, set before Fit is called
+type categoricalLearner interface {
+	SetCategorical(categorical []CategoricalFeature)
+}
+
+// MissingValueHandler is implemented by classifiers that accept NaN as a
+// missing value, so that unimputed features reach them as NaN instead of zero
+type MissingValueHandler interface {
+	HandlesMissing() bool
+}
+
+// denseInputs returns the dense features of data for clf, with missing
+// values as NaN when clf handles them
+func denseInputs(clf Classifier, data *FeatureMatrix) *mat.Dense {
+	if mh, ok := clf.(MissingValueHandler); ok && mh.HandlesMissing() {
+		return data.DenseWithMissing()
+	}
+	return data.Dense()
+}
+
+// newClassifier returns an untrained learner for the model type, or nil if
+// the type is unknown. Randomized learners use seed, where zero draws a
+// random one.
+func newClassifier(modelType ModelType, seed uint64) Classifier {
+	switch modelType {
+	case LogisticRegression:
+		return NewLogisticRegressionModel(DefaultLogisticRegressionConfig())
+	case DecisionTree:
+		return NewDecisionTreeModel(DefaultDecisionTreeConfig())
+	case RandomForest:
+		config := DefaultRandomForestConfig()
+		config.Seed = seed
+		return NewRandomForestModel(config)
+	case GradientBoosting:
+		config := DefaultGradientBoostingConfig()
+		config.Seed = seed
+		return NewGradientBoostingModel(config)
+	case KNN:
+		return NewKNNModel(DefaultKNNConfig())
+	case NaiveBayes:
+		return NewNaiveBayesModel(DefaultNaiveBayesConfig())
+	case LinearSVM:
+		config := DefaultLinearSVMConfig()
+		config.Seed = seed
+		return NewLinearSVMModel(config)
+	case MLP:
+		config := DefaultMLPConfig()
+		config.Seed = seed
+		return NewMLPModel(config)
+	}
+	return nil
+}
+
+// fitClassifier passes clf the feature names and categorical columns it
+// uses, then trains it on the sparse features when both the data and the
+// classifier support it, and on the dense features otherwise
+func fitClassifier(clf Classifier, data *FeatureMatrix) error {
+	if namer, ok := clf.(featureNamer); ok {
+		namer.SetFeatureNames(data.Features)
+	}
+	if learner, ok := clf.(categoricalLearner); ok {
+		learner.SetCategorical(data.Categorical)
+	}
+	if sc, ok := clf.(SparseClassifier); ok && data.Sparse != nil {
+		return sc.FitSparse(data.Sparse, data.Y)
+	}
+	return clf.Fit(denseInputs(clf, data), data.Y)
+}
+
+// predictProba scores data with clf, using the sparse features when both
+// support it
+func predictProba(clf Classifier, data *FeatureMatrix) []float64 {
+	if sc, ok := clf.(SparseClassifier); ok && data.Sparse != nil {
+		return sc.PredictProbaSparse(data.Sparse)
+	}
+	return clf.PredictProba(denseInputs(clf, data))
+}
+
+// Score returns the probability clf gives the positive class for each row
+// of data, passing missing values and sparse features the way training does
+func Score(clf Classifier, data *FeatureMatrix) []float64 {
+	return predictProba(clf, data)
+}
+
+// evaluateClassifier scores a trained classifier on the test set at a 0.5
+// threshold, weighting rows by the test sample weights, and builds its
+// ModelResult
+func evaluateClassifier(name string, clf Classifier, testData *FeatureMatrix) (*ModelResult, error) {
+	rows := testData.Rows()
+	if rows != len(testData.Y) {
+		return nil, fmt.Errorf("test matrix has %d rows but %d labels", rows, len(testData.Y))
+	}
+
+	probs := predictProba(clf, testData)
+
+	// Rows count by their sample weight, or once when there are none
+	weights := testData.Weights
+	confMatrix := map[string]map[string]float64{
+		"0": {"0": 0, "1": 0},
+		"1": {"0": 0, "1": 0},
+	}
+	correct, total := 0.0, 0.0
+	for i, p := range probs {
+		actual := "0"
+		if testData.Y[i] >= 0.5 {
+			actual = "1"
+		}
+		predicted := "0"
+		if p >= 0.5 {
+			predicted = "1"
+		}
+		w := WeightAt(weights, i)
+		confMatrix[actual][predicted] += w
+		total += w
+		if actual == predicted {
+			correct += w
+		}
+	}
+
+	precision, recall, f1 := calculatePRF(confMatrix)
+	specificity, balancedAccuracy, mcc, kappa := calculateAgreement(confMatrix)
+
+	accuracy := 0.0
+	if total > 0 {
+		accuracy = correct / total
+	}
+
+	return &ModelResult{
+		ModelName:        name,
+		Accuracy:         accuracy,
+		Precision:        precision,
+		Recall:           recall,
+		F1Score:          f1,
+		AUC:              AUC(probs, testData.Y, weights),
+		AveragePrecision: AveragePrecision(probs, testData.Y, weights),
+		KS:               KS(probs, testData.Y, weights),
+		Brier:            BrierScore(probs, testData.Y, weights),
+		Specificity:      specificity,
+		BalancedAccuracy: balancedAccuracy,
+		MCC:              mcc,
+		Kappa:            kappa,
+		ConfMatrix:       confMatrix,
+		Model:            clf,
+		Probabilities:    probs,
+		Labels:           append([]float64(nil), testData.Y...),
+		Weights:          append([]float64(nil), weights...),
+	}, nil
+}
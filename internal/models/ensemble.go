@@ -0,0 +1,172 @@
+package models
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// SelectedEnsembleName is the ModelName reported for the selected ensemble
+const SelectedEnsembleName = "Selected Ensemble"
+
+// EnsembleSelectionConfig holds the parameters for greedy ensemble selection
+type EnsembleSelectionConfig struct {
+	// ValidationFraction of the training rows is held out to score candidates
+	ValidationFraction float64
+	// MaxRounds bounds how many members (with repetition) are added
+	MaxRounds int
+	// Seed determines the validation split and the candidates retrained on
+	// it. Zero draws a random seed, which SelectEnsemble records in the
+	// ensemble's config.
+	Seed uint64
+}
+
+// DefaultEnsembleSelectionConfig returns a 20% validation fold and up to 25
+// selection rounds
+func DefaultEnsembleSelectionConfig() EnsembleSelectionConfig {
+	return EnsembleSelectionConfig{
+		ValidationFraction: 0.2,
+		MaxRounds:          25,
+	}
+}
+
+// EnsembleModel averages the probabilities of its members with the given
+// weights
+type EnsembleModel struct {
+	Config  EnsembleSelectionConfig
+	Names   []string
+	Members []Classifier
+	Weights []float64
+	// ValidationAUC is the AUC of the selected blend on the validation fold
+	ValidationAUC float64
+}
+
+// Fit refits every member on X
+func (m *EnsembleModel) Fit(X *mat.Dense, y []float64) error {
+	for k, member := range m.Members {
+		if err := member.Fit(X, y); err != nil {
+			return fmt.Errorf("error fitting ensemble member %s: %v", m.Names[k], err)
+		}
+	}
+	return nil
+}
+
+// PredictProba returns the weighted average of the members' probabilities
+func (m *EnsembleModel) PredictProba(X *mat.Dense) []float64 {
+	rows, _ := X.Dims()
+	probs := make([]float64, rows)
+	total := 0.0
+	for k, member := range m.Members {
+		for i, p := range member.PredictProba(X) {
+			probs[i] += m.Weights[k] * p
+		}
+		total += m.Weights[k]
+	}
+	for i := range probs {
+		probs[i] /= total
+	}
+	return probs
+}
+
+// String lists the members and their weights
+func (m *EnsembleModel) String() string {
+	parts := make([]string, len(m.Names))
+	for k, name := range m.Names {
+		parts[k] = fmt.Sprintf("%s x%g", name, m.Weights[k])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SelectEnsemble picks a weighted subset of the trained models by greedy
+// forward selection with replacement (Caruana et al.): each round adds the
+// candidate that most improves the validation AUC of the averaged
+// probabilities, stopping when no candidate helps. Candidates are retrained
+// on a split of the training data to get honest validation scores; the
+// ensemble itself blends the models in results, which saw all of it.
+func SelectEnsemble(trainData, testData *FeatureMatrix, results map[string]*ModelResult, config EnsembleSelectionConfig) (*ModelResult, error) {
+	if config.ValidationFraction <= 0 || config.ValidationFraction >= 1 {
+		return nil, fmt.Errorf("validation fraction must be in (0, 1), got %v", config.ValidationFraction)
+	}
+	if config.MaxRounds <= 0 {
+		return nil, fmt.Errorf("max rounds must be positive")
+	}
+	if config.Seed == 0 {
+		config.Seed = newSeed()
+	}
+
+	// Only built-in model types can be retrained for validation
+	var candidates []ModelType
+	for _, modelType := range AllModelTypes {
+		if result, ok := results[modelType.String()]; ok && result.Model != nil {
+			candidates = append(candidates, modelType)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no trained models to select from")
+	}
+
+	rng := rand.New(rand.NewPCG(config.Seed, 0))
+	perm := rng.Perm(len(trainData.Y))
+	nValid := int(config.ValidationFraction * float64(len(perm)))
+	if nValid == 0 || nValid == len(perm) {
+		return nil, fmt.Errorf("too few rows to hold out a validation set")
+	}
+	valid := perm[:nValid]
+	fit := perm[nValid:]
+	sort.Ints(valid)
+	sort.Ints(fit)
+	fitData := trainData.Subset(fit)
+	validData := trainData.Subset(valid)
+
+	validProbs := make([][]float64, len(candidates))
+	for k, modelType := range candidates {
+		clf := newClassifier(modelType, config.Seed)
+		if err := fitClassifier(clf, fitData); err != nil {
+			return nil, fmt.Errorf("error fitting %s for ensemble selection: %v", modelType, err)
+		}
+		validProbs[k] = predictProba(clf, validData)
+	}
+
+	counts := make([]int, len(candidates))
+	blend := make([]float64, nValid)
+	trial := make([]float64, nValid)
+	bestAUC := 0.5
+	for round := 0; round < config.MaxRounds; round++ {
+		best, bestRoundAUC := -1, bestAUC
+		for k := range candidates {
+			for i := range trial {
+				trial[i] = (blend[i]*float64(round) + validProbs[k][i]) / float64(round+1)
+			}
+			if auc := AUC(trial, validData.Y, validData.Weights); auc > bestRoundAUC+1e-12 {
+				best, bestRoundAUC = k, auc
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		counts[best]++
+		bestAUC = bestRoundAUC
+		for i := range blend {
+			blend[i] = (blend[i]*float64(round) + validProbs[best][i]) / float64(round+1)
+		}
+	}
+
+	ensemble := &EnsembleModel{Config: config, ValidationAUC: bestAUC}
+	for k, modelType := range candidates {
+		if counts[k] == 0 {
+			continue
+		}
+		ensemble.Names = append(ensemble.Names, modelType.String())
+		ensemble.Members = append(ensemble.Members, results[modelType.String()].Model)
+		ensemble.Weights = append(ensemble.Weights, float64(counts[k]))
+	}
+	if len(ensemble.Members) == 0 {
+		return nil, fmt.Errorf("no candidate improved on a random ranking")
+	}
+
+	return evaluateClassifier(SelectedEnsembleName, ensemble, testData)
+}
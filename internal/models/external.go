@@ -0,0 +1,184 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// ExternalConfig describes an external training process. The command is run
+// once per call with "fit" or "predict" appended to its arguments and speaks
+// JSON over stdin/stdout:
+//
+//	fit      stdin:  {"features": [...], "x": [[...], ...], "y": [...]}
+//	         stdout: {"model": <any JSON>}
+//	predict  stdin:  {"features": [...], "model": <from fit>, "x": [[...], ...]}
+//	         stdout: {"probabilities": [...]}
+//
+// Anything the process writes to stderr is included in error messages.
+type ExternalConfig struct {
+	Name    string
+	Command []string
+	// Timeout bounds each invocation; zero means no limit
+	Timeout time.Duration
+}
+
+// ExternalModel delegates training and scoring to an external process, so
+// algorithms implemented elsewhere (e.g. a Python worker) can be compared
+// with the Go models using the same preprocessing and evaluation
+type ExternalModel struct {
+	Config   ExternalConfig
+	Features []string
+	// State is the opaque model returned by the process's fit call
+	State json.RawMessage
+
+	// scoreErr is the error from the last PredictProba call
+	scoreErr error
+}
+
+// NewExternalModel creates an untrained external model
+func NewExternalModel(config ExternalConfig, features []string) *ExternalModel {
+	return &ExternalModel{Config: config, Features: features}
+}
+
+// externalRequest is the JSON sent to the external process
+type externalRequest struct {
+	Features []string        `json:"features"`
+	Model    json.RawMessage `json:"model,omitempty"`
+	X        [][]float64     `json:"x"`
+	Y        []float64       `json:"y,omitempty"`
+}
+
+// externalResponse is the JSON read back from the external process
+type externalResponse struct {
+	Model         json.RawMessage `json:"model"`
+	Probabilities []float64       `json:"probabilities"`
+}
+
+// Fit sends the training data to the process and keeps the model it returns
+func (m *ExternalModel) Fit(X *mat.Dense, y []float64) error {
+	rows, _ := X.Dims()
+	if rows != len(y) {
+		return fmt.Errorf("feature matrix has %d rows but %d labels", rows, len(y))
+	}
+
+	resp, err := m.call("fit", externalRequest{Features: m.Features, X: denseRows(X), Y: y})
+	if err != nil {
+		return err
+	}
+	if len(resp.Model) == 0 {
+		return fmt.Errorf("external fit returned no model")
+	}
+
+	m.State = resp.Model
+	return nil
+}
+
+// PredictProba asks the process to score X with the fitted model. Since the
+// Classifier interface has no error return, failures yield NaN probabilities
+// and are reported by Err.
+func (m *ExternalModel) PredictProba(X *mat.Dense) []float64 {
+	probs, err := m.Predict(X)
+	m.scoreErr = err
+	if err != nil {
+		rows, _ := X.Dims()
+		probs = make([]float64, rows)
+		for i := range probs {
+			probs[i] = math.NaN()
+		}
+	}
+	return probs
+}
+
+// Err returns the error from the last PredictProba call, if any
+func (m *ExternalModel) Err() error {
+	return m.scoreErr
+}
+
+// Predict asks the process to score X and returns any protocol error
+func (m *ExternalModel) Predict(X *mat.Dense) ([]float64, error) {
+	if m.State == nil {
+		return nil, fmt.Errorf("external model has not been fitted")
+	}
+
+	resp, err := m.call("predict", externalRequest{Features: m.Features, Model: m.State, X: denseRows(X)})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, _ := X.Dims()
+	if len(resp.Probabilities) != rows {
+		return nil, fmt.Errorf("external predict returned %d probabilities for %d rows", len(resp.Probabilities), rows)
+	}
+	return resp.Probabilities, nil
+}
+
+// call runs the process for one action and decodes its response
+func (m *ExternalModel) call(action string, req externalRequest) (*externalResponse, error) {
+	if len(m.Config.Command) == 0 {
+		return nil, fmt.Errorf("external model %s has no command", m.Config.Name)
+	}
+
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %s request: %v", action, err)
+	}
+
+	ctx := context.Background()
+	if m.Config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Config.Timeout)
+		defer cancel()
+	}
+
+	args := append(append([]string(nil), m.Config.Command[1:]...), action)
+	cmd := exec.CommandContext(ctx, m.Config.Command[0], args...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("external %s failed: %v: %s", action, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var resp externalResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("error decoding external %s response: %v", action, err)
+	}
+	return &resp, nil
+}
+
+// TrainExternalModel trains and evaluates an external model like any other
+func TrainExternalModel(trainData, testData *FeatureMatrix, config ExternalConfig) (*ModelResult, error) {
+	clf := NewExternalModel(config, trainData.Features)
+	if err := clf.Fit(trainData.Dense(), trainData.Y); err != nil {
+		return nil, fmt.Errorf("error fitting %s: %v", config.Name, err)
+	}
+
+	result, err := evaluateClassifier(config.Name, clf, testData)
+	if err != nil {
+		return nil, err
+	}
+	if err := clf.Err(); err != nil {
+		return nil, fmt.Errorf("error scoring %s: %v", config.Name, err)
+	}
+	return result, nil
+}
+
+// denseRows copies a matrix into a slice of rows for encoding
+func denseRows(X *mat.Dense) [][]float64 {
+	rows, cols := X.Dims()
+	out := make([][]float64, rows)
+	for i := range out {
+		out[i] = make([]float64, cols)
+		mat.Row(out[i], i, X)
+	}
+	return out
+}
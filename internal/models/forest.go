@@ -0,0 +1,229 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// FeatureSampling selects how many features each forest split considers
+type FeatureSampling int
+
+const (
+	SqrtFeatures FeatureSampling = iota
+	Log2Features
+	FractionFeatures
+	AllFeatures
+)
+
+// RandomForestConfig holds the training parameters for a random forest
+type RandomForestConfig struct {
+	Trees int
+	Tree  DecisionTreeConfig
+	// FeatureSampling picks the per-split feature count; FeatureFraction is
+	// only used with FractionFeatures
+	FeatureSampling FeatureSampling
+	FeatureFraction float64
+	// Workers bounds how many trees are grown concurrently; zero uses GOMAXPROCS
+	Workers int
+	// Seed determines the bootstrap samples and feature choices. Each tree
+	// draws from its own stream of the seed, so the forest does not depend
+	// on Workers or scheduling. Zero draws a random seed, which Fit records
+	// here.
+	Seed uint64
+}
+
+// DefaultRandomForestConfig returns a 100-tree forest of fully grown trees
+// with sqrt feature sampling
+func DefaultRandomForestConfig() RandomForestConfig {
+	return RandomForestConfig{
+		Trees: 100,
+		Tree: DecisionTreeConfig{
+			Criterion:         Gini,
+			MinSamplesLeaf:    1,
+			CategoricalSplits: true,
+		},
+		FeatureSampling: SqrtFeatures,
+	}
+}
+
+// RandomForestModel is a bagged ensemble of CART trees
+type RandomForestModel struct {
+	Config RandomForestConfig
+	Trees  []*DecisionTreeModel
+	// OOBError is the misclassification rate of out-of-bag predictions, and
+	// OOBRows is how many training rows had at least one out-of-bag tree
+	OOBError    float64
+	OOBRows     int
+	categorical []CategoricalFeature
+}
+
+// NewRandomForestModel creates an untrained random forest
+func NewRandomForestModel(config RandomForestConfig) *RandomForestModel {
+	return &RandomForestModel{Config: config}
+}
+
+// SetCategorical records the categorical fields the trees split on as a
+// whole
+func (m *RandomForestModel) SetCategorical(categorical []CategoricalFeature) {
+	m.categorical = categorical
+}
+
+// maxFeatures returns the number of features each split considers
+func (c RandomForestConfig) maxFeatures(cols int) int {
+	return c.FeatureSampling.count(cols, c.FeatureFraction)
+}
+
+// count returns how many of cols features a split considers, where
+// fraction is only used with FractionFeatures
+func (s FeatureSampling) count(cols int, fraction float64) int {
+	var k int
+	switch s {
+	case SqrtFeatures:
+		k = int(math.Sqrt(float64(cols)))
+	case Log2Features:
+		k = int(math.Log2(float64(cols)))
+	case FractionFeatures:
+		k = int(fraction * float64(cols))
+	default:
+		k = cols
+	}
+	if k < 1 {
+		k = 1
+	}
+	if k > cols {
+		k = cols
+	}
+	return k
+}
+
+// Fit grows each tree on a bootstrap sample of the rows, in parallel, and
+// estimates the out-of-bag error from the rows each tree did not see
+func (m *RandomForestModel) Fit(X *mat.Dense, y []float64) error {
+	rows, cols := X.Dims()
+	if rows != len(y) {
+		return fmt.Errorf("feature matrix has %d rows but %d labels", rows, len(y))
+	}
+	if m.Config.Trees <= 0 {
+		return fmt.Errorf("forest needs at least one tree")
+	}
+	if m.Config.FeatureSampling == FractionFeatures && (m.Config.FeatureFraction <= 0 || m.Config.FeatureFraction > 1) {
+		return fmt.Errorf("feature fraction must be in (0, 1], got %v", m.Config.FeatureFraction)
+	}
+
+	if m.Config.Seed == 0 {
+		m.Config.Seed = newSeed()
+	}
+
+	// A categorical field counts as one feature when sampling
+	maxFeatures := m.Config.maxFeatures(len(m.Config.Tree.splitUnits(cols, m.categorical)))
+	m.Trees = make([]*DecisionTreeModel, m.Config.Trees)
+	inBag := make([][]bool, m.Config.Trees)
+
+	workers := m.Config.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				rng := rand.New(rand.NewPCG(m.Config.Seed, uint64(t)))
+
+				// Draw a bootstrap sample of the rows
+				idx := make([]int, rows)
+				seen := make([]bool, rows)
+				for i := range idx {
+					idx[i] = rng.IntN(rows)
+					seen[idx[i]] = true
+				}
+
+				tree := NewDecisionTreeModel(m.Config.Tree)
+				tree.categorical = m.categorical
+				tree.fitRows(X, y, idx, maxFeatures, rng)
+				m.Trees[t] = tree
+				inBag[t] = seen
+			}
+		}()
+	}
+	for t := 0; t < m.Config.Trees; t++ {
+		jobs <- t
+	}
+	close(jobs)
+	wg.Wait()
+
+	m.estimateOOB(X, y, inBag)
+	return nil
+}
+
+// newSeed draws a random non-zero seed
+func newSeed() uint64 {
+	for {
+		if seed := rand.Uint64(); seed != 0 {
+			return seed
+		}
+	}
+}
+
+// estimateOOB scores every training row with only the trees that did not see
+// it during training
+func (m *RandomForestModel) estimateOOB(X *mat.Dense, y []float64, inBag [][]bool) {
+	raw := X.RawMatrix()
+
+	m.OOBRows = 0
+	errors := 0
+	for i := 0; i < raw.Rows; i++ {
+		row := raw.Data[i*raw.Stride : i*raw.Stride+raw.Cols]
+
+		sum := 0.0
+		votes := 0
+		for t, tree := range m.Trees {
+			if inBag[t][i] {
+				continue
+			}
+			sum += tree.Root.predict(row)
+			votes++
+		}
+		if votes == 0 {
+			continue
+		}
+
+		m.OOBRows++
+		if (sum/float64(votes) >= 0.5) != (y[i] >= 0.5) {
+			errors++
+		}
+	}
+
+	m.OOBError = 0
+	if m.OOBRows > 0 {
+		m.OOBError = float64(errors) / float64(m.OOBRows)
+	}
+}
+
+// PredictProba averages the leaf positive rates of all trees
+func (m *RandomForestModel) PredictProba(X *mat.Dense) []float64 {
+	raw := X.RawMatrix()
+	probs := make([]float64, raw.Rows)
+	for i := range probs {
+		row := raw.Data[i*raw.Stride : i*raw.Stride+raw.Cols]
+		for _, tree := range m.Trees {
+			probs[i] += tree.Root.predict(row)
+		}
+		probs[i] /= float64(len(m.Trees))
+	}
+	return probs
+}
+
+// HandlesMissing reports that the trees route NaN features by their learned
+// missing-value direction
+func (m *RandomForestModel) HandlesMissing() bool {
+	return true
+}
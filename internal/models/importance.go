@@ -0,0 +1,102 @@
+package models
+
+import "math"
+
+// FeatureImporter is implemented by models that measure how much each
+// feature column contributes to their fit
+type FeatureImporter interface {
+	// FeatureImportance returns a non-negative score for each of the
+	// features columns the model was trained on, normalized to sum to 1
+	// unless every score is zero
+	FeatureImportance(features int) []float64
+}
+
+// FeatureImportance returns the absolute coefficients. The features are
+// min-max normalized, so each coefficient is the change in log-odds across
+// the feature's observed range and the magnitudes are comparable.
+func (m *LogisticRegressionModel) FeatureImportance(features int) []float64 {
+	importance := make([]float64, features)
+	for j := range importance {
+		if j < len(m.Weights) {
+			importance[j] = math.Abs(m.Weights[j])
+		}
+	}
+	return normalizeImportance(importance)
+}
+
+// FeatureImportance returns the Gini importance: the total drop in
+// sample-weighted impurity over the splits on each column. A categorical
+// split counts towards the first of its one-hot columns.
+func (m *DecisionTreeModel) FeatureImportance(features int) []float64 {
+	importance := make([]float64, features)
+	addGain(m.Root, importance)
+	return normalizeImportance(importance)
+}
+
+// FeatureImportance averages the trees' Gini importances
+func (m *RandomForestModel) FeatureImportance(features int) []float64 {
+	importance := make([]float64, features)
+	for _, tree := range m.Trees {
+		for j, v := range tree.FeatureImportance(features) {
+			importance[j] += v / float64(len(m.Trees))
+		}
+	}
+	return normalizeImportance(importance)
+}
+
+// FeatureImportance returns the total gain of the splits on each column
+// over the trees kept after early stopping
+func (m *GradientBoostingModel) FeatureImportance(features int) []float64 {
+	importance := make([]float64, features)
+	for _, tree := range m.Trees {
+		addGain(tree, importance)
+	}
+	return normalizeImportance(importance)
+}
+
+// addGain adds the gain of every split in the subtree to its column
+func addGain(node *TreeNode, importance []float64) {
+	if node == nil || node.IsLeaf() {
+		return
+	}
+	if node.Feature < len(importance) {
+		importance[node.Feature] += node.Gain
+	}
+	addGain(node.Left, importance)
+	addGain(node.Right, importance)
+}
+
+// normalizeImportance scales the scores to sum to 1, leaving all-zero
+// scores as they are
+func normalizeImportance(importance []float64) []float64 {
+	total := 0.0
+	for _, v := range importance {
+		total += v
+	}
+	if total > 0 {
+		for j := range importance {
+			importance[j] /= total
+		}
+	}
+	return importance
+}
+
+// RawFeatureImportance returns a trained model's importance per raw
+// feature of data, summing the one-hot columns of a categorical field and
+// naming a normalized column after its raw column. It reports false when
+// the model does not measure importance.
+func RawFeatureImportance(clf Classifier, data *FeatureMatrix) (map[string]float64, bool) {
+	importer, ok := clf.(FeatureImporter)
+	if !ok {
+		return nil, false
+	}
+	scores := importer.FeatureImportance(len(data.Features))
+
+	importance := make(map[string]float64)
+	for _, g := range data.Groups() {
+		for _, j := range g.Columns {
+			importance[g.Name] += scores[j]
+		}
+	}
+	return importance, true
+}
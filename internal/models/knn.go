@@ -0,0 +1,242 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// DistanceMetric is the distance used to find nearest neighbors
+type DistanceMetric int
+
+const (
+	Euclidean DistanceMetric = iota
+	Manhattan
+	// Cosine is one minus the cosine similarity of two rows
+	Cosine
+)
+
+// String returns the name of the metric
+func (d DistanceMetric) String() string {
+	switch d {
+	case Euclidean:
+		return "euclidean"
+	case Manhattan:
+		return "manhattan"
+	case Cosine:
+		return "cosine"
+	}
+	return fmt.Sprintf("DistanceMetric(%d)", int(d))
+}
+
+// KNNConfig holds the parameters for k-nearest-neighbors
+type KNNConfig struct {
+	K      int
+	Metric DistanceMetric
+	// Weighted weights each neighbor's vote by its inverse distance instead
+	// of counting votes equally
+	Weighted bool
+}
+
+// DefaultKNNConfig returns a distance-weighted 15-neighbor euclidean vote
+func DefaultKNNConfig() KNNConfig {
+	return KNNConfig{
+		K:        15,
+		Metric:   Euclidean,
+		Weighted: true,
+	}
+}
+
+// KNNModel classifies a row by the labels of its nearest training rows. The
+// training rows are kept in X, or in Sparse when fitted with FitSparse.
+type KNNModel struct {
+	Config KNNConfig
+	X      *mat.Dense
+	Sparse *CSR
+	Y      []float64
+}
+
+// NewKNNModel creates an untrained KNN model
+func NewKNNModel(config KNNConfig) *KNNModel {
+	return &KNNModel{Config: config}
+}
+
+// Fit stores a copy of the training data
+func (m *KNNModel) Fit(X *mat.Dense, y []float64) error {
+	rows, _ := X.Dims()
+	if err := m.check(rows, y); err != nil {
+		return err
+	}
+	m.X = mat.DenseCopyOf(X)
+	m.Sparse = nil
+	m.Y = append([]float64(nil), y...)
+	return nil
+}
+
+// FitSparse stores the training data in CSR form
+func (m *KNNModel) FitSparse(X *CSR, y []float64) error {
+	if err := m.check(X.Rows, y); err != nil {
+		return err
+	}
+	m.X = nil
+	m.Sparse = X
+	m.Y = append([]float64(nil), y...)
+	return nil
+}
+
+// check validates the training data and configuration
+func (m *KNNModel) check(rows int, y []float64) error {
+	if rows != len(y) {
+		return fmt.Errorf("feature matrix has %d rows but %d labels", rows, len(y))
+	}
+	if rows == 0 {
+		return fmt.Errorf("cannot fit KNN on an empty matrix")
+	}
+	if m.Config.K <= 0 {
+		return fmt.Errorf("k must be positive, got %d", m.Config.K)
+	}
+	return nil
+}
+
+// PredictProba returns the (optionally distance-weighted) share of positive
+// labels among the k nearest training rows
+func (m *KNNModel) PredictProba(X *mat.Dense) []float64 {
+	if m.Sparse != nil {
+		return m.PredictProbaSparse(NewCSR(X))
+	}
+	raw := X.RawMatrix()
+	train := m.X.RawMatrix()
+
+	dists := make([]float64, train.Rows)
+	probs := make([]float64, raw.Rows)
+	for i := range probs {
+		row := raw.Data[i*raw.Stride : i*raw.Stride+raw.Cols]
+		for j := range dists {
+			dists[j] = m.Config.Metric.distance(row, train.Data[j*train.Stride:j*train.Stride+train.Cols])
+		}
+		probs[i] = m.vote(dists)
+	}
+	return probs
+}
+
+// PredictProbaSparse is PredictProba for CSR rows, with distances computed
+// by merging the non-zeros of each pair of rows
+func (m *KNNModel) PredictProbaSparse(X *CSR) []float64 {
+	if m.Sparse == nil {
+		return m.PredictProba(X.Dense())
+	}
+
+	dists := make([]float64, m.Sparse.Rows)
+	probs := make([]float64, X.Rows)
+	for i := range probs {
+		ai, av := X.Row(i)
+		for j := range dists {
+			bi, bv := m.Sparse.Row(j)
+			dists[j] = m.Config.Metric.sparseDistance(ai, av, bi, bv)
+		}
+		probs[i] = m.vote(dists)
+	}
+	return probs
+}
+
+// vote returns the (optionally distance-weighted) share of positive labels
+// among the k training rows with the smallest distances
+func (m *KNNModel) vote(dists []float64) float64 {
+	k := m.Config.K
+	if k > len(dists) {
+		k = len(dists)
+	}
+
+	order := make([]int, len(dists))
+	for j := range order {
+		order[j] = j
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return dists[order[a]] < dists[order[b]]
+	})
+
+	pos, total := 0.0, 0.0
+	for _, j := range order[:k] {
+		w := 1.0
+		if m.Config.Weighted {
+			w = 1 / (dists[j] + 1e-9)
+		}
+		pos += w * m.Y[j]
+		total += w
+	}
+	return pos / total
+}
+
+// distance returns the metric's distance between two rows
+func (d DistanceMetric) distance(a, b []float64) float64 {
+	switch d {
+	case Manhattan:
+		sum := 0.0
+		for i := range a {
+			sum += math.Abs(a[i] - b[i])
+		}
+		return sum
+	case Cosine:
+		dot, na, nb := 0.0, 0.0, 0.0
+		for i := range a {
+			dot += a[i] * b[i]
+			na += a[i] * a[i]
+			nb += b[i] * b[i]
+		}
+		if na == 0 || nb == 0 {
+			return 1
+		}
+		return 1 - dot/math.Sqrt(na*nb)
+	default:
+		sum := 0.0
+		for i := range a {
+			diff := a[i] - b[i]
+			sum += diff * diff
+		}
+		return math.Sqrt(sum)
+	}
+}
+
+// sparseDistance returns the metric's distance between two sparse rows given
+// as sorted column indices and values
+func (d DistanceMetric) sparseDistance(ai []int, av []float64, bi []int, bv []float64) float64 {
+	var abs, sq, dot, na, nb float64
+	add := func(a, b float64) {
+		diff := a - b
+		abs += math.Abs(diff)
+		sq += diff * diff
+		dot += a * b
+		na += a * a
+		nb += b * b
+	}
+
+	p, q := 0, 0
+	for p < len(ai) || q < len(bi) {
+		switch {
+		case q == len(bi) || (p < len(ai) && ai[p] < bi[q]):
+			add(av[p], 0)
+			p++
+		case p == len(ai) || bi[q] < ai[p]:
+			add(0, bv[q])
+			q++
+		default:
+			add(av[p], bv[q])
+			p++
+			q++
+		}
+	}
+
+	switch d {
+	case Manhattan:
+		return abs
+	case Cosine:
+		if na == 0 || nb == 0 {
+			return 1
+		}
+		return 1 - dot/math.Sqrt(na*nb)
+	default:
+		return math.Sqrt(sq)
+	}
+}
@@ -0,0 +1,482 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+)
+
+// TargetColumn is the name of the binary approval label in processed files
+const TargetColumn = "A16"
+
+// WeightColumn is the name of the optional per-row sample weight in
+// processed files
+const WeightColumn = "weight"
+
+// AmountColumn is the name of the optional amount, such as the credit
+// limit, that the second stage of a two-stage model predicts. The outcome
+// columns start with an underscore so they never share a feature's name.
+const AmountColumn = "_amount"
+
+// DurationColumn and EventColumn are the names of the optional
+// time-to-default target: how long each account was observed, and 1 when
+// it then defaulted or 0 when it was censored
+const (
+	DurationColumn = "_duration"
+	EventColumn    = "_event"
+)
+
+// ClassColumn is the name of the optional multiclass outcome, such as
+// decline, refer or approve, coded from 0 for the worst class
+const ClassColumn = "_class"
+
+// FeatureMatrix is a processed dataset ready for training: the feature
+// matrix, the binary target for each row and the feature column names. The
+// features are held in X, or only in Sparse for a sparse matrix until a
+// model needs them dense.
+type FeatureMatrix struct {
+	X        *mat.Dense
+	Sparse   *CSR
+	Y        []float64
+	Features []string
+	// Missing lists, per row, the feature columns whose value was missing
+	// and is stored as zero. It is nil when no value is missing.
+	Missing [][]int
+	// Categorical lists the categorical columns of the dataset whose one-hot
+	// encoding is among the features
+	Categorical []CategoricalFeature
+	// Weights holds each row's sample weight, which evaluation metrics
+	// honor. It is nil when rows count equally.
+	Weights []float64
+	// Amounts holds each row's amount, NaN where it is missing. It is nil
+	// when the processed data has no amount column.
+	Amounts []float64
+	// Durations and Events hold each row's time-to-default target, NaN
+	// where it is missing. They are nil when the processed data has none.
+	Durations []float64
+	Events    []float64
+	// Classes holds each row's multiclass outcome, NaN where it is
+	// missing. It is nil when the processed data has none.
+	Classes []float64
+}
+
+// CategoricalFeature is a categorical dataset column represented by its
+// one-hot feature columns, one per level
+type CategoricalFeature struct {
+	Name    string
+	Columns []int
+	Levels  []string
+}
+
+// FeatureGroup is a raw feature: the one-hot columns of a categorical
+// field, or a single column
+type FeatureGroup struct {
+	Name    string
+	Columns []int
+}
+
+// Groups returns the raw features of the matrix, the categorical fields
+// first, naming a normalized column after its raw column
+func (fm *FeatureMatrix) Groups() []FeatureGroup {
+	var groups []FeatureGroup
+	grouped := make(map[int]bool)
+	for _, cf := range fm.Categorical {
+		groups = append(groups, FeatureGroup{Name: cf.Name, Columns: cf.Columns})
+		for _, j := range cf.Columns {
+			grouped[j] = true
+		}
+	}
+	for j, name := range fm.Features {
+		if !grouped[j] {
+			groups = append(groups, FeatureGroup{Name: strings.TrimSuffix(name, "_norm"), Columns: []int{j}})
+		}
+	}
+	return groups
+}
+
+// categoricalFeatures finds the text columns of ds whose one-hot columns,
+// named "<column>_<level>", are among the features. A normalized column
+// and a missing-value indicator, "<column>_imputed", are not levels.
+func categoricalFeatures(ds *dataset.Dataset, features []string) []CategoricalFeature {
+	var categorical []CategoricalFeature
+	for _, col := range ds.Columns() {
+		if col.Kind != dataset.String {
+			continue
+		}
+		cf := CategoricalFeature{Name: col.Name}
+		for j, name := range features {
+			if level := strings.TrimPrefix(name, col.Name+"_"); level != name && !strings.HasSuffix(name, "_norm") && !strings.HasSuffix(name, "_imputed") {
+				cf.Columns = append(cf.Columns, j)
+				cf.Levels = append(cf.Levels, level)
+			}
+		}
+		if len(cf.Columns) < 2 {
+			continue
+		}
+		categorical = append(categorical, cf)
+	}
+	return categorical
+}
+
+// Dense returns the dense feature matrix, expanding it from Sparse on first use
+func (fm *FeatureMatrix) Dense() *mat.Dense {
+	if fm.X == nil && fm.Sparse != nil {
+		fm.X = fm.Sparse.Dense()
+	}
+	return fm.X
+}
+
+// DenseWithMissing returns a copy of the dense feature matrix with NaN in
+// place of missing values, or the matrix itself when none are missing
+func (fm *FeatureMatrix) DenseWithMissing() *mat.Dense {
+	X := fm.Dense()
+	if fm.Missing == nil {
+		return X
+	}
+	withNaN := mat.DenseCopyOf(X)
+	for i, cols := range fm.Missing {
+		for _, j := range cols {
+			withNaN.Set(i, j, math.NaN())
+		}
+	}
+	return withNaN
+}
+
+// IsMissing reports whether row i's value of feature column j was missing
+func (fm *FeatureMatrix) IsMissing(i, j int) bool {
+	if fm.Missing == nil {
+		return false
+	}
+	for _, m := range fm.Missing[i] {
+		if m == j {
+			return true
+		}
+	}
+	return false
+}
+
+// missingCells records the invalid entries of a feature column in missing,
+// allocating it on the first one
+func missingCells(missing [][]int, valid []bool, col int) [][]int {
+	for i, ok := range valid {
+		if ok {
+			continue
+		}
+		if missing == nil {
+			missing = make([][]int, len(valid))
+		}
+		missing[i] = append(missing[i], col)
+	}
+	return missing
+}
+
+// Rows returns the number of rows in the matrix
+func (fm *FeatureMatrix) Rows() int {
+	if fm.Sparse != nil {
+		return fm.Sparse.Rows
+	}
+	rows, _ := fm.X.Dims()
+	return rows
+}
+
+// LoadDataFromCSV loads the processed train and test files into feature matrices.
+// The test matrix uses the same feature columns as the training matrix.
+func LoadDataFromCSV(trainPath, testPath string) (trainData, testData *FeatureMatrix, err error) {
+	return loadData(trainPath, testPath, false)
+}
+
+// LoadSparseDataFromCSV is LoadDataFromCSV with the features stored in CSR
+// form, for models that train on sparse matrices
+func LoadSparseDataFromCSV(trainPath, testPath string) (trainData, testData *FeatureMatrix, err error) {
+	return loadData(trainPath, testPath, true)
+}
+
+// loadData loads the processed train and test files in either storage format
+func loadData(trainPath, testPath string, sparse bool) (trainData, testData *FeatureMatrix, err error) {
+	fmt.Printf("Loading data from %s and %s...\n", trainPath, testPath)
+
+	trainDS, err := readDataset(trainPath, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	features := FeatureColumns(trainDS)
+
+	if sparse {
+		trainData, err = NewSparseFeatureMatrix(trainDS, features)
+	} else {
+		trainData, err = NewFeatureMatrix(trainDS, features)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error building training matrix: %v", err)
+	}
+
+	// The test set only needs the columns chosen on the training set, and
+	// the sample weights and amounts when the training set has them
+	var extra []string
+	for _, name := range []string{WeightColumn, AmountColumn, DurationColumn, EventColumn, ClassColumn} {
+		if _, err := trainDS.Col(name); err == nil {
+			extra = append(extra, name)
+		}
+	}
+	testData, err = loadFeatureMatrix(testPath, features, sparse, extra)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error building test matrix: %v", err)
+	}
+	// The raw categorical columns are not read from the test file, but the
+	// one-hot columns are the same as in training
+	testData.Categorical = trainData.Categorical
+
+	return trainData, testData, nil
+}
+
+// readDataset reads the named columns of a processed CSV file, or every
+// column when names is nil
+func readDataset(path string, names []string) (*dataset.Dataset, error) {
+	file, err := dataset.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	ds, err := dataset.ReadCSVColumns(file, names)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return ds, nil
+}
+
+// FeatureColumns selects the model inputs from a processed dataset: every
+// numeric column except the target, sample weight, amount, survival and
+// class columns, using the normalized copy of a continuous column in place of its
+// raw values
+func FeatureColumns(ds *dataset.Dataset) []string {
+	var features []string
+	for _, col := range ds.Columns() {
+		if isOutcome(col.Name) || col.Kind == dataset.String {
+			continue
+		}
+		if !strings.HasSuffix(col.Name, "_norm") {
+			if _, err := ds.Col(col.Name + "_norm"); err == nil {
+				continue
+			}
+		}
+		features = append(features, col.Name)
+	}
+	return features
+}
+
+// isOutcome reports whether a processed column holds a target or the
+// sample weight rather than a feature. Schemas cannot name a feature after
+// any of these columns, so a feature such as the german amount is kept.
+func isOutcome(name string) bool {
+	switch name {
+	case TargetColumn, WeightColumn, AmountColumn, DurationColumn, EventColumn, ClassColumn:
+		return true
+	}
+	return false
+}
+
+// LoadFeatureMatrix reads only the given feature columns and the target from
+// a processed CSV file, leaving every other column undecoded
+func LoadFeatureMatrix(path string, features []string) (*FeatureMatrix, error) {
+	return loadFeatureMatrix(path, features, false, nil)
+}
+
+// loadFeatureMatrix is LoadFeatureMatrix with a choice of storage format,
+// also reading the extra columns, such as the sample weights
+func loadFeatureMatrix(path string, features []string, sparse bool, extra []string) (*FeatureMatrix, error) {
+	names := append(append(append([]string(nil), features...), TargetColumn), extra...)
+	ds, err := readDataset(path, names)
+	if err != nil {
+		return nil, err
+	}
+	if sparse {
+		return NewSparseFeatureMatrix(ds, features)
+	}
+	return NewFeatureMatrix(ds, features)
+}
+
+// NewFeatureMatrix copies the named feature columns and the target into a
+// dense matrix. Missing values are stored as zero and recorded in Missing.
+func NewFeatureMatrix(ds *dataset.Dataset, features []string) (*FeatureMatrix, error) {
+	rows := ds.Nrow()
+	if rows == 0 || len(features) == 0 {
+		return nil, fmt.Errorf("dataset has no rows or no feature columns")
+	}
+
+	X := mat.NewDense(rows, len(features), nil)
+	var missing [][]int
+	for j, name := range features {
+		col, err := ds.Col(name)
+		if err != nil {
+			return nil, err
+		}
+		vals, valid := col.FloatValues()
+		X.SetCol(j, vals)
+		missing = missingCells(missing, valid, j)
+	}
+
+	target, err := ds.Col(TargetColumn)
+	if err != nil {
+		return nil, err
+	}
+	y, _ := target.FloatValues()
+
+	weights, err := sampleWeights(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FeatureMatrix{X: X, Y: y, Features: features, Missing: missing, Categorical: categoricalFeatures(ds, features), Weights: weights, Amounts: optionalColumn(ds, AmountColumn), Durations: optionalColumn(ds, DurationColumn), Events: optionalColumn(ds, EventColumn), Classes: optionalColumn(ds, ClassColumn)}, nil
+}
+
+// sampleWeights returns the weight column of ds, or nil when it has none.
+// Weights must be present, finite and non-negative.
+func sampleWeights(ds *dataset.Dataset) ([]float64, error) {
+	col, err := ds.Col(WeightColumn)
+	if err != nil {
+		return nil, nil
+	}
+	weights, valid := col.FloatValues()
+	for i, w := range weights {
+		if !valid[i] || w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("row %d has invalid sample weight %q", i+1, col.String(i))
+		}
+	}
+	return weights, nil
+}
+
+// optionalColumn returns the named column of ds with NaN where it is
+// missing, or nil when ds has none
+func optionalColumn(ds *dataset.Dataset, name string) []float64 {
+	col, err := ds.Col(name)
+	if err != nil {
+		return nil
+	}
+	values, valid := col.FloatValues()
+	for i, ok := range valid {
+		if !ok {
+			values[i] = math.NaN()
+		}
+	}
+	return values
+}
+
+// Subset returns a new feature matrix with the given rows, in the same
+// storage format
+func (fm *FeatureMatrix) Subset(rows []int) *FeatureMatrix {
+	sub := &FeatureMatrix{
+		Y:           make([]float64, len(rows)),
+		Features:    fm.Features,
+		Categorical: fm.Categorical,
+	}
+	for k, i := range rows {
+		sub.Y[k] = fm.Y[i]
+	}
+	if fm.Weights != nil {
+		sub.Weights = make([]float64, len(rows))
+		for k, i := range rows {
+			sub.Weights[k] = fm.Weights[i]
+		}
+	}
+	sub.Amounts = subsetValues(fm.Amounts, rows)
+	sub.Durations = subsetValues(fm.Durations, rows)
+	sub.Events = subsetValues(fm.Events, rows)
+	sub.Classes = subsetValues(fm.Classes, rows)
+	if fm.Missing != nil {
+		sub.Missing = make([][]int, len(rows))
+		for k, i := range rows {
+			sub.Missing[k] = fm.Missing[i]
+		}
+	}
+
+	if fm.Sparse != nil {
+		X := &CSR{Rows: len(rows), Cols: fm.Sparse.Cols, Indptr: make([]int, 1, len(rows)+1)}
+		for _, i := range rows {
+			indices, values := fm.Sparse.Row(i)
+			X.Indices = append(X.Indices, indices...)
+			X.Data = append(X.Data, values...)
+			X.Indptr = append(X.Indptr, len(X.Data))
+		}
+		sub.Sparse = X
+		return sub
+	}
+
+	_, cols := fm.X.Dims()
+	sub.X = mat.NewDense(len(rows), cols, nil)
+	for k, i := range rows {
+		sub.X.SetRow(k, fm.X.RawRowView(i))
+	}
+	return sub
+}
+
+// subsetValues returns the given rows of a per-row column, or nil for a
+// nil column
+func subsetValues(values []float64, rows []int) []float64 {
+	if values == nil {
+		return nil
+	}
+	sub := make([]float64, len(rows))
+	for k, i := range rows {
+		sub[k] = values[i]
+	}
+	return sub
+}
+
+// WithCategorical returns a copy of the matrix with a derived categorical
+// feature appended as one-hot columns named "<name>_<level>", in the same
+// storage format. codes holds each row's index into levels.
+func (fm *FeatureMatrix) WithCategorical(name string, levels []string, codes []int) (*FeatureMatrix, error) {
+	rows := fm.Rows()
+	if len(codes) != rows {
+		return nil, fmt.Errorf("%d codes for %d rows", len(codes), rows)
+	}
+	for i, c := range codes {
+		if c < 0 || c >= len(levels) {
+			return nil, fmt.Errorf("row %d has code %d outside the %d levels of %s", i, c, len(levels), name)
+		}
+	}
+
+	cols := len(fm.Features)
+	out := &FeatureMatrix{
+		Y:           fm.Y,
+		Features:    append([]string(nil), fm.Features...),
+		Missing:     fm.Missing,
+		Categorical: append([]CategoricalFeature(nil), fm.Categorical...),
+		Weights:     fm.Weights,
+		Amounts:     fm.Amounts,
+		Durations:   fm.Durations,
+		Events:      fm.Events,
+		Classes:     fm.Classes,
+	}
+	cf := CategoricalFeature{Name: name, Levels: levels}
+	for k, level := range levels {
+		out.Features = append(out.Features, name+"_"+level)
+		cf.Columns = append(cf.Columns, cols+k)
+	}
+	out.Categorical = append(out.Categorical, cf)
+
+	if fm.Sparse != nil {
+		X := &CSR{Rows: rows, Cols: cols + len(levels), Indptr: make([]int, 1, rows+1)}
+		for i := 0; i < rows; i++ {
+			indices, values := fm.Sparse.Row(i)
+			X.Indices = append(append(X.Indices, indices...), cols+codes[i])
+			X.Data = append(append(X.Data, values...), 1)
+			X.Indptr = append(X.Indptr, len(X.Data))
+		}
+		out.Sparse = X
+		return out, nil
+	}
+
+	out.X = mat.NewDense(rows, cols+len(levels), nil)
+	for i := 0; i < rows; i++ {
+		copy(out.X.RawRowView(i), fm.X.RawRowView(i))
+		out.X.Set(i, cols+codes[i], 1)
+	}
+	return out, nil
+}
@@ -0,0 +1,368 @@
+package models
+
+import (
+	"math"
+	"sort"
+)
+
+// AUC returns the area under the ROC curve of the scores for 0/1 labels:
+// the chance that a positive row scores above a negative one, with tied
+// scores counting half. Rows are weighted by weights, or count once when it
+// is nil. It returns 0.5 when only one class is present.
+func AUC(scores, labels, weights []float64) float64 {
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return scores[order[a]] < scores[order[b]]
+	})
+
+	var pos, neg, area float64
+	for start := 0; start < len(order); {
+		// Each positive outranks the negatives below its tied block and
+		// ties half of those inside it
+		end := start
+		blockPos, blockNeg := 0.0, 0.0
+		for end < len(order) && scores[order[end]] == scores[order[start]] {
+			i := order[end]
+			if labels[i] >= 0.5 {
+				blockPos += WeightAt(weights, i)
+			} else {
+				blockNeg += WeightAt(weights, i)
+			}
+			end++
+		}
+		area += blockPos * (neg + blockNeg/2)
+		pos += blockPos
+		neg += blockNeg
+		start = end
+	}
+
+	if pos == 0 || neg == 0 {
+		return 0.5
+	}
+	return area / (pos * neg)
+}
+
+// KS returns the Kolmogorov-Smirnov statistic of the scores for 0/1
+// labels: the largest gap between the share of positive and of negative
+// rows scored at or below any threshold. Rows are weighted by weights, or
+// count once when it is nil. It returns 0 when only one class is present.
+func KS(scores, labels, weights []float64) float64 {
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return scores[order[a]] < scores[order[b]]
+	})
+
+	var pos, neg float64
+	for i, y := range labels {
+		if y >= 0.5 {
+			pos += WeightAt(weights, i)
+		} else {
+			neg += WeightAt(weights, i)
+		}
+	}
+	if pos == 0 || neg == 0 {
+		return 0
+	}
+
+	ks, cumPos, cumNeg := 0.0, 0.0, 0.0
+	for start := 0; start < len(order); {
+		// Tied scores move both distributions together
+		end := start
+		for end < len(order) && scores[order[end]] == scores[order[start]] {
+			i := order[end]
+			if labels[i] >= 0.5 {
+				cumPos += WeightAt(weights, i)
+			} else {
+				cumNeg += WeightAt(weights, i)
+			}
+			end++
+		}
+		ks = math.Max(ks, math.Abs(cumNeg/neg-cumPos/pos))
+		start = end
+	}
+	return ks
+}
+
+// WeightAt returns the weight of row i, or 1 when weights is nil
+func WeightAt(weights []float64, i int) float64 {
+	if weights == nil {
+		return 1
+	}
+	return weights[i]
+}
+
+// PRPoint is the precision and recall of approving every row scored at or
+// above Threshold
+type PRPoint struct {
+	Threshold float64
+	Precision float64
+	Recall    float64
+}
+
+// PRCurve returns the precision-recall curve of the scores for 0/1 labels,
+// one point per distinct score from the highest down, so recall rises
+// along the curve. Rows are weighted by weights, or count once when it is
+// nil. It returns nil when there are no positive labels.
+func PRCurve(scores, labels, weights []float64) []PRPoint {
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+
+	nPos := 0.0
+	for i, y := range labels {
+		if y >= 0.5 {
+			nPos += WeightAt(weights, i)
+		}
+	}
+	if nPos == 0 {
+		return nil
+	}
+
+	var curve []PRPoint
+	tp, approved := 0.0, 0.0
+	for start := 0; start < len(order); {
+		// Tied scores cross the threshold together
+		end := start
+		for end < len(order) && scores[order[end]] == scores[order[start]] {
+			i := order[end]
+			approved += WeightAt(weights, i)
+			if labels[i] >= 0.5 {
+				tp += WeightAt(weights, i)
+			}
+			end++
+		}
+		precision := 0.0
+		if approved > 0 {
+			precision = tp / approved
+		}
+		curve = append(curve, PRPoint{
+			Threshold: scores[order[start]],
+			Precision: precision,
+			Recall:    tp / nPos,
+		})
+		start = end
+	}
+	return curve
+}
+
+// AveragePrecision summarizes the precision-recall curve as the mean of the
+// precision at each threshold weighted by the recall it adds, without
+// interpolation. Rows are weighted as in PRCurve. It returns 0 when there
+// are no positive labels.
+func AveragePrecision(scores, labels, weights []float64) float64 {
+	ap, recall := 0.0, 0.0
+	for _, p := range PRCurve(scores, labels, weights) {
+		ap += (p.Recall - recall) * p.Precision
+		recall = p.Recall
+	}
+	return ap
+}
+
+// BrierScore returns the mean squared difference between the scores and
+// the 0/1 labels. Rows are weighted by weights, or count once when it is
+// nil. Lower is better; it returns 0 when there are no rows.
+func BrierScore(scores, labels, weights []float64) float64 {
+	sum, total := 0.0, 0.0
+	for i, p := range scores {
+		y := 0.0
+		if labels[i] >= 0.5 {
+			y = 1
+		}
+		w := WeightAt(weights, i)
+		sum += w * (p - y) * (p - y)
+		total += w
+	}
+	if total == 0 {
+		return 0
+	}
+	return sum / total
+}
+
+// RegressionMetrics are the errors of predicted amounts against actual ones
+type RegressionMetrics struct {
+	Rows int
+	RMSE float64
+	MAE  float64
+	// R2 is the share of the actual amounts' variance the predictions
+	// explain; it is negative when they do worse than the mean
+	R2 float64
+}
+
+// RegressionErrors compares predicted with actual values, skipping rows
+// whose actual value is NaN. Rows are weighted by weights, or count once
+// when it is nil.
+func RegressionErrors(predicted, actual, weights []float64) RegressionMetrics {
+	var m RegressionMetrics
+	sum, total := 0.0, 0.0
+	for i, y := range actual {
+		if math.IsNaN(y) {
+			continue
+		}
+		w := WeightAt(weights, i)
+		m.Rows++
+		sum += w * y
+		total += w
+	}
+	if total == 0 {
+		return m
+	}
+	mean := sum / total
+
+	squared, absolute, variance := 0.0, 0.0, 0.0
+	for i, y := range actual {
+		if math.IsNaN(y) {
+			continue
+		}
+		w := WeightAt(weights, i)
+		d := predicted[i] - y
+		squared += w * d * d
+		absolute += w * math.Abs(d)
+		variance += w * (y - mean) * (y - mean)
+	}
+	m.RMSE = math.Sqrt(squared / total)
+	m.MAE = absolute / total
+	if variance > 0 {
+		m.R2 = 1 - squared/variance
+	}
+	return m
+}
+
+// IntervalMetrics summarize prediction intervals against actual amounts
+type IntervalMetrics struct {
+	Rows int
+	// Coverage is the share of actual amounts inside their interval, which
+	// should be close to the intervals' nominal coverage
+	Coverage float64
+	// Width is the mean width of the intervals
+	Width float64
+}
+
+// IntervalErrors compares the intervals from lower to upper with actual
+// values, skipping rows whose actual value is NaN. Rows are weighted by
+// weights, or count once when it is nil.
+func IntervalErrors(lower, upper, actual, weights []float64) IntervalMetrics {
+	var m IntervalMetrics
+	covered, width, total := 0.0, 0.0, 0.0
+	for i, y := range actual {
+		if math.IsNaN(y) {
+			continue
+		}
+		w := WeightAt(weights, i)
+		m.Rows++
+		total += w
+		width += w * (upper[i] - lower[i])
+		if y >= lower[i] && y <= upper[i] {
+			covered += w
+		}
+	}
+	if total > 0 {
+		m.Coverage = covered / total
+		m.Width = width / total
+	}
+	return m
+}
+
+// Concordance returns Harrell's C of risk scores against survival data:
+// of the pairs where one row defaulted before the other's duration, the
+// share where that row has the higher risk, with tied risks counting half.
+// A pair is weighted by the product of its rows' weights, or counts once
+// when weights is nil. It returns 0.5 when no pair is comparable.
+func Concordance(risks, durations, events, weights []float64) float64 {
+	concordant, comparable := 0.0, 0.0
+	for i, di := range durations {
+		if events[i] == 0 {
+			continue
+		}
+		for j, dj := range durations {
+			if dj <= di {
+				continue
+			}
+			w := WeightAt(weights, i) * WeightAt(weights, j)
+			comparable += w
+			switch {
+			case risks[i] > risks[j]:
+				concordant += w
+			case risks[i] == risks[j]:
+				concordant += w / 2
+			}
+		}
+	}
+	if comparable == 0 {
+		return 0.5
+	}
+	return concordant / comparable
+}
+
+// CalibrationPoint is one bin of a reliability diagram: the scores in
+// [Lower, Upper), their mean and the observed positive rate of their rows
+type CalibrationPoint struct {
+	Lower         float64
+	Upper         float64
+	MeanPredicted float64
+	ObservedRate  float64
+	// Weight is the summed sample weight of the bin, which is the row count
+	// when rows are unweighted
+	Weight float64
+}
+
+// CalibrationCurve cuts [0, 1] into bins of equal width and returns the
+// mean score and observed positive rate of each non-empty bin, lowest
+// first. A score of exactly 1 falls in the last bin. Rows are weighted by
+// weights, or count once when it is nil.
+func CalibrationCurve(scores, labels, weights []float64, bins int) []CalibrationPoint {
+	points := make([]CalibrationPoint, bins)
+	for b := range points {
+		points[b].Lower = float64(b) / float64(bins)
+		points[b].Upper = float64(b+1) / float64(bins)
+	}
+	for i, p := range scores {
+		b := int(p * float64(bins))
+		if b >= bins {
+			b = bins - 1
+		}
+		if b < 0 {
+			b = 0
+		}
+		w := WeightAt(weights, i)
+		points[b].MeanPredicted += w * p
+		if labels[i] >= 0.5 {
+			points[b].ObservedRate += w
+		}
+		points[b].Weight += w
+	}
+
+	curve := points[:0]
+	for _, pt := range points {
+		if pt.Weight == 0 {
+			continue
+		}
+		pt.MeanPredicted /= pt.Weight
+		pt.ObservedRate /= pt.Weight
+		curve = append(curve, pt)
+	}
+	return curve
+}
+
+// ExpectedCalibrationError is the weighted mean absolute gap between the
+// mean score and the observed rate over the bins of a calibration curve
+func ExpectedCalibrationError(curve []CalibrationPoint) float64 {
+	gap, total := 0.0, 0.0
+	for _, pt := range curve {
+		gap += pt.Weight * math.Abs(pt.MeanPredicted-pt.ObservedRate)
+		total += pt.Weight
+	}
+	if total == 0 {
+		return 0
+	}
+	return gap / total
+}
@@ -0,0 +1,269 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// MLPConfig holds the architecture and training parameters for an MLP
+type MLPConfig struct {
+	// Hidden lists the width of each ReLU hidden layer
+	Hidden       []int
+	LearningRate float64
+	Epochs       int
+	BatchSize    int
+	// L2 is the weight decay applied to every weight matrix
+	L2 float64
+	// Beta1 and Beta2 are Adam's moment decay rates
+	Beta1 float64
+	Beta2 float64
+	// Seed determines the weight initialization and batch order. Zero draws
+	// a random seed, which Fit records here.
+	Seed uint64
+}
+
+// DefaultMLPConfig returns a single 32-unit hidden layer trained with Adam
+func DefaultMLPConfig() MLPConfig {
+	return MLPConfig{
+		Hidden:       []int{32},
+		LearningRate: 0.005,
+		Epochs:       100,
+		BatchSize:    32,
+		L2:           1e-3,
+		Beta1:        0.9,
+		Beta2:        0.999,
+	}
+}
+
+// MLPModel is a feed-forward network with ReLU hidden layers and a sigmoid
+// output, trained on the log loss with mini-batch Adam
+type MLPModel struct {
+	Config MLPConfig
+	// Weights[l] maps layer l's inputs (rows) to its outputs (columns)
+	Weights []*mat.Dense
+	Biases  [][]float64
+	// LossHistory is the mean training loss of each epoch
+	LossHistory []float64
+}
+
+// NewMLPModel creates an untrained MLP
+func NewMLPModel(config MLPConfig) *MLPModel {
+	return &MLPModel{Config: config}
+}
+
+// LossCurve returns the training loss per epoch
+func (m *MLPModel) LossCurve() []float64 {
+	return m.LossHistory
+}
+
+// Fit trains the network with mini-batch Adam
+func (m *MLPModel) Fit(X *mat.Dense, y []float64) error {
+	rows, cols := X.Dims()
+	if rows != len(y) {
+		return fmt.Errorf("feature matrix has %d rows but %d labels", rows, len(y))
+	}
+	if len(m.Config.Hidden) == 0 {
+		return fmt.Errorf("MLP needs at least one hidden layer")
+	}
+	for _, width := range m.Config.Hidden {
+		if width <= 0 {
+			return fmt.Errorf("hidden layer width must be positive, got %d", width)
+		}
+	}
+	if m.Config.LearningRate <= 0 || m.Config.Epochs <= 0 || m.Config.BatchSize <= 0 {
+		return fmt.Errorf("learning rate, epochs and batch size must be positive")
+	}
+
+	if m.Config.Seed == 0 {
+		m.Config.Seed = newSeed()
+	}
+	rng := rand.New(rand.NewPCG(m.Config.Seed, 0))
+
+	// He initialization for the ReLU layers
+	sizes := append(append([]int{cols}, m.Config.Hidden...), 1)
+	m.Weights = make([]*mat.Dense, len(sizes)-1)
+	m.Biases = make([][]float64, len(sizes)-1)
+	for l := range m.Weights {
+		scale := math.Sqrt(2 / float64(sizes[l]))
+		data := make([]float64, sizes[l]*sizes[l+1])
+		for i := range data {
+			data[i] = rng.NormFloat64() * scale
+		}
+		m.Weights[l] = mat.NewDense(sizes[l], sizes[l+1], data)
+		m.Biases[l] = make([]float64, sizes[l+1])
+	}
+
+	// Adam state for every weight and bias, in the same layout
+	params := m.params()
+	first := make([][]float64, len(params))
+	second := make([][]float64, len(params))
+	for k, p := range params {
+		first[k] = make([]float64, len(p))
+		second[k] = make([]float64, len(p))
+	}
+	grads := make([][]float64, len(params))
+
+	order := make([]int, rows)
+	for i := range order {
+		order[i] = i
+	}
+
+	m.LossHistory = m.LossHistory[:0]
+	step := 0
+	for epoch := 0; epoch < m.Config.Epochs; epoch++ {
+		rng.Shuffle(rows, func(a, b int) { order[a], order[b] = order[b], order[a] })
+
+		total := 0.0
+		for start := 0; start < rows; start += m.Config.BatchSize {
+			end := start + m.Config.BatchSize
+			if end > rows {
+				end = rows
+			}
+			batch := order[start:end]
+
+			xb := mat.NewDense(len(batch), cols, nil)
+			yb := make([]float64, len(batch))
+			for k, i := range batch {
+				xb.SetRow(k, X.RawRowView(i))
+				yb[k] = y[i]
+			}
+
+			loss := m.backprop(xb, yb, grads)
+			total += loss * float64(len(batch))
+
+			step++
+			m.adam(params, grads, first, second, step)
+		}
+		m.LossHistory = append(m.LossHistory, total/float64(rows))
+	}
+
+	return nil
+}
+
+// params returns the raw weight and bias slices of every layer
+func (m *MLPModel) params() [][]float64 {
+	params := make([][]float64, 0, 2*len(m.Weights))
+	for l := range m.Weights {
+		params = append(params, m.Weights[l].RawMatrix().Data, m.Biases[l])
+	}
+	return params
+}
+
+// forward returns the pre-activation and activation of every layer for a
+// batch; the last activation holds the output probabilities
+func (m *MLPModel) forward(X mat.Matrix) (pre, act []*mat.Dense) {
+	n, _ := X.Dims()
+	input := X
+	for l, w := range m.Weights {
+		_, out := w.Dims()
+		z := mat.NewDense(n, out, nil)
+		z.Mul(input, w)
+		b := m.Biases[l]
+		z.Apply(func(i, j int, v float64) float64 { return v + b[j] }, z)
+
+		last := l == len(m.Weights)-1
+		a := mat.NewDense(n, out, nil)
+		a.Apply(func(i, j int, v float64) float64 {
+			if last {
+				return sigmoid(v)
+			}
+			return math.Max(v, 0)
+		}, z)
+		pre = append(pre, z)
+		act = append(act, a)
+		input = a
+	}
+	return pre, act
+}
+
+// backprop computes the gradient of the mean log loss plus weight decay for
+// a batch into grads (laid out like params) and returns the batch's log loss
+func (m *MLPModel) backprop(X *mat.Dense, y []float64, grads [][]float64) float64 {
+	n := float64(len(y))
+	pre, act := m.forward(X)
+	out := act[len(act)-1]
+
+	// The sigmoid and log loss combine to a delta of (p - y)/n at the output
+	loss := 0.0
+	delta := mat.NewDense(len(y), 1, nil)
+	for i, label := range y {
+		p := out.At(i, 0)
+		loss -= label*math.Log(math.Max(p, 1e-15)) + (1-label)*math.Log(math.Max(1-p, 1e-15))
+		delta.Set(i, 0, (p-label)/n)
+	}
+
+	for l := len(m.Weights) - 1; l >= 0; l-- {
+		var input mat.Matrix = X
+		if l > 0 {
+			input = act[l-1]
+		}
+
+		in, out := m.Weights[l].Dims()
+		dw := mat.NewDense(in, out, gradSlice(grads, 2*l, in*out))
+		dw.Mul(input.T(), delta)
+		dw.Apply(func(i, j int, v float64) float64 {
+			return v + m.Config.L2*m.Weights[l].At(i, j)
+		}, dw)
+
+		db := gradSlice(grads, 2*l+1, out)
+		for j := range db {
+			db[j] = 0
+		}
+		rows, _ := delta.Dims()
+		for i := 0; i < rows; i++ {
+			for j, v := range delta.RawRowView(i) {
+				db[j] += v
+			}
+		}
+
+		if l == 0 {
+			break
+		}
+
+		// Propagate through the weights and the previous layer's ReLU
+		prev := mat.NewDense(rows, in, nil)
+		prev.Mul(delta, m.Weights[l].T())
+		z := pre[l-1]
+		prev.Apply(func(i, j int, v float64) float64 {
+			if z.At(i, j) <= 0 {
+				return 0
+			}
+			return v
+		}, prev)
+		delta = prev
+	}
+
+	return loss / n
+}
+
+// gradSlice returns grads[k], allocating it with the given length on first use
+func gradSlice(grads [][]float64, k, length int) []float64 {
+	if len(grads[k]) != length {
+		grads[k] = make([]float64, length)
+	}
+	return grads[k]
+}
+
+// adam applies one bias-corrected Adam update to every parameter
+func (m *MLPModel) adam(params, grads, first, second [][]float64, step int) {
+	b1, b2 := m.Config.Beta1, m.Config.Beta2
+	c1 := 1 - math.Pow(b1, float64(step))
+	c2 := 1 - math.Pow(b2, float64(step))
+	for k, p := range params {
+		g := grads[k]
+		for i := range p {
+			first[k][i] = b1*first[k][i] + (1-b1)*g[i]
+			second[k][i] = b2*second[k][i] + (1-b2)*g[i]*g[i]
+			p[i] -= m.Config.LearningRate * (first[k][i] / c1) / (math.Sqrt(second[k][i]/c2) + 1e-8)
+		}
+	}
+}
+
+// PredictProba returns the network output for each row of X
+func (m *MLPModel) PredictProba(X *mat.Dense) []float64 {
+	_, act := m.forward(X)
+	return mat.Col(nil, 0, act[len(act)-1])
+}
@@ -2,7 +2,8 @@ package models
 
 import (
 	"fmt"
-	"math/rand/v2"
+	"math"
+	"sort"
 )
 
 // ModelType represents the type of model to train
@@ -13,72 +14,180 @@ const (
 	RandomForest
 	DecisionTree
 	GradientBoosting
+	KNN
+	NaiveBayes
+	LinearSVM
+	MLP
 )
 
-// ModelResult contains the evaluation metrics for a trained model
-type ModelResult struct {
-	ModelName  string
-	Accuracy   float64
-	Precision  float64
-	Recall     float64
-	F1Score    float64
-	ConfMatrix map[string]map[string]int
+// AllModelTypes lists every model type trained by TrainAllModels
+var AllModelTypes = []ModelType{
+	LogisticRegression,
+	RandomForest,
+	DecisionTree,
+	GradientBoosting,
+	KNN,
+	NaiveBayes,
+	LinearSVM,
+	MLP,
 }
 
-// TrainModel trains a machine learning model on the given dataset
-// This is a mock implementation for testing purposes
-func TrainModel(trainData, testData interface{}, modelType ModelType) (*ModelResult, error) {
-	modelName := ""
-
-	// Initialize the appropriate model based on modelType
-	switch modelType {
+// String returns the display name of the model type
+func (mt ModelType) String() string {
+	switch mt {
 	case LogisticRegression:
-		modelName = "Logistic Regression"
+		return "Logistic Regression"
 	case RandomForest:
-		modelName = "Random Forest"
+		return "Random Forest"
 	case DecisionTree:
-		modelName = "Decision Tree"
+		return "Decision Tree"
 	case GradientBoosting:
-		modelName = "Gradient Boosting"
-	default:
+		return "Gradient Boosting"
+	case KNN:
+		return "KNN"
+	case NaiveBayes:
+		return "Naive Bayes"
+	case LinearSVM:
+		return "Linear SVM"
+	case MLP:
+		return "Neural Network"
+	}
+	return fmt.Sprintf("ModelType(%d)", int(mt))
+}
+
+// ModelResult contains the evaluation metrics for a trained model
+type ModelResult struct {
+	ModelName string
+	Accuracy  float64
+	Precision float64
+	Recall    float64
+	F1Score   float64
+	// AUC and AveragePrecision summarize the ROC and precision-recall
+	// curves of the test probabilities
+	AUC              float64
+	AveragePrecision float64
+	// KS is the Kolmogorov-Smirnov separation of the two classes' scores
+	KS float64
+	// Brier is the mean squared error of the test probabilities, which
+	// rewards calibration as well as ranking
+	Brier float64
+	// Specificity is the recall of the rejected class, BalancedAccuracy the
+	// mean of both classes' recall, MCC the Matthews correlation
+	// coefficient and Kappa Cohen's kappa. Unlike accuracy, none of them
+	// can be inflated by predicting the majority class.
+	Specificity      float64
+	BalancedAccuracy float64
+	MCC              float64
+	Kappa            float64
+	// ConfMatrix holds the summed sample weight of each actual/predicted
+	// pair, which is the row count when rows are unweighted
+	ConfMatrix map[string]map[string]float64
+	// Classes orders the confusion matrix classes of a multiclass result
+	// from worst to best. It is nil for the binary "0"/"1" matrix.
+	Classes []string
+	// Model is the trained classifier
+	Model Classifier
+	// Probabilities holds the predicted approval probability of each test
+	// row, Labels its true 0/1 label and Weights its sample weight (nil when
+	// unweighted), in test-set order
+	Probabilities []float64
+	Labels        []float64
+	Weights       []float64
+	// CrossValidation holds the k-fold spread of the metrics on the
+	// training data, when cross-validation was run
+	CrossValidation *CrossValidationResult
+}
+
+// MetricSummary is the mean and standard deviation of a metric across folds
+type MetricSummary struct {
+	Mean float64
+	Std  float64
+}
+
+// CrossValidationResult summarizes each metric over k folds
+type CrossValidationResult struct {
+	Folds     int
+	Accuracy  MetricSummary
+	Precision MetricSummary
+	Recall    MetricSummary
+	F1Score   MetricSummary
+}
+
+// TrainModel trains a machine learning model on the given dataset and
+// evaluates it on the test set. Randomized models are seeded with seed, or
+// randomly when it is zero.
+func TrainModel(trainData, testData *FeatureMatrix, modelType ModelType, seed uint64) (*ModelResult, error) {
+	clf := newClassifier(modelType, seed)
+	if clf == nil {
 		return nil, fmt.Errorf("unsupported model type: %v", modelType)
 	}
+	modelName := modelType.String()
 
-	// Train the model (mock implementation)
-	fmt.Printf("Training %s model...\n", modelName)
+	if err := fitClassifier(clf, trainData); err != nil {
+		return nil, fmt.Errorf("error fitting %s: %v", modelName, err)
+	}
+	return evaluateClassifier(modelName, clf, testData)
+}
 
-	// Generate mock metrics
-	accuracy := 0.75 + rand.Float64()*0.2
-	precision := 0.7 + rand.Float64()*0.25
-	recall := 0.7 + rand.Float64()*0.25
-	f1Score := 2 * (precision * recall) / (precision + recall)
+// ClassOrder returns the confusion matrix classes in the order reports
+// list them: the result's Classes, or the sorted classes of a binary result
+func (r *ModelResult) ClassOrder() []string {
+	if r.Classes != nil {
+		return r.Classes
+	}
+	return matrixClasses(r.ConfMatrix)
+}
 
-	// Create mock confusion matrix
-	confMatrix := map[string]map[string]int{
-		"0": {"0": 80, "1": 20},
-		"1": {"0": 15, "1": 85},
+// matrixClasses returns the actual classes of a confusion matrix in sorted
+// order
+func matrixClasses(confMatrix map[string]map[string]float64) []string {
+	classes := make([]string, 0, len(confMatrix))
+	for class := range confMatrix {
+		classes = append(classes, class)
 	}
+	sort.Strings(classes)
+	return classes
+}
+
+// binaryMatrix reports whether a confusion matrix has the binary "0" and "1"
+// classes only
+func binaryMatrix(confMatrix map[string]map[string]float64) bool {
+	_, rejected := confMatrix["0"]
+	_, approved := confMatrix["1"]
+	return len(confMatrix) == 2 && rejected && approved
+}
 
-	// Return results
-	result := &ModelResult{
-		ModelName:  modelName,
-		Accuracy:   accuracy,
-		Precision:  precision,
-		Recall:     recall,
-		F1Score:    f1Score,
-		ConfMatrix: confMatrix,
+// calculatePRF calculates precision, recall, and F1 score from a confusion
+// matrix: those of the approved class of a binary matrix, or their macro
+// averages over the classes of a multiclass one
+func calculatePRF(confMatrix map[string]map[string]float64) (precision, recall, f1 float64) {
+	if binaryMatrix(confMatrix) {
+		return classPRF(confMatrix, "1")
 	}
 
-	return result, nil
+	classes := matrixClasses(confMatrix)
+	n := float64(len(classes))
+	for _, class := range classes {
+		p, r, f := classPRF(confMatrix, class)
+		precision += p / n
+		recall += r / n
+		f1 += f / n
+	}
+	return precision, recall, f1
 }
 
-// calculatePRF calculates precision, recall, and F1 score from a confusion matrix
-// This is kept for reference but not used in the mock implementation
-func calculatePRF(confMatrix map[string]map[string]int) (precision, recall, f1 float64) {
+// classPRF calculates the precision, recall, and F1 score of one class
+// against the rest
+func classPRF(confMatrix map[string]map[string]float64, class string) (precision, recall, f1 float64) {
 	// Calculate true positives, false positives, false negatives
-	tp := float64(confMatrix["1"]["1"])
-	fp := float64(confMatrix["0"]["1"])
-	fn := float64(confMatrix["1"]["0"])
+	tp := confMatrix[class][class]
+	fp, fn := 0.0, 0.0
+	for _, other := range matrixClasses(confMatrix) {
+		if other != class {
+			fp += confMatrix[other][class]
+			fn += confMatrix[class][other]
+		}
+	}
 
 	// Calculate precision and recall
 	precision = 0
@@ -100,34 +209,102 @@ func calculatePRF(confMatrix map[string]map[string]int) (precision, recall, f1 f
 	return precision, recall, f1
 }
 
-// LoadDataFromCSV loads data from CSV files
-// This is a mock implementation for testing purposes
-func LoadDataFromCSV(trainPath, testPath string) (trainData, testData interface{}, err error) {
-	// Mock implementation - just check if files exist
-	fmt.Printf("Loading data from %s and %s...\n", trainPath, testPath)
+// calculateAgreement calculates the specificity, balanced accuracy,
+// Matthews correlation coefficient and Cohen's kappa of a confusion matrix.
+// MCC and kappa are 0 when a class is never actual or never predicted. A
+// multiclass matrix gets the mean specificity and recall of its classes
+// and the multiclass MCC and kappa.
+func calculateAgreement(confMatrix map[string]map[string]float64) (specificity, balancedAccuracy, mcc, kappa float64) {
+	if !binaryMatrix(confMatrix) {
+		return multiclassAgreement(confMatrix)
+	}
+
+	tp := confMatrix["1"]["1"]
+	fp := confMatrix["0"]["1"]
+	fn := confMatrix["1"]["0"]
+	tn := confMatrix["0"]["0"]
+
+	if tn+fp > 0 {
+		specificity = tn / (tn + fp)
+	}
+	recall := 0.0
+	if tp+fn > 0 {
+		recall = tp / (tp + fn)
+	}
+	balancedAccuracy = (recall + specificity) / 2
 
-	// Return mock data structures
-	trainData = "mock_train_data"
-	testData = "mock_test_data"
+	if denom := (tp + fp) * (tp + fn) * (tn + fp) * (tn + fn); denom > 0 {
+		mcc = (tp*tn - fp*fn) / math.Sqrt(denom)
+	}
 
-	return trainData, testData, nil
+	// Kappa compares the observed agreement with the agreement expected
+	// from the class and prediction rates alone
+	if total := tp + fp + fn + tn; total > 0 {
+		observed := (tp + tn) / total
+		expected := ((tp+fp)*(tp+fn) + (tn+fn)*(tn+fp)) / (total * total)
+		if expected < 1 {
+			kappa = (observed - expected) / (1 - expected)
+		}
+	}
+
+	return specificity, balancedAccuracy, mcc, kappa
 }
 
-// TrainAllModels trains and evaluates multiple model types
-// This is a mock implementation for testing purposes
-func TrainAllModels(trainData, testData interface{}) (map[string]*ModelResult, error) {
-	// Define model types to train
-	modelTypes := []ModelType{
-		LogisticRegression,
-		RandomForest,
-		DecisionTree,
-		GradientBoosting,
+// multiclassAgreement is calculateAgreement for more than two classes. MCC
+// is Gorodkin's generalization, which compares the correct predictions
+// with the actual and predicted class totals.
+func multiclassAgreement(confMatrix map[string]map[string]float64) (specificity, balancedAccuracy, mcc, kappa float64) {
+	classes := matrixClasses(confMatrix)
+	actual := make(map[string]float64, len(classes))
+	predicted := make(map[string]float64, len(classes))
+	correct, total := 0.0, 0.0
+	for _, a := range classes {
+		for _, p := range classes {
+			count := confMatrix[a][p]
+			actual[a] += count
+			predicted[p] += count
+			total += count
+			if a == p {
+				correct += count
+			}
+		}
+	}
+	if total == 0 {
+		return 0, 0, 0, 0
 	}
 
+	n := float64(len(classes))
+	var chance, actualSquares, predictedSquares float64
+	for _, class := range classes {
+		tp := confMatrix[class][class]
+		if negatives := total - actual[class]; negatives > 0 {
+			specificity += (negatives - (predicted[class] - tp)) / negatives / n
+		}
+		if actual[class] > 0 {
+			balancedAccuracy += tp / actual[class] / n
+		}
+		chance += actual[class] * predicted[class]
+		actualSquares += actual[class] * actual[class]
+		predictedSquares += predicted[class] * predicted[class]
+	}
+
+	if denom := (total*total - predictedSquares) * (total*total - actualSquares); denom > 0 {
+		mcc = (correct*total - chance) / math.Sqrt(denom)
+	}
+	if expected := chance / (total * total); expected < 1 {
+		kappa = (correct/total - expected) / (1 - expected)
+	}
+	return specificity, balancedAccuracy, mcc, kappa
+}
+
+// TrainAllModels trains and evaluates multiple model types, seeding the
+// randomized ones with seed (zero draws a random seed for each)
+func TrainAllModels(trainData, testData *FeatureMatrix, seed uint64) (map[string]*ModelResult, error) {
 	// Train each model and collect results
 	results := make(map[string]*ModelResult)
-	for _, modelType := range modelTypes {
-		result, err := TrainModel(trainData, testData, modelType)
+	for _, modelType := range AllModelTypes {
+		fmt.Printf("Training %s model...\n", modelType)
+		result, err := TrainModel(trainData, testData, modelType, seed)
 		if err != nil {
 			fmt.Printf("Error training model %v: %v\n", modelType, err)
 			continue
@@ -0,0 +1,33 @@
+package models_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/benchmark"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+func BenchmarkTrainModel(b *testing.B) {
+	sizes, err := benchmark.Sizes()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, n := range sizes {
+		trainData, testData, err := benchmark.FeatureMatrices(benchmark.Records(n, 1), 1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, modelType := range models.AllModelTypes {
+			modelType := modelType
+			b.Run(fmt.Sprintf("%s/rows=%d", modelType, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := models.TrainModel(trainData, testData, modelType, 1); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
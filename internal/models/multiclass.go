@@ -0,0 +1,249 @@
+package models
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// OneVsRestModel is a multiclass classifier built from one binary
+// classifier per class, each separating its class from the rest. A row's
+// class probabilities are the binary probabilities rescaled to sum to one.
+type OneVsRestModel struct {
+	ModelType ModelType
+	// Classes names the classes from worst to best, indexed like the
+	// FeatureMatrix Classes
+	Classes []string
+	Seed    uint64
+	// Models holds the trained classifier of each class
+	Models []Classifier
+}
+
+// NewOneVsRestModel creates an untrained one-vs-rest model of the model
+// type. Randomized classifiers use seed, where zero draws a random one.
+func NewOneVsRestModel(modelType ModelType, classes []string, seed uint64) *OneVsRestModel {
+	return &OneVsRestModel{ModelType: modelType, Classes: classes, Seed: seed}
+}
+
+// Fit rejects binary labels, since the model learns from the classes; use
+// FitMulticlass
+func (m *OneVsRestModel) Fit(X *mat.Dense, y []float64) error {
+	return fmt.Errorf("the one-vs-rest model is fitted on classes, not binary labels")
+}
+
+// FitMulticlass trains one classifier per class on the rows of data, whose
+// Classes must all be known
+func (m *OneVsRestModel) FitMulticlass(data *FeatureMatrix) error {
+	if data.Classes == nil {
+		return fmt.Errorf("data has no %s column", ClassColumn)
+	}
+	m.Models = nil
+	for k := range m.Classes {
+		clf := newClassifier(m.ModelType, m.Seed)
+		if clf == nil {
+			return fmt.Errorf("unsupported model type: %v", m.ModelType)
+		}
+
+		// The class is the positive label against all others
+		binary := *data
+		binary.Y = make([]float64, len(data.Classes))
+		for i, c := range data.Classes {
+			if int(c) == k {
+				binary.Y[i] = 1
+			}
+		}
+		if err := fitClassifier(clf, &binary); err != nil {
+			return fmt.Errorf("error fitting class %s: %v", m.Classes[k], err)
+		}
+		m.Models = append(m.Models, clf)
+	}
+	return nil
+}
+
+// PredictClassProba returns each row's probability of every class, passing
+// missing values and sparse features the way training does
+func (m *OneVsRestModel) PredictClassProba(data *FeatureMatrix) [][]float64 {
+	scores := make([][]float64, len(m.Models))
+	for k, clf := range m.Models {
+		scores[k] = predictProba(clf, data)
+	}
+	return normalizeClasses(scores, data.Rows())
+}
+
+// PredictProba returns each row's probability of the best class, so the
+// model can stand in wherever a binary score is expected
+func (m *OneVsRestModel) PredictProba(X *mat.Dense) []float64 {
+	rows, _ := X.Dims()
+	scores := make([][]float64, len(m.Models))
+	for k, clf := range m.Models {
+		scores[k] = clf.PredictProba(X)
+	}
+	probs := normalizeClasses(scores, rows)
+	best := make([]float64, rows)
+	for i, p := range probs {
+		best[i] = p[len(p)-1]
+	}
+	return best
+}
+
+// normalizeClasses turns the per-class scores of each row into
+// probabilities that sum to one, or equal ones when every score is zero
+func normalizeClasses(scores [][]float64, rows int) [][]float64 {
+	probs := make([][]float64, rows)
+	for i := range probs {
+		probs[i] = make([]float64, len(scores))
+		sum := 0.0
+		for k := range scores {
+			sum += scores[k][i]
+		}
+		for k := range scores {
+			if sum > 0 {
+				probs[i][k] = scores[k][i] / sum
+			} else {
+				probs[i][k] = 1 / float64(len(scores))
+			}
+		}
+	}
+	return probs
+}
+
+// TrainMulticlassModel trains a one-vs-rest model of the model type on the
+// training rows with a known class and evaluates it on the test rows with
+// one. classes names the classes from worst to best.
+func TrainMulticlassModel(trainData, testData *FeatureMatrix, modelType ModelType, classes []string, seed uint64) (*ModelResult, error) {
+	if trainData.Classes == nil || testData.Classes == nil {
+		return nil, fmt.Errorf("processed data has no %s column", ClassColumn)
+	}
+	if len(classes) < 2 {
+		return nil, fmt.Errorf("need at least two classes, got %d", len(classes))
+	}
+
+	model := NewOneVsRestModel(modelType, classes, seed)
+	if err := model.FitMulticlass(trainData.Subset(knownClasses(trainData, len(classes)))); err != nil {
+		return nil, fmt.Errorf("error fitting %s: %v", modelType, err)
+	}
+	return evaluateMulticlass(modelType.String(), model, testData.Subset(knownClasses(testData, len(classes))))
+}
+
+// TrainAllMulticlassModels trains and evaluates a one-vs-rest model of
+// every model type, seeding the randomized ones with seed
+func TrainAllMulticlassModels(trainData, testData *FeatureMatrix, classes []string, seed uint64) map[string]*ModelResult {
+	results := make(map[string]*ModelResult)
+	for _, modelType := range AllModelTypes {
+		fmt.Printf("Training %s multiclass model...\n", modelType)
+		result, err := TrainMulticlassModel(trainData, testData, modelType, classes, seed)
+		if err != nil {
+			fmt.Printf("Error training multiclass model %v: %v\n", modelType, err)
+			continue
+		}
+		results[result.ModelName] = result
+	}
+	return results
+}
+
+// knownClasses returns the rows of data whose class is one of n
+func knownClasses(data *FeatureMatrix, n int) []int {
+	var rows []int
+	for i, c := range data.Classes {
+		if !math.IsNaN(c) && c >= 0 && int(c) < n {
+			rows = append(rows, i)
+		}
+	}
+	return rows
+}
+
+// evaluateMulticlass scores a trained one-vs-rest model on the test set,
+// predicting each row's most probable class, and builds its ModelResult.
+// Precision, recall and F1 are macro averages over the classes, and AUC,
+// average precision and KS the macro averages of each class against the
+// rest. Brier sums the squared error over the classes, so it ranges from
+// 0 to 2. Probabilities and Labels hold the best class's probability and
+// 0/1 indicator.
+func evaluateMulticlass(name string, model *OneVsRestModel, testData *FeatureMatrix) (*ModelResult, error) {
+	rows := testData.Rows()
+	if rows == 0 {
+		return nil, fmt.Errorf("no test row has a known class")
+	}
+
+	probs := model.PredictClassProba(testData)
+	weights := testData.Weights
+	confMatrix := make(map[string]map[string]float64, len(model.Classes))
+	for _, actual := range model.Classes {
+		confMatrix[actual] = make(map[string]float64, len(model.Classes))
+		for _, predicted := range model.Classes {
+			confMatrix[actual][predicted] = 0
+		}
+	}
+
+	correct, total, brier := 0.0, 0.0, 0.0
+	for i, p := range probs {
+		actual := int(testData.Classes[i])
+		predicted := 0
+		for k := range p {
+			if p[k] > p[predicted] {
+				predicted = k
+			}
+		}
+		w := WeightAt(weights, i)
+		confMatrix[model.Classes[actual]][model.Classes[predicted]] += w
+		total += w
+		if actual == predicted {
+			correct += w
+		}
+		for k := range p {
+			y := 0.0
+			if k == actual {
+				y = 1
+			}
+			brier += w * (p[k] - y) * (p[k] - y)
+		}
+	}
+
+	// Each class against the rest
+	var auc, averagePrecision, ks float64
+	n := float64(len(model.Classes))
+	scores := make([]float64, rows)
+	labels := make([]float64, rows)
+	for k := range model.Classes {
+		for i, p := range probs {
+			scores[i] = p[k]
+			labels[i] = 0
+			if int(testData.Classes[i]) == k {
+				labels[i] = 1
+			}
+		}
+		auc += AUC(scores, labels, weights) / n
+		averagePrecision += AveragePrecision(scores, labels, weights) / n
+		ks += KS(scores, labels, weights) / n
+	}
+	// After the loop, scores and labels are those of the best class
+
+	precision, recall, f1 := calculatePRF(confMatrix)
+	specificity, balancedAccuracy, mcc, kappa := calculateAgreement(confMatrix)
+
+	result := &ModelResult{
+		ModelName:        name,
+		Precision:        precision,
+		Recall:           recall,
+		F1Score:          f1,
+		AUC:              auc,
+		AveragePrecision: averagePrecision,
+		KS:               ks,
+		Specificity:      specificity,
+		BalancedAccuracy: balancedAccuracy,
+		MCC:              mcc,
+		Kappa:            kappa,
+		ConfMatrix:       confMatrix,
+		Classes:          model.Classes,
+		Model:            model,
+		Probabilities:    scores,
+		Labels:           labels,
+		Weights:          append([]float64(nil), weights...),
+	}
+	if total > 0 {
+		result.Accuracy = correct / total
+		result.Brier = brier / total
+	}
+	return result, nil
+}
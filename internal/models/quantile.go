@@ -0,0 +1,239 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"sync"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// QuantileForestConfig holds the training parameters for a quantile
+// regression forest
+type QuantileForestConfig struct {
+	Trees int
+	// MaxDepth limits each tree's depth, where zero means unlimited, and
+	// MinSamplesLeaf is the smallest number of rows allowed in a leaf
+	MaxDepth       int
+	MinSamplesLeaf int
+	// FeatureSampling picks the per-split feature count; FeatureFraction is
+	// only used with FractionFeatures
+	FeatureSampling FeatureSampling
+	FeatureFraction float64
+	// Workers bounds how many trees are grown concurrently; zero uses GOMAXPROCS
+	Workers int
+	// Seed determines the bootstrap samples and feature choices, as in
+	// RandomForestConfig. Zero draws a random seed, which Fit records here.
+	Seed uint64
+}
+
+// DefaultQuantileForestConfig returns a 100-tree forest considering a third
+// of the features at each split, the usual choice for regression, with at
+// least 5 rows in a leaf so each leaf holds a spread of targets
+func DefaultQuantileForestConfig() QuantileForestConfig {
+	return QuantileForestConfig{
+		Trees:           100,
+		MinSamplesLeaf:  5,
+		FeatureSampling: FractionFeatures,
+		FeatureFraction: 1.0 / 3,
+	}
+}
+
+// QuantileForestModel is a quantile regression forest (Meinshausen, 2006): a
+// random forest of regression trees that keeps the training targets of each
+// leaf instead of only their mean. A row's conditional distribution weights
+// every training target by how often, across the trees, it shares the row's
+// leaf, so the forest predicts quantiles and intervals as well as the mean.
+type QuantileForestModel struct {
+	Config QuantileForestConfig
+	Trees  []*TreeNode
+	// leafRows maps each leaf of each tree to the training rows in it, and
+	// targets holds the training targets with order sorting them
+	leafRows []map[*TreeNode][]int
+	targets  []float64
+	order    []int
+}
+
+// NewQuantileForestModel creates an untrained quantile regression forest
+func NewQuantileForestModel(config QuantileForestConfig) *QuantileForestModel {
+	return &QuantileForestModel{Config: config}
+}
+
+// Fit grows each regression tree on a bootstrap sample of the rows, in
+// parallel, splitting on the largest drop in squared error, then files every
+// training row under its leaf in each tree
+func (m *QuantileForestModel) Fit(X *mat.Dense, y []float64) error {
+	rows, cols := X.Dims()
+	if rows != len(y) {
+		return fmt.Errorf("feature matrix has %d rows but %d targets", rows, len(y))
+	}
+	if rows == 0 {
+		return fmt.Errorf("cannot fit a forest on an empty matrix")
+	}
+	if m.Config.Trees <= 0 {
+		return fmt.Errorf("forest needs at least one tree")
+	}
+	if m.Config.FeatureSampling == FractionFeatures && (m.Config.FeatureFraction <= 0 || m.Config.FeatureFraction > 1) {
+		return fmt.Errorf("feature fraction must be in (0, 1], got %v", m.Config.FeatureFraction)
+	}
+
+	if m.Config.Seed == 0 {
+		m.Config.Seed = newSeed()
+	}
+
+	// Under squared loss the second-order gain of the residuals from the
+	// mean is the drop in squared error, so the boosting builder grows
+	// regression trees
+	mean := 0.0
+	for _, v := range y {
+		mean += v
+	}
+	mean /= float64(rows)
+	grad := make([]float64, rows)
+	hess := make([]float64, rows)
+	for i, v := range y {
+		grad[i], hess[i] = SquaredLoss.derivatives(v, mean)
+	}
+	treeConfig := GradientBoostingConfig{MaxDepth: m.Config.MaxDepth, MinSamplesLeaf: m.Config.MinSamplesLeaf}
+	maxFeatures := m.Config.FeatureSampling.count(cols, m.Config.FeatureFraction)
+	raw := X.RawMatrix()
+
+	m.Trees = make([]*TreeNode, m.Config.Trees)
+	m.leafRows = make([]map[*TreeNode][]int, m.Config.Trees)
+
+	workers := m.Config.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				rng := rand.New(rand.NewPCG(m.Config.Seed, uint64(t)))
+
+				// Draw a bootstrap sample of the rows
+				idx := make([]int, rows)
+				for i := range idx {
+					idx[i] = rng.IntN(rows)
+				}
+
+				b := &boostBuilder{config: treeConfig, X: raw, grad: grad, hess: hess, maxFeatures: maxFeatures, rng: rng}
+				tree := b.build(idx, 0)
+
+				// Leaves hold all the training rows, as in Meinshausen's
+				// forest, not only the bootstrap sample
+				leaves := make(map[*TreeNode][]int)
+				for i := 0; i < rows; i++ {
+					leaf := tree.leaf(b.row(i))
+					leaves[leaf] = append(leaves[leaf], i)
+				}
+				m.Trees[t] = tree
+				m.leafRows[t] = leaves
+			}
+		}()
+	}
+	for t := 0; t < m.Config.Trees; t++ {
+		jobs <- t
+	}
+	close(jobs)
+	wg.Wait()
+
+	m.targets = append([]float64(nil), y...)
+	m.order = make([]int, rows)
+	for i := range m.order {
+		m.order[i] = i
+	}
+	sort.SliceStable(m.order, func(a, c int) bool {
+		return m.targets[m.order[a]] < m.targets[m.order[c]]
+	})
+	return nil
+}
+
+// rowWeights returns the weight of each training target in the conditional
+// distribution of a row: the mean over the trees of one over the size of
+// the row's leaf for the targets in it. The weights sum to one.
+func (m *QuantileForestModel) rowWeights(row []float64, weights []float64) []float64 {
+	for i := range weights {
+		weights[i] = 0
+	}
+	for t, tree := range m.Trees {
+		rows := m.leafRows[t][tree.leaf(row)]
+		if len(rows) == 0 {
+			continue
+		}
+		w := 1 / (float64(len(rows)) * float64(len(m.Trees)))
+		for _, i := range rows {
+			weights[i] += w
+		}
+	}
+	return weights
+}
+
+// PredictProba returns the conditional mean target of each row of X, the
+// usual random forest regression
+func (m *QuantileForestModel) PredictProba(X *mat.Dense) []float64 {
+	raw := X.RawMatrix()
+	predictions := make([]float64, raw.Rows)
+	weights := make([]float64, len(m.targets))
+	for r := range predictions {
+		m.rowWeights(raw.Data[r*raw.Stride:r*raw.Stride+raw.Cols], weights)
+		for i, w := range weights {
+			predictions[r] += w * m.targets[i]
+		}
+	}
+	return predictions
+}
+
+// PredictQuantiles returns, for each of the probabilities, the conditional
+// quantile of the target for each row of X: the smallest training target
+// whose weighted share at or below it reaches the probability
+func (m *QuantileForestModel) PredictQuantiles(X *mat.Dense, probabilities []float64) [][]float64 {
+	raw := X.RawMatrix()
+	quantiles := make([][]float64, len(probabilities))
+	for k := range quantiles {
+		quantiles[k] = make([]float64, raw.Rows)
+	}
+
+	weights := make([]float64, len(m.targets))
+	for r := 0; r < raw.Rows; r++ {
+		m.rowWeights(raw.Data[r*raw.Stride:r*raw.Stride+raw.Cols], weights)
+		for k, p := range probabilities {
+			cumulative := 0.0
+			value := math.NaN()
+			for _, i := range m.order {
+				if weights[i] == 0 {
+					continue
+				}
+				cumulative += weights[i]
+				value = m.targets[i]
+				if cumulative >= p-1e-12 {
+					break
+				}
+			}
+			quantiles[k][r] = value
+		}
+	}
+	return quantiles
+}
+
+// PredictInterval returns the central prediction interval of each row of X
+// that holds the target with the given coverage, such as 0.8 for the 10th to
+// the 90th percentile
+func (m *QuantileForestModel) PredictInterval(X *mat.Dense, coverage float64) (lower, upper []float64) {
+	tail := (1 - coverage) / 2
+	quantiles := m.PredictQuantiles(X, []float64{tail, 1 - tail})
+	return quantiles[0], quantiles[1]
+}
+
+// HandlesMissing reports that the trees route NaN features by their learned
+// missing-value direction
+func (m *QuantileForestModel) HandlesMissing() bool {
+	return true
+}
@@ -0,0 +1,430 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// SegmentRule is a condition on a raw feature that routes an application to
+// a segment, e.g. "A15 <= 0" or "A9 == f". Numeric values are in raw units.
+type SegmentRule struct {
+	Feature  string `json:"feature"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// Segment is a declared group of applicants with its own model. An
+// application belongs to the first segment whose rules all hold, so a
+// segment without rules takes every application left.
+type Segment struct {
+	Name  string        `json:"name"`
+	Rules []SegmentRule `json:"rules"`
+}
+
+// SegmentPlan declares the segments and the type of model trained for each
+type SegmentPlan struct {
+	// Model is the display name of the model type, such as "Gradient
+	// Boosting"
+	Model string `json:"model"`
+	// MinRows is the fewest training rows a segment needs for a model of
+	// its own. Smaller segments, and those with one class, are scored by
+	// the pooled model trained on every row.
+	MinRows  int       `json:"min_rows"`
+	Segments []Segment `json:"segments"`
+}
+
+// LoadSegmentPlan reads a segment plan from a JSON file such as
+//
+//	{"model": "Logistic Regression", "segments": [
+//	  {"name": "thin-file", "rules": [{"feature": "A15", "operator": "<=", "value": "0"}]},
+//	  {"name": "thick-file"}
+//	]}
+func LoadSegmentPlan(path string) (*SegmentPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading segment plan: %v", err)
+	}
+
+	plan := &SegmentPlan{Model: LogisticRegression.String(), MinRows: 30}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, fmt.Errorf("error parsing segment plan: %v", err)
+	}
+	if err := plan.Validate(); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Validate checks that the plan names a known model type and at least two
+// uniquely named segments with well-formed rules
+func (p *SegmentPlan) Validate() error {
+	if _, err := ParseModelType(p.Model); err != nil {
+		return err
+	}
+	if len(p.Segments) < 2 {
+		return fmt.Errorf("segment plan needs at least two segments, got %d", len(p.Segments))
+	}
+	if p.MinRows < 1 {
+		return fmt.Errorf("segment plan needs a positive min_rows, got %d", p.MinRows)
+	}
+	seen := make(map[string]bool)
+	for _, s := range p.Segments {
+		if s.Name == "" || seen[s.Name] {
+			return fmt.Errorf("segment names must be present and unique, got %q", s.Name)
+		}
+		seen[s.Name] = true
+		for _, r := range s.Rules {
+			switch r.Operator {
+			case "<", "<=", ">", ">=", "==", "!=":
+			default:
+				return fmt.Errorf("segment %s has unknown operator %q", s.Name, r.Operator)
+			}
+			if r.Feature == "" {
+				return fmt.Errorf("segment %s has a rule without a feature", s.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseModelType returns the model type with the given display name,
+// ignoring case
+func ParseModelType(name string) (ModelType, error) {
+	for _, modelType := range AllModelTypes {
+		if strings.EqualFold(modelType.String(), name) {
+			return modelType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown model type %q", name)
+}
+
+// Normalizer converts a raw value of a continuous column to the normalized
+// scale the models see, reporting false when the column is not normalized
+type Normalizer func(column string, raw float64) (float64, bool)
+
+// segmentCondition is a rule resolved against the feature columns
+type segmentCondition struct {
+	rule SegmentRule
+	// column holds a numeric feature, compared with threshold on its
+	// normalized scale
+	column    int
+	threshold float64
+	// categorical rules test levelColumn, the one-hot column of the level
+	categorical bool
+	levelColumn int
+}
+
+// holds reports whether row i of X satisfies the condition
+func (c segmentCondition) holds(X *mat.Dense, i int) bool {
+	if c.categorical {
+		is := X.At(i, c.levelColumn) == 1
+		return is == (c.rule.Operator == "==")
+	}
+	v := X.At(i, c.column)
+	switch c.rule.Operator {
+	case "<":
+		return v < c.threshold
+	case "<=":
+		return v <= c.threshold
+	case ">":
+		return v > c.threshold
+	case ">=":
+		return v >= c.threshold
+	case "==":
+		return v == c.threshold
+	}
+	return v != c.threshold
+}
+
+// SegmentedModel trains one model per declared segment and routes each
+// application to its segment's model at prediction time. A pooled model
+// trained on every row scores the applications of segments too small for a
+// model of their own, and any matching no segment.
+type SegmentedModel struct {
+	Plan *SegmentPlan
+	// Models holds each segment's classifier, nil for a segment scored by
+	// Fallback
+	Models   []Classifier
+	Fallback Classifier
+	// TrainRows counts the training rows routed to each segment and
+	// UnmatchedRows those matching none
+	TrainRows     []int
+	UnmatchedRows int
+
+	modelType   ModelType
+	seed        uint64
+	normalize   Normalizer
+	features    []string
+	categorical []CategoricalFeature
+	conditions  [][]segmentCondition
+}
+
+// NewSegmentedModel returns an untrained segmented model. normalize puts the
+// thresholds of numeric rules on the normalized scale; it may be nil when
+// they are given on that scale.
+func NewSegmentedModel(plan *SegmentPlan, seed uint64, normalize Normalizer) (*SegmentedModel, error) {
+	if err := plan.Validate(); err != nil {
+		return nil, err
+	}
+	modelType, _ := ParseModelType(plan.Model)
+	return &SegmentedModel{Plan: plan, modelType: modelType, seed: seed, normalize: normalize}, nil
+}
+
+// Name returns the name the segmented model is reported under
+func (m *SegmentedModel) Name() string {
+	return "Segmented " + m.modelType.String()
+}
+
+// SetFeatureNames records the feature columns the rules refer to
+func (m *SegmentedModel) SetFeatureNames(names []string) {
+	m.features = names
+}
+
+// SetCategorical records the one-hot columns of categorical rules
+func (m *SegmentedModel) SetCategorical(categorical []CategoricalFeature) {
+	m.categorical = categorical
+}
+
+// resolve turns each rule into a condition on the feature columns
+func (m *SegmentedModel) resolve() error {
+	m.conditions = make([][]segmentCondition, len(m.Plan.Segments))
+	for k, s := range m.Plan.Segments {
+		for _, r := range s.Rules {
+			c, err := m.condition(r)
+			if err != nil {
+				return fmt.Errorf("segment %s: %v", s.Name, err)
+			}
+			m.conditions[k] = append(m.conditions[k], c)
+		}
+	}
+	return nil
+}
+
+// condition resolves one rule, on a categorical feature's level or on a
+// numeric feature's normalized column
+func (m *SegmentedModel) condition(r SegmentRule) (segmentCondition, error) {
+	c := segmentCondition{rule: r, levelColumn: -1}
+	for _, cf := range m.categorical {
+		if cf.Name != r.Feature {
+			continue
+		}
+		if r.Operator != "==" && r.Operator != "!=" {
+			return c, fmt.Errorf("categorical feature %s only supports == and !=", r.Feature)
+		}
+		c.categorical = true
+		for k, level := range cf.Levels {
+			if level == r.Value {
+				c.levelColumn = cf.Columns[k]
+			}
+		}
+		if c.levelColumn < 0 {
+			return c, fmt.Errorf("categorical feature %s has no level %q", r.Feature, r.Value)
+		}
+		return c, nil
+	}
+
+	c.column = -1
+	for j, name := range m.features {
+		if name == r.Feature+"_norm" || name == r.Feature && c.column < 0 {
+			c.column = j
+		}
+	}
+	if c.column < 0 {
+		return c, fmt.Errorf("feature %s is not among the model features", r.Feature)
+	}
+	raw, err := strconv.ParseFloat(r.Value, 64)
+	if err != nil {
+		return c, fmt.Errorf("numeric feature %s needs a numeric value, got %q", r.Feature, r.Value)
+	}
+	c.threshold = raw
+	if m.normalize != nil {
+		if normalized, ok := m.normalize(r.Feature, raw); ok {
+			c.threshold = normalized
+		}
+	}
+	return c, nil
+}
+
+// route returns the segment of row i of X, or -1 when it matches none
+func (m *SegmentedModel) route(X *mat.Dense, i int) int {
+	for k, conditions := range m.conditions {
+		matched := true
+		for _, c := range conditions {
+			if !c.holds(X, i) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return k
+		}
+	}
+	return -1
+}
+
+// Route returns the segment of each row of data, -1 for rows matching none
+func (m *SegmentedModel) Route(data *FeatureMatrix) []int {
+	X := data.Dense()
+	segments := make([]int, data.Rows())
+	for i := range segments {
+		segments[i] = m.route(X, i)
+	}
+	return segments
+}
+
+// Fit trains the pooled model on every row and a model for each segment
+// with enough rows of both classes
+func (m *SegmentedModel) Fit(X *mat.Dense, y []float64) error {
+	if m.features == nil {
+		_, cols := X.Dims()
+		m.features = make([]string, cols)
+		for j := range m.features {
+			m.features[j] = strconv.Itoa(j)
+		}
+	}
+	if err := m.resolve(); err != nil {
+		return err
+	}
+
+	data := &FeatureMatrix{X: X, Y: y, Features: m.features, Categorical: m.categorical}
+	m.Fallback = newClassifier(m.modelType, m.seed)
+	if err := fitClassifier(m.Fallback, data); err != nil {
+		return fmt.Errorf("error fitting pooled model: %v", err)
+	}
+
+	rows := make([][]int, len(m.Plan.Segments))
+	m.UnmatchedRows = 0
+	for i := range y {
+		if k := m.route(X, i); k >= 0 {
+			rows[k] = append(rows[k], i)
+		} else {
+			m.UnmatchedRows++
+		}
+	}
+	m.Models = make([]Classifier, len(m.Plan.Segments))
+	m.TrainRows = make([]int, len(m.Plan.Segments))
+	for k, segmentRows := range rows {
+		m.TrainRows[k] = len(segmentRows)
+		good := 0
+		for _, i := range segmentRows {
+			if y[i] >= 0.5 {
+				good++
+			}
+		}
+		if len(segmentRows) < m.Plan.MinRows || good == 0 || good == len(segmentRows) {
+			continue
+		}
+		clf := newClassifier(m.modelType, m.seed)
+		if err := fitClassifier(clf, data.Subset(segmentRows)); err != nil {
+			return fmt.Errorf("error fitting segment %s: %v", m.Plan.Segments[k].Name, err)
+		}
+		m.Models[k] = clf
+	}
+	return nil
+}
+
+// PredictProba scores each row with its segment's model
+func (m *SegmentedModel) PredictProba(X *mat.Dense) []float64 {
+	rows, _ := X.Dims()
+	bySegment := make(map[Classifier][]int)
+	for i := 0; i < rows; i++ {
+		clf := m.Fallback
+		if k := m.route(X, i); k >= 0 && m.Models[k] != nil {
+			clf = m.Models[k]
+		}
+		bySegment[clf] = append(bySegment[clf], i)
+	}
+
+	probs := make([]float64, rows)
+	data := &FeatureMatrix{X: X, Y: make([]float64, rows), Features: m.features, Categorical: m.categorical}
+	for clf, segmentRows := range bySegment {
+		for k, p := range predictProba(clf, data.Subset(segmentRows)) {
+			probs[segmentRows[k]] = p
+		}
+	}
+	return probs
+}
+
+// SegmentEvaluation compares a segment's model with the pooled model on
+// the segment's test applications
+type SegmentEvaluation struct {
+	Segment   string
+	TrainRows int
+	// TestCount is the summed sample weight of the segment's test rows
+	TestCount float64
+	// OwnModel is false when the segment is scored by the pooled model
+	OwnModel       bool
+	AUC            float64
+	Accuracy       float64
+	PooledAUC      float64
+	PooledAccuracy float64
+}
+
+// EvaluateSegments scores each segment's test applications with the model
+// they are routed to and with the pooled model. Rows matching no segment
+// are reported as "(unmatched)".
+func (m *SegmentedModel) EvaluateSegments(testData *FeatureMatrix) []SegmentEvaluation {
+	routed := Score(m, testData)
+	pooled := Score(m.Fallback, testData)
+	segments := m.Route(testData)
+
+	var evaluations []SegmentEvaluation
+	for k := -1; k < len(m.Plan.Segments); k++ {
+		e := SegmentEvaluation{Segment: "(unmatched)", TrainRows: m.UnmatchedRows}
+		if k >= 0 {
+			e.Segment = m.Plan.Segments[k].Name
+			e.TrainRows = m.TrainRows[k]
+			e.OwnModel = m.Models[k] != nil
+		}
+		var scores, pooledScores, labels, weights []float64
+		correct, pooledCorrect := 0.0, 0.0
+		for i, s := range segments {
+			if s != k {
+				continue
+			}
+			w := 1.0
+			if testData.Weights != nil {
+				w = testData.Weights[i]
+			}
+			y := testData.Y[i]
+			scores, pooledScores = append(scores, routed[i]), append(pooledScores, pooled[i])
+			labels, weights = append(labels, y), append(weights, w)
+			e.TestCount += w
+			if (routed[i] >= 0.5) == (y >= 0.5) {
+				correct += w
+			}
+			if (pooled[i] >= 0.5) == (y >= 0.5) {
+				pooledCorrect += w
+			}
+		}
+		if k < 0 && len(labels) == 0 {
+			continue
+		}
+		if e.TestCount > 0 {
+			e.AUC = AUC(scores, labels, weights)
+			e.PooledAUC = AUC(pooledScores, labels, weights)
+			e.Accuracy = correct / e.TestCount
+			e.PooledAccuracy = pooledCorrect / e.TestCount
+		}
+		evaluations = append(evaluations, e)
+	}
+	return evaluations
+}
+
+// TrainSegmentedModel trains a model per segment of the plan and evaluates
+// the routed predictions on the test set as a whole
+func TrainSegmentedModel(trainData, testData *FeatureMatrix, plan *SegmentPlan, seed uint64, normalize Normalizer) (*ModelResult, error) {
+	clf, err := NewSegmentedModel(plan, seed, normalize)
+	if err != nil {
+		return nil, err
+	}
+	if err := fitClassifier(clf, trainData); err != nil {
+		return nil, fmt.Errorf("error fitting %s: %v", clf.Name(), err)
+	}
+	return evaluateClassifier(clf.Name(), clf, testData)
+}
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"fmt"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+)
+
+// CSR is a sparse matrix in compressed sparse row form. The non-zero values
+// of row i are Data[Indptr[i]:Indptr[i+1]], in the columns given by the same
+// range of Indices.
+type CSR struct {
+	Rows, Cols int
+	Indptr     []int
+	Indices    []int
+	Data       []float64
+}
+
+// NewCSR copies the non-zero entries of a matrix into CSR form
+func NewCSR(X mat.Matrix) *CSR {
+	rows, cols := X.Dims()
+	m := &CSR{Rows: rows, Cols: cols, Indptr: make([]int, 1, rows+1)}
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			if v := X.At(i, j); v != 0 {
+				m.Indices = append(m.Indices, j)
+				m.Data = append(m.Data, v)
+			}
+		}
+		m.Indptr = append(m.Indptr, len(m.Data))
+	}
+	return m
+}
+
+// Dims returns the number of rows and columns
+func (m *CSR) Dims() (rows, cols int) {
+	return m.Rows, m.Cols
+}
+
+// NNZ returns the number of stored non-zero values
+func (m *CSR) NNZ() int {
+	return len(m.Data)
+}
+
+// Row returns the column indices and values of the non-zeros in row i
+func (m *CSR) Row(i int) (indices []int, values []float64) {
+	start, end := m.Indptr[i], m.Indptr[i+1]
+	return m.Indices[start:end], m.Data[start:end]
+}
+
+// Dense expands the matrix into a dense one
+func (m *CSR) Dense() *mat.Dense {
+	X := mat.NewDense(m.Rows, m.Cols, nil)
+	for i := 0; i < m.Rows; i++ {
+		indices, values := m.Row(i)
+		for k, j := range indices {
+			X.Set(i, j, values[k])
+		}
+	}
+	return X
+}
+
+// SparseClassifier is implemented by classifiers that can train on and score
+// CSR matrices without expanding them
+type SparseClassifier interface {
+	Classifier
+	FitSparse(X *CSR, y []float64) error
+	PredictProbaSparse(X *CSR) []float64
+}
+
+// NewSparseFeatureMatrix builds a feature matrix whose features are stored
+// only in CSR form, straight from the dataset columns
+func NewSparseFeatureMatrix(ds *dataset.Dataset, features []string) (*FeatureMatrix, error) {
+	rows := ds.Nrow()
+	if rows == 0 || len(features) == 0 {
+		return nil, fmt.Errorf("dataset has no rows or no feature columns")
+	}
+
+	cols := make([][]float64, len(features))
+	var missing [][]int
+	for j, name := range features {
+		col, err := ds.Col(name)
+		if err != nil {
+			return nil, err
+		}
+		var valid []bool
+		cols[j], valid = col.FloatValues()
+		missing = missingCells(missing, valid, j)
+	}
+
+	X := &CSR{Rows: rows, Cols: len(features), Indptr: make([]int, 1, rows+1)}
+	for i := 0; i < rows; i++ {
+		for j := range cols {
+			if v := cols[j][i]; v != 0 {
+				X.Indices = append(X.Indices, j)
+				X.Data = append(X.Data, v)
+			}
+		}
+		X.Indptr = append(X.Indptr, len(X.Data))
+	}
+
+	target, err := ds.Col(TargetColumn)
+	if err != nil {
+		return nil, err
+	}
+	y, _ := target.FloatValues()
+
+	weights, err := sampleWeights(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FeatureMatrix{Sparse: X, Y: y, Features: features, Missing: missing, Categorical: categoricalFeatures(ds, features), Weights: weights, Amounts: optionalColumn(ds, AmountColumn), Durations: optionalColumn(ds, DurationColumn), Events: optionalColumn(ds, EventColumn), Classes: optionalColumn(ds, ClassColumn)}, nil
+}
+
+// linearOperator is the access a linear model needs to its training matrix,
+// implemented for both dense and CSR storage
+type linearOperator interface {
+	Dims() (rows, cols int)
+	// mulVec sets dst = X·w
+	mulVec(dst, w []float64)
+	// mulTransVec sets dst = Xᵀ·r
+	mulTransVec(dst, r []float64)
+	// rowDot returns the dot product of row i with w
+	rowDot(i int, w []float64) float64
+	// addRow adds alpha times row i to dst
+	addRow(dst []float64, i int, alpha float64)
+}
+
+// denseOperator adapts a dense matrix to linearOperator using gonum's BLAS
+type denseOperator struct {
+	*mat.Dense
+}
+
+func (d denseOperator) mulVec(dst, w []float64) {
+	rows, cols := d.Dims()
+	mat.NewVecDense(rows, dst).MulVec(d.Dense, mat.NewVecDense(cols, w))
+}
+
+func (d denseOperator) mulTransVec(dst, r []float64) {
+	rows, cols := d.Dims()
+	mat.NewVecDense(cols, dst).MulVec(d.Dense.T(), mat.NewVecDense(rows, r))
+}
+
+func (d denseOperator) rowDot(i int, w []float64) float64 {
+	return floats.Dot(d.RawRowView(i), w)
+}
+
+func (d denseOperator) addRow(dst []float64, i int, alpha float64) {
+	floats.AddScaled(dst, alpha, d.RawRowView(i))
+}
+
+func (m *CSR) mulVec(dst, w []float64) {
+	for i := 0; i < m.Rows; i++ {
+		dst[i] = m.rowDot(i, w)
+	}
+}
+
+func (m *CSR) mulTransVec(dst, r []float64) {
+	for j := range dst {
+		dst[j] = 0
+	}
+	for i := 0; i < m.Rows; i++ {
+		m.addRow(dst, i, r[i])
+	}
+}
+
+func (m *CSR) rowDot(i int, w []float64) float64 {
+	indices, values := m.Row(i)
+	sum := 0.0
+	for k, j := range indices {
+		sum += values[k] * w[j]
+	}
+	return sum
+}
+
+func (m *CSR) addRow(dst []float64, i int, alpha float64) {
+	indices, values := m.Row(i)
+	for k, j := range indices {
+		dst[j] += alpha * values[k]
+	}
+}
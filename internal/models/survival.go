@@ -0,0 +1,353 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// CoxModelName names the Cox proportional hazards model in the evaluation
+// output
+const CoxModelName = "Cox Survival"
+
+// CoxConfig holds the training parameters of the Cox proportional hazards
+// model
+type CoxConfig struct {
+	// L2 penalizes the coefficients, which keeps those of rare one-hot
+	// levels finite
+	L2            float64
+	MaxIterations int
+	// Tolerance stops Newton's method once an iteration improves the
+	// penalized log partial likelihood by less
+	Tolerance float64
+	// Horizon is the time PredictProba gives the probability of surviving
+	// without default to; zero means the median training duration
+	Horizon float64
+}
+
+// DefaultCoxConfig returns a lightly penalized fit that scores the
+// probability of no default within horizon
+func DefaultCoxConfig(horizon float64) CoxConfig {
+	return CoxConfig{
+		L2:            1,
+		MaxIterations: 50,
+		Tolerance:     1e-9,
+		Horizon:       horizon,
+	}
+}
+
+// CoxModel is a Cox proportional hazards model of the time to default.
+// Each applicant's hazard is the baseline hazard scaled by exp(x·β), so a
+// positive coefficient makes default come sooner.
+type CoxModel struct {
+	Config       CoxConfig
+	Coefficients []float64
+	// Times holds the distinct default times of the training data in
+	// increasing order, and CumulativeHazard the Breslow estimate of the
+	// baseline cumulative hazard at each
+	Times            []float64
+	CumulativeHazard []float64
+}
+
+// NewCoxModel creates an untrained Cox model
+func NewCoxModel(config CoxConfig) *CoxModel {
+	return &CoxModel{Config: config}
+}
+
+// Fit rejects binary labels, since the model learns from the time to
+// default; use FitSurvival
+func (m *CoxModel) Fit(X *mat.Dense, y []float64) error {
+	return fmt.Errorf("the Cox model is fitted on durations and events, not binary labels")
+}
+
+// FitSurvival maximizes the penalized Breslow partial likelihood by
+// Newton's method, halving steps that would lower it, then estimates the
+// baseline cumulative hazard. events holds 1 for a default and 0 for a
+// censored duration.
+func (m *CoxModel) FitSurvival(X *mat.Dense, durations, events []float64) error {
+	rows, cols := X.Dims()
+	if rows != len(durations) || rows != len(events) {
+		return fmt.Errorf("feature matrix has %d rows but %d durations and %d events", rows, len(durations), len(events))
+	}
+	observed := 0
+	for _, e := range events {
+		if e != 0 {
+			observed++
+		}
+	}
+	if observed == 0 {
+		return fmt.Errorf("no default was observed")
+	}
+	if m.Config.Horizon <= 0 {
+		m.Config.Horizon = medianOf(durations)
+	}
+
+	// Later durations first, so each risk set grows as times decrease
+	order := make([]int, rows)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return durations[order[a]] > durations[order[b]]
+	})
+
+	beta := make([]float64, cols)
+	loglik, grad, hess := m.partialLikelihood(X, durations, events, order, beta)
+	for iter := 0; iter < m.Config.MaxIterations; iter++ {
+		// The Newton step solves -H·δ = g
+		var step mat.VecDense
+		negHess := mat.NewSymDense(cols, nil)
+		negHess.ScaleSym(-1, hess)
+		if err := step.SolveVec(negHess, mat.NewVecDense(cols, grad)); err != nil {
+			return fmt.Errorf("error solving Newton step: %v", err)
+		}
+
+		improved := false
+		for scale := 1.0; scale > 1e-6; scale /= 2 {
+			candidate := make([]float64, cols)
+			for j := range candidate {
+				candidate[j] = beta[j] + scale*step.AtVec(j)
+			}
+			l, g, h := m.partialLikelihood(X, durations, events, order, candidate)
+			if l >= loglik {
+				improved = l-loglik >= m.Config.Tolerance
+				beta, loglik, grad, hess = candidate, l, g, h
+				break
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+	m.Coefficients = beta
+
+	m.baselineHazard(X, durations, events, order)
+	return nil
+}
+
+// partialLikelihood returns the penalized Breslow log partial likelihood
+// of beta with its gradient and Hessian. order lists the rows by
+// decreasing duration.
+func (m *CoxModel) partialLikelihood(X *mat.Dense, durations, events []float64, order []int, beta []float64) (float64, []float64, *mat.SymDense) {
+	_, cols := X.Dims()
+	eta := m.linearPredictor(X, beta)
+	// exp(η) is taken relative to the largest η, which leaves every ratio
+	// unchanged and cannot overflow
+	shift := math.Inf(-1)
+	for _, v := range eta {
+		shift = math.Max(shift, v)
+	}
+
+	loglik := 0.0
+	grad := make([]float64, cols)
+	hess := mat.NewSymDense(cols, nil)
+	s0 := 0.0
+	s1 := make([]float64, cols)
+	s2 := mat.NewSymDense(cols, nil)
+	for k := 0; k < len(order); {
+		// Every row tied at this duration joins the risk set first
+		end := k
+		for end < len(order) && durations[order[end]] == durations[order[k]] {
+			i := order[end]
+			r := math.Exp(eta[i] - shift)
+			x := X.RawRowView(i)
+			s0 += r
+			for a := 0; a < cols; a++ {
+				s1[a] += r * x[a]
+				for b := a; b < cols; b++ {
+					s2.SetSym(a, b, s2.At(a, b)+r*x[a]*x[b])
+				}
+			}
+			end++
+		}
+		for _, i := range order[k:end] {
+			if events[i] == 0 {
+				continue
+			}
+			x := X.RawRowView(i)
+			loglik += eta[i] - shift - math.Log(s0)
+			for a := 0; a < cols; a++ {
+				grad[a] += x[a] - s1[a]/s0
+				for b := a; b < cols; b++ {
+					hess.SetSym(a, b, hess.At(a, b)-(s2.At(a, b)/s0-s1[a]*s1[b]/(s0*s0)))
+				}
+			}
+		}
+		k = end
+	}
+
+	for a := 0; a < cols; a++ {
+		loglik -= m.Config.L2 * beta[a] * beta[a] / 2
+		grad[a] -= m.Config.L2 * beta[a]
+		hess.SetSym(a, a, hess.At(a, a)-m.Config.L2)
+	}
+	return loglik, grad, hess
+}
+
+// baselineHazard sets the Breslow baseline cumulative hazard: at each
+// default time, the defaults then over the summed exp(x·β) of the rows
+// still at risk
+func (m *CoxModel) baselineHazard(X *mat.Dense, durations, events []float64, order []int) {
+	eta := m.linearPredictor(X, m.Coefficients)
+	var times, hazards []float64
+	atRisk := 0.0
+	for k := 0; k < len(order); {
+		end, defaults := k, 0.0
+		for end < len(order) && durations[order[end]] == durations[order[k]] {
+			atRisk += math.Exp(eta[order[end]])
+			if events[order[end]] != 0 {
+				defaults++
+			}
+			end++
+		}
+		if defaults > 0 {
+			times = append(times, durations[order[k]])
+			hazards = append(hazards, defaults/atRisk)
+		}
+		k = end
+	}
+
+	// The times were collected in decreasing order
+	m.Times = make([]float64, len(times))
+	m.CumulativeHazard = make([]float64, len(times))
+	total := 0.0
+	for k := range times {
+		j := len(times) - 1 - k
+		total += hazards[j]
+		m.Times[k] = times[j]
+		m.CumulativeHazard[k] = total
+	}
+}
+
+// linearPredictor returns x·β for each row of X
+func (m *CoxModel) linearPredictor(X *mat.Dense, beta []float64) []float64 {
+	rows, _ := X.Dims()
+	eta := make([]float64, rows)
+	for i := range eta {
+		eta[i] = mat.Dot(mat.NewVecDense(len(beta), X.RawRowView(i)), mat.NewVecDense(len(beta), beta))
+	}
+	return eta
+}
+
+// RiskScores returns each row's log relative hazard x·β; a higher score
+// means an earlier expected default
+func (m *CoxModel) RiskScores(X *mat.Dense) []float64 {
+	return m.linearPredictor(X, m.Coefficients)
+}
+
+// SurvivalAt returns each row's probability of no default by time t
+func (m *CoxModel) SurvivalAt(X *mat.Dense, t float64) []float64 {
+	// The baseline cumulative hazard is a step function of the default
+	// times
+	k := sort.Search(len(m.Times), func(k int) bool { return m.Times[k] > t })
+	baseline := 0.0
+	if k > 0 {
+		baseline = m.CumulativeHazard[k-1]
+	}
+
+	scores := m.RiskScores(X)
+	survival := make([]float64, len(scores))
+	for i, s := range scores {
+		survival[i] = math.Exp(-baseline * math.Exp(s))
+	}
+	return survival
+}
+
+// PredictProba returns each row's probability of no default within the
+// horizon, which serves as its approval probability
+func (m *CoxModel) PredictProba(X *mat.Dense) []float64 {
+	return m.SurvivalAt(X, m.Config.Horizon)
+}
+
+// SurvivalReport summarizes a Cox model on the test applications
+type SurvivalReport struct {
+	ModelName   string
+	Horizon     float64
+	TrainRows   int
+	TrainEvents int
+	TestRows    int
+	TestEvents  int
+	// Concordance is Harrell's C on the test applications
+	Concordance float64
+	// Features and Coefficients list the model's coefficients, whose
+	// exponents are the hazard ratios
+	Features     []string
+	Coefficients []float64
+}
+
+// TrainCoxModel fits a Cox model on the training rows with a known
+// duration and event, then evaluates its probability of no default within
+// the horizon against the test labels like any classifier. The report
+// adds the concordance of its risk scores with the test durations.
+func TrainCoxModel(trainData, testData *FeatureMatrix, config CoxConfig) (*ModelResult, *SurvivalReport, error) {
+	if trainData.Durations == nil || testData.Durations == nil || trainData.Events == nil || testData.Events == nil {
+		return nil, nil, fmt.Errorf("processed data has no %s and %s columns", DurationColumn, EventColumn)
+	}
+
+	rows := knownSurvival(trainData)
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("no training application has a duration and event")
+	}
+	train := trainData.Subset(rows)
+	model := NewCoxModel(config)
+	if err := model.FitSurvival(train.Dense(), train.Durations, train.Events); err != nil {
+		return nil, nil, fmt.Errorf("error fitting %s: %v", CoxModelName, err)
+	}
+
+	result, err := evaluateClassifier(CoxModelName, model, testData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	test := testData.Subset(knownSurvival(testData))
+	report := &SurvivalReport{
+		ModelName:    CoxModelName,
+		Horizon:      model.Config.Horizon,
+		TrainRows:    len(rows),
+		TrainEvents:  countEvents(train.Events),
+		TestRows:     test.Rows(),
+		TestEvents:   countEvents(test.Events),
+		Concordance:  Concordance(model.RiskScores(test.Dense()), test.Durations, test.Events, test.Weights),
+		Features:     trainData.Features,
+		Coefficients: model.Coefficients,
+	}
+	return result, report, nil
+}
+
+// knownSurvival returns the rows of data with a duration and an event
+func knownSurvival(data *FeatureMatrix) []int {
+	var rows []int
+	for i, d := range data.Durations {
+		if !math.IsNaN(d) && !math.IsNaN(data.Events[i]) {
+			rows = append(rows, i)
+		}
+	}
+	return rows
+}
+
+// countEvents returns the number of defaults among events
+func countEvents(events []float64) int {
+	n := 0
+	for _, e := range events {
+		if e != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// medianOf returns the median of values, or 0 when there are none
+func medianOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 0 {
+		return (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return sorted[n/2]
+}
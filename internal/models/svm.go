@@ -0,0 +1,203 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// LinearSVMConfig holds the training parameters for a linear SVM
+type LinearSVMConfig struct {
+	// Lambda is the L2 penalty; the Pegasos step size at step t is 1/(λt)
+	Lambda float64
+	Epochs int
+	// CalibrationFraction of the training rows is held out to fit the Platt
+	// sigmoid that turns margins into probabilities
+	CalibrationFraction float64
+	// Seed determines the calibration split and the SGD row order. Zero
+	// draws a random seed, which Fit records here.
+	Seed uint64
+}
+
+// DefaultLinearSVMConfig returns settings that converge on the normalized
+// crx features
+func DefaultLinearSVMConfig() LinearSVMConfig {
+	return LinearSVMConfig{
+		Lambda:              1e-3,
+		Epochs:              50,
+		CalibrationFraction: 0.2,
+	}
+}
+
+// LinearSVMModel is a soft-margin linear SVM trained with Pegasos SGD on the
+// hinge loss, with Platt scaling for probabilities
+type LinearSVMModel struct {
+	Config    LinearSVMConfig
+	Weights   []float64
+	Intercept float64
+	// PlattA and PlattB map a margin f to the probability 1/(1+exp(A·f+B))
+	PlattA float64
+	PlattB float64
+}
+
+// NewLinearSVMModel creates an untrained linear SVM
+func NewLinearSVMModel(config LinearSVMConfig) *LinearSVMModel {
+	return &LinearSVMModel{Config: config}
+}
+
+// Fit trains the SVM on most of the rows and calibrates it on the rest
+func (m *LinearSVMModel) Fit(X *mat.Dense, y []float64) error {
+	return m.fit(denseOperator{X}, y)
+}
+
+// FitSparse trains the SVM on a CSR matrix, touching only the non-zeros
+func (m *LinearSVMModel) FitSparse(X *CSR, y []float64) error {
+	return m.fit(X, y)
+}
+
+// fit runs Pegasos on either storage format. The weights are kept as
+// scale·v so the per-step shrinkage costs O(1) instead of O(cols).
+func (m *LinearSVMModel) fit(X linearOperator, y []float64) error {
+	rows, cols := X.Dims()
+	if rows != len(y) {
+		return fmt.Errorf("feature matrix has %d rows but %d labels", rows, len(y))
+	}
+	if m.Config.Lambda <= 0 || m.Config.Epochs <= 0 {
+		return fmt.Errorf("lambda and epochs must be positive")
+	}
+	if m.Config.CalibrationFraction <= 0 || m.Config.CalibrationFraction >= 1 {
+		return fmt.Errorf("calibration fraction must be in (0, 1), got %v", m.Config.CalibrationFraction)
+	}
+
+	if m.Config.Seed == 0 {
+		m.Config.Seed = newSeed()
+	}
+	rng := rand.New(rand.NewPCG(m.Config.Seed, 0))
+
+	perm := rng.Perm(rows)
+	nCal := int(m.Config.CalibrationFraction * float64(rows))
+	calib, train := perm[:nCal], perm[nCal:]
+	if len(train) == 0 || len(calib) == 0 {
+		return fmt.Errorf("too few rows to hold out a calibration set")
+	}
+
+	v := make([]float64, cols)
+	scale := 1.0
+	m.Intercept = 0
+
+	t := 0
+	for epoch := 0; epoch < m.Config.Epochs; epoch++ {
+		rng.Shuffle(len(train), func(a, b int) { train[a], train[b] = train[b], train[a] })
+		for _, i := range train {
+			t++
+			eta := 1 / (m.Config.Lambda * float64(t))
+			label := 2*y[i] - 1
+
+			margin := label * (scale*X.rowDot(i, v) + m.Intercept)
+
+			// Shrink w by (1-ηλ), folding the scale back into v before it
+			// underflows (the first step shrinks it to exactly zero)
+			scale *= 1 - eta*m.Config.Lambda
+			if scale < 1e-9 {
+				floats.Scale(scale, v)
+				scale = 1
+			}
+			if margin < 1 {
+				X.addRow(v, i, eta*label/scale)
+				m.Intercept += eta * label
+			}
+		}
+	}
+	floats.Scale(scale, v)
+	m.Weights = v
+
+	margins := make([]float64, len(calib))
+	labels := make([]float64, len(calib))
+	for k, i := range calib {
+		margins[k] = X.rowDot(i, m.Weights) + m.Intercept
+		labels[k] = y[i]
+	}
+	m.PlattA, m.PlattB = fitPlatt(margins, labels)
+	return nil
+}
+
+// PredictProba returns the calibrated probability of approval for each row of X
+func (m *LinearSVMModel) PredictProba(X *mat.Dense) []float64 {
+	return m.predict(denseOperator{X})
+}
+
+// PredictProbaSparse returns the calibrated probability of approval for each
+// row of X
+func (m *LinearSVMModel) PredictProbaSparse(X *CSR) []float64 {
+	return m.predict(X)
+}
+
+// predict scores the rows of either storage format
+func (m *LinearSVMModel) predict(X linearOperator) []float64 {
+	rows, _ := X.Dims()
+	probs := make([]float64, rows)
+	X.mulVec(probs, m.Weights)
+	for i, f := range probs {
+		probs[i] = sigmoid(-(m.PlattA*(f+m.Intercept) + m.PlattB))
+	}
+	return probs
+}
+
+// fitPlatt fits the sigmoid 1/(1+exp(A·f+B)) to labeled margins by Newton's
+// method on the log loss, using Platt's smoothed targets to avoid
+// overconfident probabilities on separable data
+func fitPlatt(margins, labels []float64) (a, b float64) {
+	var nPos, nNeg float64
+	for _, label := range labels {
+		if label >= 0.5 {
+			nPos++
+		} else {
+			nNeg++
+		}
+	}
+	hi := (nPos + 1) / (nPos + 2)
+	lo := 1 / (nNeg + 2)
+
+	targets := make([]float64, len(labels))
+	for i, label := range labels {
+		targets[i] = lo
+		if label >= 0.5 {
+			targets[i] = hi
+		}
+	}
+
+	a, b = 0, math.Log((nNeg+1)/(nPos+1))
+	for iter := 0; iter < 100; iter++ {
+		// Gradient and Hessian of the log loss in (A, B); p = P(y=1|f)
+		var ga, gb, haa, hab, hbb float64
+		for i, f := range margins {
+			p := sigmoid(-(a*f + b))
+			d := targets[i] - p
+			w := p * (1 - p)
+			ga += d * f
+			gb += d
+			haa += w * f * f
+			hab += w * f
+			hbb += w
+		}
+
+		// Small ridge keeps the Hessian invertible
+		haa += 1e-12
+		hbb += 1e-12
+		det := haa*hbb - hab*hab
+		if det == 0 {
+			break
+		}
+		da := (hbb*ga - hab*gb) / det
+		db := (haa*gb - hab*ga) / det
+		a -= da
+		b -= db
+		if math.Abs(da) < 1e-10 && math.Abs(db) < 1e-10 {
+			break
+		}
+	}
+	return a, b
+}
@@ -0,0 +1,647 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/mat"
+)
+
+// SplitCriterion is the impurity measure used to choose tree splits
+type SplitCriterion int
+
+const (
+	Gini SplitCriterion = iota
+	Entropy
+)
+
+// String returns the name of the criterion
+func (c SplitCriterion) String() string {
+	switch c {
+	case Gini:
+		return "gini"
+	case Entropy:
+		return "entropy"
+	}
+	return fmt.Sprintf("SplitCriterion(%d)", int(c))
+}
+
+// DecisionTreeConfig holds the growth limits for a CART tree
+type DecisionTreeConfig struct {
+	Criterion SplitCriterion
+	// MaxDepth limits the depth of the tree; zero means unlimited
+	MaxDepth int
+	// MinSamplesLeaf is the smallest number of rows allowed in a leaf
+	MinSamplesLeaf int
+	// CategoricalSplits splits on the levels of each categorical field as a
+	// whole, instead of on its one-hot columns one at a time
+	CategoricalSplits bool
+}
+
+// DefaultDecisionTreeConfig returns limits that keep the tree readable on crx
+func DefaultDecisionTreeConfig() DecisionTreeConfig {
+	return DecisionTreeConfig{
+		Criterion:         Gini,
+		MaxDepth:          6,
+		MinSamplesLeaf:    5,
+		CategoricalSplits: true,
+	}
+}
+
+// TreeNode is a node of a fitted decision tree. Rows with a feature value at
+// or below Threshold go Left, and rows missing the feature (NaN) go Left
+// when MissingLeft is set. A categorical split sets Columns to the one-hot
+// columns of a field, and Feature to the first of them: rows go Left when
+// the Categories entry of their hot column is set, and follow MissingLeft
+// when no column is hot, and Field names the field. Leaves have Feature set
+// to -1.
+type TreeNode struct {
+	Feature     int
+	Threshold   float64
+	MissingLeft bool
+	Columns     []int
+	Categories  []bool
+	Field       string
+	Left        *TreeNode
+	Right       *TreeNode
+	// Value is the fraction of positive rows that reached the node
+	Value    float64
+	Samples  int
+	Impurity float64
+	// Gain is how much the node's split reduced the training loss: the drop
+	// in sample-weighted impurity in a classification tree and the
+	// second-order gain in a boosting tree. It is zero for leaves.
+	Gain float64
+}
+
+// IsLeaf reports whether the node has no children
+func (n *TreeNode) IsLeaf() bool {
+	return n.Feature < 0
+}
+
+// IsCategorical reports whether the node splits on the levels of a
+// categorical field
+func (n *TreeNode) IsCategorical() bool {
+	return n.Columns != nil
+}
+
+// goesLeft reports whether a row goes to the left child
+func (n *TreeNode) goesLeft(row []float64) bool {
+	if n.IsCategorical() {
+		if k := hotLevel(row, n.Columns); k >= 0 {
+			return n.Categories[k]
+		}
+		return n.MissingLeft
+	}
+	v := row[n.Feature]
+	if math.IsNaN(v) {
+		return n.MissingLeft
+	}
+	return v <= n.Threshold
+}
+
+// DecisionTreeModel is a binary CART classification tree
+type DecisionTreeModel struct {
+	Config      DecisionTreeConfig
+	Root        *TreeNode
+	categorical []CategoricalFeature
+}
+
+// NewDecisionTreeModel creates an untrained decision tree
+func NewDecisionTreeModel(config DecisionTreeConfig) *DecisionTreeModel {
+	return &DecisionTreeModel{Config: config}
+}
+
+// SetCategorical records the categorical fields to split on as a whole
+func (m *DecisionTreeModel) SetCategorical(categorical []CategoricalFeature) {
+	m.categorical = categorical
+}
+
+// Fit grows the tree greedily, choosing at each node the threshold or
+// categorical split that most reduces the configured impurity. NaN values in
+// X are treated as missing and sent down whichever side of each split fits
+// them best.
+func (m *DecisionTreeModel) Fit(X *mat.Dense, y []float64) error {
+	rows, _ := X.Dims()
+	if rows != len(y) {
+		return fmt.Errorf("feature matrix has %d rows but %d labels", rows, len(y))
+	}
+	if rows == 0 {
+		return fmt.Errorf("cannot fit a tree on an empty matrix")
+	}
+
+	idx := make([]int, rows)
+	for i := range idx {
+		idx[i] = i
+	}
+
+	m.fitRows(X, y, idx, 0, nil)
+	return nil
+}
+
+// fitRows grows the tree on the given row indices, which may repeat as in a
+// bootstrap sample. When maxFeatures is positive each split only considers
+// that many randomly chosen split units.
+func (m *DecisionTreeModel) fitRows(X *mat.Dense, y []float64, idx []int, maxFeatures int, rng *rand.Rand) {
+	_, cols := X.Dims()
+	b := &treeBuilder{
+		config:      m.Config,
+		X:           X.RawMatrix(),
+		y:           y,
+		units:       m.Config.splitUnits(cols, m.categorical),
+		maxFeatures: maxFeatures,
+		rng:         rng,
+	}
+	m.Root = b.build(idx, 0)
+}
+
+// PredictProba returns the leaf positive rate for each row of X
+func (m *DecisionTreeModel) PredictProba(X *mat.Dense) []float64 {
+	raw := X.RawMatrix()
+	probs := make([]float64, raw.Rows)
+	for i := range probs {
+		probs[i] = m.Root.predict(raw.Data[i*raw.Stride : i*raw.Stride+raw.Cols])
+	}
+	return probs
+}
+
+// predict walks a single row down to its leaf
+func (n *TreeNode) predict(row []float64) float64 {
+	return n.leaf(row).Value
+}
+
+// leaf returns the leaf a single row reaches
+func (n *TreeNode) leaf(row []float64) *TreeNode {
+	for !n.IsLeaf() {
+		if n.goesLeft(row) {
+			n = n.Left
+		} else {
+			n = n.Right
+		}
+	}
+	return n
+}
+
+// HandlesMissing reports that the tree routes NaN features by their learned
+// missing-value direction
+func (m *DecisionTreeModel) HandlesMissing() bool {
+	return true
+}
+
+// Dump writes the tree as indented text, one line per node, using the given
+// feature names (falling back to column indices when names are missing)
+func (m *DecisionTreeModel) Dump(w io.Writer, featureNames []string) error {
+	return m.DumpRaw(w, featureNames, nil)
+}
+
+// Denormalizer converts a normalized value of a feature column back to its
+// raw column and units, reporting false when the column is not normalized
+type Denormalizer func(feature string, normalized float64) (column string, raw float64, ok bool)
+
+// DumpRaw is Dump with the thresholds of the columns raw knows written in
+// raw units; a nil raw leaves every threshold on the model's scale
+func (m *DecisionTreeModel) DumpRaw(w io.Writer, featureNames []string, raw Denormalizer) error {
+	if m.Root == nil {
+		return fmt.Errorf("tree has not been fitted")
+	}
+	return m.Root.dump(w, featureNames, raw, 0)
+}
+
+// dump writes the subtree rooted at n
+func (n *TreeNode) dump(w io.Writer, featureNames []string, raw Denormalizer, depth int) error {
+	indent := strings.Repeat("|   ", depth)
+
+	if n.IsLeaf() {
+		class := 0
+		if n.Value >= 0.5 {
+			class = 1
+		}
+		_, err := fmt.Fprintf(w, "%s|--- class: %d (p=%.3f, samples=%d)\n", indent, class, n.Value, n.Samples)
+		return err
+	}
+
+	left, right := n.conditions(featureNames, raw)
+	if _, err := fmt.Fprintf(w, "%s|--- %s\n", indent, left); err != nil {
+		return err
+	}
+	if err := n.Left.dump(w, featureNames, raw, depth+1); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%s|--- %s\n", indent, right); err != nil {
+		return err
+	}
+	return n.Right.dump(w, featureNames, raw, depth+1)
+}
+
+// conditions describes the rows sent to each child of an internal node,
+// with the threshold in raw units when raw knows the column
+func (n *TreeNode) conditions(featureNames []string, raw Denormalizer) (left, right string) {
+	name := func(j int) string {
+		if j < len(featureNames) {
+			return featureNames[j]
+		}
+		return fmt.Sprintf("x[%d]", j)
+	}
+
+	if !n.IsCategorical() {
+		if raw != nil {
+			if column, threshold, ok := raw(name(n.Feature), n.Threshold); ok {
+				return fmt.Sprintf("%s <= %.2f", column, threshold),
+					fmt.Sprintf("%s >  %.2f", column, threshold)
+			}
+		}
+		return fmt.Sprintf("%s <= %.4f", name(n.Feature), n.Threshold),
+			fmt.Sprintf("%s >  %.4f", name(n.Feature), n.Threshold)
+	}
+
+	// One-hot columns are named "<field>_<level>"
+	field := n.Field
+	var levels [2][]string
+	for k, j := range n.Columns {
+		side := 1
+		if n.Categories[k] {
+			side = 0
+		}
+		levels[side] = append(levels[side], strings.TrimPrefix(name(j), field+"_"))
+	}
+	return fmt.Sprintf("%s in {%s}", field, strings.Join(levels[0], ", ")),
+		fmt.Sprintf("%s in {%s}", field, strings.Join(levels[1], ", "))
+}
+
+// treeBuilder holds the training data while a tree is grown
+type treeBuilder struct {
+	config      DecisionTreeConfig
+	X           blas64.General
+	y           []float64
+	units       []splitUnit
+	maxFeatures int
+	rng         *rand.Rand
+}
+
+// splitUnit is a variable a split can be made on: a single column, or the
+// one-hot columns of a categorical field, named field, when columns is set
+type splitUnit struct {
+	column  int
+	columns []int
+	field   string
+}
+
+// splitUnits returns one unit per column, except that with categorical
+// splits on the one-hot columns of each categorical field form a single
+// unit, placed at its first column
+func (c DecisionTreeConfig) splitUnits(cols int, categorical []CategoricalFeature) []splitUnit {
+	groups := make(map[int]CategoricalFeature)
+	grouped := make([]bool, cols)
+	if c.CategoricalSplits {
+		for _, cf := range categorical {
+			if !validColumns(cf.Columns, cols) {
+				continue
+			}
+			groups[cf.Columns[0]] = cf
+			for _, j := range cf.Columns {
+				grouped[j] = true
+			}
+		}
+	}
+
+	var units []splitUnit
+	for j := 0; j < cols; j++ {
+		if cf, ok := groups[j]; ok {
+			units = append(units, splitUnit{column: -1, columns: cf.Columns, field: cf.Name})
+		} else if !grouped[j] {
+			units = append(units, splitUnit{column: j})
+		}
+	}
+	return units
+}
+
+// validColumns reports whether columns are distinct and in [0, cols), with
+// the first one the smallest
+func validColumns(columns []int, cols int) bool {
+	seen := make(map[int]bool, len(columns))
+	for _, j := range columns {
+		if j < columns[0] || j >= cols || seen[j] {
+			return false
+		}
+		seen[j] = true
+	}
+	return len(columns) > 0
+}
+
+// candidateUnits returns the split units to consider for the next split
+func (b *treeBuilder) candidateUnits() []splitUnit {
+	if b.maxFeatures <= 0 || b.maxFeatures >= len(b.units) {
+		return b.units
+	}
+	units := make([]splitUnit, b.maxFeatures)
+	for k, u := range b.rng.Perm(len(b.units))[:b.maxFeatures] {
+		units[k] = b.units[u]
+	}
+	return units
+}
+
+// value returns the feature value of a row
+func (b *treeBuilder) value(row, feature int) float64 {
+	return b.X.Data[row*b.X.Stride+feature]
+}
+
+// row returns the feature values of a row
+func (b *treeBuilder) row(i int) []float64 {
+	return b.X.Data[i*b.X.Stride : i*b.X.Stride+b.X.Cols]
+}
+
+// build grows the subtree for the given rows
+func (b *treeBuilder) build(idx []int, depth int) *TreeNode {
+	pos := 0.0
+	for _, i := range idx {
+		pos += b.y[i]
+	}
+	n := float64(len(idx))
+
+	node := &TreeNode{
+		Feature:  -1,
+		Value:    pos / n,
+		Samples:  len(idx),
+		Impurity: b.impurity(pos, n),
+	}
+
+	minLeaf := b.config.MinSamplesLeaf
+	if minLeaf < 1 {
+		minLeaf = 1
+	}
+	if node.Impurity == 0 || len(idx) < 2*minLeaf {
+		return node
+	}
+	if b.config.MaxDepth > 0 && depth >= b.config.MaxDepth {
+		return node
+	}
+
+	split, ok := b.bestSplit(idx, pos, node.Impurity, minLeaf)
+	if !ok {
+		return node
+	}
+
+	split.apply(node)
+	left, right := partitionRows(node, idx, b.row)
+	node.Left = b.build(left, depth+1)
+	node.Right = b.build(right, depth+1)
+	node.Gain = n*node.Impurity - float64(node.Left.Samples)*node.Left.Impurity - float64(node.Right.Samples)*node.Right.Impurity
+	return node
+}
+
+// partitionRows splits idx between the children of node
+func partitionRows(node *TreeNode, idx []int, row func(i int) []float64) (left, right []int) {
+	left = make([]int, 0, len(idx))
+	right = make([]int, 0, len(idx))
+	for _, i := range idx {
+		if node.goesLeft(row(i)) {
+			left = append(left, i)
+		} else {
+			right = append(right, i)
+		}
+	}
+	return left, right
+}
+
+// presentRows sorts the rows of idx with a value for feature f into sorted,
+// returning them and the rows missing it
+func presentRows(idx, sorted []int, f int, value func(row, feature int) float64) (present, missing []int) {
+	present = sorted[:0]
+	for _, i := range idx {
+		if math.IsNaN(value(i, f)) {
+			missing = append(missing, i)
+		} else {
+			present = append(present, i)
+		}
+	}
+	sort.Slice(present, func(a, c int) bool {
+		return value(present[a], f) < value(present[c], f)
+	})
+	return present, missing
+}
+
+// hotLevel returns the index of the first hot column of row among columns,
+// or -1 when none is hot
+func hotLevel(row []float64, columns []int) int {
+	for k, j := range columns {
+		if row[j] >= 0.5 {
+			return k
+		}
+	}
+	return -1
+}
+
+// splitCandidate is a threshold or categorical split with the side missing
+// values take
+type splitCandidate struct {
+	Feature     int
+	Threshold   float64
+	MissingLeft bool
+	Columns     []int
+	Categories  []bool
+	Field       string
+}
+
+// apply turns a leaf into an internal node splitting as c does
+func (c splitCandidate) apply(node *TreeNode) {
+	node.Feature = c.Feature
+	node.Threshold = c.Threshold
+	node.MissingLeft = c.MissingLeft
+	node.Columns = c.Columns
+	node.Categories = c.Categories
+	node.Field = c.Field
+}
+
+// bestSplit returns the split with the lowest weighted child impurity over
+// the candidate units
+func (b *treeBuilder) bestSplit(idx []int, pos, parentImpurity float64, minLeaf int) (split splitCandidate, ok bool) {
+	bestScore := parentImpurity - 1e-12
+
+	sorted := make([]int, len(idx))
+	for _, u := range b.candidateUnits() {
+		var candidate splitCandidate
+		var score float64
+		var found bool
+		if u.columns != nil {
+			candidate, score, found = b.categoricalSplit(idx, u.columns, pos, minLeaf)
+			candidate.Field = u.field
+		} else {
+			candidate, score, found = b.thresholdSplit(idx, sorted, u.column, pos, minLeaf)
+		}
+		if found && score < bestScore {
+			bestScore = score
+			split = candidate
+			ok = true
+		}
+	}
+
+	return split, ok
+}
+
+// thresholdSplit finds the threshold on feature f with the lowest weighted
+// child impurity. The feature is sorted once and swept with running counts.
+// Rows missing the feature are tried on both sides of every threshold; a
+// threshold above all present values separates missing from present rows.
+// When no row is missing they follow the larger child.
+func (b *treeBuilder) thresholdSplit(idx, sorted []int, f int, pos float64, minLeaf int) (split splitCandidate, bestScore float64, ok bool) {
+	n := float64(len(idx))
+	present, missing := presentRows(idx, sorted, f, b.value)
+	missN := len(missing)
+	missPos := 0.0
+	for _, i := range missing {
+		missPos += b.y[i]
+	}
+
+	leftPos := 0.0
+	for k := 0; k < len(present); k++ {
+		leftPos += b.y[present[k]]
+
+		cur, last := b.value(present[k], f), k == len(present)-1
+		if last && missN == 0 {
+			break
+		}
+		if !last && cur == b.value(present[k+1], f) {
+			continue
+		}
+		threshold := cur
+		if !last {
+			threshold = (cur + b.value(present[k+1], f)) / 2
+		}
+
+		for _, missingLeft := range []bool{true, false} {
+			leftN, lp := k+1, leftPos
+			if missingLeft {
+				if last {
+					continue
+				}
+				leftN, lp = leftN+missN, lp+missPos
+			}
+			if leftN < minLeaf || len(idx)-leftN < minLeaf {
+				continue
+			}
+			if missN == 0 {
+				missingLeft = 2*leftN >= len(idx)
+			}
+
+			ln := float64(leftN)
+			rn := n - ln
+			score := (ln*b.impurity(lp, ln) + rn*b.impurity(pos-lp, rn)) / n
+			if !ok || score < bestScore {
+				bestScore = score
+				split = splitCandidate{Feature: f, Threshold: threshold, MissingLeft: missingLeft}
+				ok = true
+			}
+			if missN == 0 {
+				break
+			}
+		}
+	}
+
+	return split, bestScore, ok
+}
+
+// categoricalSplit finds the subset of a categorical field's levels whose
+// rows, sent left, give the lowest weighted child impurity. For a binary
+// target the best subset is a prefix of the levels ordered by positive rate,
+// so only those are swept. Rows with no hot column are treated as missing,
+// and levels absent from the node follow them.
+func (b *treeBuilder) categoricalSplit(idx []int, columns []int, pos float64, minLeaf int) (split splitCandidate, bestScore float64, ok bool) {
+	n := float64(len(idx))
+	levelN := make([]int, len(columns))
+	levelPos := make([]float64, len(columns))
+	missN, missPos := 0, 0.0
+	for _, i := range idx {
+		if k := hotLevel(b.row(i), columns); k >= 0 {
+			levelN[k]++
+			levelPos[k] += b.y[i]
+		} else {
+			missN++
+			missPos += b.y[i]
+		}
+	}
+
+	var order []int
+	for k, count := range levelN {
+		if count > 0 {
+			order = append(order, k)
+		}
+	}
+	sort.SliceStable(order, func(a, c int) bool {
+		return levelPos[order[a]]/float64(levelN[order[a]]) < levelPos[order[c]]/float64(levelN[order[c]])
+	})
+
+	leftN, leftPos := 0, 0.0
+	for t, k := range order {
+		leftN += levelN[k]
+		leftPos += levelPos[k]
+
+		last := t == len(order)-1
+		if last && missN == 0 {
+			break
+		}
+
+		for _, missingLeft := range []bool{true, false} {
+			ln, lp := leftN, leftPos
+			if missingLeft {
+				if last {
+					continue
+				}
+				ln, lp = ln+missN, lp+missPos
+			}
+			if ln < minLeaf || len(idx)-ln < minLeaf {
+				continue
+			}
+			if missN == 0 {
+				missingLeft = 2*ln >= len(idx)
+			}
+
+			lf := float64(ln)
+			rf := n - lf
+			score := (lf*b.impurity(lp, lf) + rf*b.impurity(pos-lp, rf)) / n
+			if !ok || score < bestScore {
+				bestScore = score
+				split = splitCandidate{Feature: columns[0], MissingLeft: missingLeft, Columns: columns}
+				split.Categories = make([]bool, len(columns))
+				for k := range split.Categories {
+					split.Categories[k] = levelN[k] == 0 && missingLeft
+				}
+				for _, left := range order[:t+1] {
+					split.Categories[left] = true
+				}
+				ok = true
+			}
+			if missN == 0 {
+				break
+			}
+		}
+	}
+
+	return split, bestScore, ok
+}
+
+// impurity returns the configured impurity of a node with pos positives out of n
+func (b *treeBuilder) impurity(pos, n float64) float64 {
+	if n == 0 {
+		return 0
+	}
+	p := pos / n
+	switch b.config.Criterion {
+	case Entropy:
+		return binaryEntropy(p)
+	default:
+		return 2 * p * (1 - p)
+	}
+}
+
+// binaryEntropy returns the entropy in bits of a Bernoulli(p) variable
+func binaryEntropy(p float64) float64 {
+	if p <= 0 || p >= 1 {
+		return 0
+	}
+	return -p*math.Log2(p) - (1-p)*math.Log2(1-p)
+}
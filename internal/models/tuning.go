@@ -0,0 +1,240 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+)
+
+// TuningConfig holds the parameters for random search with successive
+// halving
+type TuningConfig struct {
+	// Trials is the number of random configurations sampled
+	Trials int
+	// Eta is the halving rate: each rung keeps the best 1/Eta of its trials
+	// and gives them Eta times the budget. Values below 2 turn halving off,
+	// so every trial trains with the full budget.
+	Eta int
+	// ValidationFraction of the training rows is held out to score trials
+	ValidationFraction float64
+	// Seed determines the validation split, the sampled configurations and
+	// the models' own randomness. Zero draws a random seed, which TuneModel
+	// records in the report.
+	Seed uint64
+}
+
+// DefaultTuningConfig returns 27 trials halved by thirds on a 20%
+// validation fold
+func DefaultTuningConfig() TuningConfig {
+	return TuningConfig{
+		Trials:             27,
+		Eta:                3,
+		ValidationFraction: 0.2,
+	}
+}
+
+// TunableModelTypes are the model types TuneModel can search over
+var TunableModelTypes = []ModelType{RandomForest, GradientBoosting}
+
+// TuningTrial is one configuration scored at one budget
+type TuningTrial struct {
+	Params string
+	// Budget is the number of trees the trial was trained with
+	Budget        int
+	ValidationAUC float64
+}
+
+// TuningReport records a tuning run
+type TuningReport struct {
+	Config TuningConfig
+	// Trials lists every evaluation, rung by rung
+	Trials []TuningTrial
+	// BestParams is the winning configuration, retrained on all the
+	// training data
+	BestParams string
+}
+
+// tuningCandidate is a sampled configuration that can be built at any
+// budget
+type tuningCandidate interface {
+	classifier(budget int, seed uint64) Classifier
+	String() string
+}
+
+// forestCandidate is a sampled random forest configuration
+type forestCandidate RandomForestConfig
+
+func (c forestCandidate) classifier(budget int, seed uint64) Classifier {
+	config := RandomForestConfig(c)
+	config.Trees = budget
+	config.Seed = seed
+	return NewRandomForestModel(config)
+}
+
+func (c forestCandidate) String() string {
+	sampling := map[FeatureSampling]string{SqrtFeatures: "sqrt", Log2Features: "log2", AllFeatures: "all"}[c.FeatureSampling]
+	if c.FeatureSampling == FractionFeatures {
+		sampling = fmt.Sprintf("%.2f", c.FeatureFraction)
+	}
+	return fmt.Sprintf("criterion=%s max_depth=%d min_samples_leaf=%d features=%s",
+		c.Tree.Criterion, c.Tree.MaxDepth, c.Tree.MinSamplesLeaf, sampling)
+}
+
+// sampleForest draws a random forest configuration
+func sampleForest(rng *rand.Rand) tuningCandidate {
+	config := DefaultRandomForestConfig()
+	if rng.IntN(2) == 1 {
+		config.Tree.Criterion = Entropy
+	}
+	// Zero keeps trees fully grown
+	config.Tree.MaxDepth = []int{0, 4, 6, 8, 12, 16}[rng.IntN(6)]
+	config.Tree.MinSamplesLeaf = 1 + rng.IntN(10)
+	config.FeatureSampling = []FeatureSampling{SqrtFeatures, Log2Features, FractionFeatures}[rng.IntN(3)]
+	if config.FeatureSampling == FractionFeatures {
+		config.FeatureFraction = 0.2 + 0.6*rng.Float64()
+	}
+	return forestCandidate(config)
+}
+
+// boostingCandidate is a sampled gradient boosting configuration
+type boostingCandidate GradientBoostingConfig
+
+func (c boostingCandidate) classifier(budget int, seed uint64) Classifier {
+	config := GradientBoostingConfig(c)
+	config.Iterations = budget
+	config.Seed = seed
+	return NewGradientBoostingModel(config)
+}
+
+func (c boostingCandidate) String() string {
+	return fmt.Sprintf("learning_rate=%.4f max_depth=%d min_samples_leaf=%d l2=%.3f subsample=%.2f",
+		c.LearningRate, c.MaxDepth, c.MinSamplesLeaf, c.L2, c.Subsample)
+}
+
+// sampleBoosting draws a gradient boosting configuration, with the learning
+// rate and L2 penalty sampled on a log scale
+func sampleBoosting(rng *rand.Rand) tuningCandidate {
+	config := DefaultGradientBoostingConfig()
+	config.LearningRate = math.Exp(math.Log(0.01) + rng.Float64()*(math.Log(0.3)-math.Log(0.01)))
+	config.MaxDepth = 2 + rng.IntN(4)
+	config.MinSamplesLeaf = 1 + rng.IntN(20)
+	config.L2 = math.Exp(math.Log(0.1) + rng.Float64()*(math.Log(10)-math.Log(0.1)))
+	config.Subsample = 0.5 + 0.5*rng.Float64()
+	return boostingCandidate(config)
+}
+
+// tuningSpace returns the sampler and full tree budget for a model type
+func tuningSpace(modelType ModelType) (sample func(*rand.Rand) tuningCandidate, budget int, err error) {
+	switch modelType {
+	case RandomForest:
+		return sampleForest, DefaultRandomForestConfig().Trees, nil
+	case GradientBoosting:
+		return sampleBoosting, DefaultGradientBoostingConfig().Iterations, nil
+	}
+	return nil, 0, fmt.Errorf("%s cannot be tuned", modelType)
+}
+
+// TuneModel searches random configurations of a tree ensemble. With
+// halving, all trials start on a fraction of the full number of trees;
+// after each rung only the best 1/Eta by validation AUC continue, with Eta
+// times the trees, until the survivors train with the full budget. The
+// winner is retrained on all the training data and scored on the test set
+// as "Tuned <model>".
+func TuneModel(trainData, testData *FeatureMatrix, modelType ModelType, config TuningConfig) (*ModelResult, *TuningReport, error) {
+	sample, fullBudget, err := tuningSpace(modelType)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config.Trials <= 0 {
+		return nil, nil, fmt.Errorf("trial count must be positive, got %d", config.Trials)
+	}
+	if config.ValidationFraction <= 0 || config.ValidationFraction >= 1 {
+		return nil, nil, fmt.Errorf("validation fraction must be in (0, 1), got %v", config.ValidationFraction)
+	}
+	if config.Seed == 0 {
+		config.Seed = newSeed()
+	}
+
+	perm := rand.New(rand.NewPCG(config.Seed, 0)).Perm(len(trainData.Y))
+	nValid := int(config.ValidationFraction * float64(len(perm)))
+	if nValid == 0 || nValid == len(perm) {
+		return nil, nil, fmt.Errorf("too few rows to hold out a validation set")
+	}
+	valid := perm[:nValid]
+	fit := perm[nValid:]
+	sort.Ints(valid)
+	sort.Ints(fit)
+	fitData := trainData.Subset(fit)
+	validData := trainData.Subset(valid)
+
+	rng := rand.New(rand.NewPCG(config.Seed, 1))
+	candidates := make([]tuningCandidate, config.Trials)
+	for k := range candidates {
+		candidates[k] = sample(rng)
+	}
+
+	// The number of rungs is how often the trials can be cut by Eta while
+	// more than one survives
+	rungs := 1
+	if config.Eta >= 2 {
+		for n := config.Trials; n > config.Eta; n /= config.Eta {
+			rungs++
+		}
+	}
+
+	report := &TuningReport{Config: config}
+	for rung := 0; rung < rungs; rung++ {
+		budget := fullBudget
+		for k := rung; k < rungs-1; k++ {
+			budget /= config.Eta
+		}
+		if budget < 1 {
+			budget = 1
+		}
+
+		scores := make([]float64, len(candidates))
+		for k, candidate := range candidates {
+			clf := candidate.classifier(budget, config.Seed)
+			if err := fitClassifier(clf, fitData); err != nil {
+				return nil, nil, fmt.Errorf("error fitting %s trial %s: %v", modelType, candidate, err)
+			}
+			scores[k] = AUC(predictProba(clf, validData), validData.Y, validData.Weights)
+			report.Trials = append(report.Trials, TuningTrial{
+				Params:        candidate.String(),
+				Budget:        budget,
+				ValidationAUC: scores[k],
+			})
+		}
+
+		order := make([]int, len(candidates))
+		for k := range order {
+			order[k] = k
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return scores[order[a]] > scores[order[b]]
+		})
+		keep := 1
+		if rung < rungs-1 {
+			keep = len(candidates) / config.Eta
+		}
+		survivors := make([]tuningCandidate, keep)
+		for k := range survivors {
+			survivors[k] = candidates[order[k]]
+		}
+		candidates = survivors
+	}
+
+	best := candidates[0]
+	report.BestParams = best.String()
+	clf := best.classifier(fullBudget, config.Seed)
+	if err := fitClassifier(clf, trainData); err != nil {
+		return nil, nil, fmt.Errorf("error fitting tuned %s: %v", modelType, err)
+	}
+
+	result, err := evaluateClassifier("Tuned "+modelType.String(), clf, testData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, report, nil
+}
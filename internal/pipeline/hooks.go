@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/evaluation"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/preprocessing"
+)
+
+// Stages lists the pipeline stages in the order they run
+var Stages = []string{"preprocess", "train", "evaluate", "visualize"}
+
+// Context is the state of the pipeline handed to a hook. Fields a stage has
+// not produced yet are nil, and a hook may replace or modify the ones it is
+// given; the pipeline carries on with them.
+type Context struct {
+	// Point is the hook point being run, such as "after-train"
+	Point string
+	Seed  uint64
+
+	RawDataPath   string
+	TrainDataPath string
+	TestDataPath  string
+
+	// Data is the loaded raw data before preprocessing, and the processed
+	// training rows after it. It is nil after preprocessing restored from
+	// the cache.
+	Data *preprocessing.CreditData
+
+	// TrainData and TestData are the feature matrices, set from training on
+	TrainData *models.FeatureMatrix
+	TestData  *models.FeatureMatrix
+
+	// Evaluation collects the model results; it is empty before training
+	Evaluation *evaluation.ModelEvaluation
+}
+
+// Hook is a custom pipeline step; an error stops the pipeline
+type Hook func(ctx *Context) error
+
+var (
+	mu    sync.Mutex
+	hooks = make(map[string][]Hook)
+)
+
+// validPoint reports whether point is "before-" or "after-" a stage
+func validPoint(point string) bool {
+	for _, stage := range Stages {
+		if point == "before-"+stage || point == "after-"+stage {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterHook adds a hook to run at a point, "before-" or "after-" one of
+// the Stages. Hooks at the same point run in registration order. Custom
+// steps, such as scrubbing personal data from the raw file, are added
+// without changing the stages by registering them from an init function in
+// a file of the command's package:
+//
+//	func init() {
+//		pipeline.MustRegisterHook("before-preprocess", scrubPII)
+//	}
+func RegisterHook(point string, fn Hook) error {
+	if !validPoint(point) {
+		return fmt.Errorf("unknown hook point %q (want before- or after- one of %v)", point, Stages)
+	}
+	if fn == nil {
+		return fmt.Errorf("hook for %s is nil", point)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	hooks[point] = append(hooks[point], fn)
+	return nil
+}
+
+// MustRegisterHook is RegisterHook for init functions, panicking on an
+// invalid point
+func MustRegisterHook(point string, fn Hook) {
+	if err := RegisterHook(point, fn); err != nil {
+		panic(err)
+	}
+}
+
+// HasHooks reports whether any hook is registered at point
+func HasHooks(point string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return len(hooks[point]) > 0
+}
+
+// RunHooks runs the hooks registered at point in order, stopping at the
+// first error
+func RunHooks(point string, ctx *Context) error {
+	mu.Lock()
+	registered := append([]Hook(nil), hooks[point]...)
+	mu.Unlock()
+
+	ctx.Point = point
+	for k, fn := range registered {
+		if err := fn(ctx); err != nil {
+			return fmt.Errorf("%s hook %d failed: %v", point, k+1, err)
+		}
+	}
+	return nil
+}
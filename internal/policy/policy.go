@@ -0,0 +1,214 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+)
+
+// Outcome is the final credit decision for an application
+type Outcome string
+
+const (
+	Approve Outcome = "approve"
+	Refer   Outcome = "refer"
+	Decline Outcome = "decline"
+)
+
+// Rule is a knock-out rule evaluated against the raw applicant attributes
+// before the score bands are considered, e.g. "A2 < 18 -> decline"
+type Rule struct {
+	Name     string  `json:"name"`
+	Feature  string  `json:"feature"`
+	Operator string  `json:"operator"`
+	Value    string  `json:"value"`
+	Outcome  Outcome `json:"outcome"`
+}
+
+// Policy turns a model score into an approve/refer/decline outcome.
+// Scores at or above ApproveThreshold are approved, scores below
+// DeclineThreshold are declined and everything in between is referred
+// for manual review.
+type Policy struct {
+	ApproveThreshold float64 `json:"approve_threshold"`
+	DeclineThreshold float64 `json:"decline_threshold"`
+	Rules            []Rule  `json:"rules"`
+}
+
+// Decision is the result of applying a policy to a single application.
+// Rule names the first knock-out rule that fired, whether or not the score
+// would have given the same outcome, and is empty when none did.
+type Decision struct {
+	Outcome Outcome
+	Score   float64
+	Rule    string
+	Reasons []string
+}
+
+// DefaultPolicy returns a plain cut-off policy at 0.5 with no referral band
+func DefaultPolicy() *Policy {
+	return &Policy{
+		ApproveThreshold: 0.5,
+		DeclineThreshold: 0.5,
+	}
+}
+
+// LoadPolicy reads a policy from a JSON file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file: %v", err)
+	}
+
+	p := DefaultPolicy()
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("error parsing policy file: %v", err)
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Validate checks that thresholds and rules are consistent
+func (p *Policy) Validate() error {
+	if p.DeclineThreshold > p.ApproveThreshold {
+		return fmt.Errorf("decline threshold %.4f is above approve threshold %.4f",
+			p.DeclineThreshold, p.ApproveThreshold)
+	}
+
+	for i, rule := range p.Rules {
+		if rule.Feature == "" {
+			return fmt.Errorf("rule %d has no feature", i)
+		}
+		switch rule.Operator {
+		case "<", "<=", ">", ">=", "==", "!=":
+		default:
+			return fmt.Errorf("rule %d has unsupported operator %q", i, rule.Operator)
+		}
+		switch rule.Outcome {
+		case Decline, Refer:
+		default:
+			return fmt.Errorf("rule %d must decline or refer, got %q", i, rule.Outcome)
+		}
+	}
+
+	return nil
+}
+
+// Decide applies the knock-out rules and score bands to an application.
+// A declining rule always wins; a referring rule caps the outcome at refer.
+func (p *Policy) Decide(score float64, applicant map[string]string) Decision {
+	decision := Decision{Score: score}
+
+	refer := false
+	for _, rule := range p.Rules {
+		val, ok := applicant[rule.Feature]
+		if !ok || !rule.matches(val) {
+			continue
+		}
+
+		decision.Reasons = append(decision.Reasons, rule.describe())
+		if rule.Outcome == Decline {
+			decision.Outcome = Decline
+			decision.Rule = rule.describe()
+			return decision
+		}
+		if !refer {
+			decision.Rule = rule.describe()
+		}
+		refer = true
+	}
+
+	switch {
+	case score < p.DeclineThreshold:
+		decision.Outcome = Decline
+		decision.Reasons = append(decision.Reasons,
+			fmt.Sprintf("score %.4f below decline threshold %.4f", score, p.DeclineThreshold))
+	case score < p.ApproveThreshold || refer:
+		decision.Outcome = Refer
+		if score < p.ApproveThreshold {
+			decision.Reasons = append(decision.Reasons,
+				fmt.Sprintf("score %.4f in manual review band", score))
+		}
+	default:
+		decision.Outcome = Approve
+	}
+
+	return decision
+}
+
+// DecideAll applies the policy to the score of each row of ds, whose
+// columns hold the applicant attributes the rules test
+func (p *Policy) DecideAll(scores []float64, ds *dataset.Dataset) ([]Decision, error) {
+	if ds.Nrow() != len(scores) {
+		return nil, fmt.Errorf("got %d scores for %d applicants", len(scores), ds.Nrow())
+	}
+	for _, rule := range p.Rules {
+		if _, err := ds.Col(rule.Feature); err != nil {
+			return nil, fmt.Errorf("rule %s tests %s, which the applicants do not have", rule.describe(), rule.Feature)
+		}
+	}
+
+	columns := ds.Columns()
+	decisions := make([]Decision, len(scores))
+	applicant := make(map[string]string, len(columns))
+	for i, score := range scores {
+		for _, col := range columns {
+			applicant[col.Name] = col.String(i)
+		}
+		decisions[i] = p.Decide(score, applicant)
+	}
+	return decisions, nil
+}
+
+// matches compares the applicant value with the rule value, numerically when
+// both sides parse as numbers and as strings otherwise
+func (r Rule) matches(val string) bool {
+	val = strings.TrimSpace(val)
+	if val == "" || val == "?" {
+		return false
+	}
+
+	a, errA := strconv.ParseFloat(val, 64)
+	b, errB := strconv.ParseFloat(r.Value, 64)
+	if errA == nil && errB == nil {
+		switch r.Operator {
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		case "==":
+			return a == b
+		case "!=":
+			return a != b
+		}
+		return false
+	}
+
+	switch r.Operator {
+	case "==":
+		return val == r.Value
+	case "!=":
+		return val != r.Value
+	}
+	return false
+}
+
+// describe returns a human readable reason for a rule hit
+func (r Rule) describe() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("%s %s %s", r.Feature, r.Operator, r.Value)
+}
@@ -0,0 +1,100 @@
+package policy_test
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/calibration"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/evaluation"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/policy"
+)
+
+// TestPolicyDecidesPredictions loads a policy, decides scored test rows as
+// -policy does and checks the decisions written to the predictions file
+func TestPolicyDecidesPredictions(t *testing.T) {
+	dir := t.TempDir()
+	policyPath := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(policyPath, []byte(`{
+		"approve_threshold": 0.65,
+		"decline_threshold": 0.35,
+		"rules": [
+			{"name": "applicant under 18", "feature": "A2", "operator": "<", "value": "18", "outcome": "decline"},
+			{"feature": "A9", "operator": "==", "value": "f", "outcome": "refer"}
+		]
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := policy.LoadPolicy(policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The processed test file keeps the unscaled attributes the rules test
+	applicants, err := dataset.FromRecords([]string{"A2", "A9", "A16"}, [][]string{
+		{"30.5", "t", "1"}, // approved on its score
+		{"17", "t", "1"},   // knocked out by age despite its score
+		{"45", "f", "1"},   // referred by the A9 rule despite its score
+		{"52", "t", "0"},   // in the review band
+		{"", "t", "0"},     // declined on its score; missing age fires no rule
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores := []float64{0.9, 0.9, 0.8, 0.5, 0.1}
+	decisions, err := p.DecideAll(scores, applicants)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &models.ModelResult{ModelName: "Logistic Regression", Probabilities: scores, Labels: []float64{1, 1, 1, 0, 0}}
+	pds := []float64{0.05, 0.05, 0.1, 0.4, 0.9}
+	predictionsPath := filepath.Join(dir, "predictions.csv")
+	if err := evaluation.SavePredictions(predictionsPath, result, pds, calibration.DefaultGradeScale(), decisions); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(predictionsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, row := range rows {
+		got = append(got, row[len(row)-2:])
+	}
+	want := [][]string{
+		{"Decision", "Rule"},
+		{"approve", ""},
+		{"decline", "applicant under 18"},
+		{"refer", "A9 == f"},
+		{"refer", ""},
+		{"decline", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("predictions decisions = %v, want %v", got, want)
+	}
+}
+
+func TestDecideAllRejectsUnknownFeature(t *testing.T) {
+	p := &policy.Policy{
+		ApproveThreshold: 0.5,
+		DeclineThreshold: 0.5,
+		Rules:            []policy.Rule{{Feature: "income", Operator: "<", Value: "1000", Outcome: policy.Decline}},
+	}
+	applicants, err := dataset.FromRecords([]string{"A2"}, [][]string{{"30"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DecideAll([]float64{0.7}, applicants); err == nil {
+		t.Error("a rule on a missing attribute was accepted")
+	}
+}
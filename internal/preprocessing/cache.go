@@ -0,0 +1,169 @@
+package preprocessing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+)
+
+// cacheVersion must be bumped whenever preprocessing code changes its output
+// for the same raw data and configuration
+const cacheVersion = 4
+
+// Cached artifact file names inside a cache entry
+const (
+	cachedTrainFile    = "train.csv"
+	cachedTestFile     = "test.csv"
+	cachedPipelineFile = "pipeline.json"
+)
+
+// configHash hashes everything besides the raw data that determines the
+// processed output
+func configHash(seed uint64, keepMissing bool, pii *PIIConfig, schema *Schema) (string, error) {
+	piiFingerprint := ""
+	if pii != nil {
+		piiFingerprint = pii.Fingerprint()
+	}
+
+	config := struct {
+		Version     int
+		Raw         []string
+		Categorical []string
+		Continuous  []string
+		TestSize    float64
+		Seed        uint64
+		KeepMissing bool    `json:",omitempty"`
+		PII         string  `json:",omitempty"`
+		Schema      *Schema `json:",omitempty"`
+	}{cacheVersion, RawColumns, CategoricalColumns, ContinuousColumns, TestSize, seed, keepMissing, piiFingerprint, schema}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("error encoding preprocessing config: %v", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ResolveSeed returns seed, or a random non-zero seed when it is zero. A
+// resolved seed makes a random split repeatable and gives it a cache key of
+// its own, so one random run's split is never reused by the next.
+func ResolveSeed(seed uint64) uint64 {
+	for seed == 0 {
+		seed = rand.Uint64()
+	}
+	return seed
+}
+
+// CacheKey returns the content address of the processed output for a raw data
+// file: a hash of the raw bytes combined with the preprocessing config hash.
+// pii is the identifier masking, or nil for none, and schema the
+// preprocessing config, or nil for the crx defaults.
+func CacheKey(rawPath string, seed uint64, keepMissing bool, pii *PIIConfig, schema *Schema) (string, error) {
+	file, err := os.Open(rawPath)
+	if err != nil {
+		return "", fmt.Errorf("error opening raw data: %v", err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("error hashing raw data: %v", err)
+	}
+
+	cfg, err := configHash(seed, keepMissing, pii, schema)
+	if err != nil {
+		return "", err
+	}
+	io.WriteString(h, cfg)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// RestoreFromCache copies a cached train/test pair and its fitted
+// preprocessing pipeline to the given paths. It reports false, with no
+// error, when the cache has no entry for key.
+func RestoreFromCache(cacheDir, key, trainPath, testPath, pipelinePath string) (bool, error) {
+	entry := filepath.Join(cacheDir, key)
+	if _, err := os.Stat(entry); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err := copyFile(filepath.Join(entry, cachedTrainFile), trainPath); err != nil {
+		return false, fmt.Errorf("error restoring cached training data: %v", err)
+	}
+	if err := copyFile(filepath.Join(entry, cachedTestFile), testPath); err != nil {
+		return false, fmt.Errorf("error restoring cached test data: %v", err)
+	}
+	if err := copyFile(filepath.Join(entry, cachedPipelineFile), pipelinePath); err != nil {
+		return false, fmt.Errorf("error restoring cached pipeline: %v", err)
+	}
+
+	return true, nil
+}
+
+// StoreInCache saves a train/test pair and its fitted pipeline under
+// key. The entry is written to a temporary directory and renamed into place
+// so readers never see a partial entry.
+func StoreInCache(cacheDir, key, trainPath, testPath, pipelinePath string) error {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return fmt.Errorf("error creating cache directory: %v", err)
+	}
+
+	tmp, err := os.MkdirTemp(cacheDir, key+".tmp")
+	if err != nil {
+		return fmt.Errorf("error creating cache entry: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := copyFile(trainPath, filepath.Join(tmp, cachedTrainFile)); err != nil {
+		return fmt.Errorf("error caching training data: %v", err)
+	}
+	if err := copyFile(testPath, filepath.Join(tmp, cachedTestFile)); err != nil {
+		return fmt.Errorf("error caching test data: %v", err)
+	}
+	if err := copyFile(pipelinePath, filepath.Join(tmp, cachedPipelineFile)); err != nil {
+		return fmt.Errorf("error caching pipeline: %v", err)
+	}
+
+	entry := filepath.Join(cacheDir, key)
+	if err := os.Rename(tmp, entry); err != nil {
+		// Another run may have stored the same entry first
+		if _, statErr := os.Stat(entry); statErr == nil {
+			return nil
+		}
+		return fmt.Errorf("error storing cache entry: %v", err)
+	}
+
+	return nil
+}
+
+// copyFile copies src to dst, replacing dst if it exists. Entries are kept
+// uncompressed, so the content is decompressed or compressed as needed to
+// match the destination name.
+func copyFile(src, dst string) error {
+	in, err := dataset.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := dataset.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
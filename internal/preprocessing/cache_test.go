@@ -0,0 +1,57 @@
+package preprocessing_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/preprocessing"
+)
+
+// TestRandomSeedRunsDoNotShareCache checks that two -seed 0 runs resolve to
+// different seeds, so the second does not restore the first one's split
+func TestRandomSeedRunsDoNotShareCache(t *testing.T) {
+	if seed := preprocessing.ResolveSeed(7); seed != 7 {
+		t.Errorf("ResolveSeed(7) = %d, want 7", seed)
+	}
+
+	dir := t.TempDir()
+	rawPath := filepath.Join(dir, "crx.data")
+	if err := os.WriteFile(rawPath, []byte("b,30.83,0,u,g,w,v,1.25,t,t,01,f,g,00202,0,+\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	trainPath := filepath.Join(dir, "train.csv")
+	testPath := filepath.Join(dir, "test.csv")
+	pipelinePath := filepath.Join(dir, "pipeline.json")
+	for _, path := range []string{trainPath, testPath, pipelinePath} {
+		if err := os.WriteFile(path, []byte("first run\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cacheDir := filepath.Join(dir, "cache")
+	first := preprocessing.ResolveSeed(0)
+	firstKey, err := preprocessing.CacheKey(rawPath, first, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := preprocessing.StoreInCache(cacheDir, firstKey, trainPath, testPath, pipelinePath); err != nil {
+		t.Fatal(err)
+	}
+
+	second := preprocessing.ResolveSeed(0)
+	if first == 0 || second == 0 || first == second {
+		t.Fatalf("random seeds %d and %d, want two different non-zero seeds", first, second)
+	}
+	secondKey, err := preprocessing.CacheKey(rawPath, second, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := preprocessing.RestoreFromCache(cacheDir, secondKey, trainPath, testPath, pipelinePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached {
+		t.Error("a second random-seed run restored the first run's split")
+	}
+}
@@ -0,0 +1,192 @@
+package preprocessing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Column types of a preprocessing config
+const (
+	CategoricalType = "categorical"
+	ContinuousType  = "continuous"
+	TargetType      = "target"
+	// IgnoreType columns, such as record IDs, are dropped after loading
+	IgnoreType = "ignore"
+	// AmountType marks the target of the second-stage regression, such as
+	// the credit limit
+	AmountType = "amount"
+	// DurationType and EventType mark the columns of a time-to-default
+	// target: the time observed and whether it ended in default (1) or
+	// censoring (0)
+	DurationType = "duration"
+	EventType    = "event"
+)
+
+// Imputation strategies for missing values. Categorical columns accept
+// mode, constant, knn and none; continuous ones mean, median, constant,
+// knn and none.
+const (
+	ImputeMode     = "mode"
+	ImputeMean     = "mean"
+	ImputeMedian   = "median"
+	ImputeConstant = "constant"
+	// ImputeKNN takes the mean, or for a categorical column the most
+	// frequent level, of the nearest rows by the continuous columns
+	ImputeKNN = "knn"
+	// ImputeNone leaves missing values missing, for models that handle
+	// them natively
+	ImputeNone = "none"
+)
+
+// Encodings of categorical columns
+const (
+	// OneHotEncoding adds a 0/1 column "<column>_<level>" per level
+	OneHotEncoding = "onehot"
+	// OrdinalEncoding adds one column "<column>_ordinal" holding the
+	// level's position in Levels, or in sorted order
+	OrdinalEncoding = "ordinal"
+	// FrequencyEncoding adds one column "<column>_freq" holding the share
+	// of rows with the level, which suits columns with many levels
+	FrequencyEncoding = "frequency"
+)
+
+// ColumnOptions sets how one column is preprocessed. Empty fields take the
+// defaults: categorical columns are imputed with their mode and one-hot
+// encoded, and continuous ones are imputed with their mean.
+type ColumnOptions struct {
+	Impute string `json:"impute,omitempty" yaml:"impute"`
+	// Fill is the value of constant imputation, "missing" or 0 by default
+	Fill string `json:"fill,omitempty" yaml:"fill"`
+	// Neighbors is the number of rows KNN imputation takes a value from,
+	// KNNNeighbors by default
+	Neighbors int `json:"neighbors,omitempty" yaml:"neighbors"`
+	// Indicator adds a 0/1 column "<column>_imputed" marking the rows
+	// whose value was missing
+	Indicator bool   `json:"indicator,omitempty" yaml:"indicator"`
+	Encoding  string `json:"encoding,omitempty" yaml:"encoding"`
+	// Levels orders the levels of an ordinal column; levels not listed
+	// follow in sorted order
+	Levels []string `json:"levels,omitempty" yaml:"levels"`
+}
+
+// ColumnConfig declares one raw column of a preprocessing config
+type ColumnConfig struct {
+	Name          string `yaml:"name"`
+	Type          string `yaml:"type"`
+	ColumnOptions `yaml:",inline"`
+}
+
+// Config is the YAML form of a schema: the raw columns in file order, each
+// with its type and preprocessing options
+type Config struct {
+	Name string `yaml:"name"`
+	// Path is the raw data file, relative to the config file; empty means
+	// the default raw data path
+	Path      string   `yaml:"path"`
+	Delimiter string   `yaml:"delimiter"`
+	Positive  []string `yaml:"positive"`
+	// Horizon labels applicants when there is no target column: good when
+	// they did not default within it
+	Horizon float64 `yaml:"horizon"`
+	// Classes lists the target values of a multiclass outcome from worst
+	// to best; positive defaults to the last
+	Classes []string       `yaml:"classes"`
+	Columns []ColumnConfig `yaml:"columns"`
+	// Derived defines features computed from the continuous columns, each
+	// as "name = expression"
+	Derived []string `yaml:"derived"`
+}
+
+// LoadConfig reads a preprocessing config such as
+//
+//	name: crx
+//	path: crx.data
+//	positive: ["+"]
+//	columns:
+//	  - {name: A1, type: categorical, impute: constant, fill: unknown}
+//	  - {name: A2, type: continuous, impute: median}
+//	  - {name: A6, type: categorical, encoding: frequency}
+//	  - {name: A16, type: target}
+//	derived:
+//	  - debt_ratio = A3 / (A15 + 1)
+//
+// and returns its schema and raw data path, resolved against the config's
+// directory
+func LoadConfig(path string) (*Schema, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading preprocessing config: %v", err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, "", fmt.Errorf("error parsing preprocessing config: %v", err)
+	}
+	schema, err := config.Schema()
+	if err != nil {
+		return nil, "", err
+	}
+
+	rawPath := config.Path
+	if rawPath != "" && !filepath.IsAbs(rawPath) {
+		rawPath = filepath.Join(filepath.Dir(path), rawPath)
+	}
+	return schema, rawPath, nil
+}
+
+// Schema converts the config to the schema preprocessing runs on
+func (c *Config) Schema() (*Schema, error) {
+	s := &Schema{Name: c.Name, Positive: c.Positive, Delimiter: c.Delimiter, Horizon: c.Horizon, Classes: c.Classes, Options: make(map[string]ColumnOptions)}
+	if len(s.Positive) == 0 && len(s.Classes) > 0 {
+		s.Positive = []string{s.Classes[len(s.Classes)-1]}
+	}
+	for _, col := range c.Columns {
+		s.Columns = append(s.Columns, col.Name)
+		switch col.Type {
+		case CategoricalType:
+			s.Categorical = append(s.Categorical, col.Name)
+		case ContinuousType:
+			s.Continuous = append(s.Continuous, col.Name)
+		case TargetType:
+			if s.Target != "" {
+				return nil, fmt.Errorf("config %s has two target columns, %s and %s", c.Name, s.Target, col.Name)
+			}
+			s.Target = col.Name
+		case IgnoreType:
+			s.Ignore = append(s.Ignore, col.Name)
+		case AmountType:
+			if s.Amount != "" {
+				return nil, fmt.Errorf("config %s has two amount columns, %s and %s", c.Name, s.Amount, col.Name)
+			}
+			s.Amount = col.Name
+		case DurationType, EventType:
+			field := &s.Duration
+			if col.Type == EventType {
+				field = &s.Event
+			}
+			if *field != "" {
+				return nil, fmt.Errorf("config %s has two %s columns, %s and %s", c.Name, col.Type, *field, col.Name)
+			}
+			*field = col.Name
+		default:
+			return nil, fmt.Errorf("column %s has unknown type %q (want categorical, continuous, target, ignore, amount, duration or event)", col.Name, col.Type)
+		}
+		if opts := col.ColumnOptions; opts.Impute != "" || opts.Fill != "" || opts.Neighbors != 0 || opts.Indicator || opts.Encoding != "" || len(opts.Levels) > 0 {
+			s.Options[col.Name] = col.ColumnOptions
+		}
+	}
+	for _, definition := range c.Derived {
+		d, err := ParseDerivedFeature(definition)
+		if err != nil {
+			return nil, fmt.Errorf("config %s: %v", c.Name, err)
+		}
+		s.Derived = append(s.Derived, d)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,384 @@
+package preprocessing
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+)
+
+// DerivedFeature is a continuous feature computed from other continuous
+// columns by an arithmetic expression, such as debt_ratio = A3 / (A15 + 1)
+type DerivedFeature struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+// ParseDerivedFeature parses a definition of the form "name = expression"
+func ParseDerivedFeature(definition string) (DerivedFeature, error) {
+	name, expression, ok := strings.Cut(definition, "=")
+	name, expression = strings.TrimSpace(name), strings.TrimSpace(expression)
+	if !ok || name == "" || expression == "" {
+		return DerivedFeature{}, fmt.Errorf("derived feature %q is not of the form name = expression", definition)
+	}
+	return DerivedFeature{Name: name, Expression: expression}, nil
+}
+
+// expressionFunctions are the functions an expression may call, by their
+// number of arguments
+var expressionFunctions = map[string]int{
+	"abs":   1,
+	"log":   1,
+	"log1p": 1,
+	"sqrt":  1,
+	"exp":   1,
+	"min":   2,
+	"max":   2,
+}
+
+// expr is a node of a parsed expression
+type expr interface {
+	// eval computes the node from the values of the referenced columns,
+	// where NaN marks a missing value
+	eval(values map[string]float64) float64
+}
+
+// numberExpr is a constant
+type numberExpr float64
+
+// columnExpr is the value of a column
+type columnExpr string
+
+// negateExpr is a unary minus
+type negateExpr struct {
+	operand expr
+}
+
+// binaryExpr is an arithmetic operation, one of + - * /
+type binaryExpr struct {
+	op          byte
+	left, right expr
+}
+
+// callExpr is a call of one of the expressionFunctions
+type callExpr struct {
+	function string
+	args     []expr
+}
+
+func (e numberExpr) eval(map[string]float64) float64 {
+	return float64(e)
+}
+
+func (e columnExpr) eval(values map[string]float64) float64 {
+	return values[string(e)]
+}
+
+func (e negateExpr) eval(values map[string]float64) float64 {
+	return -e.operand.eval(values)
+}
+
+func (e binaryExpr) eval(values map[string]float64) float64 {
+	left, right := e.left.eval(values), e.right.eval(values)
+	switch e.op {
+	case '+':
+		return left + right
+	case '-':
+		return left - right
+	case '*':
+		return left * right
+	default:
+		return left / right
+	}
+}
+
+func (e callExpr) eval(values map[string]float64) float64 {
+	x := e.args[0].eval(values)
+	switch e.function {
+	case "abs":
+		return math.Abs(x)
+	case "log":
+		return math.Log(x)
+	case "log1p":
+		return math.Log1p(x)
+	case "sqrt":
+		return math.Sqrt(x)
+	case "exp":
+		return math.Exp(x)
+	}
+	// min and max are missing when either argument is, unlike math.Min
+	y := e.args[1].eval(values)
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return math.NaN()
+	}
+	if (e.function == "min") == (x < y) {
+		return x
+	}
+	return y
+}
+
+// expressionParser is a recursive descent parser of the grammar
+//
+//	expression = term {("+" | "-") term}
+//	term       = factor {("*" | "/") factor}
+//	factor     = "-" factor | number | column | function "(" arguments ")" | "(" expression ")"
+//
+// where columns and functions are names of letters, digits, "_" and "."
+type expressionParser struct {
+	source  string
+	pos     int
+	columns []string
+}
+
+// parseExpression parses an expression and returns it with the columns it
+// references, in order of first use
+func parseExpression(source string) (expr, []string, error) {
+	p := &expressionParser{source: source}
+	e, err := p.expression()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing expression %q: %v", source, err)
+	}
+	if p.skipSpace(); p.pos < len(p.source) {
+		return nil, nil, fmt.Errorf("error parsing expression %q: unexpected %q at position %d", source, p.source[p.pos], p.pos+1)
+	}
+	return e, p.columns, nil
+}
+
+// skipSpace moves past any white space
+func (p *expressionParser) skipSpace() {
+	for p.pos < len(p.source) && unicode.IsSpace(rune(p.source[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek returns the next character that is not white space, or 0 at the end
+func (p *expressionParser) peek() byte {
+	p.skipSpace()
+	if p.pos == len(p.source) {
+		return 0
+	}
+	return p.source[p.pos]
+}
+
+// expression parses a sum of terms
+func (p *expressionParser) expression() (expr, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// term parses a product of factors
+func (p *expressionParser) term() (expr, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// factor parses a negation, number, column, call or parenthesized
+// expression
+func (p *expressionParser) factor() (expr, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end")
+	case c == '-':
+		p.pos++
+		operand, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return negateExpr{operand}, nil
+	case c == '(':
+		p.pos++
+		e, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ) at position %d", p.pos+1)
+		}
+		p.pos++
+		return e, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.source) && (isNameChar(p.source[p.pos]) || (p.source[p.pos] == '+' || p.source[p.pos] == '-') && (p.source[p.pos-1] == 'e' || p.source[p.pos-1] == 'E')) {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.source[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p.source[start:p.pos])
+		}
+		return numberExpr(value), nil
+	case isNameChar(c):
+		start := p.pos
+		for p.pos < len(p.source) && isNameChar(p.source[p.pos]) {
+			p.pos++
+		}
+		name := p.source[start:p.pos]
+		if p.peek() != '(' {
+			if !contains(p.columns, name) {
+				p.columns = append(p.columns, name)
+			}
+			return columnExpr(name), nil
+		}
+		return p.call(name)
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+}
+
+// call parses the parenthesized arguments of a function call
+func (p *expressionParser) call(function string) (expr, error) {
+	arity, ok := expressionFunctions[function]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", function)
+	}
+	p.pos++
+	var args []expr
+	for {
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	if p.peek() != ')' {
+		return nil, fmt.Errorf("missing ) at position %d", p.pos+1)
+	}
+	p.pos++
+	if len(args) != arity {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", function, arity, len(args))
+	}
+	return callExpr{function: function, args: args}, nil
+}
+
+// isNameChar reports whether c can be part of a column or function name
+func isNameChar(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// validateDerived checks that every derived feature has a new name and an
+// expression that parses and only references continuous columns or the
+// derived features before it
+func (s *Schema) validateDerived() error {
+	inputs := append([]string(nil), s.Continuous...)
+	for _, d := range s.Derived {
+		if !isName(d.Name) {
+			return fmt.Errorf("schema %s derived feature %q needs a name of letters, digits, _ and .", s.Name, d.Name)
+		}
+		if contains(s.Columns, d.Name) || contains(inputs, d.Name) {
+			return fmt.Errorf("schema %s derived feature %s is already a column", s.Name, d.Name)
+		}
+		if isProcessedOutcome(d.Name) {
+			return fmt.Errorf("schema %s derived feature %s clashes with a processed column name", s.Name, d.Name)
+		}
+		_, columns, err := parseExpression(d.Expression)
+		if err != nil {
+			return fmt.Errorf("schema %s derived feature %s: %v", s.Name, d.Name, err)
+		}
+		for _, name := range columns {
+			if !contains(inputs, name) {
+				return fmt.Errorf("schema %s derived feature %s uses %s, which is not a continuous column or an earlier derived feature", s.Name, d.Name, name)
+			}
+		}
+		inputs = append(inputs, d.Name)
+	}
+	return nil
+}
+
+// isName reports whether name is a non-empty column name an expression can
+// reference
+func isName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' || name[0] == '.' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isNameChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// continuousFeatures returns the continuous columns followed by the derived
+// features, which are preprocessed like them
+func (s *Schema) continuousFeatures() []string {
+	names := append([]string(nil), s.Continuous...)
+	for _, d := range s.Derived {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// deriveFeatures adds a column for each derived feature of the schema, in
+// order, so later ones can use earlier ones. A row's value is missing when
+// an input is missing or not numeric, or the result is not finite, such as
+// after a division by zero; imputation then fills it like any continuous
+// value.
+func (cd *CreditData) deriveFeatures() error {
+	for _, d := range cd.schema().Derived {
+		e, columns, err := parseExpression(d.Expression)
+		if err != nil {
+			return fmt.Errorf("error parsing derived feature %s: %v", d.Name, err)
+		}
+		inputs := make(map[string][]float64, len(columns))
+		for _, name := range columns {
+			col, err := cd.Data.Col(name)
+			if err != nil {
+				return fmt.Errorf("error accessing column %s of derived feature %s: %v", name, d.Name, err)
+			}
+			values, valid := col.FloatValues()
+			for i, ok := range valid {
+				if !ok {
+					values[i] = math.NaN()
+				}
+			}
+			inputs[name] = values
+		}
+
+		rows := cd.Data.Nrow()
+		values := make([]float64, rows)
+		null := make([]bool, rows)
+		row := make(map[string]float64, len(columns))
+		for i := range values {
+			for name, column := range inputs {
+				row[name] = column[i]
+			}
+			values[i] = e.eval(row)
+			if math.IsNaN(values[i]) || math.IsInf(values[i], 0) {
+				values[i] = 0
+				null[i] = true
+			}
+		}
+		if err := cd.Data.Set(dataset.NewFloatColumn(d.Name, values, null)); err != nil {
+			return fmt.Errorf("error adding derived feature %s: %v", d.Name, err)
+		}
+	}
+	return nil
+}
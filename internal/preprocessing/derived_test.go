@@ -0,0 +1,171 @@
+package preprocessing
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+)
+
+func TestParseDerivedFeature(t *testing.T) {
+	tests := []struct {
+		definition string
+		want       DerivedFeature
+		wantErr    bool
+	}{
+		{definition: "ratio = A3 / A15", want: DerivedFeature{Name: "ratio", Expression: "A3 / A15"}},
+		{definition: "  debt.log=log1p(A3)  ", want: DerivedFeature{Name: "debt.log", Expression: "log1p(A3)"}},
+		{definition: "ratio", wantErr: true},
+		{definition: "= A3", wantErr: true},
+		{definition: "ratio =", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDerivedFeature(tt.definition)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDerivedFeature(%q) error = %v, want error %v", tt.definition, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDerivedFeature(%q) = %+v, want %+v", tt.definition, got, tt.want)
+		}
+	}
+}
+
+func TestExpressionEval(t *testing.T) {
+	values := map[string]float64{"A2": 4, "A3": 0, "A15": math.NaN()}
+	tests := []struct {
+		expression string
+		want       float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"8 - 4 - 2", 2},
+		{"8 / 4 / 2", 1},
+		{"2 * 3 - 8 / 4", 4},
+		{"- -3", 3},
+		{"2 - -3", 5},
+		{"-A2 * 2", -8},
+		{"1.5e1 + 2E-1", 15.2},
+		{"sqrt(A2) + abs(-1)", 3},
+		{"min(A2, 3) * max(A2, 3)", 12},
+		{"A2 / A3", math.Inf(1)},
+		{"A2 + A15", math.NaN()},
+		{"max(A2, A15)", math.NaN()},
+	}
+	for _, tt := range tests {
+		e, _, err := parseExpression(tt.expression)
+		if err != nil {
+			t.Errorf("parseExpression(%q): %v", tt.expression, err)
+			continue
+		}
+		got := e.eval(values)
+		if !sameFloat(got, tt.want) {
+			t.Errorf("%q = %v, want %v", tt.expression, got, tt.want)
+		}
+	}
+}
+
+// sameFloat reports whether a and b are equal up to rounding, or both NaN
+func sameFloat(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	return a == b || math.Abs(a-b) < 1e-9
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		message    string
+	}{
+		{"foo(A2)", "unknown function foo"},
+		{"log(A2, A3)", "log takes 1 arguments, got 2"},
+		{"1 +", "unexpected end"},
+		{"(1 + 2", "missing )"},
+		{"1 2", "unexpected"},
+		{"A2 $ A3", "unexpected"},
+		{"1.2.3", "invalid number"},
+	}
+	for _, tt := range tests {
+		_, _, err := parseExpression(tt.expression)
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("parseExpression(%q) error = %v, want one containing %q", tt.expression, err, tt.message)
+		}
+	}
+}
+
+func TestValidateDerived(t *testing.T) {
+	tests := []struct {
+		name    string
+		derived []DerivedFeature
+		message string
+	}{
+		{"continuous inputs", []DerivedFeature{{"ratio", "A3 / (A15 + 1)"}}, ""},
+		{"earlier derived feature", []DerivedFeature{{"ratio", "A3 / (A15 + 1)"}, {"log_ratio", "log1p(ratio)"}}, ""},
+		{"unknown column", []DerivedFeature{{"ratio", "A3 / income"}}, "uses income"},
+		{"categorical column", []DerivedFeature{{"ratio", "A3 / A4"}}, "uses A4"},
+		{"forward reference", []DerivedFeature{{"log_ratio", "log1p(ratio)"}, {"ratio", "A3 / (A15 + 1)"}}, "uses ratio"},
+		{"self reference", []DerivedFeature{{"ratio", "ratio + 1"}}, "uses ratio"},
+		{"unknown function", []DerivedFeature{{"ratio", "foo(A3)"}}, "unknown function foo"},
+		{"existing column", []DerivedFeature{{"A2", "A3 + 1"}}, "already a column"},
+		{"processed column", []DerivedFeature{{WeightColumn, "A3 + 1"}}, "clashes"},
+		{"invalid name", []DerivedFeature{{"debt ratio", "A3 + 1"}}, "needs a name"},
+	}
+	for _, tt := range tests {
+		s := CRXSchema()
+		s.Derived = tt.derived
+		err := s.validateDerived()
+		if tt.message == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.message)
+		}
+	}
+}
+
+func TestDeriveFeatures(t *testing.T) {
+	ds, err := dataset.New(
+		dataset.NewFloatColumn("A3", []float64{6, 1, 0, 2}, []bool{false, false, false, true}),
+		dataset.NewFloatColumn("A15", []float64{2, 0, 0, 1}, nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := CRXSchema()
+	s.Derived = []DerivedFeature{{"ratio", "A3 / A15"}, {"scaled", "ratio * 10"}}
+	cd := &CreditData{Data: ds, Schema: s}
+	if err := cd.deriveFeatures(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Division by zero, 0/0 and a missing input all give a missing value,
+	// which carries into features derived from it
+	tests := []struct {
+		column string
+		want   []float64
+	}{
+		{"ratio", []float64{3, math.NaN(), math.NaN(), math.NaN()}},
+		{"scaled", []float64{30, math.NaN(), math.NaN(), math.NaN()}},
+	}
+	for _, tt := range tests {
+		col, err := cd.Data.Col(tt.column)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, valid := col.FloatValues()
+		for i, want := range tt.want {
+			if math.IsNaN(want) {
+				if valid[i] {
+					t.Errorf("%s row %d = %v, want missing", tt.column, i, values[i])
+				}
+			} else if !valid[i] || values[i] != want {
+				t.Errorf("%s row %d = %v (valid %v), want %v", tt.column, i, values[i], valid[i], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package preprocessing
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// DictionaryEntry describes one column of a processed dataset
+type DictionaryEntry struct {
+	Column string
+	// Type is continuous, derived, categorical, one-hot, normalized, target
+	// or weight
+	Type string
+	// Source is the raw column the column is derived from
+	Source      string
+	Description string
+	// Observed is the value range of a numeric column, the levels of a
+	// categorical one, or the share of rows set for a one-hot or target
+	// column
+	Observed    string
+	MissingRate float64
+	// IV is the information value of the column against the target; HasIV
+	// is false for the target and weight columns
+	IV    float64
+	HasIV bool
+}
+
+// DataDictionary describes every column of one processed dataset version
+type DataDictionary struct {
+	// Version identifies the processed output, such as its cache key
+	Version string
+	Rows    int
+	Entries []DictionaryEntry
+}
+
+// LoadAttributeDescriptions reads the attribute descriptions from the
+// "Attribute Information" section of a UCI .names file, keyed by column
+// name, such as "A4" -> "u, y, l, t"
+func LoadAttributeDescriptions(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening names file: %v", err)
+	}
+	defer file.Close()
+
+	descriptions := make(map[string]string)
+	inSection := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.Contains(line, "Attribute Information") {
+			inSection = true
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		// The section ends at the next numbered heading
+		if len(line) > 0 && line[0] >= '0' && line[0] <= '9' {
+			break
+		}
+		name, text, ok := strings.Cut(line, ":")
+		if !ok || !contains(RawColumns, name) {
+			continue
+		}
+		descriptions[name] = strings.TrimSuffix(strings.Join(strings.Fields(text), " "), ".")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading names file: %v", err)
+	}
+	if len(descriptions) == 0 {
+		return nil, fmt.Errorf("no attribute descriptions found in %s", path)
+	}
+	return descriptions, nil
+}
+
+// BuildDataDictionary describes each column of a processed dataset: its
+// type and source column, its description from the names file, its observed
+// values, missing rate and information value against the A16 target. Rows
+// count by the weight column when there is one. schema tells the raw
+// columns apart; nil means the crx data.
+func BuildDataDictionary(ds *dataset.Dataset, version string, descriptions map[string]string, schema *Schema) (*DataDictionary, error) {
+	if schema == nil {
+		schema = CRXSchema()
+	}
+	// Derived features are described by their expressions
+	if len(schema.Derived) > 0 {
+		withDerived := make(map[string]string, len(descriptions)+len(schema.Derived))
+		for name, text := range descriptions {
+			withDerived[name] = text
+		}
+		for _, d := range schema.Derived {
+			withDerived[d.Name] = "derived as " + d.Expression
+		}
+		descriptions = withDerived
+	}
+	target, err := ds.Col("A16")
+	if err != nil {
+		return nil, fmt.Errorf("error accessing target column A16: %v", err)
+	}
+	labels, valid := target.FloatValues()
+	for i, ok := range valid {
+		if !ok {
+			return nil, fmt.Errorf("row %d has non-numeric target %q", i+1, target.String(i))
+		}
+	}
+
+	var weights []float64
+	if col, err := ds.Col(WeightColumn); err == nil {
+		values, valid := col.FloatValues()
+		for i, ok := range valid {
+			if !ok || values[i] < 0 {
+				return nil, fmt.Errorf("row %d has invalid sample weight %q", i+1, col.String(i))
+			}
+		}
+		weights = values
+	}
+
+	dict := &DataDictionary{Version: version, Rows: ds.Nrow()}
+	for _, col := range ds.Columns() {
+		entry := describeColumn(col, labels, weights, schema)
+		entry.Description = columnDescription(entry, descriptions)
+		dict.Entries = append(dict.Entries, entry)
+	}
+	return dict, nil
+}
+
+// describeColumn classifies a column by its name and measures its values
+func describeColumn(col *dataset.Column, labels, weights []float64, schema *Schema) DictionaryEntry {
+	entry := DictionaryEntry{Column: col.Name, Source: col.Name}
+	values, valid := col.FloatValues()
+	rows, missing, missingRate := splitRows(col.Len(), func(i int) bool {
+		return !isMissing(col, i)
+	}, weights)
+	entry.MissingRate = missingRate
+
+	switch {
+	case col.Name == "A16":
+		entry.Type = "target"
+		entry.Observed = fmt.Sprintf("%.2f%% approved", 100*weightedShare(rows, values, weights))
+		return entry
+	case col.Name == ClassColumn && len(schema.Classes) > 0:
+		entry.Type = "class"
+		entry.Source = schema.Target
+		entry.Observed = strings.Join(schema.Classes, ", ")
+		return entry
+	case col.Name == WeightColumn:
+		entry.Type = "weight"
+		entry.Observed = valueRange(rows, values)
+		return entry
+	case col.Name == AmountColumn && schema.Amount != "":
+		entry.Type = "amount"
+		entry.Source = schema.Amount
+		entry.Observed = valueRange(rows, values)
+		return entry
+	case (col.Name == DurationColumn || col.Name == EventColumn) && schema.survival():
+		entry.Type = col.Name
+		entry.Source = schema.Duration
+		if col.Name == EventColumn {
+			entry.Source = schema.Event
+		}
+		entry.Observed = valueRange(rows, values)
+		return entry
+	case strings.HasSuffix(col.Name, IndicatorSuffix) && (contains(schema.Categorical, strings.TrimSuffix(col.Name, IndicatorSuffix)) || contains(schema.continuousFeatures(), strings.TrimSuffix(col.Name, IndicatorSuffix))):
+		entry.Type = "indicator"
+		entry.Source = strings.TrimSuffix(col.Name, IndicatorSuffix)
+	case strings.HasSuffix(col.Name, "_norm"):
+		entry.Type = "normalized"
+		entry.Source = strings.TrimSuffix(col.Name, "_norm")
+	case strings.HasSuffix(col.Name, "_ordinal") && contains(schema.Categorical, strings.TrimSuffix(col.Name, "_ordinal")):
+		entry.Type = "ordinal"
+		entry.Source = strings.TrimSuffix(col.Name, "_ordinal")
+	case strings.HasSuffix(col.Name, "_freq") && contains(schema.Categorical, strings.TrimSuffix(col.Name, "_freq")):
+		entry.Type = "frequency"
+		entry.Source = strings.TrimSuffix(col.Name, "_freq")
+	case contains(schema.Continuous, col.Name):
+		entry.Type = "continuous"
+	case contains(schema.continuousFeatures(), col.Name):
+		entry.Type = "derived"
+	case contains(schema.Categorical, col.Name):
+		entry.Type = "categorical"
+	default:
+		source, _, _ := strings.Cut(col.Name, "_")
+		if !contains(schema.Categorical, source) {
+			// A column the pipeline does not produce; describe it by its
+			// values alone
+			entry.Type = col.Kind.String()
+			entry.Observed = valueRange(rows, values)
+			if col.Kind == dataset.String {
+				levels, _ := levelBins(col, rows)
+				entry.Observed = fmt.Sprintf("%d distinct values", len(levels))
+			}
+			return entry
+		}
+		entry.Type = "one-hot"
+		entry.Source = source
+	}
+
+	entry.HasIV = true
+	switch entry.Type {
+	case "categorical":
+		levels, bins := levelBins(col, rows)
+		entry.Observed = strings.Join(levels, ", ")
+		entry.IV = informationValue(bins, missing, labels, weights)
+	case "one-hot", "indicator":
+		var unset, set []int
+		for _, i := range rows {
+			if valid[i] && values[i] >= 0.5 {
+				set = append(set, i)
+			} else {
+				unset = append(unset, i)
+			}
+		}
+		entry.Observed = fmt.Sprintf("%.2f%% set", 100*weightedShare(rows, values, weights))
+		entry.IV = informationValue([][]int{unset, set}, missing, labels, weights)
+	default:
+		// Values that do not parse count as missing for a numeric column
+		var numeric []int
+		for _, i := range rows {
+			if valid[i] {
+				numeric = append(numeric, i)
+			} else {
+				missing = append(missing, i)
+			}
+		}
+		entry.Observed = valueRange(numeric, values)
+		entry.IV = informationValue(quantileBins(numeric, values, ScreenBins), missing, labels, weights)
+	}
+	return entry
+}
+
+// columnDescription combines the names file description of the source
+// column with how the pipeline derived the column from it
+func columnDescription(entry DictionaryEntry, descriptions map[string]string) string {
+	source := descriptions[entry.Source]
+	if source == "" {
+		source = "no description"
+	}
+	switch entry.Type {
+	case "target":
+		return fmt.Sprintf("Approval decision, 1 for + and 0 for - (%s)", source)
+	case "weight":
+		return "Sample weight of the row"
+	case "amount":
+		return fmt.Sprintf("Raw %s, the target of the amount model (%s)", entry.Source, source)
+	case "class":
+		return fmt.Sprintf("Raw %s as the position of its class, from 0 for the worst (%s)", entry.Source, source)
+	case "duration":
+		return fmt.Sprintf("Raw %s, the time the account was observed (%s)", entry.Source, source)
+	case "event":
+		return fmt.Sprintf("Raw %s, 1 when the account defaulted and 0 when censored (%s)", entry.Source, source)
+	case "normalized":
+		return fmt.Sprintf("%s min-max scaled to [0, 1] (%s)", entry.Source, source)
+	case "one-hot":
+		level := strings.TrimPrefix(entry.Column, entry.Source+"_")
+		return fmt.Sprintf("1 when %s is %s (%s)", entry.Source, level, source)
+	case "indicator":
+		return fmt.Sprintf("1 when %s was missing and imputed (%s)", entry.Source, source)
+	case "ordinal":
+		return fmt.Sprintf("Position of the %s level in its declared order (%s)", entry.Source, source)
+	case "frequency":
+		return fmt.Sprintf("Share of rows with the same %s level (%s)", entry.Source, source)
+	case "derived":
+		return fmt.Sprintf("Derived feature %s, %s", entry.Source, source)
+	case "continuous", "categorical":
+		// The credit approval attributes are anonymized, so the names file
+		// only lists their domains
+		return "Anonymized attribute: " + source
+	}
+	return source
+}
+
+// contains reports whether names includes name
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// levelBins groups the rows by level and returns the levels, sorted, with
+// their rows
+func levelBins(col *dataset.Column, rows []int) ([]string, [][]int) {
+	byLevel := make(map[string][]int)
+	var levels []string
+	for _, i := range rows {
+		level := col.String(i)
+		if _, ok := byLevel[level]; !ok {
+			levels = append(levels, level)
+		}
+		byLevel[level] = append(byLevel[level], i)
+	}
+	sort.Strings(levels)
+
+	bins := make([][]int, len(levels))
+	for k, level := range levels {
+		bins[k] = byLevel[level]
+	}
+	return levels, bins
+}
+
+// weightedShare returns the weighted share of rows whose value is at least
+// 0.5
+func weightedShare(rows []int, values, weights []float64) float64 {
+	var set, total float64
+	for _, i := range rows {
+		total += models.WeightAt(weights, i)
+		if values[i] >= 0.5 {
+			set += models.WeightAt(weights, i)
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return set / total
+}
+
+// valueRange formats the smallest and largest value of the rows
+func valueRange(rows []int, values []float64) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, i := range rows {
+		lo = math.Min(lo, values[i])
+		hi = math.Max(hi, values[i])
+	}
+	return fmt.Sprintf("%s to %s", strconv.FormatFloat(lo, 'g', 6, 64), strconv.FormatFloat(hi, 'g', 6, 64))
+}
+
+// SaveCSV writes the dictionary to a CSV file, gzip-compressed when the
+// path ends in .gz
+func (d *DataDictionary) SaveCSV(path string) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating data dictionary file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Version", "Column", "Type", "Source", "Description", "Observed", "Missing Rate", "Information Value"})
+	for _, e := range d.Entries {
+		writer.Write([]string{
+			d.Version,
+			e.Column,
+			e.Type,
+			e.Source,
+			e.Description,
+			e.Observed,
+			strconv.FormatFloat(e.MissingRate, 'f', 4, 64),
+			e.ivText(),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing data dictionary: %v", err)
+	}
+	return file.Close()
+}
+
+// ivText formats the information value, or leaves it blank when there is
+// none
+func (e DictionaryEntry) ivText() string {
+	if !e.HasIV {
+		return ""
+	}
+	return strconv.FormatFloat(e.IV, 'f', 4, 64)
+}
+
+// WriteMarkdown writes the dictionary as a Markdown table
+func (d *DataDictionary) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# Data dictionary\n\n")
+	fmt.Fprintf(&b, "Processed dataset version %s, %d rows.\n\n", d.Version, d.Rows)
+	b.WriteString("| Column | Type | Source | Description | Observed | Missing | IV |\n")
+	b.WriteString("|---|---|---|---|---|---:|---:|\n")
+	for _, e := range d.Entries {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %.2f%% | %s |\n",
+			e.Column, e.Type, e.Source, markdownEscape(e.Description), markdownEscape(e.Observed), 100*e.MissingRate, e.ivText())
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownEscape keeps a cell's pipes from splitting the table
+func markdownEscape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// SaveMarkdown writes the Markdown table to path
+func (d *DataDictionary) SaveMarkdown(path string) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating data dictionary file: %v", err)
+	}
+	defer file.Close()
+
+	if err := d.WriteMarkdown(file); err != nil {
+		return fmt.Errorf("error writing data dictionary: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,492 @@
+package preprocessing
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+)
+
+// KNNNeighbors is the number of nearest rows KNN imputation averages unless
+// a column sets its own
+const KNNNeighbors = 5
+
+// IndicatorSuffix ends the name of the 0/1 column an indicator adds, which
+// marks the rows whose value of the column was missing
+const IndicatorSuffix = "_imputed"
+
+// ColumnImputation is the fitted imputation of one column
+type ColumnImputation struct {
+	Column      string `json:"column"`
+	Categorical bool   `json:"categorical"`
+	Strategy    string `json:"strategy"`
+	// Fill replaces a missing value: the mode or constant level of a
+	// categorical column, or the mean, median or constant of a continuous
+	// one. KNN imputation falls back to it when no donor has the column.
+	Fill      string `json:"fill,omitempty"`
+	Neighbors int    `json:"neighbors,omitempty"`
+	Indicator bool   `json:"indicator,omitempty"`
+}
+
+// Imputation holds the fitted imputation of every column, so that new
+// applications, such as those scored at prediction time, are imputed
+// exactly like the training data
+type Imputation struct {
+	Columns []ColumnImputation `json:"columns"`
+	// Donors are the rows KNN imputation takes values from, or nil when no
+	// column uses it
+	Donors *KNNDonors `json:"donors,omitempty"`
+}
+
+// KNNDonors are the fitted rows KNN imputation takes values from. Each row
+// holds a donor's Features and then its Columns as text, empty where
+// missing. Rows are compared by the Euclidean distance between their
+// features, min-max scaled by Min and Scale, over the features both rows
+// have, scaled up for those either lacks.
+type KNNDonors struct {
+	Features []string   `json:"features"`
+	Min      []float64  `json:"min"`
+	Scale    []float64  `json:"scale"`
+	Columns  []string   `json:"columns"`
+	Rows     [][]string `json:"rows"`
+}
+
+// markMissing marks "?" as missing in every text column
+func (cd *CreditData) markMissing() {
+	cd.transformColumns(cd.Data.Names(), func(name string) ([]*dataset.Column, error) {
+		col, _ := cd.Data.Col(name)
+		if col.Kind != dataset.String {
+			return nil, nil
+		}
+		for i, str := range col.Strings {
+			if str == "?" {
+				col.Null[i] = true
+			}
+		}
+		return nil, nil
+	})
+}
+
+// FitImputation fits the schema's imputation of every column to the data,
+// whose "?" values must already be marked missing. With KeepMissing no
+// column is imputed, though indicators are still added.
+func (cd *CreditData) FitImputation() *Imputation {
+	s := cd.schema()
+	imp := &Imputation{}
+	var knn []string
+	for _, categorical := range []bool{true, false} {
+		names := s.continuousFeatures()
+		if categorical {
+			names = s.Categorical
+		}
+		for _, name := range names {
+			col, err := cd.Data.Col(name)
+			if err != nil {
+				continue
+			}
+			opts := s.Options[name]
+			ci := ColumnImputation{Column: name, Categorical: categorical, Strategy: s.impute(name), Indicator: opts.Indicator}
+			if cd.KeepMissing {
+				ci.Strategy = ImputeNone
+			}
+			switch ci.Strategy {
+			case ImputeConstant:
+				ci.Fill = opts.Fill
+				if ci.Fill == "" && categorical {
+					ci.Fill = "missing"
+				} else if ci.Fill == "" {
+					ci.Fill = "0"
+				}
+			case ImputeMedian:
+				ci.Fill = formatFill(median(col))
+			case ImputeMean:
+				ci.Fill = formatFill(mean(col))
+			case ImputeMode:
+				ci.Fill = mode(col)
+			case ImputeKNN:
+				ci.Neighbors = opts.Neighbors
+				if ci.Neighbors == 0 {
+					ci.Neighbors = KNNNeighbors
+				}
+				if categorical {
+					ci.Fill = mode(col)
+				} else {
+					ci.Fill = formatFill(mean(col))
+				}
+				knn = append(knn, name)
+			}
+			imp.Columns = append(imp.Columns, ci)
+		}
+	}
+	if len(knn) > 0 {
+		imp.Donors = fitDonors(cd.Data, s.continuousFeatures(), knn)
+	}
+	return imp
+}
+
+// ApplyImputation imputes the data's missing values with an imputation
+// fitted on other data, marking "?" values missing first. Columns of the
+// imputation that the data lacks are skipped.
+func (cd *CreditData) ApplyImputation(imp *Imputation) error {
+	cd.markMissing()
+	return cd.applyImputation(imp)
+}
+
+// applyImputation fills the missing values of every column of imp and adds
+// its indicator columns
+func (cd *CreditData) applyImputation(imp *Imputation) error {
+	// KNN values are found before any column is filled, so that every
+	// distance is measured on the observed values
+	var knnFills map[string]map[int]string
+	if imp.Donors != nil {
+		var err error
+		if knnFills, err = imp.Donors.fills(cd.Data, imp.Columns); err != nil {
+			return err
+		}
+	}
+
+	byName := make(map[string]ColumnImputation, len(imp.Columns))
+	names := make([]string, 0, len(imp.Columns))
+	for _, ci := range imp.Columns {
+		byName[ci.Column] = ci
+		names = append(names, ci.Column)
+	}
+	return cd.transformColumns(names, func(name string) ([]*dataset.Column, error) {
+		col, err := cd.Data.Col(name)
+		if err != nil {
+			return nil, nil // Skip this column if it doesn't exist
+		}
+		ci := byName[name]
+		imputed, err := ci.impute(col, knnFills[name])
+		if err != nil {
+			return nil, err
+		}
+		if !ci.Indicator {
+			return imputed, nil
+		}
+		return append(imputed, indicator(col, ci.Categorical)), nil
+	})
+}
+
+// impute returns the column with its missing values filled, taking the
+// values of KNN imputation from fills
+func (ci ColumnImputation) impute(col *dataset.Column, fills map[int]string) ([]*dataset.Column, error) {
+	if ci.Categorical {
+		if ci.Strategy == ImputeNone {
+			return nil, nil
+		}
+		strVals := make([]string, col.Len())
+		for i := range strVals {
+			switch {
+			case !col.IsNull(i):
+				strVals[i] = col.String(i)
+			case fills[i] != "":
+				strVals[i] = fills[i]
+			default:
+				strVals[i] = ci.Fill
+			}
+		}
+		return []*dataset.Column{dataset.NewStringColumn(col.Name, strVals, nil)}, nil
+	}
+
+	floatVals, valid := col.FloatValues()
+	if ci.Strategy == ImputeNone {
+		null := make([]bool, len(valid))
+		for i, ok := range valid {
+			null[i] = !ok
+		}
+		return []*dataset.Column{dataset.NewFloatColumn(col.Name, floatVals, null)}, nil
+	}
+	fill, err := strconv.ParseFloat(ci.Fill, 64)
+	if err != nil {
+		return nil, fmt.Errorf("column %s has non-numeric fill %q", col.Name, ci.Fill)
+	}
+	for i, ok := range valid {
+		if ok {
+			continue
+		}
+		floatVals[i] = fill
+		if v, ok := fills[i]; ok {
+			floatVals[i], _ = strconv.ParseFloat(v, 64)
+		}
+	}
+	return []*dataset.Column{dataset.NewFloatColumn(col.Name, floatVals, nil)}, nil
+}
+
+// indicator returns the 0/1 column marking the rows whose value of col is
+// missing
+func indicator(col *dataset.Column, categorical bool) *dataset.Column {
+	flags := make([]int, col.Len())
+	if categorical {
+		for i := range flags {
+			if col.IsNull(i) {
+				flags[i] = 1
+			}
+		}
+	} else {
+		_, valid := col.FloatValues()
+		for i, ok := range valid {
+			if !ok {
+				flags[i] = 1
+			}
+		}
+	}
+	return dataset.NewIntColumn(col.Name+IndicatorSuffix, flags, nil)
+}
+
+// mode returns the most frequent value of a column, breaking ties
+// alphabetically
+func mode(col *dataset.Column) string {
+	valCounts := make(map[string]int)
+	for i := 0; i < col.Len(); i++ {
+		if !col.IsNull(i) {
+			valCounts[col.String(i)]++
+		}
+	}
+	return mostFrequent(valCounts)
+}
+
+// mostFrequent returns the value with the highest count, breaking ties
+// alphabetically
+func mostFrequent(counts map[string]int) string {
+	mostFreqVal := ""
+	maxCount := 0
+	for val, count := range counts {
+		if count > maxCount || (count == maxCount && val < mostFreqVal) {
+			maxCount = count
+			mostFreqVal = val
+		}
+	}
+	return mostFreqVal
+}
+
+// mean returns the mean of the numeric values of a column, or 0 when it
+// has none
+func mean(col *dataset.Column) float64 {
+	values, valid := col.FloatValues()
+	sum, count := 0.0, 0
+	for i, ok := range valid {
+		if ok {
+			sum += values[i]
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// median returns the median of the numeric values of a column, or 0 when
+// it has none
+func median(col *dataset.Column) float64 {
+	values, valid := col.FloatValues()
+	var present []float64
+	for i, ok := range valid {
+		if ok {
+			present = append(present, values[i])
+		}
+	}
+	n := len(present)
+	if n == 0 {
+		return 0
+	}
+	sort.Float64s(present)
+	if n%2 == 0 {
+		return (present[n/2-1] + present[n/2]) / 2
+	}
+	return present[n/2]
+}
+
+// formatFill formats a numeric fill so that it parses back exactly
+func formatFill(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// fitDonors keeps every row of ds as a KNN donor, measuring distances on
+// the continuous features
+func fitDonors(ds *dataset.Dataset, continuous, columns []string) *KNNDonors {
+	d := &KNNDonors{Columns: columns}
+	for _, name := range continuous {
+		if _, err := ds.Col(name); err == nil {
+			d.Features = append(d.Features, name)
+		}
+	}
+
+	d.Rows = make([][]string, ds.Nrow())
+	for i := range d.Rows {
+		d.Rows[i] = make([]string, 0, len(d.Features)+len(columns))
+	}
+	for _, name := range d.Features {
+		col, _ := ds.Col(name)
+		values, valid := col.FloatValues()
+		min, max := math.Inf(1), math.Inf(-1)
+		for i, ok := range valid {
+			text := ""
+			if ok {
+				text = formatFill(values[i])
+				min = math.Min(min, values[i])
+				max = math.Max(max, values[i])
+			}
+			d.Rows[i] = append(d.Rows[i], text)
+		}
+		scale := max - min
+		if math.IsInf(min, 0) || scale <= 0 {
+			min, scale = 0, 1
+		}
+		d.Min = append(d.Min, min)
+		d.Scale = append(d.Scale, scale)
+	}
+	for _, name := range columns {
+		col, _ := ds.Col(name)
+		for i := range d.Rows {
+			text := ""
+			if !col.IsNull(i) {
+				text = col.String(i)
+			}
+			d.Rows[i] = append(d.Rows[i], text)
+		}
+	}
+	return d
+}
+
+// scaledFeatures returns the min-max scaled features of each row of ds,
+// NaN where missing
+func (d *KNNDonors) scaledFeatures(ds *dataset.Dataset) [][]float64 {
+	rows := make([][]float64, ds.Nrow())
+	for i := range rows {
+		rows[i] = make([]float64, len(d.Features))
+	}
+	for j, name := range d.Features {
+		col, err := ds.Col(name)
+		if err != nil {
+			for i := range rows {
+				rows[i][j] = math.NaN()
+			}
+			continue
+		}
+		values, valid := col.FloatValues()
+		for i, ok := range valid {
+			rows[i][j] = math.NaN()
+			if ok {
+				rows[i][j] = (values[i] - d.Min[j]) / d.Scale[j]
+			}
+		}
+	}
+	return rows
+}
+
+// fills returns, for each KNN-imputed column of ds, the value imputed into
+// each of its missing rows: the mean of the nearest donors' values for a
+// continuous column and their most frequent level for a categorical one
+func (d *KNNDonors) fills(ds *dataset.Dataset, columns []ColumnImputation) (map[string]map[int]string, error) {
+	donors := make([][]float64, len(d.Rows))
+	for r, row := range d.Rows {
+		if len(row) != len(d.Features)+len(d.Columns) {
+			return nil, fmt.Errorf("KNN donor %d has %d values, want %d", r+1, len(row), len(d.Features)+len(d.Columns))
+		}
+		donors[r] = make([]float64, len(d.Features))
+		for j := range d.Features {
+			donors[r][j] = math.NaN()
+			if row[j] == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(row[j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("KNN donor %d has non-numeric %s %q", r+1, d.Features[j], row[j])
+			}
+			donors[r][j] = (v - d.Min[j]) / d.Scale[j]
+		}
+	}
+	recipients := d.scaledFeatures(ds)
+
+	fills := make(map[string]map[int]string)
+	for _, ci := range columns {
+		if ci.Strategy != ImputeKNN {
+			continue
+		}
+		c := len(d.Features) + indexOf(d.Columns, ci.Column)
+		if c < len(d.Features) {
+			return nil, fmt.Errorf("KNN donors have no column %s", ci.Column)
+		}
+		col, err := ds.Col(ci.Column)
+		if err != nil {
+			continue
+		}
+		_, valid := col.FloatValues()
+
+		fills[ci.Column] = make(map[int]string)
+		for i := 0; i < col.Len(); i++ {
+			if (ci.Categorical && !col.IsNull(i)) || (!ci.Categorical && valid[i]) {
+				continue
+			}
+			nearest := nearestDonors(recipients[i], donors, d.Rows, c, ci.Neighbors)
+			if len(nearest) == 0 {
+				continue
+			}
+			if ci.Categorical {
+				counts := make(map[string]int)
+				for _, r := range nearest {
+					counts[d.Rows[r][c]]++
+				}
+				fills[ci.Column][i] = mostFrequent(counts)
+				continue
+			}
+			sum := 0.0
+			for _, r := range nearest {
+				v, err := strconv.ParseFloat(d.Rows[r][c], 64)
+				if err != nil {
+					return nil, fmt.Errorf("KNN donor %d has non-numeric %s %q", r+1, ci.Column, d.Rows[r][c])
+				}
+				sum += v
+			}
+			fills[ci.Column][i] = formatFill(sum / float64(len(nearest)))
+		}
+	}
+	return fills, nil
+}
+
+// nearestDonors returns up to k donors that have a value in column c,
+// nearest to row first. Donors sharing no feature with row are never
+// near.
+func nearestDonors(row []float64, donors [][]float64, texts [][]string, c, k int) []int {
+	var candidates []int
+	distances := make(map[int]float64)
+	for r, donor := range donors {
+		if texts[r][c] == "" {
+			continue
+		}
+		sum, shared := 0.0, 0
+		for j, v := range row {
+			if math.IsNaN(v) || math.IsNaN(donor[j]) {
+				continue
+			}
+			sum += (v - donor[j]) * (v - donor[j])
+			shared++
+		}
+		if shared == 0 {
+			continue
+		}
+		distances[r] = sum * float64(len(row)) / float64(shared)
+		candidates = append(candidates, r)
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return distances[candidates[a]] < distances[candidates[b]]
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
+
+// indexOf returns the position of name in names, or -1
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
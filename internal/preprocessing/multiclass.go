@@ -0,0 +1,57 @@
+package preprocessing
+
+import "fmt"
+
+// ClassColumn names the multiclass outcome in processed data: each row's
+// position in the schema's Classes, from 0 for the worst
+const ClassColumn = "_class"
+
+// validateClasses checks that a multiclass outcome has a target, at least
+// two distinct classes and positive values among them
+func (s *Schema) validateClasses() error {
+	if len(s.Classes) == 0 {
+		return nil
+	}
+	if s.Target == "" {
+		return fmt.Errorf("schema %s lists classes but has no target", s.Name)
+	}
+	if len(s.Classes) < 2 {
+		return fmt.Errorf("schema %s needs at least two classes", s.Name)
+	}
+	seen := make(map[string]bool, len(s.Classes))
+	for _, class := range s.Classes {
+		if seen[class] {
+			return fmt.Errorf("schema %s lists class %q twice", s.Name, class)
+		}
+		seen[class] = true
+	}
+	for _, value := range s.Positive {
+		if !seen[value] {
+			return fmt.Errorf("schema %s positive value %q is not among its classes", s.Name, value)
+		}
+	}
+	return nil
+}
+
+// classIndices returns each row's position in the schema's classes, or -1
+// when its target value is not among them
+func (cd *CreditData) classIndices() ([]int, error) {
+	s := cd.schema()
+	col, err := cd.Data.Col(s.Target)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing target column %s: %v", s.Target, err)
+	}
+	position := make(map[string]int, len(s.Classes))
+	for k, class := range s.Classes {
+		position[class] = k
+	}
+	indices := make([]int, col.Len())
+	for i := range indices {
+		k, ok := position[col.String(i)]
+		if col.IsNull(i) || !ok {
+			k = -1
+		}
+		indices[i] = k
+	}
+	return indices, nil
+}
@@ -0,0 +1,68 @@
+package preprocessing
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+)
+
+// columnTransform computes the new columns derived from one input column.
+// It must only read from the dataset; the caller applies the results.
+type columnTransform func(name string) ([]*dataset.Column, error)
+
+// workerCount returns the number of workers to use for column transforms
+func (cd *CreditData) workerCount() int {
+	if cd.Workers > 0 {
+		return cd.Workers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// transformColumns runs fn for each named column on a bounded pool of workers
+// and then applies the produced columns to the dataset in the order of names,
+// so the resulting column order never depends on scheduling. The first error
+// in name order is returned and nothing is applied.
+func (cd *CreditData) transformColumns(names []string, fn columnTransform) error {
+	results := make([][]*dataset.Column, len(names))
+	errs := make([]error, len(names))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := cd.workerCount()
+	if workers > len(names) {
+		workers = len(names)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j], errs[j] = fn(names[j])
+			}
+		}()
+	}
+
+	for j := range names {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, cols := range results {
+		for _, col := range cols {
+			if err := cd.Data.Set(col); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package preprocessing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+)
+
+// PIIAction is how an identifier column is masked
+type PIIAction string
+
+// The masking actions
+const (
+	// DropPII removes the column
+	DropPII PIIAction = "drop"
+	// HashPII replaces each value with a keyed pseudonym, so rows of the
+	// same applicant can still be linked without revealing who it is
+	HashPII PIIAction = "hash"
+)
+
+// PIIKeyEnv names the environment variable holding the secret key that
+// pseudonyms are derived from. Without a secret, hashes of short
+// identifiers such as SSNs could be reversed by trying every value.
+const PIIKeyEnv = "CCAP_PII_KEY"
+
+// pseudonymPrefix marks pseudonyms, and keeps an all-digit hash from being
+// read back as a numeric feature
+const pseudonymPrefix = "pid_"
+
+// PIIColumn names an identifier column of the raw data and how to mask it
+type PIIColumn struct {
+	Name   string    `json:"name"`
+	Action PIIAction `json:"action"`
+}
+
+// PIIConfig lists the identifier columns to mask right after the raw data
+// is loaded, before any artifact is written
+type PIIConfig struct {
+	Columns []PIIColumn `json:"columns"`
+
+	key []byte
+}
+
+// LoadPIIConfig reads a PII configuration from a JSON file such as
+//
+//	{"columns": [{"name": "name", "action": "drop"}, {"name": "ssn", "action": "hash"}]}
+//
+// and, when any column is hashed, the key from the PIIKeyEnv environment
+// variable. columns are the raw columns of the active schema.
+func LoadPIIConfig(path string, columns []string) (*PIIConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading PII config: %v", err)
+	}
+
+	config := &PIIConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("error parsing PII config: %v", err)
+	}
+	if err := config.Validate(columns); err != nil {
+		return nil, err
+	}
+
+	for _, c := range config.Columns {
+		if c.Action == HashPII {
+			key := os.Getenv(PIIKeyEnv)
+			if key == "" {
+				return nil, fmt.Errorf("hashing column %s needs a secret key in %s", c.Name, PIIKeyEnv)
+			}
+			config.key = []byte(key)
+			break
+		}
+	}
+	return config, nil
+}
+
+// Validate checks that every column is named once with a known action and
+// is not one of the raw columns, which the models need
+func (c *PIIConfig) Validate(columns []string) error {
+	if len(c.Columns) == 0 {
+		return fmt.Errorf("PII config lists no columns")
+	}
+	seen := make(map[string]bool)
+	for _, col := range c.Columns {
+		if col.Name == "" {
+			return fmt.Errorf("PII column has no name")
+		}
+		if seen[col.Name] {
+			return fmt.Errorf("PII column %s is listed twice", col.Name)
+		}
+		seen[col.Name] = true
+		if contains(columns, col.Name) || col.Name == WeightColumn {
+			return fmt.Errorf("PII column %s is a model input and cannot be masked", col.Name)
+		}
+		if col.Action != DropPII && col.Action != HashPII {
+			return fmt.Errorf("PII column %s has unknown action %q (want drop or hash)", col.Name, col.Action)
+		}
+	}
+	return nil
+}
+
+// Fingerprint identifies the masking for the preprocessing cache: the
+// columns and actions, and a keyed digest that changes with the key
+// without revealing it
+func (c *PIIConfig) Fingerprint() string {
+	h := sha256.New()
+	for _, col := range c.Columns {
+		fmt.Fprintf(h, "%s=%s;", col.Name, col.Action)
+	}
+	if c.key != nil {
+		mac := hmac.New(sha256.New, c.key)
+		mac.Write([]byte("fingerprint"))
+		h.Write(mac.Sum(nil))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Pseudonym returns the keyed pseudonym of a value: a prefix and the first
+// 16 bytes of its HMAC-SHA256, in hex
+func (c *PIIConfig) Pseudonym(value string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(value))
+	return pseudonymPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// MaskPII drops or pseudonymizes the configured identifier columns. Every
+// configured column must be in the data, so a misspelled name cannot let
+// an identifier through. Missing values stay missing.
+func (cd *CreditData) MaskPII(config *PIIConfig) error {
+	for _, c := range config.Columns {
+		col, err := cd.Data.Col(c.Name)
+		if err != nil {
+			return fmt.Errorf("identifier column %s is not in the raw data", c.Name)
+		}
+
+		if c.Action == DropPII {
+			if err := cd.Data.Drop(c.Name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		values := make([]string, col.Len())
+		null := make([]bool, col.Len())
+		for i := range values {
+			if isMissing(col, i) || col.String(i) == "" {
+				null[i] = true
+				continue
+			}
+			values[i] = config.Pseudonym(col.String(i))
+		}
+		if err := cd.Data.Set(dataset.NewStringColumn(c.Name, values, null)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
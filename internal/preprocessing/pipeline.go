@@ -0,0 +1,162 @@
+package preprocessing
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+)
+
+// Pipeline holds everything preprocessing learns from data: the
+// imputation, the categorical encodings and the normalization ranges. Its
+// schema carries the derived feature expressions, so the features are
+// computed again wherever the pipeline is loaded. Fit learns them from the
+// training rows only, so no statistic of the test rows leaks into the
+// features, and Transform applies them to any rows: the training and test
+// sets, or new applications at serve time.
+type Pipeline struct {
+	Schema *Schema `json:"schema"`
+	// KeepMissing leaves missing values unimputed, as in CreditData
+	KeepMissing bool             `json:"keep_missing,omitempty"`
+	Imputation  *Imputation      `json:"imputation"`
+	Encodings   []ColumnEncoding `json:"encodings"`
+	Scalings    []ColumnScaling  `json:"scalings"`
+}
+
+// NewPipeline creates an unfitted pipeline for the schema, or the crx data
+// when it is nil
+func NewPipeline(schema *Schema, keepMissing bool) *Pipeline {
+	if schema == nil {
+		schema = CRXSchema()
+	}
+	return &Pipeline{Schema: schema, KeepMissing: keepMissing}
+}
+
+// Fit learns the imputation, encodings and normalization ranges from the
+// training rows, each stage from the output of the one before, as
+// preprocessing the whole data would. train is left unchanged.
+func (p *Pipeline) Fit(train *CreditData) error {
+	if train.Data == nil {
+		return fmt.Errorf("invalid dataset: no data loaded")
+	}
+	rows := make([]int, train.Data.Nrow())
+	for i := range rows {
+		rows[i] = i
+	}
+	cd := &CreditData{Data: train.Data.Subset(rows), Workers: train.Workers, KeepMissing: p.KeepMissing, Schema: p.Schema}
+
+	if err := cd.deriveFeatures(); err != nil {
+		return err
+	}
+	cd.markMissing()
+	p.Imputation = cd.FitImputation()
+	if err := cd.applyImputation(p.Imputation); err != nil {
+		return fmt.Errorf("error imputing missing values: %v", err)
+	}
+	p.Encodings = cd.fitEncodings()
+	if err := cd.applyEncodings(p.Encodings); err != nil {
+		return fmt.Errorf("error encoding categorical features: %v", err)
+	}
+	p.Scalings = cd.fitScalings()
+	return nil
+}
+
+// Transform preprocesses the data with the fitted pipeline: it computes
+// the derived features, imputes missing values, encodes the categorical
+// features, converts the target when the data has one and normalizes the
+// continuous features. New applications without a target keep only their
+// features.
+func (p *Pipeline) Transform(cd *CreditData) error {
+	if p.Imputation == nil {
+		return fmt.Errorf("pipeline has not been fitted")
+	}
+	cd.Schema = p.Schema
+	cd.KeepMissing = p.KeepMissing
+
+	if err := cd.deriveFeatures(); err != nil {
+		return err
+	}
+	if err := cd.ApplyImputation(p.Imputation); err != nil {
+		return fmt.Errorf("error imputing missing values: %v", err)
+	}
+	cd.Imputation = p.Imputation
+	if err := cd.applyEncodings(p.Encodings); err != nil {
+		return fmt.Errorf("error encoding categorical features: %v", err)
+	}
+	if cd.hasOutcome() {
+		if err := cd.ConvertTargetVariable(); err != nil {
+			return fmt.Errorf("error converting target variable: %v", err)
+		}
+	}
+	if err := cd.applyScalings(p.Scalings); err != nil {
+		return fmt.Errorf("error normalizing features: %v", err)
+	}
+	return nil
+}
+
+// hasOutcome reports whether the data has the columns its label comes
+// from: the target, or without one the survival columns
+func (cd *CreditData) hasOutcome() bool {
+	s := cd.schema()
+	names := []string{s.Target}
+	if s.Target == "" {
+		names = []string{s.Duration, s.Event}
+	}
+	for _, name := range names {
+		if _, err := cd.Data.Col(name); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Split shuffles the rows into a training and a test set, holding out
+// testSize of them for testing. Both keep the data's settings.
+func (cd *CreditData) Split(testSize float64) (train, test *CreditData) {
+	trainDS, testDS := cd.SplitTrainTest(testSize)
+	train, test = &CreditData{}, &CreditData{}
+	*train, *test = *cd, *cd
+	train.Data, test.Data = trainDS, testDS
+	return train, test
+}
+
+// SavePipeline writes the fitted pipeline as JSON, gzip-compressed when the
+// path ends in .gz
+func SavePipeline(path string, p *Pipeline) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating pipeline file: %v", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(p); err != nil {
+		return fmt.Errorf("error writing pipeline: %v", err)
+	}
+	return file.Close()
+}
+
+// LoadPipeline reads a pipeline saved by SavePipeline
+func LoadPipeline(path string) (*Pipeline, error) {
+	file, err := dataset.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening pipeline file: %v", err)
+	}
+	defer file.Close()
+
+	p := &Pipeline{}
+	if err := json.NewDecoder(file).Decode(p); err != nil {
+		return nil, fmt.Errorf("error parsing pipeline: %v", err)
+	}
+	if p.Schema == nil || p.Imputation == nil {
+		return nil, fmt.Errorf("pipeline has no schema or imputation")
+	}
+	if err := p.Schema.Validate(); err != nil {
+		return nil, err
+	}
+	if d := p.Imputation.Donors; d != nil && (len(d.Min) != len(d.Features) || len(d.Scale) != len(d.Features)) {
+		return nil, fmt.Errorf("imputation donors have %d features but %d minimums and %d scales", len(d.Features), len(d.Min), len(d.Scale))
+	}
+	return p, nil
+}
@@ -4,21 +4,67 @@ import (
 	"encoding/csv"
 	"fmt"
 	"math"
-	"os"
-	"strconv"
+	"math/rand/v2"
+	"sort"
 
-	"github.com/go-gota/gota/dataframe"
-	"github.com/go-gota/gota/series"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
 )
 
 // CreditData represents the structure of our credit card approval dataset
 type CreditData struct {
-	DF dataframe.DataFrame
+	Data *dataset.Dataset
+
+	// Workers bounds how many columns are transformed concurrently;
+	// zero uses GOMAXPROCS
+	Workers int
+
+	// Seed determines the train/test shuffle; zero shuffles randomly
+	Seed uint64
+
+	// KeepMissing leaves missing values unimputed: continuous columns keep
+	// them as blanks and categorical ones get no one-hot level, for models
+	// that handle missing values natively
+	KeepMissing bool
+
+	// Schema describes the raw columns; nil means the crx data
+	Schema *Schema
+
+	// Imputation is the imputation HandleMissingValues fitted
+	Imputation *Imputation
 }
 
+// RawColumns are the column names of the headerless raw crx data
+var RawColumns = []string{"A1", "A2", "A3", "A4", "A5", "A6", "A7", "A8", "A9", "A10", "A11", "A12", "A13", "A14", "A15", "A16"}
+
+// WeightColumn names the optional sample weight a raw file may carry as an
+// extra last field. It passes through preprocessing unchanged and is
+// honored by the evaluation metrics.
+const WeightColumn = "weight"
+
+// AmountColumn names the schema's amount in processed data, such as the
+// credit limit a second-stage model predicts for approved applicants. It
+// holds the raw values, blank where missing or not numeric. Like the other
+// processed outcome columns it starts with an underscore, so it never
+// collides with a feature called amount.
+const AmountColumn = "_amount"
+
+// CategoricalColumns are imputed with their mode and one-hot encoded
+var CategoricalColumns = []string{"A1", "A4", "A5", "A6", "A7", "A9", "A10", "A12", "A13"}
+
+// ContinuousColumns are imputed with their mean and min-max normalized
+var ContinuousColumns = []string{"A2", "A3", "A8", "A11", "A14", "A15"}
+
+// TestSize is the fraction of rows held out for the test set
+const TestSize = 0.2
+
 // LoadData loads the credit card dataset from a CSV file
 func LoadData(filepath string) (*CreditData, error) {
-	file, err := os.Open(filepath)
+	return LoadDataWithSchema(filepath, CRXSchema())
+}
+
+// LoadDataWithSchema loads a raw credit dataset described by schema
+func LoadDataWithSchema(filepath string, schema *Schema) (*CreditData, error) {
+	file, err := dataset.Open(filepath)
 	if err != nil {
 		return nil, fmt.Errorf("error opening file: %v", err)
 	}
@@ -26,7 +72,7 @@ func LoadData(filepath string) (*CreditData, error) {
 
 	// Read CSV file
 	reader := csv.NewReader(file)
-	reader.Comma = ','
+	reader.Comma = schema.comma()
 	records, err := reader.ReadAll()
 	if err != nil {
 		return nil, fmt.Errorf("error reading CSV: %v", err)
@@ -37,262 +83,357 @@ func LoadData(filepath string) (*CreditData, error) {
 		return nil, fmt.Errorf("CSV file is empty")
 	}
 
-	// Define column names
-	colNames := []string{"A1", "A2", "A3", "A4", "A5", "A6", "A7", "A8", "A9", "A10", "A11", "A12", "A13", "A14", "A15", "A16"}
-
-	// Create dataframe with explicit type inference
-	df := dataframe.LoadRecords(
-		records,
-		dataframe.DetectTypes(false),
-		dataframe.DefaultType(series.String),
-	)
+	// The crx file has no header, so every record is data. An extract with
+	// extra fields, such as applicant identifiers, names its columns in a
+	// header row that includes every raw feature. New applications scored
+	// at serve time may leave out the target.
+	names := schema.Columns
+	if len(records[0]) == len(schema.Columns)+1 {
+		names = append(append([]string(nil), schema.Columns...), WeightColumn)
+	}
+	if isHeader(records[0], append(append([]string(nil), schema.Categorical...), schema.Continuous...)) {
+		names, records = records[0], records[1:]
+	}
+	ds, err := dataset.FromRecords(names, records)
+	if err != nil {
+		return nil, fmt.Errorf("error building dataset: %v", err)
+	}
 
-	// Set column names
-	df.SetNames(colNames...)
+	return &CreditData{Data: ds, Schema: schema}, nil
+}
 
-	return &CreditData{DF: df}, nil
+// isHeader reports whether a record names every one of columns
+func isHeader(record []string, columns []string) bool {
+	fields := make(map[string]bool, len(record))
+	for _, field := range record {
+		fields[field] = true
+	}
+	for _, name := range columns {
+		if !fields[name] {
+			return false
+		}
+	}
+	return true
 }
 
-// HandleMissingValues imputes missing values in the dataset
+// HandleMissingValues imputes missing values in the dataset with the
+// schema's strategy for each column, by default the most frequent value of
+// a categorical column and the mean of a continuous one. With KeepMissing
+// it only marks them and parses the continuous columns. The fitted
+// imputation is kept in Imputation for reuse on new applications.
 func (cd *CreditData) HandleMissingValues() {
-	// Replace '?' with NaN for all columns
-	for _, colName := range cd.DF.Names() {
-		cd.DF = cd.DF.Mutate(
-			cd.DF.Col(colName).Map(func(e series.Element) series.Element {
-				if e.IsNA() {
-					return e
-				}
-				str, ok := e.Val().(string)
-				if ok && str == "?" {
-					e.Set(nil)
-				}
-				return e
-			}),
-		)
-	}
+	// Mark '?' as missing for all columns
+	cd.markMissing()
 
-	// For categorical variables, replace missing values with the most frequent value
-	categoricalCols := []string{"A1", "A4", "A5", "A6", "A7", "A9", "A10", "A12", "A13"}
-	for _, col := range categoricalCols {
-		// Find most frequent value
-		valCounts := make(map[string]int)
-		// Get the column and ensure it exists
-		s := cd.DF.Col(col)
-		if s.Err != nil {
-			continue // Skip this column if it doesn't exist
+	cd.Imputation = cd.FitImputation()
+	cd.applyImputation(cd.Imputation)
+}
+
+// parseContinuous returns a transform that parses a continuous column as
+// floats, leaving missing values missing
+func parseContinuous(ds *dataset.Dataset) columnTransform {
+	return func(name string) ([]*dataset.Column, error) {
+		col, err := ds.Col(name)
+		if err != nil {
+			return nil, nil // Skip this column if it doesn't exist
 		}
 
-		// Convert all values to strings first
-		strVals := make([]interface{}, s.Len())
-		for i := 0; i < s.Len(); i++ {
-			e := s.Elem(i)
-			if e.IsNA() {
-				strVals[i] = nil
-				continue
-			}
-			strVals[i] = fmt.Sprintf("%v", e.Val())
+		floatVals, valid := col.FloatValues()
+		null := make([]bool, len(valid))
+		for i, ok := range valid {
+			null[i] = !ok
 		}
+		return []*dataset.Column{dataset.NewFloatColumn(name, floatVals, null)}, nil
+	}
+}
+
+// EncodeCategoricalFeatures converts categorical features to numerical
+// values, one-hot encoding them unless the schema sets another encoding.
+// The encodings are fitted on the data itself; a Pipeline fits them on the
+// training rows only.
+func (cd *CreditData) EncodeCategoricalFeatures() error {
+	// Verify the dataset is not nil
+	if cd.Data == nil {
+		return fmt.Errorf("invalid dataset: no data loaded")
+	}
+	return cd.applyEncodings(cd.fitEncodings())
+}
+
+// ColumnEncoding is the fitted encoding of one categorical column
+type ColumnEncoding struct {
+	Column   string `json:"column"`
+	Encoding string `json:"encoding"`
+	// Levels are the levels of the one-hot columns, or the order of the
+	// ordinal codes
+	Levels []string `json:"levels,omitempty"`
+	// Shares are the share of rows with each level under frequency
+	// encoding
+	Shares map[string]float64 `json:"shares,omitempty"`
+}
 
-		// Create new string series and update dataframe
-		newSeries := series.New(strVals, series.String, col)
-		cd.DF = cd.DF.Mutate(newSeries)
+// fitEncodings learns the levels of every categorical column the data has
+func (cd *CreditData) fitEncodings() []ColumnEncoding {
+	s := cd.schema()
+	var encodings []ColumnEncoding
+	for _, name := range s.Categorical {
+		col, err := cd.Data.Col(name)
+		if err != nil {
+			fmt.Printf("Warning: Column %s not found, skipping\n", name)
+			continue
+		}
 
-		// Count values in the new string series
-		newSeries.Map(func(e series.Element) series.Element {
-			if !e.IsNA() {
-				if str, ok := e.Val().(string); ok {
-					valCounts[str]++
+		// Get unique values in a stable order
+		uniqueVals := make(map[string]bool)
+		for i := 0; i < col.Len(); i++ {
+			if !col.IsNull(i) {
+				if strVal := col.String(i); strVal != "" {
+					uniqueVals[strVal] = true
 				}
 			}
-			return e
-		})
-
-		// Find the most frequent value
-		mostFreqVal := ""
-		maxCount := 0
-		for val, count := range valCounts {
-			if count > maxCount {
-				maxCount = count
-				mostFreqVal = val
-			}
 		}
+		levels := make([]string, 0, len(uniqueVals))
+		for val := range uniqueVals {
+			levels = append(levels, val)
+		}
+		sort.Strings(levels)
+
+		enc := ColumnEncoding{Column: name, Encoding: s.encoding(name), Levels: levels}
+		switch enc.Encoding {
+		case OrdinalEncoding:
+			enc.Levels = orderLevels(levels, s.Options[name].Levels)
+		case FrequencyEncoding:
+			enc.Levels = nil
+			enc.Shares = levelShares(col)
+		}
+		encodings = append(encodings, enc)
+	}
+	return encodings
+}
 
-		// Replace missing values with most frequent value
-		cd.DF = cd.DF.Mutate(
-			series.New(
-				newSeries.Map(func(e series.Element) series.Element {
-					if e.IsNA() {
-						e.Set(mostFreqVal)
-					}
-					return e
-				}),
-				series.String,
-				col,
-			),
-		)
-	}
-
-	// For continuous variables, replace missing values with the mean
-	continuousCols := []string{"A2", "A3", "A8", "A11", "A14", "A15"}
-	for _, col := range continuousCols {
+// applyEncodings replaces each encoded column by its numeric columns. A
+// level the encoding was not fitted on gets no one-hot level, a missing
+// ordinal code and a zero share.
+func (cd *CreditData) applyEncodings(encodings []ColumnEncoding) error {
+	byName := make(map[string]ColumnEncoding, len(encodings))
+	names := make([]string, 0, len(encodings))
+	for _, enc := range encodings {
+		byName[enc.Column] = enc
+		names = append(names, enc.Column)
+	}
+	return cd.transformColumns(names, func(name string) ([]*dataset.Column, error) {
 		// Get the column and ensure it exists
-		s := cd.DF.Col(col)
-		if s.Err != nil {
-			continue // Skip this column if it doesn't exist
+		col, err := cd.Data.Col(name)
+		if err != nil {
+			fmt.Printf("Warning: Column %s not found, skipping\n", name)
+			return nil, nil
 		}
 
-		// First pass: convert values to float64 and calculate mean
-		sum := 0.0
-		count := 0
-		floatVals := make([]interface{}, s.Len())
+		enc := byName[name]
+		switch enc.Encoding {
+		case OrdinalEncoding:
+			return []*dataset.Column{encodeOrdinal(col, enc.Levels)}, nil
+		case FrequencyEncoding:
+			return []*dataset.Column{encodeFrequency(col, enc.Shares)}, nil
+		}
 
-		for i := 0; i < s.Len(); i++ {
-			e := s.Elem(i)
-			if e.IsNA() {
-				floatVals[i] = nil
-				continue
-			}
+		// Create one-hot encoded columns
+		encoded := make([]*dataset.Column, 0, len(enc.Levels))
+		for _, val := range enc.Levels {
+			newColName := fmt.Sprintf("%s_%s", name, val)
+			oneHotVals := make([]int, col.Len())
 
-			// Try to convert the value to float64
-			strVal := fmt.Sprintf("%v", e.Val())
-			if val, err := strconv.ParseFloat(strVal, 64); err == nil {
-				floatVals[i] = val
-				sum += val
-				count++
-			} else {
-				floatVals[i] = nil
+			// Fill one-hot values
+			for i := 0; i < col.Len(); i++ {
+				if !col.IsNull(i) && col.String(i) == val {
+					oneHotVals[i] = 1
+				}
 			}
-		}
 
-		// Calculate mean
-		mean := 0.0
-		if count > 0 {
-			mean = sum / float64(count)
+			encoded = append(encoded, dataset.NewIntColumn(newColName, oneHotVals, nil))
 		}
+		return encoded, nil
+	})
+}
 
-		// Second pass: fill missing values with mean
-		for i := 0; i < len(floatVals); i++ {
-			if floatVals[i] == nil {
-				floatVals[i] = mean
-			}
+// orderLevels puts the declared levels first, in their order, followed by
+// the other observed levels
+func orderLevels(observed, declared []string) []string {
+	ordered := append([]string(nil), declared...)
+	for _, level := range observed {
+		if !contains(declared, level) {
+			ordered = append(ordered, level)
 		}
-
-		// Update the dataframe with the new float series
-		cd.DF = cd.DF.Mutate(
-			series.New(floatVals, series.Float, col),
-		)
 	}
+	return ordered
 }
 
-// EncodeCategoricalFeatures converts categorical features to numerical values
-func (cd *CreditData) EncodeCategoricalFeatures() error {
-	// One-hot encode categorical variables
-	categoricalCols := []string{"A1", "A4", "A5", "A6", "A7", "A9", "A10", "A12", "A13"}
+// encodeOrdinal replaces each level by its position in levels, in the
+// column "<name>_ordinal"; missing values stay missing
+func encodeOrdinal(col *dataset.Column, levels []string) *dataset.Column {
+	position := make(map[string]int, len(levels))
+	for k, level := range levels {
+		position[level] = k
+	}
+	codes := make([]int, col.Len())
+	null := make([]bool, col.Len())
+	for i := range codes {
+		k, ok := position[col.String(i)]
+		if col.IsNull(i) || !ok {
+			null[i] = true
+			continue
+		}
+		codes[i] = k
+	}
+	return dataset.NewIntColumn(col.Name+"_ordinal", codes, null)
+}
 
-	// Verify DataFrame is not nil
-	if cd.DF.Err != nil {
-		return fmt.Errorf("invalid dataframe: %v", cd.DF.Err)
+// levelShares returns the share of the column's rows with each level
+func levelShares(col *dataset.Column) map[string]float64 {
+	counts := make(map[string]int)
+	for i := 0; i < col.Len(); i++ {
+		if !col.IsNull(i) {
+			counts[col.String(i)]++
+		}
 	}
+	shares := make(map[string]float64, len(counts))
+	for level, n := range counts {
+		shares[level] = float64(n) / float64(col.Len())
+	}
+	return shares
+}
 
-	for _, col := range categoricalCols {
-		// Get the column and ensure it exists
-		s := cd.DF.Col(col)
-		if s.Err != nil {
-			fmt.Printf("Warning: Column %s not found, skipping\n", col)
+// encodeFrequency replaces each level by its share in shares, in the
+// column "<name>_freq"; missing values stay missing
+func encodeFrequency(col *dataset.Column, shares map[string]float64) *dataset.Column {
+	values := make([]float64, col.Len())
+	null := make([]bool, col.Len())
+	for i := range values {
+		if col.IsNull(i) {
+			null[i] = true
 			continue
 		}
+		values[i] = shares[col.String(i)]
+	}
+	return dataset.NewFloatColumn(col.Name+"_freq", values, null)
+}
 
-		// Get unique values
-		uniqueVals := make(map[string]bool)
-		for i := 0; i < s.Len(); i++ {
-			e := s.Elem(i)
-			if !e.IsNA() {
-				strVal := fmt.Sprintf("%v", e.Val())
-				if strVal != "" {
-					uniqueVals[strVal] = true
-				}
-			}
+// ConvertTargetVariable converts the target variable (A16 for crx) to a
+// binary (0/1) LabelColumn, replacing a target of another name, and the
+// schema's amount and survival columns, if any, to the numeric
+// AmountColumn, DurationColumn and EventColumn. Without a target the label
+// comes from the survival columns, and the rows they cannot label are
+// dropped. A schema with classes also gets the ClassColumn.
+func (cd *CreditData) ConvertTargetVariable() error {
+	s := cd.schema()
+	labels, known, err := cd.labels()
+	if err != nil {
+		return err
+	}
+	var classes []int
+	if len(s.Classes) > 0 {
+		if classes, err = cd.classIndices(); err != nil {
+			return err
 		}
+	}
 
-		// Create one-hot encoded columns
-		for val := range uniqueVals {
-			newColName := fmt.Sprintf("%s_%s", col, val)
-			oneHotVals := make([]interface{}, s.Len())
+	// Convert target variable to binary (0/1)
+	target := make([]int, len(labels))
+	for i, label := range labels {
+		target[i] = int(label)
+	}
 
-			// Fill one-hot values
-			for i := 0; i < s.Len(); i++ {
-				e := s.Elem(i)
-				if e.IsNA() {
-					oneHotVals[i] = 0
-					continue
-				}
-				strVal := fmt.Sprintf("%v", e.Val())
-				if strVal == val {
-					oneHotVals[i] = 1
-				} else {
-					oneHotVals[i] = 0
-				}
-			}
+	if s.Target != "" && s.Target != LabelColumn {
+		if err := cd.Data.Drop(s.Target); err != nil {
+			return err
+		}
+	}
+	if err := cd.Data.Set(dataset.NewIntColumn(LabelColumn, target, nil)); err != nil {
+		return err
+	}
+	if classes != nil {
+		if err := cd.Data.Set(dataset.NewIntColumn(ClassColumn, classes, nil)); err != nil {
+			return err
+		}
+	}
 
-			// Add the one-hot encoded column
-			newSeries := series.New(oneHotVals, series.Int, newColName)
-			if newSeries.Err != nil {
-				return fmt.Errorf("error creating one-hot encoded column %s: %v", newColName, newSeries.Err)
-			}
-			cd.DF = cd.DF.Mutate(newSeries)
+	for _, c := range []struct{ from, to string }{
+		{s.Amount, AmountColumn},
+		{s.Duration, DurationColumn},
+		{s.Event, EventColumn},
+	} {
+		if c.from == "" {
+			continue
+		}
+		if err := cd.convertNumeric(c.from, c.to); err != nil {
+			return err
+		}
+	}
+
+	var rows []int
+	for i, ok := range known {
+		if ok {
+			rows = append(rows, i)
 		}
 	}
+	if len(rows) < len(known) {
+		cd.Data = cd.Data.Subset(rows)
+	}
 	return nil
 }
 
-// ConvertTargetVariable converts the target variable (A16) to binary (0/1)
-func (cd *CreditData) ConvertTargetVariable() error {
-	// Get the target column
-	s := cd.DF.Col("A16")
-	if s.Err != nil {
-		return fmt.Errorf("error accessing target column A16: %v", s.Err)
+// convertNumeric replaces the column from with its numeric values, blank
+// where missing or not numeric, named to
+func (cd *CreditData) convertNumeric(from, to string) error {
+	col, err := cd.Data.Col(from)
+	if err != nil {
+		return fmt.Errorf("error accessing column %s: %v", from, err)
 	}
-
-	// Convert target variable to binary (0/1)
-	cd.DF = cd.DF.Mutate(
-		series.New(
-			s.Map(func(e series.Element) series.Element {
-				if e.IsNA() {
-					e.Set(0)
-					return e
-				}
-				str := fmt.Sprintf("%v", e.Val())
-				if str == "+" {
-					e.Set(1)
-				} else {
-					e.Set(0)
-				}
-				return e
-			}),
-			series.Int,
-			"A16",
-		),
-	)
-	return nil
+	values, valid := col.FloatValues()
+	null := make([]bool, len(values))
+	for i, ok := range valid {
+		null[i] = !ok || math.IsNaN(values[i]) || math.IsInf(values[i], 0)
+	}
+	if from != to {
+		if err := cd.Data.Drop(from); err != nil {
+			return err
+		}
+	}
+	return cd.Data.Set(dataset.NewFloatColumn(to, values, null))
 }
 
-// NormalizeFeatures scales numerical features to a standard range
+// NormalizeFeatures scales numerical features to a standard range. Missing
+// values stay missing in the normalized column. The ranges are fitted on
+// the data itself; a Pipeline fits them on the training rows only.
 func (cd *CreditData) NormalizeFeatures() {
-	continuousCols := []string{"A2", "A3", "A8", "A11", "A14", "A15"}
-	for _, col := range continuousCols {
+	cd.applyScalings(cd.fitScalings())
+}
+
+// ColumnScaling is the fitted min-max normalization of one continuous
+// column
+type ColumnScaling struct {
+	Column string  `json:"column"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+// fitScalings finds the range of every continuous column the data has,
+// skipping constant columns, which are left unnormalized
+func (cd *CreditData) fitScalings() []ColumnScaling {
+	var scalings []ColumnScaling
+	for _, name := range cd.schema().continuousFeatures() {
+		col, err := cd.Data.Col(name)
+		if err != nil {
+			continue
+		}
+
+		// Extract the column once as floats
+		values, valid := col.FloatValues()
+
 		// Find min and max values
 		min := math.MaxFloat64
 		max := -math.MaxFloat64
-
-		// Iterate through each element to find min and max
-		for i := 0; i < cd.DF.Nrow(); i++ {
-			v := cd.DF.Col(col).Elem(i).Val()
-			str, ok := v.(string)
-			if !ok {
-				continue
-			}
-			val, err := strconv.ParseFloat(str, 64)
-			if err != nil {
+		for i, val := range values {
+			if !valid[i] {
 				continue
 			}
 			if val < min {
@@ -304,126 +445,114 @@ func (cd *CreditData) NormalizeFeatures() {
 		}
 
 		// Skip normalization if min equals max
-		if min == max {
+		if min >= max {
 			continue
 		}
+		scalings = append(scalings, ColumnScaling{Column: name, Min: min, Max: max})
+	}
+	return scalings
+}
 
-		// Normalize values to [0,1] range
-		// Create a temporary series to hold the normalized values
-		values := make([]interface{}, cd.DF.Nrow())
-		for i := 0; i < cd.DF.Nrow(); i++ {
-			v := cd.DF.Col(col).Elem(i).Val()
-			str, ok := v.(string)
-			if !ok {
-				values[i] = 0.0
-				continue
-			}
-			val, err := strconv.ParseFloat(str, 64)
-			if err != nil {
-				values[i] = 0.0
+// applyScalings replaces each scaled column by "<name>_norm". Values
+// outside the fitted range fall outside [0, 1].
+func (cd *CreditData) applyScalings(scalings []ColumnScaling) error {
+	byName := make(map[string]ColumnScaling, len(scalings))
+	names := make([]string, 0, len(scalings))
+	for _, sc := range scalings {
+		byName[sc.Column] = sc
+		names = append(names, sc.Column)
+	}
+	return cd.transformColumns(names, func(name string) ([]*dataset.Column, error) {
+		col, err := cd.Data.Col(name)
+		if err != nil {
+			return nil, nil
+		}
+		values, valid := col.FloatValues()
+
+		// Normalize values to [0,1] range in place
+		sc := byName[name]
+		scale := sc.Max - sc.Min
+		null := make([]bool, len(values))
+		for i, val := range values {
+			if !valid[i] {
+				values[i] = 0
+				null[i] = true
 				continue
 			}
-			normalized := (val - min) / (max - min)
-			values[i] = normalized
+			values[i] = (val - sc.Min) / scale
 		}
 
-		cd.DF = cd.DF.Mutate(
-			series.New(
-				values,
-				series.Float,
-				fmt.Sprintf("%s_norm", col),
-			),
-		)
-	}
+		return []*dataset.Column{dataset.NewFloatColumn(fmt.Sprintf("%s_norm", name), values, null)}, nil
+	})
 }
 
 // SplitTrainTest splits the data into training and testing sets
-func (cd *CreditData) SplitTrainTest(testSize float64) (trainDF, testDF dataframe.DataFrame) {
-	// Shuffle the data
-	shuffled := cd.DF.Arrange(dataframe.Sort("target"))
+func (cd *CreditData) SplitTrainTest(testSize float64) (trainDS, testDS *dataset.Dataset) {
+	// Shuffle the data, reproducibly when a seed is set
+	totalRows := cd.Data.Nrow()
+	order := rand.Perm(totalRows)
+	if cd.Seed != 0 {
+		order = rand.New(rand.NewPCG(cd.Seed, 0)).Perm(totalRows)
+	}
 
 	// Calculate split index
-	totalRows := shuffled.Nrow()
 	testRows := int(float64(totalRows) * testSize)
 	trainRows := totalRows - testRows
 
 	// Split the data
-	trainDF = shuffled.Subset(series.Ints(generateRange(0, trainRows)))
-	testDF = shuffled.Subset(series.Ints(generateRange(trainRows, totalRows)))
-
-	return trainDF, testDF
-}
+	trainDS = cd.Data.Subset(order[:trainRows])
+	testDS = cd.Data.Subset(order[trainRows:])
 
-// generateRange creates a slice of integers from start to end (exclusive)
-func generateRange(start, end int) []int {
-	rangeSlice := make([]int, end-start)
-	for i := 0; i < end-start; i++ {
-		rangeSlice[i] = start + i
-	}
-	return rangeSlice
+	return trainDS, testDS
 }
 
 // SaveProcessedData saves the processed data to CSV files
 func (cd *CreditData) SaveProcessedData(trainPath, testPath string) error {
 	// Split the data
-	trainDF, testDF := cd.SplitTrainTest(0.2)
+	trainDS, testDS := cd.SplitTrainTest(TestSize)
 
 	// Save training data
-	trainFile, err := os.Create(trainPath)
-	if err != nil {
-		return fmt.Errorf("error creating training file: %v", err)
+	if err := writeDataset(trainDS, trainPath); err != nil {
+		return fmt.Errorf("error writing training data: %v", err)
 	}
-	defer trainFile.Close()
-
-	trainWriter := csv.NewWriter(trainFile)
-	defer trainWriter.Flush()
 
-	// Write header
-	if err := trainWriter.Write(trainDF.Names()); err != nil {
-		return fmt.Errorf("error writing training header: %v", err)
+	// Save test data
+	if err := writeDataset(testDS, testPath); err != nil {
+		return fmt.Errorf("error writing test data: %v", err)
 	}
 
-	// Write data
-	for i := 0; i < trainDF.Nrow(); i++ {
-		row := make([]string, trainDF.Ncol())
-		for j := range trainDF.Names() {
-			row[j] = fmt.Sprintf("%v", trainDF.Elem(i, j).Val())
-		}
-		if err := trainWriter.Write(row); err != nil {
-			return fmt.Errorf("error writing training row: %v", err)
-		}
-	}
+	return nil
+}
 
-	// Save test data
-	testFile, err := os.Create(testPath)
+// writeDataset writes a dataset to a CSV file, gzip-compressed when the path
+// ends in .gz
+func writeDataset(ds *dataset.Dataset, path string) error {
+	file, err := dataset.Create(path)
 	if err != nil {
-		return fmt.Errorf("error creating test file: %v", err)
+		return fmt.Errorf("error creating file: %v", err)
 	}
-	defer testFile.Close()
-
-	testWriter := csv.NewWriter(testFile)
-	defer testWriter.Flush()
+	defer file.Close()
 
-	// Write header
-	if err := testWriter.Write(testDF.Names()); err != nil {
-		return fmt.Errorf("error writing test header: %v", err)
+	if err := ds.WriteCSV(file); err != nil {
+		return err
 	}
+	return file.Close()
+}
 
-	// Write data
-	for i := 0; i < testDF.Nrow(); i++ {
-		row := make([]string, testDF.Ncol())
-		for j := range testDF.Names() {
-			row[j] = fmt.Sprintf("%v", testDF.Elem(i, j).Val())
-		}
-		if err := testWriter.Write(row); err != nil {
-			return fmt.Errorf("error writing test row: %v", err)
-		}
+// SaveProcessedSplit saves an already split training and test set to CSV
+// files
+func SaveProcessedSplit(train, test *CreditData, trainPath, testPath string) error {
+	if err := writeDataset(train.Data, trainPath); err != nil {
+		return fmt.Errorf("error writing training data: %v", err)
+	}
+	if err := writeDataset(test.Data, testPath); err != nil {
+		return fmt.Errorf("error writing test data: %v", err)
 	}
-
 	return nil
 }
 
-// PreprocessPipeline runs the complete preprocessing pipeline
+// PreprocessPipeline runs the complete preprocessing pipeline, fitting it
+// on the training rows and applying it to both sets
 func PreprocessPipeline(inputPath, trainOutputPath, testOutputPath string) error {
 	// Load data
 	data, err := LoadData(inputPath)
@@ -431,13 +560,21 @@ func PreprocessPipeline(inputPath, trainOutputPath, testOutputPath string) error
 		return fmt.Errorf("error loading data: %v", err)
 	}
 
-	// Apply preprocessing steps
-	data.HandleMissingValues()
-	data.EncodeCategoricalFeatures()
-	data.NormalizeFeatures()
+	// Split before fitting so the test rows stay unseen
+	train, test := data.Split(TestSize)
+	p := NewPipeline(data.Schema, false)
+	if err := p.Fit(train); err != nil {
+		return fmt.Errorf("error fitting preprocessing: %v", err)
+	}
+	if err := p.Transform(train); err != nil {
+		return fmt.Errorf("error preprocessing training data: %v", err)
+	}
+	if err := p.Transform(test); err != nil {
+		return fmt.Errorf("error preprocessing test data: %v", err)
+	}
 
 	// Save processed data
-	err = data.SaveProcessedData(trainOutputPath, testOutputPath)
+	err = SaveProcessedSplit(train, test, trainOutputPath, testOutputPath)
 	if err != nil {
 		return fmt.Errorf("error saving processed data: %v", err)
 	}
@@ -0,0 +1,86 @@
+package preprocessing_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/benchmark"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/preprocessing"
+)
+
+// benchSizes runs fn as a sub-benchmark on synthetic records of each size
+func benchSizes(b *testing.B, fn func(b *testing.B, records [][]string)) {
+	sizes, err := benchmark.Sizes()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, n := range sizes {
+		records := benchmark.Records(n, 1)
+		b.Run(fmt.Sprintf("rows=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			fn(b, records)
+		})
+	}
+}
+
+// newCreditData builds fresh, unprocessed data with the timer stopped
+func newCreditData(b *testing.B, records [][]string) *preprocessing.CreditData {
+	b.StopTimer()
+	defer b.StartTimer()
+	data, err := benchmark.CreditData(records)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+func BenchmarkLoadData(b *testing.B) {
+	benchSizes(b, func(b *testing.B, records [][]string) {
+		rawPath := filepath.Join(b.TempDir(), "crx.data")
+		if err := benchmark.WriteRecords(rawPath, records); err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := preprocessing.LoadData(rawPath); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkHandleMissingValues(b *testing.B) {
+	benchSizes(b, func(b *testing.B, records [][]string) {
+		for i := 0; i < b.N; i++ {
+			data := newCreditData(b, records)
+			data.HandleMissingValues()
+		}
+	})
+}
+
+func BenchmarkEncodeCategoricalFeatures(b *testing.B) {
+	benchSizes(b, func(b *testing.B, records [][]string) {
+		for i := 0; i < b.N; i++ {
+			data := newCreditData(b, records)
+			b.StopTimer()
+			data.HandleMissingValues()
+			b.StartTimer()
+			if err := data.EncodeCategoricalFeatures(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkNormalizeFeatures(b *testing.B) {
+	benchSizes(b, func(b *testing.B, records [][]string) {
+		for i := 0; i < b.N; i++ {
+			data := newCreditData(b, records)
+			b.StopTimer()
+			data.HandleMissingValues()
+			b.StartTimer()
+			data.NormalizeFeatures()
+		}
+	})
+}
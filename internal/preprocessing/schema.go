@@ -0,0 +1,359 @@
+package preprocessing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// LabelColumn names the binary label in processed data, whatever the raw
+// target is called, so the models read every dataset the same way. It is
+// the crx target.
+const LabelColumn = "A16"
+
+// Schema describes a raw credit dataset: its columns, how each is
+// preprocessed and which target values mean a good applicant
+type Schema struct {
+	Name string `json:"name"`
+	// Columns names the fields of a headerless file in order. A file
+	// with a header row naming all of them may order them freely.
+	Columns     []string `json:"columns"`
+	Categorical []string `json:"categorical"`
+	Continuous  []string `json:"continuous"`
+	Target      string   `json:"target"`
+	// Positive lists the target values of good applicants, labeled 1
+	Positive []string `json:"positive"`
+	// Delimiter separates the fields; empty means a comma
+	Delimiter string `json:"delimiter,omitempty"`
+	// Ignore lists columns dropped after loading, such as record IDs
+	Ignore []string `json:"ignore,omitempty"`
+	// Options sets the imputation and encoding of individual columns
+	Options map[string]ColumnOptions `json:"options,omitempty"`
+	// Amount names a numeric column, such as the credit limit, kept as the
+	// AmountColumn target of a second-stage regression instead of a
+	// feature. It may be an extra column of a file with a header row.
+	Amount string `json:"amount,omitempty"`
+	// Duration and Event name the columns of a time-to-default target:
+	// how long each account was observed, and whether it then defaulted
+	// (1) or was censored (0). They are kept as the DurationColumn and
+	// EventColumn of a survival model instead of features.
+	Duration string `json:"duration,omitempty"`
+	Event    string `json:"event,omitempty"`
+	// Horizon labels applicants when there is no binary target: good when
+	// they did not default within it
+	Horizon float64 `json:"horizon,omitempty"`
+	// Classes lists the target values of a multiclass outcome from worst
+	// to best, such as decline, refer and approve. Each row's position in
+	// it is kept as the ClassColumn, next to the binary label, and rows
+	// with any other target value are dropped.
+	Classes []string `json:"classes,omitempty"`
+	// Derived lists features computed from the continuous columns by
+	// expressions, in order, and then preprocessed like continuous columns
+	Derived []DerivedFeature `json:"derived,omitempty"`
+}
+
+// CRXSchema returns the schema of the UCI credit approval (crx) data
+func CRXSchema() *Schema {
+	return &Schema{
+		Name:        "crx",
+		Columns:     RawColumns,
+		Categorical: CategoricalColumns,
+		Continuous:  ContinuousColumns,
+		Target:      "A16",
+		Positive:    []string{"+"},
+	}
+}
+
+// GermanCreditSchema returns the schema of the UCI Statlog German credit
+// data (german.data), whose space-separated class is 1 for good and 2 for
+// bad credit risks
+func GermanCreditSchema() *Schema {
+	return &Schema{
+		Name: "german",
+		Columns: []string{
+			"checking", "duration", "history", "purpose", "amount", "savings", "employment",
+			"installment_rate", "personal_status", "other_debtors", "residence_since", "property",
+			"age", "other_plans", "housing", "existing_credits", "job", "dependents", "telephone",
+			"foreign_worker", "class",
+		},
+		Categorical: []string{
+			"checking", "history", "purpose", "savings", "employment", "personal_status",
+			"other_debtors", "property", "other_plans", "housing", "job", "telephone", "foreign_worker",
+		},
+		Continuous: []string{
+			"duration", "amount", "installment_rate", "residence_since", "age", "existing_credits", "dependents",
+		},
+		Target:    "class",
+		Positive:  []string{"1"},
+		Delimiter: " ",
+	}
+}
+
+// TaiwanDefaultSchema returns the schema of the UCI default of credit card
+// clients data from Taiwan, exported to CSV with its header row of column
+// names. Clients who did not default are labeled good; the ID is dropped.
+func TaiwanDefaultSchema() *Schema {
+	continuous := []string{"LIMIT_BAL", "AGE", "PAY_0", "PAY_2", "PAY_3", "PAY_4", "PAY_5", "PAY_6"}
+	for k := 1; k <= 6; k++ {
+		continuous = append(continuous, fmt.Sprintf("BILL_AMT%d", k))
+	}
+	for k := 1; k <= 6; k++ {
+		continuous = append(continuous, fmt.Sprintf("PAY_AMT%d", k))
+	}
+	columns := append([]string{"ID", "LIMIT_BAL", "SEX", "EDUCATION", "MARRIAGE"}, continuous[1:]...)
+	columns = append(columns, "default payment next month")
+	return &Schema{
+		Name:        "taiwan",
+		Columns:     columns,
+		Categorical: []string{"SEX", "EDUCATION", "MARRIAGE"},
+		Continuous:  continuous,
+		Target:      "default payment next month",
+		Positive:    []string{"0"},
+	}
+}
+
+// BuiltinSchemas maps the names of the bundled schemas to their
+// constructors
+var BuiltinSchemas = map[string]func() *Schema{
+	"crx":    CRXSchema,
+	"german": GermanCreditSchema,
+	"taiwan": TaiwanDefaultSchema,
+}
+
+// BuiltinSchemaNames returns the names of the bundled schemas, sorted
+func BuiltinSchemaNames() []string {
+	names := make([]string, 0, len(BuiltinSchemas))
+	for name := range BuiltinSchemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadSchema reads a schema from a JSON file with the fields of Schema,
+// such as
+//
+//	{"name": "bank", "columns": ["income", "region", "approved"],
+//	 "categorical": ["region"], "continuous": ["income"],
+//	 "target": "approved", "positive": ["yes"]}
+//
+// or from a YAML preprocessing config (see LoadConfig) when the file ends
+// in .yaml or .yml
+func LoadSchema(path string) (*Schema, error) {
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		s, _, err := LoadConfig(path)
+		return s, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema: %v", err)
+	}
+
+	s := &Schema{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("error parsing schema: %v", err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate checks that every preprocessed column and the target are among
+// the columns, that no column is used twice and that the label cannot
+// clash with a feature
+func (s *Schema) Validate() error {
+	if len(s.Columns) == 0 {
+		return fmt.Errorf("schema %s needs columns", s.Name)
+	}
+	if (s.Duration == "") != (s.Event == "") {
+		return fmt.Errorf("schema %s needs both a duration and an event column for a survival target", s.Name)
+	}
+	if s.Target == "" && (!s.survival() || s.Horizon <= 0) {
+		return fmt.Errorf("schema %s needs a target, or survival columns and a positive horizon", s.Name)
+	}
+	if s.Target != "" && len(s.Positive) == 0 {
+		return fmt.Errorf("schema %s needs positive target values", s.Name)
+	}
+	if err := s.validateClasses(); err != nil {
+		return err
+	}
+	if err := s.validateDerived(); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(s.Delimiter) > 1 {
+		return fmt.Errorf("schema %s delimiter must be a single character, got %q", s.Name, s.Delimiter)
+	}
+
+	used := make(map[string]bool)
+	outcomes := []string{s.Target, s.Duration, s.Event}
+	for _, name := range append(append(append(append([]string(nil), s.Categorical...), s.Continuous...), s.Ignore...), outcomes...) {
+		if name == "" {
+			continue
+		}
+		if !contains(s.Columns, name) {
+			return fmt.Errorf("schema %s uses column %s, which is not among its columns", s.Name, name)
+		}
+		if used[name] {
+			return fmt.Errorf("schema %s uses column %s twice", s.Name, name)
+		}
+		used[name] = true
+		if !contains(outcomes, name) && !contains(s.Ignore, name) && isProcessedOutcome(name) {
+			return fmt.Errorf("schema %s feature %s clashes with a processed column name", s.Name, name)
+		}
+	}
+
+	if s.Amount != "" && used[s.Amount] {
+		return fmt.Errorf("schema %s amount %s is also a feature, target or ignored column", s.Name, s.Amount)
+	}
+
+	for name, opts := range s.Options {
+		categorical := contains(s.Categorical, name)
+		if !categorical && !contains(s.continuousFeatures(), name) {
+			return fmt.Errorf("schema %s sets options of %s, which is neither categorical nor continuous", s.Name, name)
+		}
+		switch opts.Impute {
+		case "", ImputeConstant, ImputeKNN, ImputeNone:
+		case ImputeMode:
+			if !categorical {
+				return fmt.Errorf("schema %s imputes continuous column %s with its mode (want mean, median, constant, knn or none)", s.Name, name)
+			}
+		case ImputeMean, ImputeMedian:
+			if categorical {
+				return fmt.Errorf("schema %s imputes categorical column %s with its %s (want mode, constant, knn or none)", s.Name, name, opts.Impute)
+			}
+		default:
+			return fmt.Errorf("schema %s column %s has unknown imputation %q", s.Name, name, opts.Impute)
+		}
+		if opts.Impute == ImputeConstant && !categorical && opts.Fill != "" {
+			if _, err := strconv.ParseFloat(opts.Fill, 64); err != nil {
+				return fmt.Errorf("schema %s column %s has non-numeric fill %q", s.Name, name, opts.Fill)
+			}
+		}
+		if opts.Neighbors != 0 && (opts.Impute != ImputeKNN || opts.Neighbors < 0) {
+			return fmt.Errorf("schema %s column %s sets %d neighbors, which needs knn imputation and a positive count", s.Name, name, opts.Neighbors)
+		}
+		switch opts.Encoding {
+		case "":
+		case OneHotEncoding, OrdinalEncoding, FrequencyEncoding:
+			if !categorical {
+				return fmt.Errorf("schema %s encodes continuous column %s", s.Name, name)
+			}
+		default:
+			return fmt.Errorf("schema %s column %s has unknown encoding %q (want onehot, ordinal or frequency)", s.Name, name, opts.Encoding)
+		}
+	}
+	return nil
+}
+
+// WithAmount returns a copy of the schema whose amount is the named
+// column, which stops being a feature
+func (s *Schema) WithAmount(name string) (*Schema, error) {
+	out := *s
+	out.Amount = name
+	out.Categorical = without(s.Categorical, name)
+	out.Continuous = without(s.Continuous, name)
+	if _, ok := s.Options[name]; ok {
+		out.Options = make(map[string]ColumnOptions, len(s.Options))
+		for column, opts := range s.Options {
+			if column != name {
+				out.Options[column] = opts
+			}
+		}
+	}
+	if err := out.Validate(); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// without returns names less name, sharing nothing with names
+func without(names []string, name string) []string {
+	out := make([]string, 0, len(names))
+	for _, n := range names {
+		if n != name {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// impute returns the imputation strategy of a column
+func (s *Schema) impute(name string) string {
+	if strategy := s.Options[name].Impute; strategy != "" {
+		return strategy
+	}
+	if contains(s.Categorical, name) {
+		return ImputeMode
+	}
+	return ImputeMean
+}
+
+// encoding returns the encoding of a categorical column
+func (s *Schema) encoding(name string) string {
+	if encoding := s.Options[name].Encoding; encoding != "" {
+		return encoding
+	}
+	return OneHotEncoding
+}
+
+// comma returns the field delimiter
+func (s *Schema) comma() rune {
+	if s.Delimiter == "" {
+		return ','
+	}
+	r, _ := utf8.DecodeRuneInString(s.Delimiter)
+	return r
+}
+
+// schema returns the data's schema, the crx one unless set
+func (cd *CreditData) schema() *Schema {
+	if cd.Schema == nil {
+		return CRXSchema()
+	}
+	return cd.Schema
+}
+
+// DropIgnoredColumns removes the columns the schema ignores
+func (cd *CreditData) DropIgnoredColumns() error {
+	for _, name := range cd.schema().Ignore {
+		if _, err := cd.Data.Col(name); err != nil {
+			continue
+		}
+		if err := cd.Data.Drop(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isProcessedOutcome reports whether name is one of the columns that hold
+// the label, sample weight, amount, survival or class outcome in processed
+// data, whether or not the schema has that outcome
+func isProcessedOutcome(name string) bool {
+	switch name {
+	case LabelColumn, WeightColumn, AmountColumn, DurationColumn, EventColumn, ClassColumn:
+		return true
+	}
+	return false
+}
+
+// DropUnusedColumns removes every column the schema neither preprocesses
+// nor uses as the target, amount or survival columns, such as record IDs,
+// keeping the sample weight
+func (cd *CreditData) DropUnusedColumns() error {
+	s := cd.schema()
+	for _, name := range cd.Data.Names() {
+		if name == s.Target || name == s.Amount || name == s.Duration || name == s.Event || name == WeightColumn || contains(s.Categorical, name) || contains(s.continuousFeatures(), name) {
+			continue
+		}
+		if err := cd.Data.Drop(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
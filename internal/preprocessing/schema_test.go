@@ -0,0 +1,131 @@
+package preprocessing_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/preprocessing"
+)
+
+// writeGermanCredit writes n synthetic rows in the space-separated layout
+// of the UCI german.data file and returns its path
+func writeGermanCredit(t *testing.T, n int) string {
+	t.Helper()
+	schema := preprocessing.GermanCreditSchema()
+	rng := rand.New(rand.NewPCG(1, 2))
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		duration := 4 + rng.IntN(68)
+		amount := 250 + rng.IntN(18000)
+		fields := make([]string, len(schema.Columns))
+		for j, name := range schema.Columns {
+			switch name {
+			case "duration":
+				fields[j] = fmt.Sprint(duration)
+			case "amount":
+				fields[j] = fmt.Sprint(amount)
+			case "class":
+				// Long, large loans default more often, so the two
+				// features carry signal the models should use
+				fields[j] = "1"
+				if rng.Float64() < 0.1+0.5*float64(duration)/72+0.3*float64(amount)/18250 {
+					fields[j] = "2"
+				}
+			default:
+				if contains(schema.Continuous, name) {
+					fields[j] = fmt.Sprint(1 + rng.IntN(4))
+				} else {
+					fields[j] = fmt.Sprintf("A%d%d", j+1, 1+rng.IntN(3))
+				}
+			}
+		}
+		b.WriteString(strings.Join(fields, " ") + "\n")
+	}
+
+	path := filepath.Join(t.TempDir(), "german.data")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// contains reports whether names includes name
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TestGermanCreditSchemaEndToEnd checks that the german duration and amount
+// features stay features, rather than being taken for the survival and
+// amount outcomes, through preprocessing and training
+func TestGermanCreditSchemaEndToEnd(t *testing.T) {
+	schema := preprocessing.GermanCreditSchema()
+	if err := schema.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := preprocessing.LoadDataWithSchema(writeGermanCredit(t, 400), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Seed = 1
+	if err := data.DropUnusedColumns(); err != nil {
+		t.Fatal(err)
+	}
+
+	train, test := data.Split(preprocessing.TestSize)
+	prep := preprocessing.NewPipeline(schema, false)
+	if err := prep.Fit(train); err != nil {
+		t.Fatal(err)
+	}
+	for _, cd := range []*preprocessing.CreditData{train, test} {
+		if err := prep.Transform(cd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	features := models.FeatureColumns(train.Data)
+	for _, name := range []string{"duration_norm", "amount_norm"} {
+		if !contains(features, name) {
+			t.Errorf("features %v leave out %s", features, name)
+		}
+	}
+	trainData, err := models.NewFeatureMatrix(train.Data, features)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testData, err := models.NewFeatureMatrix(test.Data, features)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trainData.Amounts != nil || trainData.Durations != nil || trainData.Events != nil || trainData.Classes != nil {
+		t.Fatal("german features were read as amount, survival or class outcomes")
+	}
+
+	trained, err := models.TrainAllModels(trainData, testData, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trained) != len(models.AllModelTypes) {
+		t.Errorf("trained %d models, want %d", len(trained), len(models.AllModelTypes))
+	}
+}
+
+func TestValidateRejectsProcessedOutcomeNames(t *testing.T) {
+	for _, name := range []string{preprocessing.WeightColumn, preprocessing.AmountColumn, preprocessing.DurationColumn, preprocessing.EventColumn, preprocessing.ClassColumn} {
+		schema := preprocessing.CRXSchema()
+		schema.Columns = append(append([]string(nil), schema.Columns...), name)
+		schema.Continuous = append(append([]string(nil), schema.Continuous...), name)
+		if err := schema.Validate(); err == nil {
+			t.Errorf("schema with a feature called %s was accepted", name)
+		}
+	}
+}
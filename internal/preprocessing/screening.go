@@ -0,0 +1,341 @@
+package preprocessing
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/stat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// ScreenBins is the number of equal-frequency bins a continuous feature is
+// cut into for its information value
+const ScreenBins = 10
+
+// FeatureScreen is the univariate predictive power of one raw feature
+type FeatureScreen struct {
+	Feature     string
+	Categorical bool
+	// AUC is the area under the ROC curve of the feature alone, oriented
+	// so that it is at least 0.5. A categorical feature scores each level
+	// by its approval rate.
+	AUC float64
+	// IV is the information value of the feature's bins, or levels, with
+	// missing values as a bin of their own
+	IV float64
+	// Correlation is the Pearson correlation of a continuous feature with
+	// the target, and the correlation ratio of a categorical one
+	Correlation float64
+	// MissingRate is the share of rows with no value
+	MissingRate float64
+}
+
+// Strength describes the information value on the usual credit scoring
+// scale
+func (s FeatureScreen) Strength() string {
+	switch {
+	case s.IV < 0.02:
+		return "useless"
+	case s.IV < 0.1:
+		return "weak"
+	case s.IV < 0.3:
+		return "medium"
+	case s.IV < 0.5:
+		return "strong"
+	}
+	return "suspicious"
+}
+
+// ScreenFeatures ranks the raw continuous and categorical features by
+// univariate AUC, highest first, as a quick guide to feature selection. It
+// runs on the loaded data before any other preprocessing step, with "?"
+// counted as missing, and weights rows by the weight column when there is
+// one. Derived features are computed on a copy of the data and screened
+// with the continuous ones.
+func (cd *CreditData) ScreenFeatures() ([]FeatureScreen, error) {
+	schema := cd.schema()
+	if len(schema.Derived) > 0 {
+		rows := make([]int, cd.Data.Nrow())
+		for i := range rows {
+			rows[i] = i
+		}
+		derived := *cd
+		derived.Data = cd.Data.Subset(rows)
+		if err := derived.deriveFeatures(); err != nil {
+			return nil, err
+		}
+		cd = &derived
+	}
+	labels, known, err := cd.labels()
+	if err != nil {
+		return nil, err
+	}
+
+	var weights []float64
+	if col, err := cd.Data.Col(WeightColumn); err == nil {
+		values, valid := col.FloatValues()
+		for i, ok := range valid {
+			if !ok || values[i] < 0 {
+				return nil, fmt.Errorf("row %d has invalid sample weight %q", i+1, col.String(i))
+			}
+		}
+		weights = values
+	}
+
+	// Rows the survival columns cannot label count for nothing
+	for i, ok := range known {
+		if ok {
+			continue
+		}
+		if weights == nil {
+			weights = make([]float64, len(known))
+			for j := range weights {
+				weights[j] = 1
+			}
+		}
+		weights[i] = 0
+	}
+
+	var screens []FeatureScreen
+	for _, name := range schema.continuousFeatures() {
+		col, err := cd.Data.Col(name)
+		if err != nil {
+			continue
+		}
+		screens = append(screens, screenContinuous(col, labels, weights))
+	}
+	for _, name := range schema.Categorical {
+		col, err := cd.Data.Col(name)
+		if err != nil {
+			continue
+		}
+		screens = append(screens, screenCategorical(col, labels, weights))
+	}
+
+	sort.SliceStable(screens, func(a, b int) bool {
+		return screens[a].AUC > screens[b].AUC
+	})
+	return screens, nil
+}
+
+// splitRows separates the rows that have a value from those that do not,
+// and returns the share of weight without one
+func splitRows(n int, has func(i int) bool, weights []float64) (rows, missing []int, missingRate float64) {
+	var gone, total float64
+	for i := 0; i < n; i++ {
+		total += models.WeightAt(weights, i)
+		if !has(i) {
+			missing = append(missing, i)
+			gone += models.WeightAt(weights, i)
+			continue
+		}
+		rows = append(rows, i)
+	}
+	if total > 0 {
+		missingRate = gone / total
+	}
+	return rows, missing, missingRate
+}
+
+// isMissing reports whether row i of col is null or "?"
+func isMissing(col *dataset.Column, i int) bool {
+	return col.IsNull(i) || col.String(i) == "?"
+}
+
+// screenContinuous measures a numeric column on the rows that parse
+func screenContinuous(col *dataset.Column, labels, weights []float64) FeatureScreen {
+	values, valid := col.FloatValues()
+	rows, missing, missingRate := splitRows(col.Len(), func(i int) bool {
+		return valid[i] && !isMissing(col, i)
+	}, weights)
+
+	x, y, w := gather(rows, values, labels, weights)
+	screen := FeatureScreen{Feature: col.Name, AUC: orientedAUC(x, y, w), MissingRate: missingRate}
+	if c := stat.Correlation(x, y, w); !math.IsNaN(c) {
+		screen.Correlation = c
+	}
+
+	screen.IV = informationValue(quantileBins(rows, values, ScreenBins), missing, labels, weights)
+	return screen
+}
+
+// quantileBins sorts the rows by value and cuts them at equal-frequency
+// positions into at most n bins, keeping tied values in one bin
+func quantileBins(rows []int, values []float64, n int) [][]int {
+	rows = append([]int(nil), rows...)
+	sort.SliceStable(rows, func(a, b int) bool {
+		return values[rows[a]] < values[rows[b]]
+	})
+	var bins [][]int
+	start := 0
+	for b := 1; b <= n && start < len(rows); b++ {
+		end := b * len(rows) / n
+		if end <= start {
+			continue
+		}
+		for end < len(rows) && values[rows[end]] == values[rows[end-1]] {
+			end++
+		}
+		bins = append(bins, rows[start:end])
+		start = end
+	}
+	return bins
+}
+
+// screenCategorical measures a text column, scoring each row by the
+// approval rate of its level
+func screenCategorical(col *dataset.Column, labels, weights []float64) FeatureScreen {
+	rows, missing, missingRate := splitRows(col.Len(), func(i int) bool {
+		return !isMissing(col, i)
+	}, weights)
+
+	levels, bins := levelBins(col, rows)
+	rate := make(map[string]float64)
+	for k, level := range levels {
+		pos, sum := 0.0, 0.0
+		for _, i := range bins[k] {
+			sum += models.WeightAt(weights, i)
+			pos += models.WeightAt(weights, i) * labels[i]
+		}
+		if sum > 0 {
+			rate[level] = pos / sum
+		}
+	}
+
+	encoded := make([]float64, len(labels))
+	for _, i := range rows {
+		encoded[i] = rate[col.String(i)]
+	}
+	x, y, w := gather(rows, encoded, labels, weights)
+
+	screen := FeatureScreen{Feature: col.Name, Categorical: true, AUC: orientedAUC(x, y, w), MissingRate: missingRate}
+	if c := stat.Correlation(x, y, w); !math.IsNaN(c) {
+		screen.Correlation = c
+	}
+
+	screen.IV = informationValue(bins, missing, labels, weights)
+	return screen
+}
+
+// gather returns the values, labels and weights (nil when unweighted) of
+// the given rows
+func gather(rows []int, values, labels, weights []float64) (x, y, w []float64) {
+	for _, i := range rows {
+		x = append(x, values[i])
+		y = append(y, labels[i])
+		if weights != nil {
+			w = append(w, weights[i])
+		}
+	}
+	return x, y, w
+}
+
+// orientedAUC returns the AUC of the scores, or one minus it when the
+// feature ranks the classes the other way round
+func orientedAUC(scores, labels, weights []float64) float64 {
+	auc := models.AUC(scores, labels, weights)
+	return math.Max(auc, 1-auc)
+}
+
+// informationValue sums (good share - bad share) * ln(good share / bad
+// share) over the bins and the missing rows. A bin with no good or no bad
+// rows gets half a row of each so its log stays finite.
+func informationValue(bins [][]int, missing []int, labels, weights []float64) float64 {
+	if len(missing) > 0 {
+		bins = append(bins, missing)
+	}
+
+	goods := make([]float64, len(bins))
+	bads := make([]float64, len(bins))
+	var good, bad float64
+	for b, rows := range bins {
+		for _, i := range rows {
+			if labels[i] >= 0.5 {
+				goods[b] += models.WeightAt(weights, i)
+			} else {
+				bads[b] += models.WeightAt(weights, i)
+			}
+		}
+		if goods[b] == 0 || bads[b] == 0 {
+			goods[b] += 0.5
+			bads[b] += 0.5
+		}
+		good += goods[b]
+		bad += bads[b]
+	}
+	if good == 0 || bad == 0 {
+		return 0
+	}
+
+	iv := 0.0
+	for b := range bins {
+		g, d := goods[b]/good, bads[b]/bad
+		iv += (g - d) * math.Log(g/d)
+	}
+	return iv
+}
+
+// PrintScreening prints the feature ranking
+func PrintScreening(screens []FeatureScreen) {
+	// Size the feature column to the longest feature name
+	width := 8
+	for _, s := range screens {
+		if len(s.Feature) > width {
+			width = len(s.Feature)
+		}
+	}
+
+	fmt.Println("\nFeature Screening:")
+	fmt.Println("=========================")
+	fmt.Printf("%-*s %-12s %-8s %-8s %-12s %-8s %-10s\n", width, "Feature", "Type", "AUC", "IV", "Correlation", "Missing", "Strength")
+	fmt.Println(strings.Repeat("-", width+67))
+	for _, s := range screens {
+		fmt.Printf("%-*s %-12s %-8.4f %-8.4f %-12.4f %-8.4f %-10s\n",
+			width, s.Feature, screenType(s), s.AUC, s.IV, s.Correlation, s.MissingRate, s.Strength())
+	}
+}
+
+// screenType names whether the feature is continuous or categorical
+func screenType(s FeatureScreen) string {
+	if s.Categorical {
+		return "categorical"
+	}
+	return "continuous"
+}
+
+// SaveScreening writes the feature ranking to a CSV file, gzip-compressed
+// when the path ends in .gz
+func SaveScreening(path string, screens []FeatureScreen) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating screening file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Rank", "Feature", "Type", "AUC", "Information Value", "Correlation", "Missing Rate", "Strength"})
+	for k, s := range screens {
+		writer.Write([]string{
+			strconv.Itoa(k + 1),
+			s.Feature,
+			screenType(s),
+			strconv.FormatFloat(s.AUC, 'f', 4, 64),
+			strconv.FormatFloat(s.IV, 'f', 4, 64),
+			strconv.FormatFloat(s.Correlation, 'f', 4, 64),
+			strconv.FormatFloat(s.MissingRate, 'f', 4, 64),
+			s.Strength(),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing screening: %v", err)
+	}
+	return file.Close()
+}
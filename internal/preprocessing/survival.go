@@ -0,0 +1,94 @@
+package preprocessing
+
+import (
+	"fmt"
+	"math"
+)
+
+// DurationColumn and EventColumn name the schema's survival columns in
+// processed data: how long each account was observed, and 1 when it
+// defaulted at that time or 0 when it was censored
+const (
+	DurationColumn = "_duration"
+	EventColumn    = "_event"
+)
+
+// survival reports whether the schema has a time-to-default target
+func (s *Schema) survival() bool {
+	return s.Duration != "" && s.Event != ""
+}
+
+// labels returns the binary label of each row: 1 for a good applicant by
+// the target, or without one, for an applicant who did not default within
+// the horizon. known is false for the rows the survival columns cannot
+// label, censored within the horizon or missing their duration or event,
+// and for those whose target is not among the schema's classes.
+func (cd *CreditData) labels() (labels []float64, known []bool, err error) {
+	s := cd.schema()
+	labels = make([]float64, cd.Data.Nrow())
+	known = make([]bool, len(labels))
+
+	if s.Target != "" {
+		col, err := cd.Data.Col(s.Target)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error accessing target column %s: %v", s.Target, err)
+		}
+		for i := range labels {
+			if contains(s.Positive, col.String(i)) {
+				labels[i] = 1
+			}
+			known[i] = true
+		}
+		if len(s.Classes) > 0 {
+			classes, err := cd.classIndices()
+			if err != nil {
+				return nil, nil, err
+			}
+			for i, k := range classes {
+				known[i] = k >= 0
+			}
+		}
+		return labels, known, nil
+	}
+
+	durations, events, err := cd.survivalValues()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, d := range durations {
+		e := events[i]
+		switch {
+		case math.IsNaN(d) || math.IsNaN(e):
+		case e != 0 && d <= s.Horizon:
+			known[i] = true
+		case d > s.Horizon || (e == 0 && d == s.Horizon):
+			labels[i] = 1
+			known[i] = true
+		}
+	}
+	return labels, known, nil
+}
+
+// survivalValues parses the survival columns, NaN where a value is missing
+// or not numeric
+func (cd *CreditData) survivalValues() (durations, events []float64, err error) {
+	s := cd.schema()
+	for _, name := range []string{s.Duration, s.Event} {
+		col, err := cd.Data.Col(name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error accessing survival column %s: %v", name, err)
+		}
+		values, valid := col.FloatValues()
+		for i, ok := range valid {
+			if !ok {
+				values[i] = math.NaN()
+			}
+		}
+		if name == s.Duration {
+			durations = values
+		} else {
+			events = values
+		}
+	}
+	return durations, events, nil
+}
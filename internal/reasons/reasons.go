@@ -0,0 +1,261 @@
+package reasons
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"gonum.org/v1/gonum/mat"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/explain"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// Config holds the settings of the reason code generator
+type Config struct {
+	// Threshold is the approval probability below which an application
+	// is rejected
+	Threshold float64
+	// MaxReasons is the number of principal reasons given per rejection
+	MaxReasons int
+}
+
+// DefaultConfig gives up to four principal reasons for applications
+// scored below 0.5, as adverse action notices customarily do
+func DefaultConfig() Config {
+	return Config{
+		Threshold:  0.5,
+		MaxReasons: 4,
+	}
+}
+
+// Reason is one principal reason a rejected application was rejected
+type Reason struct {
+	// Code identifies the reason independently of its wording, e.g.
+	// "A15-LOW"
+	Code    string
+	Text    string
+	Feature string
+	// Impact is how much the feature lowered the approval probability
+	Impact float64
+}
+
+// Decision is a model's decision on one application, with the reasons for
+// a rejection
+type Decision struct {
+	Row         int
+	Probability float64
+	Approved    bool
+	// Reasons are the principal reasons, most important first. They are
+	// empty for approved applications.
+	Reasons []Reason
+}
+
+// Generator turns the feature contributions of a rejected application into
+// ranked reason codes
+type Generator struct {
+	Config    Config
+	clf       models.Classifier
+	explainer *explain.SHAPExplainer
+	// means are the training means of the numeric feature columns, which
+	// tell a low value from a high one. SHAP values measure the applicant
+	// against the average applicant, so a skewed feature such as A15 is low
+	// whenever it is below the mean, even at the median.
+	means map[string]float64
+	// catalog maps codes to the wording used in notices
+	catalog map[string]string
+}
+
+// NewGenerator prepares reason codes for clf, whose feature contributions
+// explainer computes. The numeric features of trainData set what counts as
+// a low or high value.
+func NewGenerator(clf models.Classifier, explainer *explain.SHAPExplainer, trainData *models.FeatureMatrix, config Config) (*Generator, error) {
+	if config.MaxReasons <= 0 {
+		return nil, fmt.Errorf("reason codes need a positive reason count, got %d", config.MaxReasons)
+	}
+
+	g := &Generator{Config: config, clf: clf, explainer: explainer, means: make(map[string]float64)}
+	X := trainData.Dense()
+	for _, name := range explain.NumericFeatures(trainData) {
+		j := groupColumns(trainData, name)[0]
+		total, n := 0.0, 0
+		for i := 0; i < trainData.Rows(); i++ {
+			if !trainData.IsMissing(i, j) {
+				total += X.At(i, j)
+				n++
+			}
+		}
+		if n > 0 {
+			g.means[name] = total / float64(n)
+		}
+	}
+	return g, nil
+}
+
+// LoadCatalog reads the wording of reason codes from a JSON file mapping
+// codes to text, such as
+//
+//	{"A15-LOW": "Insufficient income", "A9-f": "No prior default record"}
+//
+// Codes missing from the catalog keep their generated text.
+func (g *Generator) LoadCatalog(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading reason catalog: %v", err)
+	}
+	catalog := make(map[string]string)
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return fmt.Errorf("error parsing reason catalog: %v", err)
+	}
+	g.catalog = catalog
+	return nil
+}
+
+// Decide scores row i of data and, when it is rejected, ranks the features
+// that lowered its approval probability the most as reason codes. Features
+// that raised the probability are never given as reasons.
+func (g *Generator) Decide(data *models.FeatureMatrix, i int) (*Decision, error) {
+	if i < 0 || i >= data.Rows() {
+		return nil, fmt.Errorf("row %d is out of range [0, %d)", i, data.Rows())
+	}
+	p := models.Score(g.clf, data.Subset([]int{i}))[0]
+	decision := &Decision{Row: i, Probability: p, Approved: p >= g.Config.Threshold}
+	if decision.Approved {
+		return decision, nil
+	}
+
+	x, err := g.explainer.Explain(data, i)
+	if err != nil {
+		return nil, err
+	}
+
+	X := data.Dense()
+	for _, c := range x.Contributions {
+		if c.SHAP >= 0 {
+			continue
+		}
+		reason := g.reason(data, X, i, c)
+		reason.Impact = -c.SHAP
+		decision.Reasons = append(decision.Reasons, reason)
+	}
+	sort.SliceStable(decision.Reasons, func(a, b int) bool {
+		return decision.Reasons[a].Impact > decision.Reasons[b].Impact
+	})
+	if len(decision.Reasons) > g.Config.MaxReasons {
+		decision.Reasons = decision.Reasons[:g.Config.MaxReasons]
+	}
+	return decision, nil
+}
+
+// reason words a contribution: a numeric feature is low or high against
+// its training mean, and a categorical one names its level
+func (g *Generator) reason(data *models.FeatureMatrix, X *mat.Dense, i int, c explain.Contribution) Reason {
+	r := Reason{Feature: c.Feature}
+	cols := groupColumns(data, c.Feature)
+	mean, numeric := g.means[c.Feature]
+	switch {
+	case len(cols) > 0 && data.IsMissing(i, cols[0]):
+		r.Code = c.Feature + "-MISSING"
+		r.Text = fmt.Sprintf("%s not provided", c.Feature)
+	case numeric && X.At(i, cols[0]) < mean:
+		r.Code = c.Feature + "-LOW"
+		r.Text = fmt.Sprintf("Low value of %s (%s)", c.Feature, c.Value)
+	case numeric:
+		r.Code = c.Feature + "-HIGH"
+		r.Text = fmt.Sprintf("High value of %s (%s)", c.Feature, c.Value)
+	default:
+		r.Code = c.Feature + "-" + c.Value
+		r.Text = fmt.Sprintf("%s is %s", c.Feature, c.Value)
+	}
+	if text, ok := g.catalog[r.Code]; ok {
+		r.Text = text
+	}
+	return r
+}
+
+// groupColumns returns the feature columns of a raw feature
+func groupColumns(data *models.FeatureMatrix, name string) []int {
+	for _, group := range data.Groups() {
+		if group.Name == name {
+			return group.Columns
+		}
+	}
+	return nil
+}
+
+// DecideAll decides every row of data
+func (g *Generator) DecideAll(data *models.FeatureMatrix) ([]*Decision, error) {
+	decisions := make([]*Decision, data.Rows())
+	for i := range decisions {
+		d, err := g.Decide(data, i)
+		if err != nil {
+			return nil, fmt.Errorf("error deciding row %d: %v", i, err)
+		}
+		decisions[i] = d
+	}
+	return decisions, nil
+}
+
+// CodeCount is how often a reason code was the principal reason
+type CodeCount struct {
+	Code  string
+	Count int
+}
+
+// PrincipalCodes counts the first reason of every rejection, most frequent
+// first
+func PrincipalCodes(decisions []*Decision) []CodeCount {
+	counts := make(map[string]int)
+	for _, d := range decisions {
+		if len(d.Reasons) > 0 {
+			counts[d.Reasons[0].Code]++
+		}
+	}
+	var ranked []CodeCount
+	for code, n := range counts {
+		ranked = append(ranked, CodeCount{Code: code, Count: n})
+	}
+	sort.Slice(ranked, func(a, b int) bool {
+		if ranked[a].Count != ranked[b].Count {
+			return ranked[a].Count > ranked[b].Count
+		}
+		return ranked[a].Code < ranked[b].Code
+	})
+	return ranked
+}
+
+// SaveReasons writes the reason codes of every rejection, one line per
+// reason, gzip-compressed when the path ends in .gz. Rows are numbered as
+// in the predictions export.
+func SaveReasons(path string, decisions []*Decision) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating reason codes file: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Row", "Probability", "Rank", "Code", "Reason", "Impact"})
+	for _, d := range decisions {
+		for k, r := range d.Reasons {
+			writer.Write([]string{
+				strconv.Itoa(d.Row),
+				strconv.FormatFloat(d.Probability, 'f', 4, 64),
+				strconv.Itoa(k + 1),
+				r.Code,
+				r.Text,
+				strconv.FormatFloat(r.Impact, 'f', 4, 64),
+			})
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing reason codes: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,420 @@
+package segmentation
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
+)
+
+// FeatureName is the name of the derived segment feature, whose one-hot
+// columns are "segment_1" to "segment_<k>"
+const FeatureName = "segment"
+
+// Config holds the settings of k-means segmentation
+type Config struct {
+	// K is the number of segments
+	K int
+	// MaxIterations bounds the assignment and update rounds of each run
+	MaxIterations int
+	// Restarts is the number of k-means++ initializations tried, keeping
+	// the one with the lowest inertia
+	Restarts int
+	// Seed determines the initial centroids; zero draws a random one
+	Seed uint64
+}
+
+// DefaultConfig returns k segments from the best of ten runs of up to 100
+// rounds each
+func DefaultConfig(k int) Config {
+	return Config{
+		K:             k,
+		MaxIterations: 100,
+		Restarts:      10,
+	}
+}
+
+// KMeans segments applicants by the numeric features of the training data
+type KMeans struct {
+	// Features names the clustered columns and Columns their indices in
+	// the feature matrix
+	Features []string
+	Columns  []int
+	// Centroids holds each segment's mean of the clustered columns
+	Centroids [][]float64
+	// Inertia is the summed squared distance of the training rows to their
+	// centroids
+	Inertia float64
+	// means fill in missing values, so they never pull a row towards a
+	// segment
+	means []float64
+}
+
+// Fit clusters the rows of data by its numeric features, the normalized
+// continuous columns. Categorical features are left out since distances
+// between one-hot columns say little about how similar applicants are.
+func Fit(data *models.FeatureMatrix, config Config) (*KMeans, error) {
+	if config.K < 2 {
+		return nil, fmt.Errorf("segmentation needs at least 2 segments, got %d", config.K)
+	}
+	if config.K > data.Rows() {
+		return nil, fmt.Errorf("%d segments for %d rows", config.K, data.Rows())
+	}
+	if config.MaxIterations <= 0 || config.Restarts <= 0 {
+		return nil, fmt.Errorf("segmentation needs positive iterations and restarts")
+	}
+	for config.Seed == 0 {
+		config.Seed = rand.Uint64()
+	}
+
+	km := &KMeans{}
+	categorical := make(map[int]bool)
+	for _, cf := range data.Categorical {
+		for _, j := range cf.Columns {
+			categorical[j] = true
+		}
+	}
+	for _, group := range data.Groups() {
+		if len(group.Columns) == 1 && !categorical[group.Columns[0]] {
+			km.Features = append(km.Features, group.Name)
+			km.Columns = append(km.Columns, group.Columns[0])
+		}
+	}
+	if len(km.Columns) == 0 {
+		return nil, fmt.Errorf("data has no numeric features to segment by")
+	}
+
+	X := data.Dense()
+	km.means = make([]float64, len(km.Columns))
+	for c, j := range km.Columns {
+		total, n := 0.0, 0
+		for i := 0; i < data.Rows(); i++ {
+			if !data.IsMissing(i, j) {
+				total += X.At(i, j)
+				n++
+			}
+		}
+		if n > 0 {
+			km.means[c] = total / float64(n)
+		}
+	}
+	points := km.points(data)
+
+	rng := rand.New(rand.NewPCG(config.Seed, 0))
+	km.Inertia = math.Inf(1)
+	for r := 0; r < config.Restarts; r++ {
+		centroids := initCentroids(points, config.K, rng)
+		inertia := lloyd(points, centroids, config.MaxIterations)
+		if inertia < km.Inertia {
+			km.Centroids, km.Inertia = centroids, inertia
+		}
+	}
+	km.sortCentroids()
+	return km, nil
+}
+
+// points returns the clustered columns of each row, with missing values
+// replaced by the training means
+func (km *KMeans) points(data *models.FeatureMatrix) [][]float64 {
+	X := data.Dense()
+	points := make([][]float64, data.Rows())
+	for i := range points {
+		points[i] = make([]float64, len(km.Columns))
+		for c, j := range km.Columns {
+			if data.IsMissing(i, j) {
+				points[i][c] = km.means[c]
+			} else {
+				points[i][c] = X.At(i, j)
+			}
+		}
+	}
+	return points
+}
+
+// initCentroids picks k initial centroids by k-means++, each drawn with
+// probability proportional to its squared distance to the nearest centroid
+// already picked
+func initCentroids(points [][]float64, k int, rng *rand.Rand) [][]float64 {
+	centroids := [][]float64{append([]float64(nil), points[rng.IntN(len(points))]...)}
+	dist := make([]float64, len(points))
+	for len(centroids) < k {
+		total := 0.0
+		for i, p := range points {
+			_, dist[i] = nearest(p, centroids)
+			total += dist[i]
+		}
+		pick := rng.IntN(len(points))
+		if total > 0 {
+			u := rng.Float64() * total
+			for i, d := range dist {
+				u -= d
+				if u <= 0 && d > 0 {
+					pick = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, append([]float64(nil), points[pick]...))
+	}
+	return centroids
+}
+
+// lloyd alternates assigning points to their nearest centroid and moving
+// each centroid to the mean of its points until no assignment changes, and
+// returns the inertia. An emptied segment is moved to the point farthest
+// from its centroid.
+func lloyd(points [][]float64, centroids [][]float64, maxIterations int) float64 {
+	assignments := make([]int, len(points))
+	for i := range assignments {
+		assignments[i] = -1
+	}
+	inertia := 0.0
+	for iter := 0; iter < maxIterations; iter++ {
+		changed := false
+		inertia = 0
+		for i, p := range points {
+			c, d := nearest(p, centroids)
+			if c != assignments[i] {
+				assignments[i] = c
+				changed = true
+			}
+			inertia += d
+		}
+		if !changed {
+			break
+		}
+
+		counts := make([]int, len(centroids))
+		for c := range centroids {
+			for f := range centroids[c] {
+				centroids[c][f] = 0
+			}
+		}
+		for i, p := range points {
+			c := assignments[i]
+			counts[c]++
+			for f, v := range p {
+				centroids[c][f] += v
+			}
+		}
+		for c := range centroids {
+			if counts[c] == 0 {
+				continue
+			}
+			for f := range centroids[c] {
+				centroids[c][f] /= float64(counts[c])
+			}
+		}
+		for c := range centroids {
+			if counts[c] == 0 {
+				far, farDist := 0, -1.0
+				for i, p := range points {
+					if d := squaredDistance(p, centroids[assignments[i]]); d > farDist {
+						far, farDist = i, d
+					}
+				}
+				copy(centroids[c], points[far])
+				assignments[far] = c
+			}
+		}
+	}
+	return inertia
+}
+
+// nearest returns the closest centroid to p and its squared distance
+func nearest(p []float64, centroids [][]float64) (int, float64) {
+	best, bestDist := 0, math.Inf(1)
+	for c, centroid := range centroids {
+		if d := squaredDistance(p, centroid); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best, bestDist
+}
+
+// squaredDistance returns the squared Euclidean distance between a and b
+func squaredDistance(a, b []float64) float64 {
+	d := 0.0
+	for k := range a {
+		d += (a[k] - b[k]) * (a[k] - b[k])
+	}
+	return d
+}
+
+// sortCentroids orders the segments by their centroids, so the same
+// clustering is numbered the same way whatever the restart it came from
+func (km *KMeans) sortCentroids() {
+	sort.Slice(km.Centroids, func(a, b int) bool {
+		for f := range km.Centroids[a] {
+			if km.Centroids[a][f] != km.Centroids[b][f] {
+				return km.Centroids[a][f] < km.Centroids[b][f]
+			}
+		}
+		return false
+	})
+}
+
+// Assign returns the segment of each row of data, numbered from 0. data
+// must have the feature columns the segmentation was fitted on.
+func (km *KMeans) Assign(data *models.FeatureMatrix) []int {
+	assignments := make([]int, data.Rows())
+	for i, p := range km.points(data) {
+		assignments[i], _ = nearest(p, km.Centroids)
+	}
+	return assignments
+}
+
+// Levels returns the segment labels, "1" to "<k>"
+func (km *KMeans) Levels() []string {
+	levels := make([]string, len(km.Centroids))
+	for c := range levels {
+		levels[c] = strconv.Itoa(c + 1)
+	}
+	return levels
+}
+
+// AddFeature appends each row's segment to data as the one-hot columns of
+// the categorical feature "segment", so every model can learn a
+// segment-specific offset or split on it
+func (km *KMeans) AddFeature(data *models.FeatureMatrix) (*models.FeatureMatrix, error) {
+	return data.WithCategorical(FeatureName, km.Levels(), km.Assign(data))
+}
+
+// SegmentMetrics is a model's performance on the test applications of one
+// segment
+type SegmentMetrics struct {
+	Segment string
+	// Count is the summed sample weight of the segment's applications
+	Count float64
+	// ApprovalRate is the observed share of good applicants and
+	// PredictedRate the share the model approves at 0.5
+	ApprovalRate  float64
+	PredictedRate float64
+	Accuracy      float64
+	AUC           float64
+}
+
+// Report is a model's performance in every segment
+type Report struct {
+	ModelName string
+	Segments  []SegmentMetrics
+}
+
+// Evaluate breaks result's test metrics down by segment, assignments
+// holding the segment of each test row
+func (km *KMeans) Evaluate(result *models.ModelResult, assignments []int) (*Report, error) {
+	if len(assignments) != len(result.Probabilities) {
+		return nil, fmt.Errorf("%d segment assignments for %d %s test predictions", len(assignments), len(result.Probabilities), result.ModelName)
+	}
+
+	report := &Report{ModelName: result.ModelName}
+	for c, level := range km.Levels() {
+		var scores, labels, weights []float64
+		m := SegmentMetrics{Segment: level}
+		good, approved, correct := 0.0, 0.0, 0.0
+		for i, a := range assignments {
+			if a != c {
+				continue
+			}
+			w := 1.0
+			if result.Weights != nil {
+				w = result.Weights[i]
+			}
+			p, y := result.Probabilities[i], result.Labels[i]
+			scores, labels, weights = append(scores, p), append(labels, y), append(weights, w)
+			m.Count += w
+			if y >= 0.5 {
+				good += w
+			}
+			if p >= 0.5 {
+				approved += w
+			}
+			if (p >= 0.5) == (y >= 0.5) {
+				correct += w
+			}
+		}
+		if m.Count > 0 {
+			m.ApprovalRate = good / m.Count
+			m.PredictedRate = approved / m.Count
+			m.Accuracy = correct / m.Count
+			m.AUC = models.AUC(scores, labels, weights)
+		}
+		report.Segments = append(report.Segments, m)
+	}
+	return report, nil
+}
+
+// PrintSegments prints each segment's centroid and training approval rate
+func (km *KMeans) PrintSegments(train *models.FeatureMatrix) {
+	assignments := km.Assign(train)
+	fmt.Printf("\nApplicant Segments (k-means on %d numeric features, inertia %.2f):\n", len(km.Features), km.Inertia)
+	fmt.Printf("%-8s %-8s %-10s %s\n", "Segment", "Rows", "Approval", "Centroid")
+	for c, level := range km.Levels() {
+		rows, good := 0, 0.0
+		for i, a := range assignments {
+			if a == c {
+				rows++
+				good += train.Y[i]
+			}
+		}
+		rate := 0.0
+		if rows > 0 {
+			rate = good / float64(rows)
+		}
+		centroid := ""
+		for f, name := range km.Features {
+			if f > 0 {
+				centroid += ", "
+			}
+			centroid += fmt.Sprintf("%s %.2f", name, km.Centroids[c][f])
+		}
+		fmt.Printf("%-8s %-8d %-10.4f %s\n", level, rows, rate, centroid)
+	}
+}
+
+// PrintReport prints a model's metrics in each segment
+func PrintReport(report *Report) {
+	fmt.Printf("\nSegment Performance (%s):\n", report.ModelName)
+	fmt.Printf("%-8s %-10s %-10s %-10s %-10s %-10s\n", "Segment", "Count", "Approval", "Predicted", "Accuracy", "AUC")
+	for _, s := range report.Segments {
+		fmt.Printf("%-8s %-10.1f %-10.4f %-10.4f %-10.4f %-10.4f\n", s.Segment, s.Count, s.ApprovalRate, s.PredictedRate, s.Accuracy, s.AUC)
+	}
+}
+
+// SaveReports writes every model's per-segment metrics to a CSV file,
+// gzip-compressed when the path ends in .gz. The last columns hold each
+// segment's centroid on the normalized scale.
+func (km *KMeans) SaveReports(path string, reports []*Report) error {
+	file, err := dataset.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating segment report: %v", err)
+	}
+	defer file.Close()
+
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 4, 64)
+	}
+	writer := csv.NewWriter(file)
+	header := []string{"Model", "Segment", "Count", "Approval Rate", "Predicted Approval Rate", "Accuracy", "AUC"}
+	writer.Write(append(header, km.Features...))
+	for _, r := range reports {
+		for c, s := range r.Segments {
+			row := []string{r.ModelName, s.Segment, format(s.Count), format(s.ApprovalRate), format(s.PredictedRate), format(s.Accuracy), format(s.AUC)}
+			for _, v := range km.Centroids[c] {
+				row = append(row, format(v))
+			}
+			writer.Write(row)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing segment report: %v", err)
+	}
+	return file.Close()
+}
@@ -2,15 +2,19 @@ package visualization
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
-	"github.com/go-gota/gota/dataframe"
-	"github.com/go-gota/gota/series"
 	"github.com/wcharczuk/go-chart/v2"
 	"github.com/wcharczuk/go-chart/v2/drawing"
 
+	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/dataset"
 	"github.com/jimmymcguigan18/credit-card-approval-prediction/internal/models"
 )
 
@@ -34,25 +38,36 @@ func CreateOutputDir(outputDir string) error {
 	return nil
 }
 
-// PlotClassDistribution creates a bar chart showing the distribution of approval/rejection classes
-func PlotClassDistribution(df dataframe.DataFrame, outputPath string) error {
+// PlotClassDistribution creates a pie chart showing the distribution of
+// approval/rejection classes, or of the multiclass outcome named by classes
+// from worst to best when it is not nil
+func PlotClassDistribution(ds *dataset.Dataset, classes []string, outputPath string) error {
 	// Count class distribution
+	column := models.TargetColumn
+	if classes != nil {
+		column = models.ClassColumn
+	}
+	target, err := ds.Col(column)
+	if err != nil {
+		return fmt.Errorf("error accessing target column %s: %v", column, err)
+	}
+
 	classCounts := make(map[string]int)
-	df.Col("target").Map(func(e series.Element) series.Element {
-		val := fmt.Sprintf("%v", e.Val())
-		classCounts[val]++
-		return e
-	})
+	for i := 0; i < target.Len(); i++ {
+		classCounts[target.String(i)]++
+	}
+
+	// Prepare data for chart, in a stable order
+	codes := make([]string, 0, len(classCounts))
+	for class := range classCounts {
+		codes = append(codes, class)
+	}
+	sort.Strings(codes)
 
-	// Prepare data for chart
 	var values []chart.Value
-	for class, count := range classCounts {
-		label := "Rejected"
-		color := redColor
-		if class == "1" {
-			label = "Approved"
-			color = greenColor
-		}
+	for _, class := range codes {
+		count := classCounts[class]
+		label, color := classStyle(class, classes)
 		values = append(values, chart.Value{
 			Value: float64(count),
 			Label: label,
@@ -73,22 +88,47 @@ func PlotClassDistribution(df dataframe.DataFrame, outputPath string) error {
 	}
 
 	// Save the chart to file
-	f, err := os.Create(outputPath)
+	f, err := dataset.Create(outputPath)
 	if err != nil {
 		return fmt.Errorf("error creating output file: %v", err)
 	}
-	defer f.Close()
 
 	err = pie.Render(chart.SVG, f)
 	if err != nil {
+		f.Close()
 		return fmt.Errorf("error rendering chart: %v", err)
 	}
 
-	return nil
+	return f.Close()
 }
 
-// PlotFeatureImportance creates a bar chart showing feature importance
-func PlotFeatureImportance(featureImportance map[string]float64, outputPath string) error {
+// classStyle returns the label and color of a class code: Rejected in red
+// and Approved in green for the binary target, or the class's name on a
+// scale from red for the worst class to green for the best
+func classStyle(code string, classes []string) (string, drawing.Color) {
+	if classes == nil {
+		if code == "1" {
+			return "Approved", greenColor
+		}
+		return "Rejected", redColor
+	}
+
+	k, err := strconv.Atoi(code)
+	if err != nil || k < 0 || k >= len(classes) {
+		return code, blueColor
+	}
+	share := float64(k) / float64(len(classes)-1)
+	return classes[k], drawing.Color{
+		R: uint8(math.Round(float64(redColor.R) + share*(float64(greenColor.R)-float64(redColor.R)))),
+		G: uint8(math.Round(float64(redColor.G) + share*(float64(greenColor.G)-float64(redColor.G)))),
+		B: uint8(math.Round(float64(redColor.B) + share*(float64(greenColor.B)-float64(redColor.B)))),
+		A: 255,
+	}
+}
+
+// PlotFeatureImportance creates a bar chart showing a model's feature
+// importance
+func PlotFeatureImportance(modelName string, featureImportance map[string]float64, outputPath string) error {
 	// Sort features by importance
 	type featureScore struct {
 		Name  string
@@ -101,7 +141,10 @@ func PlotFeatureImportance(featureImportance map[string]float64, outputPath stri
 	}
 
 	sort.Slice(features, func(i, j int) bool {
-		return features[i].Score > features[j].Score
+		if features[i].Score != features[j].Score {
+			return features[i].Score > features[j].Score
+		}
+		return features[i].Name < features[j].Name
 	})
 
 	// Limit to top 10 features if there are more
@@ -125,7 +168,7 @@ func PlotFeatureImportance(featureImportance map[string]float64, outputPath stri
 
 	// Create the chart
 	graph := chart.BarChart{
-		Title:      "Feature Importance",
+		Title:      fmt.Sprintf("%s Feature Importance", modelName),
 		TitleStyle: chart.Style{FontSize: 14},
 		Width:      800,
 		Height:     500,
@@ -140,42 +183,49 @@ func PlotFeatureImportance(featureImportance map[string]float64, outputPath stri
 	}
 
 	// Save the chart to file
-	f, err := os.Create(outputPath)
+	f, err := dataset.Create(outputPath)
 	if err != nil {
 		return fmt.Errorf("error creating output file: %v", err)
 	}
-	defer f.Close()
 
 	err = graph.Render(chart.SVG, f)
 	if err != nil {
+		f.Close()
 		return fmt.Errorf("error rendering chart: %v", err)
 	}
 
-	return nil
+	return f.Close()
 }
 
 // PlotModelComparison creates a bar chart comparing model performance metrics
 func PlotModelComparison(results map[string]*models.ModelResult, outputPath string) error {
-	// Prepare data for chart
-	modelNames := make([]string, 0, len(results))
-	accuracies := make([]float64, 0, len(results))
-	precisions := make([]float64, 0, len(results))
-	recalls := make([]float64, 0, len(results))
-	f1Scores := make([]float64, 0, len(results))
+	// Prepare data for chart, in a stable order
+	modelNames := sortedNames(results)
 
-	for name, result := range results {
-		modelNames = append(modelNames, name)
-		accuracies = append(accuracies, result.Accuracy)
-		precisions = append(precisions, result.Precision)
-		recalls = append(recalls, result.Recall)
-		f1Scores = append(f1Scores, result.F1Score)
+	// One group of accuracy, precision, recall and F1 bars per model, labeled
+	// on the first bar of the group
+	bars := make([]chart.Value, 0, 4*len(modelNames))
+	for _, name := range modelNames {
+		result := results[name]
+		bars = append(bars,
+			chart.Value{Value: result.Accuracy, Label: name, Style: chart.Style{FillColor: blueColor}},
+			chart.Value{Value: result.Precision, Style: chart.Style{FillColor: greenColor}},
+			chart.Value{Value: result.Recall, Style: chart.Style{FillColor: redColor}},
+			chart.Value{Value: result.F1Score, Style: chart.Style{FillColor: purpleColor}},
+		)
+	}
+
+	width := 800
+	if w := 40*len(bars) + 100; w > width {
+		width = w
 	}
 
 	// Create the chart
 	graph := chart.BarChart{
+		Elements:   []chart.Renderable{errorBars(results, modelNames, len(bars), 30)},
 		Title:      "Model Performance Comparison",
 		TitleStyle: chart.Style{FontSize: 14},
-		Width:      800,
+		Width:      width,
 		Height:     500,
 		BarWidth:   30,
 		XAxis:      chart.Style{},
@@ -188,31 +238,354 @@ func PlotModelComparison(results map[string]*models.ModelResult, outputPath stri
 				Max: 1.0,
 			},
 		},
-		Bars: []chart.Value{
-			{Value: accuracies[0], Label: modelNames[0], Style: chart.Style{FillColor: blueColor}},
-			{Value: precisions[0], Label: modelNames[0], Style: chart.Style{FillColor: greenColor}},
-			{Value: recalls[0], Label: modelNames[0], Style: chart.Style{FillColor: redColor}},
-			{Value: f1Scores[0], Label: modelNames[0], Style: chart.Style{FillColor: purpleColor}},
+		Bars: bars,
+	}
+
+	// Save the chart to file
+	f, err := dataset.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+
+	err = graph.Render(chart.SVG, f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error rendering chart: %v", err)
+	}
+
+	return f.Close()
+}
+
+// errorBars draws a whisker of one standard deviation either side of the
+// cross-validated mean over each metric bar of the models that were
+// cross-validated. The bar positions follow go-chart's own layout for the
+// given bar width and its default spacing.
+func errorBars(results map[string]*models.ModelResult, modelNames []string, bars, barWidth int) chart.Renderable {
+	return func(r chart.Renderer, canvasBox chart.Box, defaults chart.Style) {
+		width, spacing := barLayout(canvasBox.Width(), bars, barWidth, chart.DefaultBarSpacing)
+		y := func(v float64) int {
+			v = math.Max(0, math.Min(1, v))
+			return canvasBox.Bottom - int(math.Ceil(v*float64(canvasBox.Height())))
+		}
+
+		r.SetStrokeColor(drawing.ColorBlack)
+		r.SetStrokeWidth(1)
+		for m, name := range modelNames {
+			cv := results[name].CrossValidation
+			if cv == nil {
+				continue
+			}
+			for k, metric := range []models.MetricSummary{cv.Accuracy, cv.Precision, cv.Recall, cv.F1Score} {
+				left := canvasBox.Left + (4*m+k)*(width+spacing) + spacing/2
+				center, half := left+width/2, width/4
+				top, bottom := y(metric.Mean+metric.Std), y(metric.Mean-metric.Std)
+
+				r.MoveTo(center, top)
+				r.LineTo(center, bottom)
+				r.MoveTo(center-half, top)
+				r.LineTo(center+half, top)
+				r.MoveTo(center-half, bottom)
+				r.LineTo(center+half, bottom)
+				r.Stroke()
+			}
+		}
+	}
+}
+
+// barLayout mirrors how go-chart shrinks the spacing, then the width, of n
+// bars that do not fit the canvas
+func barLayout(canvasWidth, n, barWidth, barSpacing int) (width, spacing int) {
+	spacing = barSpacing
+	if n*(barWidth+spacing) > canvasWidth {
+		spacing = 0
+		if less := canvasWidth - n*barWidth; less > 0 {
+			spacing = int(math.Ceil(float64(less) / float64(n)))
+		}
+	}
+	width = barWidth
+	if n*(barWidth+spacing) > canvasWidth {
+		width = 0
+		if less := canvasWidth - n*spacing; less > 0 {
+			width = int(math.Ceil(float64(less) / float64(n)))
+		}
+	}
+	return width, spacing
+}
+
+// PlotTrainingLoss creates a line chart of a model's training loss per epoch
+// or iteration
+func PlotTrainingLoss(modelName string, losses []float64, outputPath string) error {
+	xs := make([]float64, len(losses))
+	for i := range xs {
+		xs[i] = float64(i + 1)
+	}
+
+	// Create the chart
+	graph := chart.Chart{
+		Title:      fmt.Sprintf("%s Training Loss", modelName),
+		TitleStyle: chart.Style{FontSize: 14},
+		Width:      800,
+		Height:     500,
+		XAxis: chart.XAxis{
+			Name:      "Iteration",
+			NameStyle: chart.Style{FontSize: 12},
+			Style:     chart.Style{FontSize: 10},
+		},
+		YAxis: chart.YAxis{
+			Name:      "Log Loss",
+			NameStyle: chart.Style{FontSize: 12},
+			Style:     chart.Style{FontSize: 10},
+		},
+		Series: []chart.Series{
+			chart.ContinuousSeries{
+				Name:    modelName,
+				XValues: xs,
+				YValues: losses,
+				Style:   chart.Style{StrokeColor: orangeColor, StrokeWidth: 2},
+			},
 		},
 	}
 
 	// Save the chart to file
-	f, err := os.Create(outputPath)
+	f, err := dataset.Create(outputPath)
 	if err != nil {
 		return fmt.Errorf("error creating output file: %v", err)
 	}
-	defer f.Close()
 
 	err = graph.Render(chart.SVG, f)
 	if err != nil {
+		f.Close()
 		return fmt.Errorf("error rendering chart: %v", err)
 	}
 
-	return nil
+	return f.Close()
 }
 
-// GenerateAllVisualizations creates all visualizations for the project
-func GenerateAllVisualizations(dataPath, outputDir string, modelResults map[string]*models.ModelResult) error {
+// PlotPartialDependence draws how a model's approval probability changes
+// with one feature: an individual conditional expectation curve per sampled
+// row in light gray, and their partial dependence average on top
+func PlotPartialDependence(modelName, feature string, grid, average []float64, ice [][]float64, outputPath string) error {
+	var series []chart.Series
+	for _, curve := range ice {
+		series = append(series, chart.ContinuousSeries{
+			XValues: grid,
+			YValues: curve,
+			Style:   chart.Style{StrokeColor: chart.ColorAlternateGray.WithAlpha(96), StrokeWidth: 1},
+		})
+	}
+	series = append(series, chart.ContinuousSeries{
+		Name:    "Partial dependence",
+		XValues: grid,
+		YValues: average,
+		Style:   chart.Style{StrokeColor: orangeColor, StrokeWidth: 3},
+	})
+
+	// Create the chart
+	graph := chart.Chart{
+		Title:      fmt.Sprintf("%s Partial Dependence on %s", modelName, feature),
+		TitleStyle: chart.Style{FontSize: 14},
+		Width:      800,
+		Height:     500,
+		XAxis: chart.XAxis{
+			Name:      feature,
+			NameStyle: chart.Style{FontSize: 12},
+			Style:     chart.Style{FontSize: 10},
+		},
+		YAxis: chart.YAxis{
+			Name:      "Approval Probability",
+			NameStyle: chart.Style{FontSize: 12},
+			Style:     chart.Style{FontSize: 10},
+			Range:     &chart.ContinuousRange{Min: 0, Max: 1},
+		},
+		Series: series,
+	}
+
+	// Save the chart to file
+	f, err := dataset.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+
+	err = graph.Render(chart.SVG, f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error rendering chart: %v", err)
+	}
+
+	return f.Close()
+}
+
+// PlotPRCurves draws the precision-recall curve of every model with test
+// probabilities on one chart, labeled with its average precision
+func PlotPRCurves(results map[string]*models.ModelResult, outputPath string) error {
+	var series []chart.Series
+	for k, name := range sortedNames(results) {
+		result := results[name]
+		curve := models.PRCurve(result.Probabilities, result.Labels, result.Weights)
+		if len(curve) == 0 {
+			continue
+		}
+
+		// Start at zero recall with the first point's precision
+		recall := []float64{0}
+		precision := []float64{curve[0].Precision}
+		for _, p := range curve {
+			recall = append(recall, p.Recall)
+			precision = append(precision, p.Precision)
+		}
+		series = append(series, chart.ContinuousSeries{
+			Name:    fmt.Sprintf("%s (AP %.3f)", name, result.AveragePrecision),
+			XValues: recall,
+			YValues: precision,
+			Style:   chart.Style{StrokeColor: chart.GetDefaultColor(k), StrokeWidth: 2},
+		})
+	}
+	if len(series) == 0 {
+		return fmt.Errorf("no model has test probabilities")
+	}
+
+	// Create the chart
+	graph := chart.Chart{
+		Title:      "Precision-Recall Curves",
+		TitleStyle: chart.Style{FontSize: 14},
+		Width:      1000,
+		Height:     600,
+		// The legend is drawn in the left padding
+		Background: chart.Style{Padding: chart.Box{Top: 40, Left: 260, Right: 20, Bottom: 20}},
+		XAxis: chart.XAxis{
+			Name:      "Recall",
+			NameStyle: chart.Style{FontSize: 12},
+			Style:     chart.Style{FontSize: 10},
+			Range:     &chart.ContinuousRange{Min: 0, Max: 1},
+		},
+		YAxis: chart.YAxis{
+			Name:      "Precision",
+			NameStyle: chart.Style{FontSize: 12},
+			Style:     chart.Style{FontSize: 10},
+			Range:     &chart.ContinuousRange{Min: 0, Max: 1},
+		},
+		Series: series,
+	}
+	graph.Elements = []chart.Renderable{chart.LegendLeft(&graph)}
+
+	// Save the chart to file
+	f, err := dataset.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+
+	err = graph.Render(chart.SVG, f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error rendering chart: %v", err)
+	}
+
+	return f.Close()
+}
+
+// ReliabilityBins is the number of equal-width score bins of the
+// reliability diagram
+const ReliabilityBins = 10
+
+// PlotReliability draws the reliability diagram of every model with test
+// probabilities on one chart: the observed approval rate against the mean
+// predicted probability of each score bin, with the diagonal of perfect
+// calibration for reference
+func PlotReliability(results map[string]*models.ModelResult, outputPath string) error {
+	series := []chart.Series{chart.ContinuousSeries{
+		Name:    "Perfectly calibrated",
+		XValues: []float64{0, 1},
+		YValues: []float64{0, 1},
+		Style:   chart.Style{StrokeColor: chart.ColorAlternateGray, StrokeWidth: 1, StrokeDashArray: []float64{5, 5}},
+	}}
+	for k, name := range sortedNames(results) {
+		result := results[name]
+		curve := models.CalibrationCurve(result.Probabilities, result.Labels, result.Weights, ReliabilityBins)
+		if len(curve) == 0 {
+			continue
+		}
+
+		var predicted, observed []float64
+		for _, pt := range curve {
+			predicted = append(predicted, pt.MeanPredicted)
+			observed = append(observed, pt.ObservedRate)
+		}
+		series = append(series, chart.ContinuousSeries{
+			Name:    fmt.Sprintf("%s (Brier %.3f)", name, result.Brier),
+			XValues: predicted,
+			YValues: observed,
+			Style: chart.Style{
+				StrokeColor: chart.GetDefaultColor(k),
+				StrokeWidth: 2,
+				DotColor:    chart.GetDefaultColor(k),
+				DotWidth:    3,
+			},
+		})
+	}
+	if len(series) == 1 {
+		return fmt.Errorf("no model has test probabilities")
+	}
+
+	// Create the chart
+	graph := chart.Chart{
+		Title:      "Reliability Diagram",
+		TitleStyle: chart.Style{FontSize: 14},
+		Width:      1000,
+		Height:     600,
+		// The legend is drawn in the left padding
+		Background: chart.Style{Padding: chart.Box{Top: 40, Left: 260, Right: 20, Bottom: 20}},
+		XAxis: chart.XAxis{
+			Name:      "Mean Predicted Probability",
+			NameStyle: chart.Style{FontSize: 12},
+			Style:     chart.Style{FontSize: 10},
+			Range:     &chart.ContinuousRange{Min: 0, Max: 1},
+		},
+		YAxis: chart.YAxis{
+			Name:      "Observed Approval Rate",
+			NameStyle: chart.Style{FontSize: 12},
+			Style:     chart.Style{FontSize: 10},
+			Range:     &chart.ContinuousRange{Min: 0, Max: 1},
+		},
+		Series: series,
+	}
+	graph.Elements = []chart.Renderable{chart.LegendLeft(&graph)}
+
+	// Save the chart to file
+	f, err := dataset.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+
+	err = graph.Render(chart.SVG, f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error rendering chart: %v", err)
+	}
+
+	return f.Close()
+}
+
+// sortedNames returns the model names of results in sorted order
+func sortedNames(results map[string]*models.ModelResult) []string {
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fileSlug turns a model name into a lowercase file name prefix
+func fileSlug(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), " ", "_")
+}
+
+// GenerateAllVisualizations creates all visualizations for the project.
+// featureImportance holds each model's importance per feature, as from
+// evaluation's AnalyzeFeatureImportance, and may be nil. classes names the
+// multiclass outcome from worst to best, or is nil for the binary target
+// only; multiclassResults are the one-vs-rest models' results, if any.
+func GenerateAllVisualizations(dataPath, outputDir string, modelResults map[string]*models.ModelResult, featureImportance map[string]map[string]float64, classes []string, multiclassResults map[string]*models.ModelResult) error {
 	// Create output directory if it doesn't exist
 	err := CreateOutputDir(outputDir)
 	if err != nil {
@@ -220,81 +593,177 @@ func GenerateAllVisualizations(dataPath, outputDir string, modelResults map[stri
 	}
 
 	// Load data
-	file, err := os.Open(dataPath)
+	file, err := dataset.Open(dataPath)
 	if err != nil {
 		return fmt.Errorf("error opening data file: %v", err)
 	}
 	defer file.Close()
 
-	// Define column names
-	colNames := []string{"A1", "A2", "A3", "A4", "A5", "A6", "A7", "A8", "A9", "A10", "A11", "A12", "A13", "A14", "A15", "A16"}
+	// Read CSV; the processed files carry their own header
+	ds, err := dataset.ReadCSV(file)
+	if err != nil {
+		return fmt.Errorf("error reading data file: %v", err)
+	}
 
-	// Read CSV and set column names
-	df := dataframe.ReadCSV(file)
-	df.SetNames(colNames...)
+	var jobs []chartJob
 
 	// 1. Plot class distribution
 	classDistPath := filepath.Join(outputDir, "class_distribution.svg")
-	err = PlotClassDistribution(df, classDistPath)
-	if err != nil {
-		return fmt.Errorf("error plotting class distribution: %v", err)
+	jobs = append(jobs, chartJob{
+		name:   "class distribution",
+		fatal:  true,
+		render: func() error { return PlotClassDistribution(ds, nil, classDistPath) },
+	})
+	if classes != nil {
+		multiclassDistPath := filepath.Join(outputDir, "multiclass_distribution.svg")
+		jobs = append(jobs, chartJob{
+			name:   "multiclass distribution",
+			render: func() error { return PlotClassDistribution(ds, classes, multiclassDistPath) },
+		})
 	}
 
 	// 2. Plot numerical feature distributions
 	numericalFeatures := []string{"A2", "A3", "A8", "A11", "A14", "A15"}
 	for _, feature := range numericalFeatures {
-		featurePath := filepath.Join(outputDir, fmt.Sprintf("%s_distribution.svg", feature))
-		err = PlotFeatureDistribution(df, feature, featurePath)
-		if err != nil {
-			fmt.Printf("Error plotting %s distribution: %v\n", feature, err)
+		// A column ignored by the preprocessing config or kept as the
+		// amount is not a feature
+		if _, err := ds.Col(feature); err != nil {
 			continue
 		}
+		feature := feature
+		featurePath := filepath.Join(outputDir, fmt.Sprintf("%s_distribution.svg", feature))
+		jobs = append(jobs, chartJob{
+			name:   fmt.Sprintf("%s distribution", feature),
+			render: func() error { return PlotFeatureDistribution(ds, feature, featurePath) },
+		})
 	}
 
 	// 3. Plot model comparison if results are available
 	if len(modelResults) > 0 {
 		modelCompPath := filepath.Join(outputDir, "model_comparison.svg")
-		err = PlotModelComparison(modelResults, modelCompPath)
-		if err != nil {
-			return fmt.Errorf("error plotting model comparison: %v", err)
+		jobs = append(jobs, chartJob{
+			name:   "model comparison",
+			fatal:  true,
+			render: func() error { return PlotModelComparison(modelResults, modelCompPath) },
+		})
+	}
+
+	// The one-vs-rest models are compared on their macro averages
+	if len(multiclassResults) > 0 {
+		multiclassCompPath := filepath.Join(outputDir, "multiclass_model_comparison.svg")
+		jobs = append(jobs, chartJob{
+			name:   "multiclass model comparison",
+			render: func() error { return PlotModelComparison(multiclassResults, multiclassCompPath) },
+		})
+	}
+
+	// 4. Plot the precision-recall curves of all models together
+	if len(modelResults) > 0 {
+		prPath := filepath.Join(outputDir, "pr_curves.svg")
+		jobs = append(jobs, chartJob{
+			name:   "precision-recall curves",
+			render: func() error { return PlotPRCurves(modelResults, prPath) },
+		})
+	}
+
+	// 5. Plot the reliability diagram of all models together
+	if len(modelResults) > 0 {
+		reliabilityPath := filepath.Join(outputDir, "reliability.svg")
+		jobs = append(jobs, chartJob{
+			name:   "reliability diagram",
+			render: func() error { return PlotReliability(modelResults, reliabilityPath) },
+		})
+	}
+
+	// 6. Plot training loss curves for models that record them
+	for _, name := range sortedNames(modelResults) {
+		reporter, ok := modelResults[name].Model.(models.LossReporter)
+		if !ok || len(reporter.LossCurve()) == 0 {
+			continue
 		}
+		name := name
+		lossPath := filepath.Join(outputDir, fmt.Sprintf("%s_training_loss.svg", fileSlug(name)))
+		jobs = append(jobs, chartJob{
+			name:   fmt.Sprintf("%s training loss", name),
+			render: func() error { return PlotTrainingLoss(name, reporter.LossCurve(), lossPath) },
+		})
 	}
 
-	// 4. Plot feature importance (mock data for now)
-	// In a real implementation, this would come from model analysis
-	mockFeatureImportance := map[string]float64{
-		"A2":  0.15,
-		"A3":  0.12,
-		"A8":  0.18,
-		"A11": 0.09,
-		"A14": 0.14,
-		"A15": 0.11,
-		"A1":  0.07,
-		"A4":  0.06,
-		"A5":  0.05,
-		"A6":  0.03,
+	// 7. Plot the feature importance each model measured
+	for _, name := range sortedNames(modelResults) {
+		if _, ok := featureImportance[name]; !ok {
+			continue
+		}
+		name := name
+		featureImpPath := filepath.Join(outputDir, fmt.Sprintf("%s_feature_importance.svg", fileSlug(name)))
+		jobs = append(jobs, chartJob{
+			name:   fmt.Sprintf("%s feature importance", name),
+			render: func() error { return PlotFeatureImportance(name, featureImportance[name], featureImpPath) },
+		})
 	}
 
-	featureImpPath := filepath.Join(outputDir, "feature_importance.svg")
-	err = PlotFeatureImportance(mockFeatureImportance, featureImpPath)
-	if err != nil {
-		return fmt.Errorf("error plotting feature importance: %v", err)
+	return renderCharts(jobs)
+}
+
+// chartJob renders a single chart. Errors from fatal jobs abort the
+// visualization step; others are reported and skipped.
+type chartJob struct {
+	name   string
+	fatal  bool
+	render func() error
+}
+
+// renderCharts renders the charts concurrently on up to GOMAXPROCS workers.
+// Errors are handled in job order once every chart has finished.
+func renderCharts(jobs []chartJob) error {
+	// Load the shared default font up front; go-chart initializes it lazily
+	// and the first concurrent renders would otherwise race on it
+	if _, err := chart.GetDefaultFont(); err != nil {
+		return fmt.Errorf("error loading chart font: %v", err)
+	}
+
+	errs := make([]error, len(jobs))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+
+	for i := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = jobs[i].render()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, job := range jobs {
+		if errs[i] == nil {
+			continue
+		}
+		if job.fatal {
+			return fmt.Errorf("error plotting %s: %v", job.name, errs[i])
+		}
+		fmt.Printf("Error plotting %s: %v\n", job.name, errs[i])
 	}
 
 	return nil
 }
 
 // PlotFeatureDistribution creates a histogram showing the distribution of a numeric feature
-func PlotFeatureDistribution(df dataframe.DataFrame, feature string, outputPath string) error {
-	// Extract values from dataframe
-	values := make([]float64, 0, df.Nrow())
-	df.Col(feature).Map(func(e series.Element) series.Element {
-		val, ok := e.Val().(float64)
-		if ok {
+func PlotFeatureDistribution(ds *dataset.Dataset, feature string, outputPath string) error {
+	// Extract values from the dataset
+	col, err := ds.Col(feature)
+	if err != nil {
+		return err
+	}
+
+	values := make([]float64, 0, col.Len())
+	for i := 0; i < col.Len(); i++ {
+		if val, ok := col.Float(i); ok {
 			values = append(values, val)
 		}
-		return e
-	})
+	}
 
 	// Create bins for histogram
 	if len(values) == 0 {
@@ -372,16 +841,16 @@ func PlotFeatureDistribution(df dataframe.DataFrame, feature string, outputPath
 	}
 
 	// Save the chart to file
-	f, err := os.Create(outputPath)
+	f, err := dataset.Create(outputPath)
 	if err != nil {
 		return fmt.Errorf("error creating output file: %v", err)
 	}
-	defer f.Close()
 
 	err = histogram.Render(chart.SVG, f)
 	if err != nil {
+		f.Close()
 		return fmt.Errorf("error rendering chart: %v", err)
 	}
 
-	return nil
+	return f.Close()
 }